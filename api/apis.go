@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
 	"github.com/bipuldutta/blogzilla/usecases"
 	"github.com/bipuldutta/blogzilla/utils"
 
@@ -14,8 +21,12 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// maxSearchLimit is the largest page of the blog search
+const maxSearchLimit = 100
+
 var (
 	logger *logrus.Logger
 
@@ -32,7 +43,7 @@ var (
 func initialize() {
 	logger = utils.Logger()
 	// we need to register the counter so prometheus can collect this metric
-	prometheus.MustRegister(createBlogCount)
+	prometheus.MustRegister(createBlogCount, apiVersionRequestCount, rateLimitedRequestCount, certificateExpiry)
 }
 
 /*
@@ -40,72 +51,180 @@ WebService is the main entry to the APIs exposed by Blogzilla. In real world app
 each endpoints request/response latency, counter etc.
 */
 type WebService struct {
-	conf           *config.Config
-	authMiddleware *AuthMiddleware
-	userManager    *usecases.UserManager
-	blogManager    *usecases.BlogManager
+	conf               *config.Config
+	authMiddleware     *AuthMiddleware
+	userManager        *usecases.UserManager
+	blogManager        *usecases.BlogManager
+	commentManager     *usecases.CommentManager
+	reactionManager    *usecases.ReactionManager
+	followManager      *usecases.FollowManager
+	syndicationManager *usecases.SyndicationManager
+	mediaManager       *usecases.MediaManager
+	idempotencyManager *usecases.IdempotencyManager
+	rateLimiter        domain.RateLimiter
+	trustedProxies     []*net.IPNet
 }
 
-func NewWebService(conf *config.Config, authManager *usecases.AuthManager, userManager *usecases.UserManager, blogManager *usecases.BlogManager) *WebService {
+func NewWebService(conf *config.Config, authManager *usecases.AuthManager, userManager *usecases.UserManager, blogManager *usecases.BlogManager, commentManager *usecases.CommentManager, reactionManager *usecases.ReactionManager, followManager *usecases.FollowManager, syndicationManager *usecases.SyndicationManager, mediaManager *usecases.MediaManager, idempotencyManager *usecases.IdempotencyManager, rateLimiter domain.RateLimiter) *WebService {
 	// call the initialize func to initialize metrics and anything else we may need
 	initialize()
 	return &WebService{
-		conf:           conf,
-		authMiddleware: NewAuthMiddleware(conf, authManager),
-		userManager:    userManager,
-		blogManager:    blogManager,
+		conf:               conf,
+		authMiddleware:     NewAuthMiddleware(conf, authManager),
+		userManager:        userManager,
+		blogManager:        blogManager,
+		commentManager:     commentManager,
+		reactionManager:    reactionManager,
+		followManager:      followManager,
+		syndicationManager: syndicationManager,
+		mediaManager:       mediaManager,
+		idempotencyManager: idempotencyManager,
+		rateLimiter:        rateLimiter,
+		trustedProxies:     parseTrustedProxies(conf.RateLimit.TrustedProxies),
 	}
 }
 
 func (ws *WebService) Start() error {
+	server, reloader, err := ws.newServer(ws.handler())
+	if err != nil {
+		return err
+	}
+	if reloader == nil {
+		// Start the server
+		logger.Printf("Server listening on port %d", ws.conf.Server.Port)
+		logger.Fatal(server.ListenAndServe())
+		return nil
+	}
+
+	// the certificate and the client CAs are read again when they change, see tls.go
+	go reloader.watch(context.Background())
+	logger.Printf("Server listening with TLS on port %d", ws.conf.Server.Port)
+	logger.Fatal(server.ListenAndServeTLS("", ""))
+
+	return nil
+}
+
+// handler is the router behind the access log, the security headers and CORS, which see every request, also those
+// without a route
+func (ws *WebService) handler() http.Handler {
+	return ws.accessLogMiddleware(ws.securityHeaders(ws.cors(ws.router())))
+}
+
+// router has every route of the API, the OpenAPI document in openapi.go describes each of them
+func (ws *WebService) router() *mux.Router {
 	// Initialize HTTP router
 	r := mux.NewRouter()
+	// every route gets its own span, the access log line of handler() gets the route and the trace
+	r.Use(tracingMiddleware, accessLogRoute)
+
+	// every version of the API has all the routes, see versions.go, and the routes are rate limited, see ratelimit.go
+	for _, version := range ws.apiVersions() {
+		versioned := r.PathPrefix(versionPrefix(version.name)).Subrouter()
+		versioned.Use(version.middleware, ws.rateLimit)
+		ws.addRoutes(versioned)
+	}
+
+	// The OpenAPI document of these routes and the interactive docs on top of it
+	r.Handle("/openapi.json", ws.openAPIHandler()).Methods("GET")
+	r.Handle("/docs", http.HandlerFunc(ws.docsHandler)).Methods("GET")
+	// The Prometheus metrics, among them the requests per version of the API
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
 
+	return r
+}
+
+// addRoutes adds the routes of a version, the paths are relative to the version prefix
+func (ws *WebService) addRoutes(r *mux.Router) {
 	// Define routes
 
 	// Register a new user
-	r.Handle("/v1/register", http.HandlerFunc(ws.registerHandler)).Methods("POST")
+	r.Handle("/register", http.HandlerFunc(ws.registerHandler)).Methods("POST")
 	// User login
-	r.Handle("/v1/login", http.HandlerFunc(ws.loginHandler)).Methods("POST")
+	r.Handle("/login", http.HandlerFunc(ws.loginHandler)).Methods("POST")
+	// Log in and out of a cookie session of the browser apps, see sessions.go
+	r.Handle("/sessions", http.HandlerFunc(ws.createSessionHandler)).Methods("POST")
+	r.Handle("/sessions", http.HandlerFunc(ws.getSessionHandler)).Methods("GET")
+	r.Handle("/sessions", http.HandlerFunc(ws.deleteSessionHandler)).Methods("DELETE")
 	// Get a user details
-	r.Handle("/v1/users/{id}", ws.authMiddleware.authorize(utils.ReadUserPermission, http.HandlerFunc(ws.getUserHandler))).Methods("GET")
+	r.Handle("/users/{id}", ws.authMiddleware.authorize(utils.ReadUserPermission, http.HandlerFunc(ws.getUserHandler))).Methods("GET")
 	// Update a user details
-	r.Handle("/v1/users/{id}", ws.authMiddleware.authorize(utils.UpdateUserPermission, http.HandlerFunc(ws.updateUserHandler))).Methods("PUT")
+	r.Handle("/users/{id}", ws.authMiddleware.authorize(utils.UpdateUserPermission, http.HandlerFunc(ws.updateUserHandler))).Methods("PUT")
 	// Delete a user
-	r.Handle("/v1/users/{id}", ws.authMiddleware.authorize(utils.DeleteUserPermission, http.HandlerFunc(ws.deleteUserHandler))).Methods("DELETE")
+	r.Handle("/users/{id}", ws.authMiddleware.authorize(utils.DeleteUserPermission, http.HandlerFunc(ws.deleteUserHandler))).Methods("DELETE")
 
-	// Create a blog, creator id will be extracted from the jwt token
-	r.Handle("/v1/blogs", ws.authMiddleware.authorize(utils.CreateBlogPermission, http.HandlerFunc(ws.createBlogHandler))).Methods("POST")
+	// Create a blog, creator id will be extracted from the jwt token. A retry with the same Idempotency-Key gets the
+	// response of the first request, the same goes for the comments.
+	r.Handle("/blogs", ws.authMiddleware.authorize(utils.CreateBlogPermission, ws.idempotent(http.HandlerFunc(ws.createBlogHandler)))).Methods("POST")
 	// Update a blog, creator id will extracted from the jwt token
-	r.Handle("/v1/blogs", ws.authMiddleware.authorize(utils.UpdateBlogPermission, http.HandlerFunc(ws.updateBlogHandler))).Methods("PUT")
-	// Search all blogs, in real world application there will be filter mechanism and pagination
-	r.Handle("/v1/blogs", ws.authMiddleware.authorize(utils.ReadBlogPermission, http.HandlerFunc(ws.searchBlogsHandler))).Methods("GET")
+	r.Handle("/blogs", ws.authMiddleware.authorize(utils.UpdateBlogPermission, http.HandlerFunc(ws.updateBlogHandler))).Methods("PUT")
+	// Search all blogs, a page at a time.
+	// The blog reads need no token, without one only the public (and by id the unlisted) blogs are readable.
+	r.Handle("/blogs", ws.authMiddleware.authenticate(http.HandlerFunc(ws.searchBlogsHandler))).Methods("GET")
 	// Get the details about a blog, mainly for reading purpose
-	r.Handle("/v1/blogs/{id}", ws.authMiddleware.authorize(utils.ReadBlogPermission, http.HandlerFunc(ws.getBlogHandler))).Methods("GET")
+	r.Handle("/blogs/{id}", ws.authMiddleware.authenticate(http.HandlerFunc(ws.getBlogHandler))).Methods("GET")
+	// Get a blog by its slug, the old slugs of a renamed blog redirect to the current one
+	r.Handle("/blogs/by-slug/{slug}", ws.authMiddleware.authenticate(http.HandlerFunc(ws.getBlogBySlugHandler))).Methods("GET")
 	// Delete a blog, creator id will extracted from the jwt token
-	r.Handle("/v1/blogs/{id}", ws.authMiddleware.authorize(utils.DeleteBlogPermission, http.HandlerFunc(ws.deleteBlogHandler))).Methods("DELETE")
-
-	// Start the server
-	logger.Printf("Server listening on port %d", ws.conf.Server.Port)
-	logger.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", ws.conf.Server.Port), r))
-
-	return nil
+	r.Handle("/blogs/{id}", ws.authMiddleware.authorize(utils.DeleteBlogPermission, http.HandlerFunc(ws.deleteBlogHandler))).Methods("DELETE")
+
+	// Comment on a blog, or reply to a comment when a parentId is given
+	r.Handle("/blogs/{id}/comments", ws.authMiddleware.authorize(utils.CreateCommentPermission, ws.idempotent(http.HandlerFunc(ws.createCommentHandler)))).Methods("POST")
+	// List the approved comments of a blog in thread order, with offset and limit
+	r.Handle("/blogs/{id}/comments", ws.authMiddleware.authenticate(http.HandlerFunc(ws.listCommentsHandler))).Methods("GET")
+	// Turn the comments of a blog on or off, only the author of the blog can do this
+	r.Handle("/blogs/{id}/comments/settings", ws.authMiddleware.authorize(utils.UpdateBlogPermission, http.HandlerFunc(ws.commentSettingsHandler))).Methods("PUT")
+	// Edit and delete a comment, only the author of the comment can do this
+	r.Handle("/comments/{id}", ws.authMiddleware.authorize(utils.CreateCommentPermission, http.HandlerFunc(ws.updateCommentHandler))).Methods("PUT")
+	r.Handle("/comments/{id}", ws.authMiddleware.authorize(utils.CreateCommentPermission, http.HandlerFunc(ws.deleteCommentHandler))).Methods("DELETE")
+	// Moderation: the comments by status (pending by default) and the status changes
+	r.Handle("/comments", ws.authMiddleware.authorize(utils.ModerateCommentPermission, http.HandlerFunc(ws.moderationQueueHandler))).Methods("GET")
+	r.Handle("/comments/{id}/status", ws.authMiddleware.authorize(utils.ModerateCommentPermission, http.HandlerFunc(ws.setCommentStatusHandler))).Methods("PUT")
+
+	// React to a blog and take the reaction back, the type is "like" or one of the configured emojis
+	r.Handle("/blogs/{id}/reactions/{type}", ws.authMiddleware.authorize(utils.CreateReactionPermission, http.HandlerFunc(ws.addReactionHandler))).Methods("PUT")
+	r.Handle("/blogs/{id}/reactions/{type}", ws.authMiddleware.authorize(utils.CreateReactionPermission, http.HandlerFunc(ws.removeReactionHandler))).Methods("DELETE")
+	// Who reacted to a blog, optionally filtered by ?type=, with offset and limit
+	r.Handle("/blogs/{id}/reactions", ws.authMiddleware.authenticate(http.HandlerFunc(ws.listReactionsHandler))).Methods("GET")
+
+	// Follow and unfollow a user, the follower id will be extracted from the jwt token
+	r.Handle("/users/{id}/follow", ws.authMiddleware.authorize(utils.FollowUserPermission, http.HandlerFunc(ws.followHandler))).Methods("PUT")
+	r.Handle("/users/{id}/follow", ws.authMiddleware.authorize(utils.FollowUserPermission, http.HandlerFunc(ws.unfollowHandler))).Methods("DELETE")
+	// Who follows a user and whom the user follows, newest first with offset and limit, and how many of each
+	r.Handle("/users/{id}/followers", ws.authMiddleware.authorize(utils.ReadUserPermission, http.HandlerFunc(ws.followersHandler))).Methods("GET")
+	r.Handle("/users/{id}/following", ws.authMiddleware.authorize(utils.ReadUserPermission, http.HandlerFunc(ws.followingHandler))).Methods("GET")
+	r.Handle("/users/{id}/follow-counts", ws.authMiddleware.authorize(utils.ReadUserPermission, http.HandlerFunc(ws.followCountsHandler))).Methods("GET")
+	// The newest blogs of the followed authors, with limit and the cursor of the previous page
+	r.Handle("/feed", ws.authMiddleware.authorize(utils.ReadBlogPermission, http.HandlerFunc(ws.feedHandler))).Methods("GET")
+
+	// Public RSS, Atom and JSON feeds of the newest blogs of the site, of an author and of a tag
+	r.Handle("/feeds/{format:rss|atom|json}", http.HandlerFunc(ws.siteFeedHandler)).Methods("GET")
+	r.Handle("/feeds/authors/{id}/{format:rss|atom|json}", http.HandlerFunc(ws.authorFeedHandler)).Methods("GET")
+	r.Handle("/feeds/tags/{tag}/{format:rss|atom|json}", http.HandlerFunc(ws.tagFeedHandler)).Methods("GET")
+
+	// Media, uploaded as multipart/form-data and served with the sniffed content type
+	r.Handle("/media", ws.authMiddleware.authorize(utils.CreateBlogPermission, http.HandlerFunc(ws.uploadMediaHandler))).Methods("POST")
+	r.Handle("/media/{id}", ws.authMiddleware.authenticate(http.HandlerFunc(ws.getMediaHandler))).Methods("GET")
+	r.Handle("/media/{id}/{variant:[a-z0-9]+}.{format:[a-z]+}", ws.authMiddleware.authenticate(http.HandlerFunc(ws.getMediaVariantHandler))).Methods("GET")
+	r.Handle("/media/{id}/blog", ws.authMiddleware.authorize(utils.CreateBlogPermission, http.HandlerFunc(ws.attachMediaHandler))).Methods("PUT")
+	r.Handle("/blogs/{id}/media", ws.authMiddleware.authenticate(http.HandlerFunc(ws.listBlogMediaHandler))).Methods("GET")
+
+	// Get and change the log level at runtime
+	r.Handle("/admin/log-level", ws.authMiddleware.authorize(utils.ManageSystemPermission, http.HandlerFunc(ws.getLogLevelHandler))).Methods("GET")
+	r.Handle("/admin/log-level", ws.authMiddleware.authorize(utils.ManageSystemPermission, http.HandlerFunc(ws.setLogLevelHandler))).Methods("PUT")
 }
 
 func (ws *WebService) registerHandler(w http.ResponseWriter, r *http.Request) {
 	var request CreateUserRequestV1
 
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeRequest(w, r, &request) {
 		return
 	}
-	ctx := utils.CreateContext()
+	ctx := utils.CreateContext(r.Context())
 	newUser := convertCreateUserRequestToDomain(&request)
 
 	createdUser, err := ws.userManager.Create(ctx, newUser)
 	if err != nil {
-		http.Error(w, "error creating user", http.StatusInternalServerError)
+		setErrorResponse(w, r, err)
 		return
 	}
 	logger.Infof("successfully created user with id: %d", createdUser.ID)
@@ -119,22 +238,54 @@ func (ws *WebService) setResponse(w http.ResponseWriter, status int, payload any
 	json.NewEncoder(w).Encode(payload)
 }
 
+/*
+setValidatedResponse writes the payload of a read like setResponse, with a strong ETag of the bytes and Last-Modified
+unless it is zero. A client whose copy is still current gets a 304 without the body instead, see notModified.
+
+The reaction counts of a blog change without its Last-Modified, a client which only sends If-Modified-Since may keep
+its counts for a while, If-None-Match always tells. The responses depend on the viewer, who is known by the token,
+the session cookie or the client certificate, so only the client's own cache keeps them, apart by Authorization and
+Cookie, and checks with us before using them.
+*/
+func (ws *WebService) setValidatedResponse(w http.ResponseWriter, r *http.Request, payload any, lastModified time.Time) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	// the same bytes the json.Encoder of setResponse writes
+	body = append(body, '\n')
+	hash := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Add("Vary", "Authorization")
+	w.Header().Add("Vary", "Cookie")
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
 func (ws *WebService) loginHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse the request body to get the username and password
 	var request LoginRequestV1
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	if !decodeRequest(w, r, &request) {
 		return
 	}
 
-	ctx := utils.CreateContext()
+	ctx := utils.CreateContext(r.Context())
 	token, err := ws.userManager.Login(ctx, request.Username, request.Password)
 	if err != nil {
-		// this could also be internal server error (DB outage, etc.),
-		// but it will take extra time to have a proper error handling
-		logger.WithError(err).Error("failed to authenticate user")
-		http.Error(w, "invalid username or password", http.StatusUnauthorized)
+		// wrong credentials come back as an unauthorized error, a disabled user as a forbidden one, anything else (DB outage, etc.) is a 500
+		setErrorResponse(w, r, err)
 		return
 	}
 
@@ -158,22 +309,29 @@ func (ws *WebService) createBlogHandler(w http.ResponseWriter, r *http.Request)
 	// increment the counter
 	createBlogCount.With(nil).Inc()
 
-	// Read the request body
-	var blogRequest CreateBlogRequestV1
-	err := json.NewDecoder(r.Body).Decode(&blogRequest)
-	if err != nil {
-		http.Error(w, "failed to decode request body", http.StatusBadRequest)
-		return
-	}
-	// continue saving data
+	// Read the request body, its tags are a list from v2 on
 	userID := ws.getUserID(r)
-	newBlog := convertCreateBlogRequestToDomain(userID, &blogRequest)
+	var newBlog *domain.Blog
+	switch requestVersion(r) {
+	case apiV1:
+		var blogRequest CreateBlogRequestV1
+		if !decodeRequest(w, r, &blogRequest) {
+			return
+		}
+		newBlog = convertCreateBlogRequestToDomain(userID, &blogRequest)
+	default:
+		var blogRequest CreateBlogRequestV2
+		if !decodeRequest(w, r, &blogRequest) {
+			return
+		}
+		newBlog = convertCreateBlogRequestV2ToDomain(userID, &blogRequest)
+	}
 
 	// Insert the blog post into the database
-	ctx := utils.CreateContext()
+	ctx := utils.CreateContext(r.Context())
 	blogID, err := ws.blogManager.Create(ctx, newBlog)
 	if err != nil {
-		http.Error(w, "failed to create blog post", http.StatusInternalServerError)
+		setErrorResponse(w, r, err)
 		return
 	}
 
@@ -195,32 +353,105 @@ func (ws *WebService) searchBlogsHandler(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		limit = 10 // Default limit value
 	}
-	ctx := utils.CreateContext()
-	blogs, err := ws.blogManager.Search(ctx, offset, limit, query)
+	validationErr := domain.NewValidationError()
+	if offset < 0 {
+		validationErr.Add("offset", "out_of_range", "must not be negative")
+	}
+	if limit < 1 || limit > maxSearchLimit {
+		validationErr.Add("limit", "out_of_range", fmt.Sprintf("must be between 1 and %d", maxSearchLimit))
+	}
+	if err := validationErr.OrNil(); err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	// one more than the page tells whether there is a next page
+	blogs, err := ws.blogManager.Search(ctx, ws.getViewer(r), offset, limit+1, query)
 	if err != nil {
-		http.Error(w, "failed to search blogs", http.StatusInternalServerError)
+		setErrorResponse(w, r, err)
 		return
 	}
-	ws.setResponse(w, http.StatusOK, blogs)
+	hasMore := len(blogs) > limit
+	if hasMore {
+		blogs = blogs[:limit]
+	}
+	// a page has no single modification time, it is validated by its ETag only
+	if requestVersion(r) == apiV1 {
+		ws.setValidatedResponse(w, r, convertBlogPageDomainObjToAPI(blogs, offset, limit, hasMore), time.Time{})
+		return
+	}
+	ws.setValidatedResponse(w, r, convertBlogPageDomainObjToAPIV2(blogs, offset, limit, hasMore), time.Time{})
 }
 
 func (ws *WebService) getBlogHandler(w http.ResponseWriter, r *http.Request) {
 	blogID, err := ws.getID(r)
 	if err != nil {
-		http.Error(w, "failed to get blog", http.StatusBadRequest)
+		setMalformedRequest(w, r, err.Error())
 		return
 	}
-	ctx := utils.CreateContext()
-	blog, err := ws.blogManager.Get(ctx, blogID)
+	ctx := utils.CreateContext(r.Context())
+	blog, err := ws.blogManager.Get(ctx, ws.getViewer(r), blogID)
 	if err != nil {
-		http.Error(w, "failed to get blog", http.StatusInternalServerError)
+		setErrorResponse(w, r, err)
 		return
 	}
-	ws.setResponse(w, http.StatusOK, blog)
+	ws.setValidatedResponse(w, r, blogRepresentation(r, blog), blog.UpdatedAt)
 }
 
 func (ws *WebService) updateBlogHandler(w http.ResponseWriter, r *http.Request) {
+	var update *domain.Blog
+	switch requestVersion(r) {
+	case apiV1:
+		var request UpdateBlogRequestV1
+		if !decodeRequest(w, r, &request) {
+			return
+		}
+		update = convertUpdateBlogRequestToDomain(&request)
+	default:
+		var request UpdateBlogRequestV2
+		if !decodeRequest(w, r, &request) {
+			return
+		}
+		update = convertUpdateBlogRequestV2ToDomain(&request)
+	}
 
+	ctx := utils.CreateContext(r.Context())
+	blog, err := ws.blogManager.Update(ctx, ws.getUserID(r), update)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setBlogResponse(w, r, blog)
+}
+
+// getBlogBySlugHandler a slug the blog had before its title changed is permanently redirected to the current one
+func (ws *WebService) getBlogBySlugHandler(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	ctx := utils.CreateContext(r.Context())
+	blog, err := ws.blogManager.GetBySlug(ctx, ws.getViewer(r), slug)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	if blog.Slug != slug {
+		http.Redirect(w, r, versionPrefix(requestVersion(r))+"/blogs/by-slug/"+url.PathEscape(blog.Slug), http.StatusMovedPermanently)
+		return
+	}
+	ws.setValidatedResponse(w, r, blogRepresentation(r, blog), blog.UpdatedAt)
+}
+
+// setBlogResponse writes the blog in the representation of the version of the request
+func (ws *WebService) setBlogResponse(w http.ResponseWriter, r *http.Request, blog *domain.Blog) {
+	ws.setResponse(w, http.StatusOK, blogRepresentation(r, blog))
+}
+
+// blogRepresentation is the blog as the version of the request has it
+func blogRepresentation(r *http.Request, blog *domain.Blog) any {
+	if requestVersion(r) == apiV1 {
+		return convertBlogDomainObjToAPI(blog)
+	}
+	return convertBlogDomainObjToAPIV2(blog)
 }
 
 func (ws *WebService) deleteBlogHandler(w http.ResponseWriter, r *http.Request) {
@@ -235,6 +466,14 @@ func (ws *WebService) getUserID(r *http.Request) int64 {
 	return 0
 }
 
+// getViewer is the reader of the request, anonymous unless the request went through the auth middleware with a token
+func (ws *WebService) getViewer(r *http.Request) *domain.Viewer {
+	if viewer, ok := r.Context().Value("viewer").(*domain.Viewer); ok {
+		return viewer
+	}
+	return &domain.Viewer{}
+}
+
 func (ws *WebService) getID(r *http.Request) (int64, error) {
 	// Get the id from the URL path parameter
 	vars := mux.Vars(r)
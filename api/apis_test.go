@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidatedResponse(t *testing.T) {
+	ws := newTestWebService()
+	updated := time.Date(2026, 10, 19, 8, 30, 15, 500, time.UTC)
+	send := func(payload any, header string, value string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/v2/blogs/1", nil)
+		if header != "" {
+			request.Header.Set(header, value)
+		}
+		recorder := httptest.NewRecorder()
+		ws.setValidatedResponse(recorder, request, payload, updated)
+		return recorder
+	}
+	blog := BlogResponseV2{ID: 1, Title: "Title"}
+
+	first := send(blog, "", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || len(etag) != 34 || etag[0] != '"' || first.Body.Len() == 0 ||
+		first.Header().Get("Last-Modified") != "Mon, 19 Oct 2026 08:30:15 GMT" || first.Header().Get("Cache-Control") != "private, no-cache" ||
+		fmt.Sprint(first.Header().Values("Vary")) != "[Authorization Cookie]" {
+		t.Fatalf("expected the blog with a strong ETag and Last-Modified, got %d %v", first.Code, first.Header())
+	}
+	if again := send(blog, "", ""); again.Header().Get("ETag") != etag || again.Body.String() != first.Body.String() {
+		t.Errorf("expected the same ETag for the same bytes, got %s", again.Header().Get("ETag"))
+	}
+	if changed := send(BlogResponseV2{ID: 1, Title: "Changed"}, "", ""); changed.Header().Get("ETag") == etag {
+		t.Errorf("expected another ETag for another representation")
+	}
+
+	for _, test := range []struct {
+		header   string
+		value    string
+		expected int
+	}{
+		{"If-None-Match", etag, http.StatusNotModified},
+		{"If-None-Match", `"other", ` + etag, http.StatusNotModified},
+		{"If-None-Match", "W/" + etag, http.StatusNotModified},
+		{"If-None-Match", `"other"`, http.StatusOK},
+		{"If-Modified-Since", "Mon, 19 Oct 2026 08:30:15 GMT", http.StatusNotModified},
+		{"If-Modified-Since", "Mon, 19 Oct 2026 08:30:14 GMT", http.StatusOK},
+	} {
+		recorder := send(blog, test.header, test.value)
+		if recorder.Code != test.expected || recorder.Header().Get("ETag") != etag {
+			t.Errorf("expected %d for %s: %s, got %d %v", test.expected, test.header, test.value, recorder.Code, recorder.Header())
+		}
+		if recorder.Code == http.StatusNotModified && recorder.Body.Len() != 0 {
+			t.Errorf("expected no body with a 304, got %s", recorder.Body)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
 	"github.com/bipuldutta/blogzilla/usecases"
 )
 
@@ -24,25 +25,125 @@ func NewAuthMiddleware(conf *config.Config, authManager *usecases.AuthManager) *
 
 func (am *AuthMiddleware) authorize(permission string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := am.extractTokenFromHeader(r)
+		// an invalid token is unauthorized, a valid one without the permission is forbidden
+		viewer, err := am.requestViewer(r)
 		if err != nil {
-			http.Error(w, "invalid auth token", http.StatusUnauthorized)
+			setErrorResponse(w, r, err)
+			return
+		}
+		if !viewer.HasPermission(permission) {
+			setErrorResponse(w, r, domain.NewForbiddenError("user does not have permission"))
+			return
+		}
+
+		// Call next handler function in chain
+		next.ServeHTTP(w, withViewer(r, viewer))
+	})
+}
+
+// authenticate is the optional auth, a request without the Authorization header, the session cookie or the client
+// certificate of a service goes on as an anonymous viewer. A token which is sent has to be valid, it is never ignored.
+func (am *AuthMiddleware) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := am.serviceViewer(r); !ok && r.Header.Get("Authorization") == "" && am.sessionCookie(r) == "" {
+			next.ServeHTTP(w, withViewer(r, &domain.Viewer{}))
 			return
 		}
 
-		userID, err := am.authManager.ValidateToken(token, permission)
+		viewer, err := am.requestViewer(r)
 		if err != nil {
-			http.Error(w, "invalid auth token", http.StatusUnauthorized)
+			setErrorResponse(w, r, err)
 			return
 		}
+		next.ServeHTTP(w, withViewer(r, viewer))
+	})
+}
 
-		// inject the userId so that it can be collected downstream off the context
-		ctx := context.WithValue(r.Context(), "userId", userID)
-		r = r.WithContext(ctx)
+// authentication is the outcome of requestViewer, kept in the context of the request by withRequestViewer
+type authentication struct {
+	viewer *domain.Viewer
+	err    error
+}
 
-		// Call next handler function in chain
-		next.ServeHTTP(w, r)
-	})
+// withRequestViewer authenticates the request and keeps the outcome in the context of the returned request, so that
+// the token is verified once when the rate limit looks at the viewer before the auth of the route does
+func (am *AuthMiddleware) withRequestViewer(r *http.Request) (*http.Request, *domain.Viewer, error) {
+	viewer, err := am.requestViewer(r)
+	return r.WithContext(context.WithValue(r.Context(), "authentication", &authentication{viewer: viewer, err: err})), viewer, err
+}
+
+// requestViewer authenticates the request by its Authorization header, its session cookie or the client certificate
+// of a service, in that order, so that a service can also call on behalf of a user. A request which was authenticated
+// already, see withRequestViewer, is not authenticated again.
+func (am *AuthMiddleware) requestViewer(r *http.Request) (*domain.Viewer, error) {
+	if authenticated, ok := r.Context().Value("authentication").(*authentication); ok {
+		return authenticated.viewer, authenticated.err
+	}
+	if r.Header.Get("Authorization") == "" && am.sessionCookie(r) == "" {
+		if viewer, ok := am.serviceViewer(r); ok {
+			return viewer, nil
+		}
+	}
+
+	token, fromCookie, err := am.requestToken(r)
+	if err != nil {
+		return nil, domain.NewUnauthorizedError(err.Error())
+	}
+	viewer, err := am.authManager.Authenticate(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	if fromCookie {
+		if err := am.checkCSRF(r, token); err != nil {
+			return nil, err
+		}
+	}
+	return viewer, nil
+}
+
+// serviceName is the common name of the client certificate a service called with, verified in the TLS handshake,
+// when it is one of the services of the TLS config
+func (am *AuthMiddleware) serviceName(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	_, ok := am.conf.Server.TLS.Services[name]
+	return name, ok
+}
+
+// serviceViewer is the viewer of a service which called with a client certificate, see serviceName
+func (am *AuthMiddleware) serviceViewer(r *http.Request) (*domain.Viewer, bool) {
+	name, ok := am.serviceName(r)
+	if !ok {
+		return nil, false
+	}
+	service := am.conf.Server.TLS.Services[name]
+	permissions := make(map[string]any, len(service.Permissions))
+	for _, permission := range service.Permissions {
+		permissions[permission] = nil
+	}
+	return &domain.Viewer{UserID: service.UserID, Permissions: permissions}, true
+}
+
+// requestToken is the token of the request, from the Authorization header or, when there is none, from the session
+// cookie. fromCookie tells that it came from the cookie, so the request has to pass the CSRF check.
+func (am *AuthMiddleware) requestToken(r *http.Request) (token string, fromCookie bool, err error) {
+	if r.Header.Get("Authorization") == "" {
+		if session := am.sessionCookie(r); session != "" {
+			return session, true, nil
+		}
+	}
+	token, err = am.extractTokenFromHeader(r)
+	return token, false, err
+}
+
+// withViewer injects the viewer and the userId so that they can be collected downstream off the context,
+// the userId is 0 for an anonymous viewer
+func withViewer(r *http.Request, viewer *domain.Viewer) *http.Request {
+	ctx := context.WithValue(r.Context(), "userId", viewer.UserID)
+	ctx = context.WithValue(ctx, "viewer", viewer)
+	return r.WithContext(ctx)
 }
 
 // extractTokenFromHeader extracts the JWT token from the Authorization header in the format "Bearer {token}".
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+func (ws *WebService) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	blogID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	var request CreateCommentRequestV1
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	comment, err := ws.commentManager.Create(ctx, ws.getViewer(r), convertCreateCommentRequestToDomain(ws.getUserID(r), blogID, &request))
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusCreated, convertCommentDomainObjToAPI(comment))
+}
+
+func (ws *WebService) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	blogID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	offset, limit, err := getPage(r)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	comments, err := ws.commentManager.ListByBlog(ctx, ws.getViewer(r), blogID, offset, limit)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, convertCommentsDomainObjToAPI(comments))
+}
+
+func (ws *WebService) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	commentID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	var request UpdateCommentRequestV1
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	comment, err := ws.commentManager.Update(ctx, ws.getUserID(r), commentID, request.Content)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, convertCommentDomainObjToAPI(comment))
+}
+
+func (ws *WebService) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	commentID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	err = ws.commentManager.Delete(ctx, ws.getUserID(r), commentID)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ws *WebService) setCommentStatusHandler(w http.ResponseWriter, r *http.Request) {
+	commentID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	var request CommentStatusRequestV1
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	comment, err := ws.commentManager.SetStatus(ctx, commentID, domain.CommentStatus(request.Status))
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, convertCommentDomainObjToAPI(comment))
+}
+
+// moderationQueueHandler lists the comments by status, the pending ones by default
+func (ws *WebService) moderationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	status := domain.CommentPending
+	if value := r.URL.Query().Get("status"); value != "" {
+		status = domain.CommentStatus(value)
+	}
+	offset, limit, err := getPage(r)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	comments, err := ws.commentManager.ListByStatus(ctx, status, offset, limit)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, convertCommentsDomainObjToAPI(comments))
+}
+
+func (ws *WebService) commentSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	blogID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	var request CommentSettingsRequestV1
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	err = ws.commentManager.SetCommentsEnabled(ctx, ws.getUserID(r), blogID, request.Enabled)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, &request)
+}
+
+// maxPageLimit is the largest page of the lists which use getPage
+const maxPageLimit = 100
+
+// getPage reads the offset and limit query parameters, a missing or invalid one gets its default value. A limit
+// above maxPageLimit is a validation error.
+func getPage(r *http.Request) (int, int, error) {
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0 // Default offset value
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 0 {
+		limit = 10 // Default limit value
+	}
+	if limit > maxPageLimit {
+		return 0, 0, domain.NewValidationError(domain.FieldError{Field: "limit", Code: "out_of_range",
+			Message: fmt.Sprintf("must not be more than %d", maxPageLimit)})
+	}
+	return offset, limit, nil
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+func TestPageLimit(t *testing.T) {
+	ws := newTestWebService()
+	_, token := testTokens(t, ws)(map[string]any{utils.ReadUserPermission: true, utils.ModerateCommentPermission: true})
+	router := ws.router()
+
+	// every list with pages turns down a page which is too large before it gets to the database
+	for _, path := range []string{"/v2/blogs/1/comments", "/v2/comments", "/v2/blogs/1/reactions", "/v2/users/1/followers", "/v2/users/1/following"} {
+		request := httptest.NewRequest("GET", path+"?offset=5&limit=101", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusUnprocessableEntity || !strings.Contains(recorder.Body.String(), "out_of_range") {
+			t.Errorf("expected a 422 for a limit above %d on %s, got %d %s", maxPageLimit, path, recorder.Code, recorder.Body)
+		}
+	}
+
+	for _, test := range []struct {
+		query         string
+		offset, limit int
+	}{
+		{"", 0, 10},
+		{"offset=5&limit=100", 5, 100},
+		{"offset=-1&limit=x", 0, 10},
+	} {
+		offset, limit, err := getPage(httptest.NewRequest("GET", "/v2/comments?"+test.query, nil))
+		if err != nil || offset != test.offset || limit != test.limit {
+			t.Errorf("%s: expected %d and %d, got %d and %d %v", test.query, test.offset, test.limit, offset, limit, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// corsMethods are the methods of the routes
+	corsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	// corsRequestHeaders are the headers the browser apps may send besides the simple ones
+	corsRequestHeaders = []string{"Authorization", "Content-Type", idempotencyKeyHeader, csrfHeader, "If-None-Match", "If-Modified-Since"}
+	// corsResponseHeaders are the headers of our responses the browser apps may read besides the simple ones
+	corsResponseHeaders = []string{"ETag", "Location", "Link", "Deprecation", "Sunset", "Retry-After", idempotentReplayedHeader,
+		"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"}
+)
+
+// cors lets the browser apps of the allowed origins call the API, see CORSConfig. It wraps the router rather than
+// being one of its middlewares, the preflight requests are OPTIONS requests which match no route. A request from an
+// origin which is not allowed gets no CORS headers, so its browser does not hand the response over.
+func (ws *WebService) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		allowed, credentials := ws.allowedOrigin(origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		if !preflight {
+			if allowed {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsResponseHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsRequestHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(ws.conf.CORS.MaxAgeSeconds))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowedOrigin tells whether the origin may call the API and whether it may send the cookies along. A wildcard
+// never gets the cookies, any site could use them otherwise.
+func (ws *WebService) allowedOrigin(origin string) (allowed bool, credentials bool) {
+	for _, allowedOrigin := range ws.conf.CORS.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowedOrigin, "/"), origin) {
+			return true, ws.conf.CORS.AllowCredentials
+		}
+		if allowedOrigin == "*" {
+			allowed = true
+		}
+	}
+	return allowed, false
+}
+
+// securityHeaders are on every response. The API answers with JSON, so the content security policy allows nothing by
+// default and the docs page sets its own.
+func (ws *WebService) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		if csp := ws.conf.Security.ContentSecurityPolicy; csp != "" {
+			w.Header().Set("Content-Security-Policy", csp)
+		}
+		if ws.conf.Security.HSTSSeconds > 0 {
+			w.Header().Set("Strict-Transport-Security", "max-age="+strconv.Itoa(ws.conf.Security.HSTSSeconds)+"; includeSubDomains")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
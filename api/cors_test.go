@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	ws := newTestWebService()
+	ws.conf.CORS.AllowedOrigins = []string{"https://app.example.com/"}
+	handler := ws.handler()
+	send := func(method string, origin string, requestMethod string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/v2/blogs/x", nil)
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		if requestMethod != "" {
+			request.Header.Set("Access-Control-Request-Method", requestMethod)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	preflight := send("OPTIONS", "https://app.example.com", "PUT")
+	if preflight.Code != http.StatusNoContent || preflight.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		preflight.Header().Get("Access-Control-Allow-Credentials") != "true" || preflight.Header().Get("Access-Control-Max-Age") != "600" ||
+		!strings.Contains(preflight.Header().Get("Access-Control-Allow-Headers"), csrfHeader) ||
+		!strings.Contains(preflight.Header().Get("Access-Control-Allow-Methods"), "PUT") {
+		t.Errorf("expected the preflight to be allowed, got %d %v", preflight.Code, preflight.Header())
+	}
+
+	simple := send("GET", "https://app.example.com", "")
+	if simple.Code != http.StatusBadRequest || simple.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		!strings.Contains(simple.Header().Get("Access-Control-Expose-Headers"), "RateLimit-Remaining") ||
+		simple.Header().Get("Vary") != "Origin" {
+		t.Errorf("expected the request to get to the route with the CORS headers, got %d %v", simple.Code, simple.Header())
+	}
+
+	for _, recorder := range []*httptest.ResponseRecorder{send("OPTIONS", "https://evil.example.com", "PUT"), send("GET", "https://evil.example.com", "")} {
+		if recorder.Header().Get("Access-Control-Allow-Origin") != "" || recorder.Header().Get("Access-Control-Allow-Methods") != "" {
+			t.Errorf("expected no CORS headers for another origin, got %v", recorder.Header())
+		}
+	}
+	if recorder := send("GET", "", ""); recorder.Header().Get("Vary") != "" || recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected no CORS headers without an origin, got %v", recorder.Header())
+	}
+
+	// a wildcard lets any origin in, never with the cookies
+	ws.conf.CORS.AllowedOrigins = []string{"*"}
+	if recorder := send("GET", "https://evil.example.com", ""); recorder.Header().Get("Access-Control-Allow-Origin") != "https://evil.example.com" ||
+		recorder.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("expected the origin to be allowed without the cookies, got %v", recorder.Header())
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	ws := newTestWebService()
+	handler := ws.handler()
+	for _, path := range []string{"/v2/blogs/x", "/unknown"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		if recorder.Header().Get("X-Content-Type-Options") != "nosniff" || recorder.Header().Get("X-Frame-Options") != "DENY" ||
+			recorder.Header().Get("Content-Security-Policy") != ws.conf.Security.ContentSecurityPolicy ||
+			recorder.Header().Get("Strict-Transport-Security") != "max-age=31536000; includeSubDomains" {
+			t.Errorf("expected the security headers on %s, got %v", path, recorder.Header())
+		}
+	}
+
+	// the docs page loads Swagger UI
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/docs", nil))
+	if recorder.Header().Get("Content-Security-Policy") != docsContentSecurityPolicy {
+		t.Errorf("expected the CSP of the docs, got %v", recorder.Header())
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+func (ws *WebService) followHandler(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	err = ws.followManager.Follow(ctx, ws.getUserID(r), followeeID)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ws *WebService) unfollowHandler(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	err = ws.followManager.Unfollow(ctx, ws.getUserID(r), followeeID)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ws *WebService) followersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	offset, limit, err := getPage(r)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	follows, err := ws.followManager.Followers(ctx, userID, offset, limit)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, convertFollowsDomainObjToAPI(follows, func(follow *domain.Follow) int64 { return follow.FollowerID }))
+}
+
+func (ws *WebService) followingHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	offset, limit, err := getPage(r)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	follows, err := ws.followManager.Following(ctx, userID, offset, limit)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, convertFollowsDomainObjToAPI(follows, func(follow *domain.Follow) int64 { return follow.FolloweeID }))
+}
+
+func (ws *WebService) followCountsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	counts, err := ws.followManager.Counts(ctx, userID)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, &FollowCountsV1{Followers: counts.Followers, Following: counts.Following})
+}
+
+// feedHandler returns the newest blogs of the followed authors, the pages are chained by an opaque cursor
+func (ws *WebService) feedHandler(w http.ResponseWriter, r *http.Request) {
+	var after *domain.FeedCursor
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		cursor, err := decodeFeedCursor(value)
+		if err != nil {
+			setMalformedRequest(w, r, "invalid cursor")
+			return
+		}
+		after = cursor
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		limit = 10 // Default limit value
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	blogs, next, err := ws.blogManager.Feed(ctx, ws.getViewer(r), after, limit)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	var nextCursor string
+	if next != nil {
+		nextCursor = encodeFeedCursor(next)
+	}
+	if requestVersion(r) == apiV1 {
+		ws.setResponse(w, http.StatusOK, &FeedResponseV1{Blogs: convertBlogsDomainObjToAPI(blogs), NextCursor: nextCursor})
+		return
+	}
+	ws.setResponse(w, http.StatusOK, &FeedResponseV2{Blogs: convertBlogsDomainObjToAPIV2(blogs), NextCursor: nextCursor})
+}
+
+// the cursor is "<created at in unix microseconds>.<blog id>", base64 encoded so that clients treat it as opaque
+func encodeFeedCursor(cursor *domain.FeedCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", cursor.CreatedAt.UnixMicro(), cursor.BlogID)))
+}
+
+func decodeFeedCursor(value string) (*domain.FeedCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, blogID, found := strings.Cut(string(decoded), ".")
+	if !found {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	micros, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(blogID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.FeedCursor{CreatedAt: time.UnixMicro(micros).UTC(), BlogID: id}, nil
+}
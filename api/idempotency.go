@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks a response which was replayed rather than made by the request
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// idempotent lets the clients retry a JSON create request with the same Idempotency-Key header safely, see the
+// IdempotencyManager. The requests without the header run as usual. It goes inside authorize, the keys are per user.
+func (ws *WebService) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header[idempotencyKeyHeader]; !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := r.Header.Get(idempotencyKeyHeader)
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		userID := ws.getUserID(r)
+		ctx := utils.CreateContext(r.Context())
+		replay, err := ws.idempotencyManager.Begin(ctx, userID, key, requestFingerprint(r, body))
+		if err != nil {
+			setErrorResponse(w, r, err)
+			return
+		}
+		if replay != nil {
+			w.Header().Set("Content-Type", replay.ContentType)
+			w.Header().Set(idempotentReplayedHeader, "true")
+			w.WriteHeader(replay.Status)
+			w.Write(replay.Body)
+			return
+		}
+
+		// the response is kept even when the client is gone by now, its retry is on the way
+		recorder := &bodyRecorder{statusRecorder: statusRecorder{ResponseWriter: w, status: http.StatusOK}}
+		finished := false
+		defer func() {
+			if !finished {
+				// the handler panicked, the retry gets to run again
+				if err := ws.idempotencyManager.Abandon(context.Background(), userID, key); err != nil {
+					logger.WithError(err).Errorf("failed to give back the idempotency key of user %d", userID)
+				}
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+		finished = true
+
+		err = ws.idempotencyManager.Finish(context.Background(), userID, key, recorder.status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		if err != nil {
+			logger.WithError(err).Errorf("failed to keep the response of the idempotent request of user %d", userID)
+		}
+	})
+}
+
+// requestFingerprint tells the requests apart, a retry has the same method, path and body
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// bodyRecorder keeps a copy of the response body along with the status
+type bodyRecorder struct {
+	statusRecorder
+	body bytes.Buffer
+}
+
+func (br *bodyRecorder) Write(b []byte) (int, error) {
+	br.body.Write(b)
+	return br.statusRecorder.Write(b)
+}
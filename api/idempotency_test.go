@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/gateways/memory"
+	"github.com/bipuldutta/blogzilla/usecases"
+)
+
+func TestIdempotent(t *testing.T) {
+	ws := newTestWebService()
+	ws.idempotencyManager = usecases.NewIdempotencyManager(ws.conf, memory.NewIdempotencyRepo(memory.NewStore()))
+	var runs int64
+	handler := ws.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the middleware has read the body, the handler gets it all the same
+		var request CreateBlogRequestV1
+		if !decodeRequest(w, r, &request) {
+			return
+		}
+		ws.setResponse(w, http.StatusCreated, map[string]int64{"id": atomic.AddInt64(&runs, 1)})
+	}))
+	send := func(key string, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/v1/blogs", strings.NewReader(body))
+		if key != "" {
+			request.Header.Set(idempotencyKeyHeader, key)
+		}
+		request = request.WithContext(context.WithValue(request.Context(), "userId", int64(1)))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	body := `{"title": "T", "content": "C"}`
+
+	first := send("retry-me", body)
+	retry := send("retry-me", body)
+	if first.Code != http.StatusCreated || retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the response of the first request, got %d %s and %d %s", first.Code, first.Body, retry.Code, retry.Body)
+	}
+	if retry.Header().Get(idempotentReplayedHeader) != "true" || retry.Header().Get("Content-Type") != "application/json" || runs != 1 {
+		t.Errorf("expected a replay without running the handler again, got %v after %d runs", retry.Header(), runs)
+	}
+
+	if reused := send("retry-me", `{"title": "Other", "content": "C"}`); reused.Code != http.StatusUnprocessableEntity ||
+		!strings.Contains(reused.Body.String(), "key_reused") {
+		t.Errorf("expected a 422 for a key reused with a different body, got %d %s", reused.Code, reused.Body)
+	}
+	if invalid := send(strings.Repeat("k", 256), body); invalid.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected a 422 for a key which is too long, got %d", invalid.Code)
+	}
+	if without := send("", body); without.Code != http.StatusCreated || runs != 2 {
+		t.Errorf("expected a request without a key to run, got %d after %d runs", without.Code, runs)
+	}
+}
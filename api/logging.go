@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// accessLogEntry is what the router learns about a request for its access log line, the access log wraps the router
+// so that the requests without a route are logged as well
+type accessLogEntry struct {
+	route   string
+	traceID string
+}
+
+// accessLogMiddleware writes one log line per request with its latency and status. Successful requests
+// are sampled according to the logging config, failed ones, among them the ones without a route, are always logged.
+func (ws *WebService) accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessLogEntry{route: r.URL.Path}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), "accessLog", entry)))
+		latency := time.Since(start)
+
+		if recorder.status < http.StatusBadRequest && rand.Float64() >= ws.conf.Logging.AccessLogSampleRate {
+			return
+		}
+
+		fields := logrus.Fields{
+			"method":     r.Method,
+			"route":      entry.route,
+			"path":       r.URL.Path,
+			"status":     recorder.status,
+			"bytes":      recorder.bytes,
+			"latency_ms": latency.Milliseconds(),
+			"remote":     r.RemoteAddr,
+			"user_agent": r.UserAgent(),
+		}
+		if entry.traceID != "" {
+			fields["trace_id"] = entry.traceID
+		}
+		logger.WithFields(fields).Info("access")
+	})
+}
+
+// accessLogRoute tells the access log the route of a matched request and the trace it is part of, it goes after
+// the tracing middleware
+func accessLogRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if entry, ok := r.Context().Value("accessLog").(*accessLogEntry); ok {
+			entry.route = routeName(r)
+			if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+				entry.traceID = spanContext.TraceID().String()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (ws *WebService) getLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	ws.setResponse(w, http.StatusOK, &LogLevelV1{Level: utils.LogLevel()})
+}
+
+func (ws *WebService) setLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var request LogLevelV1
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	err := utils.SetLogLevel(request.Level)
+	if err != nil {
+		setErrorResponse(w, r, domain.NewValidationError(domain.FieldError{Field: "level", Code: "invalid", Message: err.Error()}))
+		return
+	}
+	logger.Warnf("log level changed to %s by user %d", utils.LogLevel(), ws.getUserID(r))
+	ws.setResponse(w, http.StatusOK, &LogLevelV1{Level: utils.LogLevel()})
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLogLevelHandlers(t *testing.T) {
+	ws := newTestWebService()
+	newToken := testTokens(t, ws)
+	router := ws.router()
+	defer utils.SetLogLevel(utils.LogLevel())
+	tokens := map[string]string{}
+	for name, permissions := range map[string]map[string]any{
+		"admin":  {utils.ManageSystemPermission: true},
+		"editor": {utils.CreateBlogPermission: true},
+	} {
+		_, tokens[name] = newToken(permissions)
+	}
+	send := func(method string, token string, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/v1/admin/log-level", strings.NewReader(body))
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for _, test := range []struct {
+		name     string
+		method   string
+		token    string
+		body     string
+		expected int
+	}{
+		{"no token", "GET", "", "", http.StatusUnauthorized},
+		{"without the permission", "GET", tokens["editor"], "", http.StatusForbidden},
+		{"a change without the permission", "PUT", tokens["editor"], `{"level": "debug"}`, http.StatusForbidden},
+		{"an unknown level", "PUT", tokens["admin"], `{"level": "loud"}`, http.StatusUnprocessableEntity},
+		{"a missing level", "PUT", tokens["admin"], `{}`, http.StatusUnprocessableEntity},
+	} {
+		if recorder := send(test.method, test.token, test.body); recorder.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d %s", test.name, test.expected, recorder.Code, recorder.Body)
+		}
+	}
+
+	if recorder := send("PUT", tokens["admin"], `{"level": "debug"}`); recorder.Code != http.StatusOK || utils.LogLevel() != "debug" {
+		t.Errorf("expected the level to change, got %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := send("GET", tokens["admin"], ""); recorder.Code != http.StatusOK || recorder.Body.String() != `{"level":"debug"}`+"\n" {
+		t.Errorf("expected the current level, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	ws := newTestWebService()
+	handler := ws.handler()
+	hooks := logger.ReplaceHooks(make(logrus.LevelHooks))
+	defer logger.ReplaceHooks(hooks)
+	entries := test.NewLocal(logger)
+	send := func(method string, path string) []*logrus.Entry {
+		entries.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+		var access []*logrus.Entry
+		for _, entry := range entries.AllEntries() {
+			if entry.Message == "access" {
+				access = append(access, entry)
+			}
+		}
+		return access
+	}
+
+	// everything is logged
+	ws.conf.Logging.AccessLogSampleRate = 1
+	if access := send("GET", "/openapi.json"); len(access) != 1 || access[0].Data["status"] != http.StatusOK ||
+		access[0].Data["route"] != "/openapi.json" {
+		t.Errorf("expected the request to be logged with its route, got %v", access)
+	}
+
+	// none of the successful requests are logged, the failed ones are all the same
+	ws.conf.Logging.AccessLogSampleRate = 0
+	if access := send("GET", "/openapi.json"); len(access) != 0 {
+		t.Errorf("expected the successful request to be left out, got %v", access)
+	}
+	for _, test := range []struct {
+		method string
+		path   string
+		status int
+		route  string
+	}{
+		{"GET", "/v2/blogs/x", http.StatusBadRequest, "/v2/blogs/{id}"},
+		{"GET", "/v2/admin/log-level", http.StatusUnauthorized, "/v2/admin/log-level"},
+		{"GET", "/unknown", http.StatusNotFound, "/unknown"},
+		{"PATCH", "/openapi.json", http.StatusMethodNotAllowed, "/openapi.json"},
+	} {
+		if access := send(test.method, test.path); len(access) != 1 || access[0].Data["status"] != test.status || access[0].Data["route"] != test.route {
+			t.Errorf("expected %s %s to be logged as a %d of %s, got %v", test.method, test.path, test.status, test.route, access)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package api
 
-import "github.com/bipuldutta/blogzilla/domain"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
 
 /*
 	This is where all the conversion between API->Domain objects and the Domain->API
@@ -8,10 +13,48 @@ import "github.com/bipuldutta/blogzilla/domain"
 
 func convertCreateBlogRequestToDomain(userID int64, request *CreateBlogRequestV1) *domain.Blog {
 	return &domain.Blog{
-		UserID:  userID,
-		Title:   request.Title,
-		Content: request.Content,
-		Tags:    request.Tags,
+		UserID:        userID,
+		Title:         request.Title,
+		Content:       request.Content,
+		ContentFormat: domain.ContentFormat(request.ContentFormat),
+		Tags:          request.Tags,
+		Visibility:    domain.Visibility(request.Visibility),
+	}
+}
+
+// convertUpdateBlogRequestToDomain the tags are stored comma separated
+func convertUpdateBlogRequestToDomain(request *UpdateBlogRequestV1) *domain.Blog {
+	return &domain.Blog{
+		ID:            request.ID,
+		Title:         request.Title,
+		Content:       request.Content,
+		ContentFormat: domain.ContentFormat(request.ContentFormat),
+		Tags:          strings.Join(request.Tags, ","),
+		Visibility:    domain.Visibility(request.Visibility),
+	}
+}
+
+func convertCreateBlogRequestV2ToDomain(userID int64, request *CreateBlogRequestV2) *domain.Blog {
+	return &domain.Blog{
+		UserID:        userID,
+		Title:         request.Title,
+		Content:       request.Content,
+		ContentFormat: domain.ContentFormat(request.ContentFormat),
+		Tags:          strings.Join(request.Tags, ","),
+		Visibility:    domain.Visibility(request.Visibility),
+		Status:        domain.BlogStatus(request.Status),
+	}
+}
+
+func convertUpdateBlogRequestV2ToDomain(request *UpdateBlogRequestV2) *domain.Blog {
+	return &domain.Blog{
+		ID:            request.ID,
+		Title:         request.Title,
+		Content:       request.Content,
+		ContentFormat: domain.ContentFormat(request.ContentFormat),
+		Tags:          strings.Join(request.Tags, ","),
+		Visibility:    domain.Visibility(request.Visibility),
+		Status:        domain.BlogStatus(request.Status),
 	}
 }
 
@@ -34,3 +77,199 @@ func convertUserDomainObjToAPI(dom *domain.User) *UserResponseV1 {
 		UpdatedAt: dom.UpdatedAt,
 	}
 }
+
+func convertCreateCommentRequestToDomain(userID int64, blogID int64, request *CreateCommentRequestV1) *domain.Comment {
+	return &domain.Comment{
+		BlogID:   blogID,
+		UserID:   userID,
+		ParentID: request.ParentID,
+		Content:  request.Content,
+	}
+}
+
+func convertCommentDomainObjToAPI(dom *domain.Comment) *CommentResponseV1 {
+	return &CommentResponseV1{
+		ID:        dom.ID,
+		BlogID:    dom.BlogID,
+		UserID:    dom.UserID,
+		ParentID:  dom.ParentID,
+		Depth:     dom.Depth,
+		Content:   dom.Content,
+		Status:    string(dom.Status),
+		CreatedAt: dom.CreatedAt,
+		UpdatedAt: dom.UpdatedAt,
+	}
+}
+
+func convertCommentsDomainObjToAPI(doms []*domain.Comment) []*CommentResponseV1 {
+	comments := make([]*CommentResponseV1, 0, len(doms))
+	for _, dom := range doms {
+		comments = append(comments, convertCommentDomainObjToAPI(dom))
+	}
+	return comments
+}
+
+func convertBlogDomainObjToAPI(dom *domain.Blog) *BlogResponseV1 {
+	blog := &BlogResponseV1{
+		ID:              dom.ID,
+		UserID:          dom.UserID,
+		Title:           dom.Title,
+		Slug:            dom.Slug,
+		Content:         dom.Content,
+		ContentFormat:   string(dom.ContentFormat),
+		ContentHTML:     dom.ContentHTML,
+		Tags:            dom.Tags,
+		CommentsEnabled: dom.CommentsEnabled,
+		Visibility:      string(dom.Visibility),
+		Reactions:       dom.Reactions,
+		CreatedAt:       dom.CreatedAt,
+		UpdatedAt:       dom.UpdatedAt,
+	}
+	blog.Creator = convertBlogCreatorDomainObjToAPI(dom.Creator)
+	return blog
+}
+
+// convertBlogCreatorDomainObjToAPI only the names of the author, never the rest of the user
+func convertBlogCreatorDomainObjToAPI(dom *domain.User) *BlogCreatorV1 {
+	if dom == nil {
+		return nil
+	}
+	return &BlogCreatorV1{
+		Username:  dom.Username,
+		FirstName: dom.FirstName,
+		LastName:  dom.LastName,
+	}
+}
+
+func convertBlogsDomainObjToAPI(doms []*domain.Blog) []*BlogResponseV1 {
+	blogs := make([]*BlogResponseV1, 0, len(doms))
+	for _, dom := range doms {
+		blogs = append(blogs, convertBlogDomainObjToAPI(dom))
+	}
+	return blogs
+}
+
+// convertBlogPageDomainObjToAPI hasMore tells whether there are blogs after the page
+func convertBlogPageDomainObjToAPI(doms []*domain.Blog, offset int, limit int, hasMore bool) *BlogListResponseV1 {
+	return &BlogListResponseV1{Blogs: convertBlogsDomainObjToAPI(doms), Pagination: newPagination(offset, limit, len(doms), hasMore)}
+}
+
+func newPagination(offset int, limit int, count int, hasMore bool) *PaginationV1 {
+	pagination := &PaginationV1{
+		Offset:  offset,
+		Limit:   limit,
+		Count:   count,
+		HasMore: hasMore,
+	}
+	if hasMore {
+		pagination.NextOffset = offset + count
+	}
+	return pagination
+}
+
+// convertBlogDomainObjToAPIV2 the tags are split into a list, which is empty rather than null for a blog without tags
+func convertBlogDomainObjToAPIV2(dom *domain.Blog) *BlogResponseV2 {
+	tags := []string{}
+	if dom.Tags != "" {
+		tags = strings.Split(dom.Tags, ",")
+	}
+	return &BlogResponseV2{
+		ID:              dom.ID,
+		UserID:          dom.UserID,
+		Creator:         convertBlogCreatorDomainObjToAPI(dom.Creator),
+		Title:           dom.Title,
+		Slug:            dom.Slug,
+		Status:          string(dom.Status),
+		Content:         dom.Content,
+		ContentFormat:   string(dom.ContentFormat),
+		ContentHTML:     dom.ContentHTML,
+		Tags:            tags,
+		CommentsEnabled: dom.CommentsEnabled,
+		Visibility:      string(dom.Visibility),
+		Reactions:       dom.Reactions,
+		CreatedAt:       dom.CreatedAt,
+		UpdatedAt:       dom.UpdatedAt,
+	}
+}
+
+func convertBlogsDomainObjToAPIV2(doms []*domain.Blog) []*BlogResponseV2 {
+	blogs := make([]*BlogResponseV2, 0, len(doms))
+	for _, dom := range doms {
+		blogs = append(blogs, convertBlogDomainObjToAPIV2(dom))
+	}
+	return blogs
+}
+
+func convertBlogPageDomainObjToAPIV2(doms []*domain.Blog, offset int, limit int, hasMore bool) *BlogListResponseV2 {
+	return &BlogListResponseV2{Blogs: convertBlogsDomainObjToAPIV2(doms), Pagination: newPagination(offset, limit, len(doms), hasMore)}
+}
+
+func convertReactionsDomainObjToAPI(doms []*domain.Reaction) []*ReactionResponseV1 {
+	reactions := make([]*ReactionResponseV1, 0, len(doms))
+	for _, dom := range doms {
+		reactions = append(reactions, &ReactionResponseV1{
+			UserID:    dom.UserID,
+			Type:      dom.Type,
+			CreatedAt: dom.CreatedAt,
+		})
+	}
+	return reactions
+}
+
+// convertFollowsDomainObjToAPI otherID picks the user to show from each follow
+func convertFollowsDomainObjToAPI(doms []*domain.Follow, otherID func(*domain.Follow) int64) []*FollowResponseV1 {
+	follows := make([]*FollowResponseV1, 0, len(doms))
+	for _, dom := range doms {
+		follows = append(follows, &FollowResponseV1{
+			UserID:    otherID(dom),
+			CreatedAt: dom.CreatedAt,
+		})
+	}
+	return follows
+}
+
+// convertMediaDomainObjToAPI the URLs are in the version of the API the media was asked for through
+func convertMediaDomainObjToAPI(version string, dom *domain.Media) *MediaResponseV1 {
+	media := &MediaResponseV1{
+		ID:          dom.ID,
+		UserID:      dom.UserID,
+		BlogID:      dom.BlogID,
+		URL:         fmt.Sprintf("%s/media/%d", versionPrefix(version), dom.ID),
+		ContentType: dom.ContentType,
+		Size:        dom.Size,
+		Width:       dom.Width,
+		Height:      dom.Height,
+		CreatedAt:   dom.CreatedAt,
+	}
+	for _, variant := range dom.Variants {
+		url := fmt.Sprintf("%s/media/%d/%s.%s", versionPrefix(version), dom.ID, variant.Name, variant.Format)
+		media.Variants = append(media.Variants, &MediaVariantV1{
+			Name:        variant.Name,
+			URL:         url,
+			ContentType: variant.ContentType(),
+			Width:       variant.Width,
+			Height:      variant.Height,
+		})
+		// the cropped thumbnail does not show the whole image, it is no candidate
+		if variant.Crop {
+			continue
+		}
+		if media.Srcset == nil {
+			media.Srcset = map[string]string{}
+		}
+		candidate := fmt.Sprintf("%s %dw", url, variant.Width)
+		if srcset := media.Srcset[variant.Format]; srcset != "" {
+			candidate = srcset + ", " + candidate
+		}
+		media.Srcset[variant.Format] = candidate
+	}
+	return media
+}
+
+func convertMediaListDomainObjToAPI(version string, doms []*domain.Media) []*MediaResponseV1 {
+	media := make([]*MediaResponseV1, 0, len(doms))
+	for _, dom := range doms {
+		media = append(media, convertMediaDomainObjToAPI(version, dom))
+	}
+	return media
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+func TestConvertBlogPage(t *testing.T) {
+	creator := &domain.User{ID: 7, Username: "ada", Password: "$2a$10$hash", FirstName: "Ada", LastName: "Lovelace"}
+	blogs := []*domain.Blog{
+		{ID: 1, UserID: 7, Title: "First", Creator: creator},
+		{ID: 2, UserID: 8, Title: "Orphan"},
+	}
+
+	encoded, err := json.Marshal(convertBlogPageDomainObjToAPI(blogs, 20, 2, true))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	page := string(encoded)
+	for _, expected := range []string{
+		`"id":1,"userId":7,"creator":{"username":"ada","firstName":"Ada","lastName":"Lovelace"},"title":"First"`,
+		`"id":2,"userId":8,"title":"Orphan"`,
+		`"pagination":{"offset":20,"limit":2,"count":2,"hasMore":true,"nextOffset":22}`,
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected %s in %s", expected, page)
+		}
+	}
+	if strings.Contains(page, "hash") || strings.Contains(page, `"ID"`) {
+		t.Errorf("expected only the camelCase fields of the API types, got %s", page)
+	}
+
+	last := convertBlogPageDomainObjToAPI(nil, 0, 10, false)
+	if encoded, _ := json.Marshal(last); string(encoded) != `{"blogs":[],"pagination":{"offset":0,"limit":10,"count":0,"hasMore":false}}` {
+		t.Errorf("expected an empty last page, got %s", encoded)
+	}
+}
+
+func TestConvertBlogV2(t *testing.T) {
+	blog := convertBlogDomainObjToAPIV2(&domain.Blog{ID: 1, Tags: "go,web", Status: domain.StatusDraft})
+	if !reflect.DeepEqual(blog.Tags, []string{"go", "web"}) || blog.Status != "draft" {
+		t.Errorf("expected the tags as a list and the status, got %v %s", blog.Tags, blog.Status)
+	}
+	if encoded, _ := json.Marshal(convertBlogDomainObjToAPIV2(&domain.Blog{ID: 2})); !strings.Contains(string(encoded), `"tags":[]`) {
+		t.Errorf("expected an empty list of tags, got %s", encoded)
+	}
+
+	request := convertCreateBlogRequestV2ToDomain(7, &CreateBlogRequestV2{Title: "T", Tags: []string{"go", "web"}, Status: "draft"})
+	if request.Tags != "go,web" || request.Status != domain.StatusDraft || request.UserID != 7 {
+		t.Errorf("expected the tags joined and the status, got %+v", request)
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// multipartOverhead is what the request may have on top of the file, the boundaries, the headers and the blogId
+const multipartOverhead = 1 << 20
+
+// uploadMediaHandler takes a multipart/form-data request with the file in the "file" field and optionally the id of
+// the blog to attach it to in the "blogId" field
+func (ws *WebService) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, ws.conf.Media.MaxSize+multipartOverhead)
+	// the small fields are kept in memory, the file goes to a temporary file once it gets larger than this
+	err := r.ParseMultipartForm(multipartOverhead)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			setProblem(w, r, http.StatusRequestEntityTooLarge, payloadTooLargeCode,
+				fmt.Sprintf("the file must not be larger than %d bytes", ws.conf.Media.MaxSize))
+			return
+		}
+		setMalformedRequest(w, r, "expected a multipart/form-data request")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var blogID int64
+	if value := r.FormValue("blogId"); value != "" {
+		blogID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			setMalformedRequest(w, r, fmt.Sprintf("invalid blogId '%s' provided", value))
+			return
+		}
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		setMalformedRequest(w, r, "the file field is missing")
+		return
+	}
+	defer file.Close()
+
+	ctx := utils.CreateContext(r.Context())
+	media, err := ws.mediaManager.Upload(ctx, ws.getUserID(r), blogID, file)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusCreated, convertMediaDomainObjToAPI(requestVersion(r), media))
+}
+
+// getMediaHandler serves the content with the sniffed content type, the browsers are told not to guess another one
+func (ws *WebService) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	mediaID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	ctx := utils.CreateContext(r.Context())
+	media, content, err := ws.mediaManager.Open(ctx, ws.getViewer(r), mediaID)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", media.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(media.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// the content of a media never changes, but the blog it belongs to may stop being readable
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		logger.WithError(err).Errorf("failed to write the content of media %d", mediaID)
+	}
+}
+
+// getMediaVariantHandler serves a variant of an image, e.g. /v1/media/7/w640.webp
+func (ws *WebService) getMediaVariantHandler(w http.ResponseWriter, r *http.Request) {
+	mediaID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	ctx := utils.CreateContext(r.Context())
+	variant, content, err := ws.mediaManager.OpenVariant(ctx, ws.getViewer(r), mediaID, vars["variant"], vars["format"])
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", variant.ContentType())
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		logger.WithError(err).Errorf("failed to write the variant %s.%s of media %d", variant.Name, variant.Format, mediaID)
+	}
+}
+
+func (ws *WebService) attachMediaHandler(w http.ResponseWriter, r *http.Request) {
+	mediaID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	var request AttachMediaRequestV1
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	media, err := ws.mediaManager.Attach(ctx, ws.getUserID(r), mediaID, request.BlogID)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, convertMediaDomainObjToAPI(requestVersion(r), media))
+}
+
+func (ws *WebService) listBlogMediaHandler(w http.ResponseWriter, r *http.Request) {
+	blogID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	ctx := utils.CreateContext(r.Context())
+	media, err := ws.mediaManager.ListByBlog(ctx, ws.getViewer(r), blogID)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, convertMediaListDomainObjToAPI(requestVersion(r), media))
+}
@@ -0,0 +1,586 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+const (
+	openAPIVersion  = "3.1.0"
+	jsonContentType = "application/json"
+
+	// the auth of an operation which is not behind authorize, which takes the permission instead
+	authNone     = ""
+	authOptional = "optional"
+)
+
+/*
+apiOperation is one route of the API as the OpenAPI document describes it. The list below is kept in line with the
+routes of WebService.router by TestOpenAPIMatchesRoutes, the schemas come from the request and response types
+themselves, so they can not drift apart. The operations under /v1 are in every version of the API, see
+versionedOperations.
+*/
+type apiOperation struct {
+	method  string
+	path    string
+	tag     string
+	summary string
+	auth    string
+	// the query parameters and the path parameters which need more than the default, ids are integers and the
+	// other path parameters strings
+	parameters []apiParameter
+	// request is a value of the JSON request type, requestContent the content when it is not JSON
+	request        any
+	requestContent map[string]any
+	status         int
+	// response is a value of the JSON response type, responseContent the content when it is not JSON
+	response        any
+	responseContent map[string]any
+	// errors are the statuses on top of those of the auth, 500 is always documented
+	errors []int
+	// deprecated is set on the operations of a deprecated version of the API
+	deprecated bool
+	// rateLimited is set on the operations of the versions, which are behind the rate limits
+	rateLimited bool
+}
+
+type apiParameter struct {
+	name        string
+	in          string
+	description string
+	schema      map[string]any
+}
+
+var (
+	pageParameters = []apiParameter{
+		{name: "offset", in: "query", description: "how many items to skip", schema: map[string]any{"type": "integer", "minimum": 0, "default": 0}},
+		{name: "limit", in: "query", description: "the size of the page, at most 100", schema: map[string]any{"type": "integer", "minimum": 0, "maximum": maxPageLimit, "default": 10}},
+	}
+	idempotencyKeyParameter = apiParameter{name: idempotencyKeyHeader, in: "header",
+		description: "makes the retries safe, a retry with the same key and body gets the response of the first request",
+		schema:      map[string]any{"type": "string", "minLength": 1, "maxLength": 255}}
+	feedFormatParameter = apiParameter{name: "format", in: "path", schema: map[string]any{"type": "string", "enum": []string{rssFormat, atomFormat, jsonFormat}}}
+	binarySchema        = map[string]any{"type": "string", "format": "binary"}
+)
+
+var apiOperations = []apiOperation{
+	{method: "POST", path: "/v1/register", tag: "users", summary: "Register a new user, who gets the editor and viewer roles",
+		request: CreateUserRequestV1{}, status: http.StatusOK, response: UserResponseV1{}, errors: []int{400, 409, 422}},
+	{method: "POST", path: "/v1/login", tag: "users", summary: "Log in, the token goes into the Authorization header of the other requests",
+		request: LoginRequestV1{}, status: http.StatusOK, response: LoginResponseV1{}, errors: []int{400, 401, 403}},
+	{method: "POST", path: "/v1/sessions", tag: "users", summary: "Log in to a cookie session, the requests which change something send the CSRF token in the X-CSRF-Token header",
+		request: LoginRequestV1{}, status: http.StatusOK, response: SessionResponseV1{}, errors: []int{400, 401, 403, 404}},
+	{method: "GET", path: "/v1/sessions", tag: "users", summary: "Get the CSRF token of the cookie session",
+		status: http.StatusOK, response: SessionResponseV1{}, errors: []int{401, 404}},
+	{method: "DELETE", path: "/v1/sessions", tag: "users", summary: "Log out of the cookie session",
+		status: http.StatusNoContent, errors: []int{404}},
+	{method: "GET", path: "/v1/users/{id}", tag: "users", summary: "Get a user (not implemented yet, answers with an empty body)",
+		auth: utils.ReadUserPermission, status: http.StatusOK},
+	{method: "PUT", path: "/v1/users/{id}", tag: "users", summary: "Update a user (not implemented yet, answers with an empty body)",
+		auth: utils.UpdateUserPermission, request: UpdateUserRequestV1{}, status: http.StatusOK},
+	{method: "DELETE", path: "/v1/users/{id}", tag: "users", summary: "Delete a user (not implemented yet, answers with an empty body)",
+		auth: utils.DeleteUserPermission, status: http.StatusOK},
+
+	{method: "POST", path: "/v1/blogs", tag: "blogs", summary: "Create a blog, the tags are comma separated in v1 and a list from v2 on",
+		auth: utils.CreateBlogPermission, parameters: []apiParameter{idempotencyKeyParameter}, request: CreateBlogRequestV1{},
+		status: http.StatusCreated, response: CreateBlogResponseV1{}, errors: []int{400, 409, 422}},
+	{method: "PUT", path: "/v1/blogs", tag: "blogs", summary: "Update a blog, a new title gives it a new slug",
+		auth: utils.UpdateBlogPermission, request: UpdateBlogRequestV1{}, status: http.StatusOK, response: BlogResponseV1{}, errors: []int{400, 404, 422}},
+	{method: "GET", path: "/v1/blogs", tag: "blogs", summary: "Search the readable blogs by their title, content and tags",
+		auth: authOptional, parameters: []apiParameter{
+			{name: "q", in: "query", description: "the search terms", schema: map[string]any{"type": "string"}},
+			pageParameters[0],
+			{name: "limit", in: "query", description: "the size of the page, at most 100", schema: map[string]any{"type": "integer", "minimum": 1, "maximum": maxSearchLimit, "default": 10}},
+		}, status: http.StatusOK, response: BlogListResponseV1{}, errors: []int{304, 422}},
+	{method: "GET", path: "/v1/blogs/{id}", tag: "blogs", summary: "Get a blog",
+		auth: authOptional, status: http.StatusOK, response: BlogResponseV1{}, errors: []int{304, 400, 404}},
+	{method: "GET", path: "/v1/blogs/by-slug/{slug}", tag: "blogs", summary: "Get a blog by its slug, an old slug redirects to the current one",
+		auth: authOptional, status: http.StatusOK, response: BlogResponseV1{}, errors: []int{301, 304, 404}},
+	{method: "DELETE", path: "/v1/blogs/{id}", tag: "blogs", summary: "Delete a blog (not implemented yet, answers with an empty body)",
+		auth: utils.DeleteBlogPermission, status: http.StatusOK},
+
+	{method: "POST", path: "/v1/blogs/{id}/comments", tag: "comments", summary: "Comment on a blog, or reply to a comment with a parentId",
+		auth: utils.CreateCommentPermission, parameters: []apiParameter{idempotencyKeyParameter}, request: CreateCommentRequestV1{},
+		status: http.StatusCreated, response: CommentResponseV1{}, errors: []int{400, 404, 409, 422}},
+	{method: "GET", path: "/v1/blogs/{id}/comments", tag: "comments", summary: "List the approved comments of a blog, every comment is followed by its replies",
+		auth: authOptional, parameters: pageParameters, status: http.StatusOK, response: []CommentResponseV1{}, errors: []int{400, 404, 422}},
+	{method: "PUT", path: "/v1/blogs/{id}/comments/settings", tag: "comments", summary: "Turn the comments of a blog on or off, by its author",
+		auth: utils.UpdateBlogPermission, request: CommentSettingsRequestV1{}, status: http.StatusOK, response: CommentSettingsRequestV1{}, errors: []int{400, 404}},
+	{method: "PUT", path: "/v1/comments/{id}", tag: "comments", summary: "Edit a comment, by its author",
+		auth: utils.CreateCommentPermission, request: UpdateCommentRequestV1{}, status: http.StatusOK, response: CommentResponseV1{}, errors: []int{400, 404, 422}},
+	{method: "DELETE", path: "/v1/comments/{id}", tag: "comments", summary: "Delete a comment, by its author",
+		auth: utils.CreateCommentPermission, status: http.StatusNoContent, errors: []int{400, 404}},
+	{method: "GET", path: "/v1/comments", tag: "comments", summary: "The moderation queue, the comments by status",
+		auth: utils.ModerateCommentPermission, parameters: append([]apiParameter{{name: "status", in: "query", description: "pending by default",
+			schema: map[string]any{"type": "string", "enum": []string{"pending", "approved", "spam", "removed"}}}}, pageParameters...),
+		status: http.StatusOK, response: []CommentResponseV1{}, errors: []int{422}},
+	{method: "PUT", path: "/v1/comments/{id}/status", tag: "comments", summary: "Moderate a comment",
+		auth: utils.ModerateCommentPermission, request: CommentStatusRequestV1{}, status: http.StatusOK, response: CommentResponseV1{}, errors: []int{400, 404, 422}},
+
+	{method: "PUT", path: "/v1/blogs/{id}/reactions/{type}", tag: "reactions", summary: "React to a blog with like or one of the configured emojis",
+		auth: utils.CreateReactionPermission, status: http.StatusOK, response: ReactionCountsV1{}, errors: []int{400, 404, 422}},
+	{method: "DELETE", path: "/v1/blogs/{id}/reactions/{type}", tag: "reactions", summary: "Take a reaction back",
+		auth: utils.CreateReactionPermission, status: http.StatusOK, response: ReactionCountsV1{}, errors: []int{400, 404, 422}},
+	{method: "GET", path: "/v1/blogs/{id}/reactions", tag: "reactions", summary: "Who reacted to a blog, newest first",
+		auth: authOptional, parameters: append([]apiParameter{{name: "type", in: "query", description: "only the reactions of the type", schema: map[string]any{"type": "string"}}}, pageParameters...),
+		status: http.StatusOK, response: []ReactionResponseV1{}, errors: []int{400, 404, 422}},
+
+	{method: "PUT", path: "/v1/users/{id}/follow", tag: "follows", summary: "Follow a user",
+		auth: utils.FollowUserPermission, status: http.StatusNoContent, errors: []int{400, 404, 422}},
+	{method: "DELETE", path: "/v1/users/{id}/follow", tag: "follows", summary: "Unfollow a user",
+		auth: utils.FollowUserPermission, status: http.StatusNoContent, errors: []int{400, 404}},
+	{method: "GET", path: "/v1/users/{id}/followers", tag: "follows", summary: "Who follows the user, newest first",
+		auth: utils.ReadUserPermission, parameters: pageParameters, status: http.StatusOK, response: []FollowResponseV1{}, errors: []int{400, 404, 422}},
+	{method: "GET", path: "/v1/users/{id}/following", tag: "follows", summary: "Whom the user follows, newest first",
+		auth: utils.ReadUserPermission, parameters: pageParameters, status: http.StatusOK, response: []FollowResponseV1{}, errors: []int{400, 404, 422}},
+	{method: "GET", path: "/v1/users/{id}/follow-counts", tag: "follows", summary: "How many followers the user has and how many users the user follows",
+		auth: utils.ReadUserPermission, status: http.StatusOK, response: FollowCountsV1{}, errors: []int{400, 404}},
+	{method: "GET", path: "/v1/feed", tag: "follows", summary: "The newest blogs of the followed authors, paged with a cursor",
+		auth: utils.ReadBlogPermission, parameters: []apiParameter{
+			{name: "limit", in: "query", description: "the size of the page, at most 100", schema: map[string]any{"type": "integer", "minimum": 0, "default": 10}},
+			{name: "cursor", in: "query", description: "the nextCursor of the previous page", schema: map[string]any{"type": "string"}},
+		}, status: http.StatusOK, response: FeedResponseV1{}, errors: []int{400}},
+
+	{method: "GET", path: "/v1/feeds/{format}", tag: "syndication", summary: "The newest public blogs of the site",
+		parameters: []apiParameter{feedFormatParameter}, status: http.StatusOK, responseContent: feedContent(), errors: []int{304}},
+	{method: "GET", path: "/v1/feeds/authors/{id}/{format}", tag: "syndication", summary: "The newest public blogs of an author",
+		parameters: []apiParameter{feedFormatParameter}, status: http.StatusOK, responseContent: feedContent(), errors: []int{304, 400, 404}},
+	{method: "GET", path: "/v1/feeds/tags/{tag}/{format}", tag: "syndication", summary: "The newest public blogs with a tag, ignoring the case",
+		parameters: []apiParameter{feedFormatParameter}, status: http.StatusOK, responseContent: feedContent(), errors: []int{304}},
+
+	{method: "POST", path: "/v1/media", tag: "media", summary: "Upload a file, optionally attached to a blog of the uploader right away",
+		auth: utils.CreateBlogPermission, requestContent: map[string]any{"multipart/form-data": map[string]any{"schema": map[string]any{
+			"type":     "object",
+			"required": []string{"file"},
+			"properties": map[string]any{
+				"file":   binarySchema,
+				"blogId": map[string]any{"type": "integer", "format": "int64"},
+			},
+		}}}, status: http.StatusCreated, response: MediaResponseV1{}, errors: []int{400, 404, 413, 422}},
+	{method: "GET", path: "/v1/media/{id}", tag: "media", summary: "The content of a media, with the sniffed content type",
+		auth: authOptional, status: http.StatusOK, responseContent: map[string]any{"*/*": map[string]any{"schema": binarySchema}}, errors: []int{400, 404}},
+	{method: "GET", path: "/v1/media/{id}/{variant}.{format}", tag: "media", summary: "A variant of an image, made on its first request",
+		auth: authOptional, parameters: []apiParameter{
+			{name: "variant", in: "path", description: "thumb or w followed by the width, e.g. w640", schema: map[string]any{"type": "string", "pattern": "^[a-z0-9]+$"}},
+			{name: "format", in: "path", schema: map[string]any{"type": "string", "enum": []string{"webp", "jpeg"}}},
+		}, status: http.StatusOK, responseContent: map[string]any{
+			"image/webp": map[string]any{"schema": binarySchema},
+			"image/jpeg": map[string]any{"schema": binarySchema},
+		}, errors: []int{400, 404}},
+	{method: "PUT", path: "/v1/media/{id}/blog", tag: "media", summary: "Attach an upload to a blog of the uploader",
+		auth: utils.CreateBlogPermission, request: AttachMediaRequestV1{}, status: http.StatusOK, response: MediaResponseV1{}, errors: []int{400, 404}},
+	{method: "GET", path: "/v1/blogs/{id}/media", tag: "media", summary: "The media of a blog, oldest first",
+		auth: authOptional, status: http.StatusOK, response: []MediaResponseV1{}, errors: []int{400, 404}},
+
+	{method: "GET", path: "/v1/admin/log-level", tag: "admin", summary: "The current log level",
+		auth: utils.ManageSystemPermission, status: http.StatusOK, response: LogLevelV1{}},
+	{method: "PUT", path: "/v1/admin/log-level", tag: "admin", summary: "Change the log level until the next restart",
+		auth: utils.ManageSystemPermission, request: LogLevelV1{}, status: http.StatusOK, response: LogLevelV1{}, errors: []int{400, 422}},
+
+	{method: "GET", path: "/openapi.json", tag: "docs", summary: "This document",
+		status: http.StatusOK, responseContent: map[string]any{jsonContentType: map[string]any{"schema": map[string]any{"type": "object"}}}},
+	{method: "GET", path: "/docs", tag: "docs", summary: "The interactive documentation of the API",
+		status: http.StatusOK, responseContent: map[string]any{"text/html": map[string]any{"schema": map[string]any{"type": "string"}}}},
+	{method: "GET", path: "/metrics", tag: "metrics", summary: "The Prometheus metrics, among them the requests per version of the API",
+		status: http.StatusOK, responseContent: map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}}},
+}
+
+// v2Types are the types which changed in v2, the other types are shared by the versions
+var v2Types = map[reflect.Type]any{
+	reflect.TypeOf(CreateBlogRequestV1{}): CreateBlogRequestV2{},
+	reflect.TypeOf(UpdateBlogRequestV1{}): UpdateBlogRequestV2{},
+	reflect.TypeOf(BlogResponseV1{}):      BlogResponseV2{},
+	reflect.TypeOf(BlogListResponseV1{}):  BlogListResponseV2{},
+	reflect.TypeOf(FeedResponseV1{}):      FeedResponseV2{},
+}
+
+// versionedOperations has the operations under /v1 once for every version, with the types of the version
+func versionedOperations(operations []apiOperation, versions []apiVersion) []apiOperation {
+	var versioned []apiOperation
+	for _, version := range versions {
+		for _, operation := range operations {
+			if !strings.HasPrefix(operation.path, versionPrefix(apiV1)+"/") {
+				continue
+			}
+			operation.path = versionPrefix(version.name) + strings.TrimPrefix(operation.path, versionPrefix(apiV1))
+			operation.deprecated = !version.deprecated.IsZero()
+			operation.rateLimited = true
+			if version.name != apiV1 {
+				operation.request = v2Type(operation.request)
+				operation.response = v2Type(operation.response)
+			}
+			versioned = append(versioned, operation)
+		}
+	}
+	for _, operation := range operations {
+		if !strings.HasPrefix(operation.path, versionPrefix(apiV1)+"/") {
+			versioned = append(versioned, operation)
+		}
+	}
+	return versioned
+}
+
+func v2Type(value any) any {
+	if value == nil {
+		return nil
+	}
+	if changed, ok := v2Types[reflect.TypeOf(value)]; ok {
+		return changed
+	}
+	return value
+}
+
+func feedContent() map[string]any {
+	return map[string]any{
+		"application/rss+xml":  map[string]any{"schema": map[string]any{"type": "string"}},
+		"application/atom+xml": map[string]any{"schema": map[string]any{"type": "string"}},
+		"application/feed+json": map[string]any{"schema": map[string]any{
+			"type":        "object",
+			"description": "JSON Feed 1.1, https://www.jsonfeed.org/version/1.1/",
+		}},
+	}
+}
+
+// newOpenAPIDocument builds the OpenAPI document of the operations, the schemas of their types end up in the components
+func newOpenAPIDocument(conf *config.Config, operations []apiOperation) map[string]any {
+	schemas := map[string]any{}
+	paths := map[string]any{}
+	for _, operation := range operations {
+		item, ok := paths[operation.path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[operation.path] = item
+		}
+		item[strings.ToLower(operation.method)] = operation.document(schemas)
+	}
+	// every error is a problem
+	problemSchema := schemaOf(reflect.TypeOf(ProblemV1{}), schemas)
+
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":       "Blogzilla",
+			"version":     "2",
+			"description": "A blogging service. Every route is served under /v1 and /v2, v1 is deprecated: its responses carry the Deprecation and Sunset headers and a Link to the route in v2. The errors are RFC 7807 problems with a stable code in every version, see the README. The JSON request bodies are validated against the rules of their schemas before anything else, unknown fields are rejected, and a 422 lists every violation at once. The routes are rate limited per client, the RateLimit headers of the responses tell where the client stands.",
+		},
+		"servers": []any{map[string]any{"url": strings.TrimSuffix(conf.Syndication.BaseURL, "/")}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"cookieAuth": map[string]any{"type": "apiKey", "in": "cookie", "name": sessionCookieName},
+			},
+			"responses": map[string]any{
+				"Problem": map[string]any{
+					"description": "the request failed, see the code of the problem",
+					"content":     map[string]any{problemContentType: map[string]any{"schema": problemSchema}},
+				},
+			},
+		},
+	}
+}
+
+func (o apiOperation) document(schemas map[string]any) map[string]any {
+	document := map[string]any{
+		"operationId": operationID(o.method, o.path),
+		"summary":     o.summary,
+		"tags":        []string{o.tag},
+	}
+
+	var parameters []any
+	for _, name := range pathParameterNames(o.path) {
+		parameter := apiParameter{name: name, in: "path", schema: map[string]any{"type": "string"}}
+		if name == "id" {
+			parameter.schema = map[string]any{"type": "integer", "format": "int64"}
+		}
+		for _, custom := range o.parameters {
+			if custom.in == "path" && custom.name == name {
+				parameter = custom
+			}
+		}
+		parameters = append(parameters, parameter.document(true))
+	}
+	for _, parameter := range o.parameters {
+		if parameter.in != "path" {
+			parameters = append(parameters, parameter.document(false))
+		}
+	}
+	if len(parameters) > 0 {
+		document["parameters"] = parameters
+	}
+
+	if o.request != nil {
+		document["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{jsonContentType: map[string]any{"schema": schemaOf(reflect.TypeOf(o.request), schemas)}},
+		}
+	} else if o.requestContent != nil {
+		document["requestBody"] = map[string]any{"required": true, "content": o.requestContent}
+	}
+
+	success := map[string]any{"description": http.StatusText(o.status)}
+	headers := map[string]any{}
+	if o.deprecated {
+		document["deprecated"] = true
+		for name, header := range deprecationHeaders {
+			headers[name] = header
+		}
+	}
+	if o.rateLimited {
+		for name, header := range rateLimitHeaders {
+			headers[name] = header
+		}
+	}
+	if len(headers) > 0 {
+		success["headers"] = headers
+	}
+	if o.response != nil {
+		success["content"] = map[string]any{jsonContentType: map[string]any{"schema": schemaOf(reflect.TypeOf(o.response), schemas)}}
+	} else if o.responseContent != nil {
+		success["content"] = o.responseContent
+	}
+	responses := map[string]any{strconv.Itoa(o.status): success}
+
+	statuses := append([]int{}, o.errors...)
+	if o.request != nil {
+		// decodeRequest turns down malformed, too large and invalid bodies
+		statuses = append(statuses, http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity)
+	}
+	switch o.auth {
+	case authNone:
+	case authOptional:
+		// no token is fine, an invalid one is not
+		document["security"] = []any{map[string]any{}, map[string]any{"bearerAuth": []string{}}, map[string]any{"cookieAuth": []string{}}}
+		statuses = append(statuses, http.StatusUnauthorized)
+	default:
+		document["security"] = []any{map[string]any{"bearerAuth": []string{}}, map[string]any{"cookieAuth": []string{}}}
+		document["description"] = fmt.Sprintf("Needs the `%s` permission.", o.auth)
+		document["x-permission"] = o.auth
+		statuses = append(statuses, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	if o.rateLimited {
+		statuses = append(statuses, http.StatusTooManyRequests)
+	}
+	statuses = append(statuses, http.StatusInternalServerError)
+	for _, status := range statuses {
+		switch status {
+		case http.StatusMovedPermanently:
+			responses[strconv.Itoa(status)] = map[string]any{
+				"description": "an old slug, Location has the current one",
+				"headers":     map[string]any{"Location": map[string]any{"schema": map[string]any{"type": "string"}}},
+			}
+		case http.StatusNotModified:
+			responses[strconv.Itoa(status)] = map[string]any{"description": "the ETag or Last-Modified the client sent is still current"}
+		case http.StatusTooManyRequests:
+			limitHeaders := map[string]any{"Retry-After": map[string]any{"description": "the seconds to wait", "schema": map[string]any{"type": "integer"}}}
+			for name, header := range rateLimitHeaders {
+				limitHeaders[name] = header
+			}
+			responses[strconv.Itoa(status)] = map[string]any{
+				"description": "the client used up its rate limit, Retry-After tells when to come back",
+				"headers":     limitHeaders,
+				"content":     map[string]any{problemContentType: map[string]any{"schema": schemaOf(reflect.TypeOf(ProblemV1{}), schemas)}},
+			}
+		default:
+			responses[strconv.Itoa(status)] = map[string]any{"$ref": "#/components/responses/Problem"}
+		}
+	}
+	document["responses"] = responses
+	return document
+}
+
+func (p apiParameter) document(required bool) map[string]any {
+	document := map[string]any{"name": p.name, "in": p.in, "schema": p.schema}
+	if required {
+		document["required"] = true
+	}
+	if p.description != "" {
+		document["description"] = p.description
+	}
+	return document
+}
+
+// deprecationHeaders are the headers of the responses of a deprecated version
+var deprecationHeaders = map[string]any{
+	"Deprecation": map[string]any{"description": "when the version was deprecated, e.g. @1792368000 (RFC 9745)", "schema": map[string]any{"type": "string"}},
+	"Sunset":      map[string]any{"description": "when the version stops being served (RFC 8594)", "schema": map[string]any{"type": "string"}},
+	"Link":        map[string]any{"description": "the same route in the latest version, rel=\"successor-version\"", "schema": map[string]any{"type": "string"}},
+}
+
+// rateLimitHeaders are the headers of the responses of a rate limited operation
+var rateLimitHeaders = map[string]any{
+	"RateLimit-Limit":     map[string]any{"description": "the requests the client can make at once", "schema": map[string]any{"type": "integer"}},
+	"RateLimit-Remaining": map[string]any{"description": "the requests the client has left", "schema": map[string]any{"type": "integer"}},
+	"RateLimit-Reset":     map[string]any{"description": "the seconds until the client has all of its requests back", "schema": map[string]any{"type": "integer"}},
+	"RateLimit-Policy":    map[string]any{"description": "the policy of the route, e.g. 5;w=30 for 5 requests every 30 seconds", "schema": map[string]any{"type": "string"}},
+}
+
+var pathParameterPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+func pathParameterNames(path string) []string {
+	var names []string
+	for _, match := range pathParameterPattern.FindAllStringSubmatch(path, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// operationID is the method and the path in camel case, e.g. getV1BlogsIdComments
+func operationID(method string, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf is the JSON schema of the type as encoding/json writes it, the structs are referenced from the components
+func schemaOf(t reflect.Type, schemas map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		if _, ok := schemas[t.Name()]; !ok {
+			// the placeholder stops the recursion of a type which refers to itself
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case t.Kind() == reflect.String:
+		return map[string]any{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+// structSchema lists the fields by their JSON names, with the rules of their validate tags
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	properties := map[string]any{}
+	rules := map[string]fieldRules{}
+	for _, field := range rulesOf(t) {
+		rules[field.name] = field
+	}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := jsonName(t.Field(i))
+		if !ok {
+			continue
+		}
+		property := schemaOf(t.Field(i).Type, schemas)
+		if field, ok := rules[name]; ok {
+			if addRules(property, field.rules) {
+				required = append(required, name)
+			}
+			if items, ok := property["items"].(map[string]any); ok && field.items != nil {
+				addRules(items, field.items)
+			}
+		}
+		properties[name] = property
+	}
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addRules adds the validation rules to the schema of a field and tells whether the field is required
+func addRules(schema map[string]any, rules []validationRule) bool {
+	required := false
+	for _, rule := range rules {
+		switch rule.name {
+		case "required":
+			required = true
+			switch schema["type"] {
+			case "string":
+				schema["minLength"] = 1
+			case "array":
+				schema["minItems"] = 1
+			}
+		case "min", "max":
+			keyword := map[string]string{"string": "Length", "array": "Items"}[fmt.Sprint(schema["type"])]
+			if keyword == "" {
+				keyword = map[string]string{"min": "minimum", "max": "maximum"}[rule.name]
+			} else {
+				keyword = rule.name + keyword
+			}
+			schema[keyword] = rule.limit
+		case "oneof":
+			schema["enum"] = strings.Fields(rule.value)
+		case "pattern":
+			schema["pattern"] = validationPatterns[rule.value].regexp.String()
+		}
+	}
+	return required
+}
+
+// openAPIHandler serves the document, it is built once
+func (ws *WebService) openAPIHandler() http.Handler {
+	document, err := json.MarshalIndent(newOpenAPIDocument(ws.conf, versionedOperations(apiOperations, ws.apiVersions())), "", "  ")
+	if err != nil {
+		// only a type json can not encode gets here, which the tests catch
+		panic(fmt.Sprintf("failed to encode the OpenAPI document: %v", err))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", jsonContentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(document)
+	})
+}
+
+// docsPage is Swagger UI on the document, the UI is loaded from a CDN
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Blogzilla API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+    };
+  </script>
+</body>
+</html>
+`
+
+// docsContentSecurityPolicy lets the docs page load Swagger UI from the CDN and run its inline script
+const docsContentSecurityPolicy = "default-src 'none'; script-src https://unpkg.com 'unsafe-inline'; style-src https://unpkg.com; " +
+	"img-src 'self' data: https://unpkg.com; connect-src 'self'; frame-ancestors 'none'"
+
+func (ws *WebService) docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", docsContentSecurityPolicy)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(docsPage))
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/gateways/memory"
+	"github.com/bipuldutta/blogzilla/usecases"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// routePattern is the pattern of a mux path variable, e.g. the ":rss|atom|json" of {format:rss|atom|json}
+var routePattern = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// TestOpenAPIMatchesRoutes fails when a route is added to the router without being documented, or the other way round
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	document := servedDocument(t)
+
+	routes := map[string]bool{}
+	err := newTestWebService().router().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			// the prefix of a version, its routes are walked on their own
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			routes[strings.ToLower(method)+" "+routePattern.ReplaceAllString(template, "{$1}")] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk the routes: %v", err)
+	}
+
+	documented := map[string]bool{}
+	for path, item := range document.Paths {
+		for method := range item {
+			documented[method+" "+path] = true
+		}
+	}
+	for _, route := range sortedKeys(routes) {
+		if !documented[route] {
+			t.Errorf("the route %s is missing from the OpenAPI document, add it to apiOperations", route)
+		}
+	}
+	for _, operation := range sortedKeys(documented) {
+		if !routes[operation] {
+			t.Errorf("the OpenAPI document has %s, which is no route", operation)
+		}
+	}
+}
+
+// TestOpenAPIDocument checks the document itself: the path parameters, the references and the schemas of the types
+func TestOpenAPIDocument(t *testing.T) {
+	document := servedDocument(t)
+	if document.OpenAPI != openAPIVersion {
+		t.Errorf("expected the version %s, got %s", openAPIVersion, document.OpenAPI)
+	}
+
+	encoded, err := json.Marshal(document.Paths)
+	if err != nil {
+		t.Fatalf("failed to encode the paths: %v", err)
+	}
+	for _, match := range regexp.MustCompile(`"\$ref":"#/components/(\w+)/(\w+)"`).FindAllStringSubmatch(string(encoded), -1) {
+		if _, ok := document.Components[match[1]][match[2]]; !ok {
+			t.Errorf("the reference %s/%s does not resolve", match[1], match[2])
+		}
+	}
+
+	for path, item := range document.Paths {
+		for method, operation := range item {
+			var names []string
+			for _, parameter := range operation.Parameters {
+				if parameter.In == "path" {
+					names = append(names, parameter.Name)
+				}
+			}
+			if strings.Join(names, ",") != strings.Join(pathParameterNames(path), ",") {
+				t.Errorf("%s %s: expected the path parameters %v, got %v", method, path, pathParameterNames(path), names)
+			}
+			if len(operation.Responses) == 0 {
+				t.Errorf("%s %s: no responses", method, path)
+			}
+		}
+	}
+
+	// every request and response type is in the document
+	file, err := parser.ParseFile(token.NewFileSet(), "types.go", nil, 0)
+	if err != nil {
+		t.Fatalf("failed to parse types.go: %v", err)
+	}
+	for _, declaration := range file.Decls {
+		if general, ok := declaration.(*ast.GenDecl); ok && general.Tok == token.TYPE {
+			for _, spec := range general.Specs {
+				name := spec.(*ast.TypeSpec).Name.Name
+				if _, ok := document.Components["schemas"][name]; !ok {
+					t.Errorf("the type %s of types.go is not used by any operation of the OpenAPI document", name)
+				}
+			}
+		}
+	}
+}
+
+func TestDocs(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newTestWebService().router().ServeHTTP(recorder, httptest.NewRequest("GET", "/docs", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "/openapi.json") {
+		t.Errorf("expected the docs page, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components map[string]map[string]json.RawMessage  `json:"components"`
+}
+
+type openAPIOperation struct {
+	Parameters []struct {
+		Name string `json:"name"`
+		In   string `json:"in"`
+	} `json:"parameters"`
+	RequestBody json.RawMessage            `json:"requestBody"`
+	Responses   map[string]json.RawMessage `json:"responses"`
+	Security    json.RawMessage            `json:"security"`
+}
+
+func servedDocument(t *testing.T) *openAPIDocument {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	newTestWebService().router().ServeHTTP(recorder, httptest.NewRequest("GET", "/openapi.json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the document, got %d", recorder.Code)
+	}
+	var document openAPIDocument
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatalf("failed to decode the document: %v", err)
+	}
+	return &document
+}
+
+// newTestWebService has no managers, it is good for the routes which do not use them
+func newTestWebService() *WebService {
+	logger = utils.Logger()
+	conf := config.NewConfig()
+	return &WebService{conf: conf, authMiddleware: NewAuthMiddleware(conf, nil)}
+}
+
+// testTokens has the web service authenticate against the users of a memory store, the func it returns creates a user
+// there and issues a token of the user with the permissions
+func testTokens(t *testing.T, ws *WebService) func(permissions map[string]any) (int64, string) {
+	store := memory.NewStore()
+	authRepo := memory.NewAuthRepo(ws.conf)
+	userRepo := memory.NewUserRepo(store, authRepo)
+	ws.authMiddleware = NewAuthMiddleware(ws.conf, usecases.NewAuthManager(ws.conf, userRepo))
+	created := 0
+	return func(permissions map[string]any) (int64, string) {
+		t.Helper()
+		ctx := context.Background()
+		created++
+		user, err := userRepo.Create(ctx, &domain.User{Username: fmt.Sprintf("user%d", created), Password: "hashed"})
+		if err != nil {
+			t.Fatalf("failed to create a user: %v", err)
+		}
+		token, err := authRepo.GetToken(ctx, user.ID, user.TokenVersion, permissions)
+		if err != nil {
+			t.Fatalf("failed to get a token: %v", err)
+		}
+		return user.ID, token
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
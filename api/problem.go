@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:blogzilla:problem:"
+
+	// stable error codes, clients are allowed to rely on these
+	notFoundCode         = "not_found"
+	conflictCode         = "conflict"
+	validationFailedCode = "validation_failed"
+	forbiddenCode        = "forbidden"
+	unauthorizedCode     = "unauthorized"
+	malformedRequestCode = "malformed_request"
+	payloadTooLargeCode  = "payload_too_large"
+	rateLimitedCode      = "rate_limited"
+	internalErrorCode    = "internal_error"
+)
+
+// setErrorResponse maps the (domain) error to a problem response. Errors which are not one of the
+// domain error types are logged and reported as a 500 without leaking their details.
+func setErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		notFoundErr     *domain.NotFoundError
+		conflictErr     *domain.ConflictError
+		validationErr   *domain.ValidationError
+		forbiddenErr    *domain.ForbiddenError
+		unauthorizedErr *domain.UnauthorizedError
+	)
+
+	switch {
+	case errors.As(err, &notFoundErr):
+		setProblem(w, r, http.StatusNotFound, notFoundCode, notFoundErr.Error())
+	case errors.As(err, &conflictErr):
+		setProblem(w, r, http.StatusConflict, conflictCode, conflictErr.Error())
+	case errors.As(err, &validationErr):
+		problem := newProblem(r, http.StatusUnprocessableEntity, validationFailedCode, "the request contains invalid fields")
+		for _, field := range validationErr.Fields {
+			problem.Errors = append(problem.Errors, ProblemFieldV1{
+				Field:   field.Field,
+				Code:    field.Code,
+				Message: field.Message,
+			})
+		}
+		writeProblem(w, problem)
+	case errors.As(err, &forbiddenErr):
+		setProblem(w, r, http.StatusForbidden, forbiddenCode, forbiddenErr.Error())
+	case errors.As(err, &unauthorizedErr):
+		setProblem(w, r, http.StatusUnauthorized, unauthorizedCode, unauthorizedErr.Error())
+	default:
+		logger.WithError(err).Errorf("unexpected error while serving %s %s", r.Method, r.URL.Path)
+		setProblem(w, r, http.StatusInternalServerError, internalErrorCode, "")
+	}
+}
+
+// setMalformedRequest is for requests which can not even be decoded
+func setMalformedRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	setProblem(w, r, http.StatusBadRequest, malformedRequestCode, detail)
+}
+
+func setProblem(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	writeProblem(w, newProblem(r, status, code, detail))
+}
+
+func newProblem(r *http.Request, status int, code string, detail string) *ProblemV1 {
+	return &ProblemV1{
+		Type:     problemTypePrefix + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	}
+}
+
+func writeProblem(w http.ResponseWriter, problem *ProblemV1) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
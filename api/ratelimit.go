@@ -0,0 +1,166 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultRateLimitPolicy is the name of the policy of the routes without their own, they share the bucket of a client
+const defaultRateLimitPolicy = "default"
+
+var rateLimitedRequestCount = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "http_rate_limited_requests_total",
+		Help: "Count of requests turned down by a rate limit, per policy.",
+	},
+	[]string{"policy"},
+)
+
+// rateLimitPolicy is a policy of the ratelimit config as a token bucket, the name is the route or "default"
+type rateLimitPolicy struct {
+	name  string
+	limit domain.RateLimit
+}
+
+// rateLimit turns a client down with a 429 once it used up the tokens of the policy of the route, see
+// RateLimitConfig. The responses tell the client where it stands in the RateLimit headers (draft-ietf-httpapi-
+// ratelimit-headers), and a 429 when to come back in Retry-After. It goes after the version middleware, the versions
+// share the buckets.
+func (ws *WebService) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy, ok := ws.rateLimitPolicy(r)
+		if !ok || ws.rateLimiter == nil || !ws.conf.RateLimit.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client, r := ws.rateLimitClient(r)
+		ctx := utils.CreateContext(r.Context())
+		result, err := ws.rateLimiter.Allow(ctx, policy.name+":"+client, policy.limit)
+		if err != nil {
+			// the API keeps working without the limits rather than going down along with the limiter
+			logger.WithError(err).Warnf("failed to check the rate limit of %s %s, letting it through", r.Method, r.URL.Path)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		burst := policy.limit.Burst
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", burst, ceilSeconds(time.Duration(burst)*policy.limit.Interval)))
+		if !result.Allowed {
+			rateLimitedRequestCount.WithLabelValues(policy.name).Inc()
+			retryAfter := ceilSeconds(result.RetryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			setProblem(w, r, http.StatusTooManyRequests, rateLimitedCode, fmt.Sprintf("too many requests, retry in %d seconds", retryAfter))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitPolicy is the policy of the route of the request, false when the route is not limited
+func (ws *WebService) rateLimitPolicy(r *http.Request) (rateLimitPolicy, bool) {
+	route := r.Method + " " + strings.TrimPrefix(routeName(r), versionPrefix(requestVersion(r)))
+	name := route
+	policy, ok := ws.conf.RateLimit.Routes[route]
+	if !ok {
+		name, policy = defaultRateLimitPolicy, ws.conf.RateLimit.Default
+	}
+	if policy.PerMinute <= 0 {
+		return rateLimitPolicy{}, false
+	}
+	burst := policy.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return rateLimitPolicy{name: name, limit: domain.RateLimit{Burst: burst, Interval: time.Minute / time.Duration(policy.PerMinute)}}, true
+}
+
+// rateLimitClient tells the clients apart, by their user when they authenticate with a token in the Authorization
+// header or the session cookie, by their service when a service calls on its own with its client certificate, which
+// is the API key of the services, and otherwise by their address. A service calling on behalf of a user counts as the
+// user. An invalid token is left to the auth of the route, which turns it down. The returned request carries the
+// outcome, so that the auth of the route does not verify the token again.
+func (ws *WebService) rateLimitClient(r *http.Request) (string, *http.Request) {
+	r, viewer, err := ws.authMiddleware.withRequestViewer(r)
+	if err != nil || viewer.IsAnonymous() {
+		return "ip:" + ws.clientIP(r), r
+	}
+	if r.Header.Get("Authorization") == "" && ws.authMiddleware.sessionCookie(r) == "" {
+		if service, ok := ws.authMiddleware.serviceName(r); ok {
+			return "service:" + service, r
+		}
+	}
+	return fmt.Sprintf("user:%d", viewer.UserID), r
+}
+
+// clientIP is the address of the client. Behind the trusted proxies it is the last address of X-Forwarded-For which
+// is not one of them, the addresses before it are whatever the client sent.
+func (ws *WebService) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ws.trustedProxy(ip) {
+		return host
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !ws.trustedProxy(ip) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+func (ws *WebService) trustedProxy(ip net.IP) bool {
+	for _, network := range ws.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses the CIDRs of the ratelimit config, a single address is a network of its own. An invalid
+// entry is logged and left out, so nobody is trusted by mistake.
+func parseTrustedProxies(cidrs []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") && strings.Contains(cidr, ":") {
+			cidr += "/128"
+		} else if !strings.Contains(cidr, "/") {
+			cidr += "/32"
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			logger.WithError(err).Errorf("ignoring the invalid trusted proxy '%s'", cidr)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// ceilSeconds rounds up, so that a client which waits as long as it is told is not turned down again
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/gateways/ratelimit"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRateLimit(t *testing.T) {
+	ws := newTestWebService()
+	ws.rateLimiter = ratelimit.NewMemoryLimiter()
+	ws.conf.RateLimit.Routes = map[string]config.RateLimitPolicy{"GET /blogs/{id}": {PerMinute: 60, Burst: 2}}
+	router := ws.router()
+	send := func(path string, remoteAddr string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		request.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	limited := testutil.ToFloat64(rateLimitedRequestCount.WithLabelValues("GET /blogs/{id}"))
+
+	// the requests fail before they get to a manager, they take a token all the same
+	for _, remaining := range []string{"1", "0"} {
+		recorder := send("/v1/blogs/x", "192.0.2.1:1234")
+		if recorder.Code != http.StatusBadRequest || recorder.Header().Get("RateLimit-Limit") != "2" ||
+			recorder.Header().Get("RateLimit-Remaining") != remaining || recorder.Header().Get("RateLimit-Policy") != "2;w=2" {
+			t.Errorf("expected the request to go through with %s remaining, got %d %v", remaining, recorder.Code, recorder.Header())
+		}
+	}
+	// the versions share the bucket
+	recorder := send("/v2/blogs/x", "192.0.2.1:1234")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "1" ||
+		!strings.Contains(recorder.Body.String(), rateLimitedCode) {
+		t.Errorf("expected a 429 after the burst, got %d %v %s", recorder.Code, recorder.Header(), recorder.Body)
+	}
+	if count := testutil.ToFloat64(rateLimitedRequestCount.WithLabelValues("GET /blogs/{id}")); count != limited+1 {
+		t.Errorf("expected the turned down request to be counted, got %v", count-limited)
+	}
+
+	if recorder := send("/v1/blogs/x", "192.0.2.2:1234"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected another client to have its own bucket, got %d", recorder.Code)
+	}
+	if recorder := send("/v1/blogs/x/comments?offset=x", "192.0.2.1:1234"); recorder.Code == http.StatusTooManyRequests ||
+		recorder.Header().Get("RateLimit-Limit") != "100" {
+		t.Errorf("expected another route to have the default policy, got %d %v", recorder.Code, recorder.Header())
+	}
+
+	ws.conf.RateLimit.Enabled = false
+	if recorder := send("/v1/blogs/x", "192.0.2.1:1234"); recorder.Code != http.StatusBadRequest || recorder.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("expected no limits when they are off, got %d %v", recorder.Code, recorder.Header())
+	}
+}
+
+func TestRateLimitClient(t *testing.T) {
+	ws := newTestWebService()
+	userID, token := testTokens(t, ws)(map[string]any{})
+	ws.conf.Server.TLS.Services = map[string]config.ServiceConfig{"indexer": {UserID: userID, Permissions: []string{utils.ReadAnyBlogPermission}}}
+	for _, test := range []struct {
+		authorization string
+		service       string // the common name of the client certificate
+		expected      string
+	}{
+		// a user is the same client wherever it connects from
+		{"Bearer " + token, "", fmt.Sprintf("user:%d", userID)},
+		{"Bearer invalid", "", "ip:192.0.2.1"},
+		{"", "", "ip:192.0.2.1"},
+		// a service has a bucket of its own, apart from the user it acts as, unless it calls on behalf of a user
+		{"", "indexer", "service:indexer"},
+		{"Bearer " + token, "indexer", fmt.Sprintf("user:%d", userID)},
+		{"", "unknown", "ip:192.0.2.1"},
+	} {
+		request := httptest.NewRequest("GET", "/v1/blogs", nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		if test.authorization != "" {
+			request.Header.Set("Authorization", test.authorization)
+		}
+		if test.service != "" {
+			request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: test.service}}}}}
+		}
+		if client, _ := ws.rateLimitClient(request); client != test.expected {
+			t.Errorf("expected %s for %q and %q, got %s", test.expected, test.authorization, test.service, client)
+		}
+	}
+
+	// the auth of the route takes the viewer the rate limit found, the token is not verified again
+	request := httptest.NewRequest("GET", "/v1/blogs", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	_, authenticated := ws.rateLimitClient(request)
+	ws.conf.Login.Secret = "rotated"
+	if _, err := ws.authMiddleware.requestViewer(request); err == nil {
+		t.Errorf("expected the token to fail with another secret")
+	}
+	if viewer, err := ws.authMiddleware.requestViewer(authenticated); err != nil || viewer.UserID != userID {
+		t.Errorf("expected the viewer of the rate limit, got %+v, %v", viewer, err)
+	}
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, limit domain.RateLimit) (domain.RateLimitResult, error) {
+	return domain.RateLimitResult{}, errors.New("redis is gone")
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	ws := newTestWebService()
+	ws.rateLimiter = failingLimiter{}
+	recorder := httptest.NewRecorder()
+	ws.router().ServeHTTP(recorder, httptest.NewRequest("GET", "/v1/blogs/x", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected the request to go through without the limiter, got %d", recorder.Code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	ws := newTestWebService()
+	ws.trustedProxies = parseTrustedProxies([]string{"10.0.0.0/8", "::1", "not an address"})
+	for _, test := range []struct {
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		// only a trusted proxy gets to say who the client is
+		{"192.0.2.1:1234", []string{"198.51.100.1"}, "192.0.2.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"[::1]:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		// the addresses before the last untrusted one are made up by the client
+		{"10.0.0.1:1234", []string{"203.0.113.7, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"203.0.113.7", "198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+	} {
+		request := httptest.NewRequest("GET", "/v1/blogs", nil)
+		request.RemoteAddr = test.remoteAddr
+		for _, forwarded := range test.forwarded {
+			request.Header.Add("X-Forwarded-For", forwarded)
+		}
+		if ip := ws.clientIP(request); ip != test.expected {
+			t.Errorf("expected %s for %s %v, got %s", test.expected, test.remoteAddr, test.forwarded, ip)
+		}
+	}
+}
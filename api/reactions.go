@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func (ws *WebService) addReactionHandler(w http.ResponseWriter, r *http.Request) {
+	reaction, err := ws.getReaction(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	counts, err := ws.reactionManager.Add(ctx, ws.getViewer(r), reaction)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, &ReactionCountsV1{Reactions: counts})
+}
+
+func (ws *WebService) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	reaction, err := ws.getReaction(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	counts, err := ws.reactionManager.Remove(ctx, ws.getViewer(r), reaction)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, &ReactionCountsV1{Reactions: counts})
+}
+
+func (ws *WebService) listReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	blogID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+	offset, limit, err := getPage(r)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	reactions, err := ws.reactionManager.List(ctx, ws.getViewer(r), blogID, r.URL.Query().Get("type"), offset, limit)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, convertReactionsDomainObjToAPI(reactions))
+}
+
+// getReaction reads the blog id and the reaction type from the path, the user from the token
+func (ws *WebService) getReaction(r *http.Request) (*domain.Reaction, error) {
+	blogID, err := ws.getID(r)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Reaction{
+		BlogID: blogID,
+		UserID: ws.getUserID(r),
+		Type:   mux.Vars(r)["type"],
+	}, nil
+}
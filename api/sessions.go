@@ -0,0 +1,141 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+/*
+The browser apps can log in with a cookie session rather than keep the token where their scripts (and anybody who
+manages to inject one) can read it. The token goes into the HttpOnly session cookie, which the AuthMiddleware takes
+when a request has no Authorization header.
+
+A browser sends the cookie along with the requests other sites make, so the requests which change something also have
+to carry the CSRF token of the session in the X-CSRF-Token header (double submit): it is in the CSRF cookie, which the
+pages of the API's site can read, and in the response of the login for the apps of the allowed origins. The token is an
+HMAC of the session, a CSRF cookie planted by somebody else does not match.
+*/
+
+const (
+	sessionCookieName = "blogzilla_session"
+	csrfCookieName    = "blogzilla_csrf"
+	csrfHeader        = "X-CSRF-Token"
+)
+
+// createSessionHandler logs the user in like the login, but into the cookies
+func (ws *WebService) createSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if !ws.conf.Sessions.Enabled {
+		setProblem(w, r, http.StatusNotFound, notFoundCode, "the cookie sessions are turned off")
+		return
+	}
+	var request LoginRequestV1
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	token, err := ws.userManager.Login(ctx, request.Username, request.Password)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+
+	// the cookies go when the token expires
+	maxAge := ws.conf.Login.Expiry * 60
+	csrf := csrfToken(ws.conf.Login.Secret, token)
+	http.SetCookie(w, ws.newCookie(sessionCookieName, token, maxAge, true))
+	http.SetCookie(w, ws.newCookie(csrfCookieName, csrf, maxAge, false))
+	ws.setResponse(w, http.StatusOK, &SessionResponseV1{CSRFToken: csrf})
+}
+
+// getSessionHandler hands the CSRF token of the session out again, e.g. to an app which was reloaded
+func (ws *WebService) getSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if !ws.conf.Sessions.Enabled {
+		setProblem(w, r, http.StatusNotFound, notFoundCode, "the cookie sessions are turned off")
+		return
+	}
+	session := ws.authMiddleware.sessionCookie(r)
+	if session == "" {
+		setErrorResponse(w, r, domain.NewUnauthorizedError("missing session cookie"))
+		return
+	}
+	// the session has to be valid still, whatever the Authorization header says
+	if _, err := ws.authMiddleware.authManager.Authenticate(r.Context(), session); err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setResponse(w, http.StatusOK, &SessionResponseV1{CSRFToken: csrfToken(ws.conf.Login.Secret, session)})
+}
+
+// deleteSessionHandler logs out by dropping the cookies. The token in the cookie stays valid until it expires, like
+// any other token.
+func (ws *WebService) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if !ws.conf.Sessions.Enabled {
+		setProblem(w, r, http.StatusNotFound, notFoundCode, "the cookie sessions are turned off")
+		return
+	}
+	http.SetCookie(w, ws.newCookie(sessionCookieName, "", -1, true))
+	http.SetCookie(w, ws.newCookie(csrfCookieName, "", -1, false))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newCookie is a cookie of the session, a negative maxAge deletes it
+func (ws *WebService) newCookie(name string, value string, maxAge int, httpOnly bool) *http.Cookie {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(ws.conf.Sessions.SameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   ws.conf.Sessions.Secure,
+		SameSite: sameSite,
+	}
+}
+
+// sessionCookie is the token in the session cookie, empty when there is none or the cookie sessions are off
+func (am *AuthMiddleware) sessionCookie(r *http.Request) string {
+	if !am.conf.Sessions.Enabled {
+		return ""
+	}
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// checkCSRF a request made with the session cookie which may change something has to send the CSRF token of the
+// session in the header and in the cookie
+func (am *AuthMiddleware) checkCSRF(r *http.Request, session string) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	header := r.Header.Get(csrfHeader)
+	cookie, err := r.Cookie(csrfCookieName)
+	expected := csrfToken(am.conf.Login.Secret, session)
+	if header == "" || err != nil || !hmac.Equal([]byte(header), []byte(cookie.Value)) || !hmac.Equal([]byte(header), []byte(expected)) {
+		return domain.NewForbiddenError("missing or invalid CSRF token, send the one of the session in the " + csrfHeader + " header")
+	}
+	return nil
+}
+
+// csrfToken is the CSRF token of the session, only the server can make it
+func csrfToken(secret string, session string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("csrf\n" + session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+func TestSessionCookieAuth(t *testing.T) {
+	ws := newTestWebService()
+	ws.conf.Sessions.Enabled = true
+	_, token := testTokens(t, ws)(map[string]any{utils.CreateBlogPermission: true})
+	csrf := csrfToken(ws.conf.Login.Secret, token)
+	handler := ws.authMiddleware.authorize(utils.CreateBlogPermission, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, test := range []struct {
+		name       string
+		method     string
+		session    string
+		csrfCookie string
+		csrfHeader string
+		expected   int
+	}{
+		{"a read needs no CSRF token", "GET", token, "", "", http.StatusNoContent},
+		{"a change needs the CSRF token", "POST", token, csrf, csrf, http.StatusNoContent},
+		{"no CSRF token", "POST", token, "", "", http.StatusForbidden},
+		{"only the CSRF cookie", "POST", token, csrf, "", http.StatusForbidden},
+		{"only the CSRF header", "POST", token, "", csrf, http.StatusForbidden},
+		// a CSRF cookie planted by another site does not match the session
+		{"a planted CSRF token", "POST", token, "planted", "planted", http.StatusForbidden},
+		{"the CSRF token of another session", "POST", token, csrfToken(ws.conf.Login.Secret, "other"), csrfToken(ws.conf.Login.Secret, "other"), http.StatusForbidden},
+		{"an invalid session", "POST", "invalid", csrf, csrf, http.StatusUnauthorized},
+		{"no session", "POST", "", csrf, csrf, http.StatusUnauthorized},
+	} {
+		request := httptest.NewRequest(test.method, "/v2/blogs", nil)
+		if test.session != "" {
+			request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: test.session})
+		}
+		if test.csrfCookie != "" {
+			request.AddCookie(&http.Cookie{Name: csrfCookieName, Value: test.csrfCookie})
+		}
+		if test.csrfHeader != "" {
+			request.Header.Set(csrfHeader, test.csrfHeader)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d %s", test.name, test.expected, recorder.Code, recorder.Body)
+		}
+	}
+
+	// the Authorization header needs no CSRF token, other sites can not make the browser send it
+	request := httptest.NewRequest("POST", "/v2/blogs", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "invalid"})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("expected the Authorization header to win over the cookie, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	// the cookie is ignored when the sessions are off
+	ws.conf.Sessions.Enabled = false
+	request = httptest.NewRequest("GET", "/v2/blogs", nil)
+	request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected the cookie to be ignored, got %d", recorder.Code)
+	}
+}
+
+func TestSessionHandlers(t *testing.T) {
+	ws := newTestWebService()
+	newToken := testTokens(t, ws)
+	router := ws.router()
+	send := func(method string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/v2/sessions", nil)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for _, method := range []string{"POST", "GET", "DELETE"} {
+		if recorder := send(method); recorder.Code != http.StatusNotFound {
+			t.Errorf("expected %s to be not found while the sessions are off, got %d", method, recorder.Code)
+		}
+	}
+
+	ws.conf.Sessions.Enabled = true
+	ws.conf.Sessions.SameSite = "strict"
+	_, token := newToken(map[string]any{})
+	recorder := send("GET", &http.Cookie{Name: sessionCookieName, Value: token})
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"csrfToken":"`+csrfToken(ws.conf.Login.Secret, token)+`"}`+"\n" {
+		t.Errorf("expected the CSRF token of the session, got %d %s", recorder.Code, recorder.Body)
+	}
+	for _, cookies := range [][]*http.Cookie{nil, {{Name: sessionCookieName, Value: "invalid"}}} {
+		if recorder := send("GET", cookies...); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("expected a 401 without a valid session, got %d", recorder.Code)
+		}
+	}
+
+	recorder = send("DELETE")
+	cookies := recorder.Result().Cookies()
+	if recorder.Code != http.StatusNoContent || len(cookies) != 2 {
+		t.Fatalf("expected both cookies to be dropped, got %d %v", recorder.Code, cookies)
+	}
+	for _, cookie := range cookies {
+		if cookie.MaxAge != -1 || cookie.Path != "/" || !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode ||
+			cookie.HttpOnly != (cookie.Name == sessionCookieName) {
+			t.Errorf("expected the cookie to be dropped with the attributes it was set with, got %+v", cookie)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/usecases"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	rssFormat  = "rss"
+	atomFormat = "atom"
+	jsonFormat = "json"
+)
+
+// the documents of the three feed formats, only the elements we fill in are declared
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	Self          atomLink   `xml:"atom:link"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	Creator     string   `xml:"dc:creator"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Links   []atomLink   `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomPerson     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type jsonFeed struct {
+	Version     string          `json:"version"`
+	Title       string          `json:"title"`
+	HomePageURL string          `json:"home_page_url"`
+	FeedURL     string          `json:"feed_url"`
+	Items       []*jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string            `json:"id"`
+	URL           string            `json:"url"`
+	Title         string            `json:"title"`
+	ContentHTML   string            `json:"content_html"`
+	DatePublished string            `json:"date_published"`
+	DateModified  string            `json:"date_modified"`
+	Authors       []*jsonFeedAuthor `json:"authors"`
+	Tags          []string          `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func (ws *WebService) siteFeedHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := utils.CreateContext(r.Context())
+	feed, err := ws.syndicationManager.SiteFeed(ctx)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setFeedResponse(w, r, feed)
+}
+
+func (ws *WebService) authorFeedHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := ws.getID(r)
+	if err != nil {
+		setMalformedRequest(w, r, err.Error())
+		return
+	}
+
+	ctx := utils.CreateContext(r.Context())
+	feed, err := ws.syndicationManager.AuthorFeed(ctx, userID)
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setFeedResponse(w, r, feed)
+}
+
+func (ws *WebService) tagFeedHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := utils.CreateContext(r.Context())
+	feed, err := ws.syndicationManager.TagFeed(ctx, mux.Vars(r)["tag"])
+	if err != nil {
+		setErrorResponse(w, r, err)
+		return
+	}
+	ws.setFeedResponse(w, r, feed)
+}
+
+// setFeedResponse renders the feed in the format of the route, or answers 304 when the client's copy is current
+func (ws *WebService) setFeedResponse(w http.ResponseWriter, r *http.Request, feed *usecases.SyndicationFeed) {
+	format := mux.Vars(r)["format"]
+	etag := feedETag(format, feed)
+	w.Header().Set("ETag", etag)
+	if !feed.Updated.IsZero() {
+		w.Header().Set("Last-Modified", feed.Updated.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, etag, feed.Updated) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	baseURL := strings.TrimSuffix(ws.conf.Syndication.BaseURL, "/")
+	selfURL := baseURL + r.URL.Path
+	var err error
+	switch format {
+	case rssFormat:
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		err = writeXML(w, newRSSFeed(feed, baseURL, selfURL))
+	case atomFormat:
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		err = writeXML(w, newAtomFeed(feed, baseURL, selfURL))
+	case jsonFormat:
+		w.Header().Set("Content-Type", "application/feed+json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(newJSONFeed(feed, baseURL, selfURL))
+	}
+	if err != nil {
+		logger.WithError(err).Errorf("failed to write the %s feed", format)
+	}
+}
+
+// feedETag is a weak validator, the feed changes whenever one of its items is added, removed or updated
+func feedETag(format string, feed *usecases.SyndicationFeed) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n", format, feed.Title)
+	for _, item := range feed.Items {
+		fmt.Fprintf(hash, "%d %d\n", item.Blog.ID, item.Blog.UpdatedAt.UnixNano())
+	}
+	return `W/"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// notModified follows RFC 9110, If-None-Match wins over If-Modified-Since when both are sent
+func notModified(r *http.Request, etag string, updated time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// the weak comparison ignores the W/ prefix
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if updated.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// Last-Modified has a precision of a second
+	return !updated.Truncate(time.Second).After(since)
+}
+
+func writeXML(w http.ResponseWriter, document any) error {
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(document)
+}
+
+func newRSSFeed(feed *usecases.SyndicationFeed, baseURL string, selfURL string) *rssFeed {
+	document := &rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       feed.Title,
+			Link:        baseURL,
+			Description: feed.Title,
+			Self:        atomLink{Href: selfURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if !feed.Updated.IsZero() {
+		document.Channel.LastBuildDate = feed.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, item := range feed.Items {
+		document.Channel.Items = append(document.Channel.Items, &rssItem{
+			Title:       item.Blog.Title,
+			Link:        blogLink(baseURL, item.Blog),
+			GUID:        rssGUID{IsPermaLink: true, Value: blogURL(baseURL, item.Blog.ID)},
+			Creator:     item.AuthorName,
+			PubDate:     item.Blog.CreatedAt.UTC().Format(time.RFC1123Z),
+			Categories:  splitTags(item.Blog.Tags),
+			Description: item.Blog.ContentHTML,
+		})
+	}
+	return document
+}
+
+func newAtomFeed(feed *usecases.SyndicationFeed, baseURL string, selfURL string) *atomFeed {
+	// the updated element is required, an empty feed has never been updated
+	updated := feed.Updated
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+	document := &atomFeed{
+		Title:   feed.Title,
+		ID:      selfURL,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: selfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: baseURL, Rel: "alternate"},
+		},
+	}
+	for _, item := range feed.Items {
+		entry := &atomEntry{
+			Title:     item.Blog.Title,
+			ID:        blogURL(baseURL, item.Blog.ID),
+			Link:      atomLink{Href: blogLink(baseURL, item.Blog), Rel: "alternate"},
+			Published: item.Blog.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   item.Blog.UpdatedAt.UTC().Format(time.RFC3339),
+			Author:    atomPerson{Name: item.AuthorName},
+			Content:   atomContent{Type: "html", Value: item.Blog.ContentHTML},
+		}
+		for _, tag := range splitTags(item.Blog.Tags) {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		document.Entries = append(document.Entries, entry)
+	}
+	return document
+}
+
+func newJSONFeed(feed *usecases.SyndicationFeed, baseURL string, selfURL string) *jsonFeed {
+	document := &jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: baseURL,
+		FeedURL:     selfURL,
+		// an empty feed has an empty list rather than null
+		Items: []*jsonFeedItem{},
+	}
+	for _, item := range feed.Items {
+		document.Items = append(document.Items, &jsonFeedItem{
+			ID:            blogURL(baseURL, item.Blog.ID),
+			URL:           blogLink(baseURL, item.Blog),
+			Title:         item.Blog.Title,
+			ContentHTML:   item.Blog.ContentHTML,
+			DatePublished: item.Blog.CreatedAt.UTC().Format(time.RFC3339),
+			DateModified:  item.Blog.UpdatedAt.UTC().Format(time.RFC3339),
+			Authors:       []*jsonFeedAuthor{{Name: item.AuthorName}},
+			Tags:          splitTags(item.Blog.Tags),
+		})
+	}
+	return document
+}
+
+// blogURL is the permanent identifier of the blog in the feeds, unlike its slug it never changes. It stays under v1,
+// the feed readers would otherwise see every blog as a new one.
+func blogURL(baseURL string, blogID int64) string {
+	return fmt.Sprintf("%s/v1/blogs/%d", baseURL, blogID)
+}
+
+// blogLink is the link the readers follow in the latest version of the API, by the slug when the blog has one
+func blogLink(baseURL string, blog *domain.Blog) string {
+	if blog.Slug == "" {
+		return fmt.Sprintf("%s%s/blogs/%d", baseURL, versionPrefix(latestVersion), blog.ID)
+	}
+	return baseURL + versionPrefix(latestVersion) + "/blogs/by-slug/" + url.PathEscape(blog.Slug)
+}
+
+func splitTags(tags string) []string {
+	var split []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			split = append(split, tag)
+		}
+	}
+	return split
+}
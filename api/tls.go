@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var certificateExpiry = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "tls_certificate_expiry_timestamp_seconds",
+		Help: "When the served TLS certificate expires, in seconds since the epoch.",
+	},
+)
+
+// newServer is the server of the handler, with TLS when it is enabled. The certReloader, nil without TLS, has to
+// watch the certificate files for the server to pick up the new certificates.
+func (ws *WebService) newServer(handler http.Handler) (*http.Server, *certReloader, error) {
+	server := &http.Server{Addr: fmt.Sprintf(":%d", ws.conf.Server.Port), Handler: handler}
+	conf := ws.conf.Server.TLS
+	if !conf.Enabled {
+		return server, nil, nil
+	}
+
+	reloader, err := newCertReloader(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	server.TLSConfig, err = reloader.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !conf.HTTP2 {
+		// a map which is not nil keeps the server from setting up HTTP/2
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return server, reloader, nil
+}
+
+/*
+certReloader keeps the certificate and the client CAs of the TLS config and reads their files again when they change,
+so that the certificates of an internal CA, which live for hours or days, are renewed without a restart. The files are
+polled rather than watched, which also sees the files of a Kubernetes secret being swapped behind their symlinks.
+
+The handshakes which are under way keep the certificate they started with, the new one is used from the next
+handshake on.
+*/
+type certReloader struct {
+	conf config.TLSConfig
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	// stamp is the size and the modification time of the files the certificate and the CAs were read from
+	stamp string
+}
+
+func newCertReloader(conf config.TLSConfig) (*certReloader, error) {
+	reloader := &certReloader{conf: conf}
+	if _, err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// reload reads the files again when they changed since the last time, true when it did. A failed read, e.g. of a
+// certificate whose key is not written yet, keeps the current certificate and is tried again the next time.
+func (c *certReloader) reload() (bool, error) {
+	stamp, err := c.fileStamp()
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := stamp == c.stamp
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.conf.CertFile, c.conf.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load the certificate %s: %w", c.conf.CertFile, err)
+	}
+	certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse the certificate %s: %w", c.conf.CertFile, err)
+	}
+	var clientCAs *x509.CertPool
+	if c.conf.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.conf.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("failed to read the client CAs: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("no certificates in the client CA file %s", c.conf.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	c.certificate, c.clientCAs, c.stamp = &certificate, clientCAs, stamp
+	c.mu.Unlock()
+	certificateExpiry.Set(float64(certificate.Leaf.NotAfter.Unix()))
+	return true, nil
+}
+
+func (c *certReloader) fileStamp() (string, error) {
+	var stamp strings.Builder
+	for _, file := range []string{c.conf.CertFile, c.conf.KeyFile, c.conf.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the TLS file: %w", err)
+		}
+		fmt.Fprintf(&stamp, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp.String(), nil
+}
+
+// watch reloads the files every ReloadSeconds until the context is done
+func (c *certReloader) watch(ctx context.Context) {
+	if c.conf.ReloadSeconds <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(c.conf.ReloadSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.reload()
+			if err != nil {
+				logger.WithError(err).Error("failed to reload the TLS certificate, keeping the current one")
+			} else if reloaded {
+				logger.Infof("reloaded the TLS certificate, it expires at %s", c.current().Leaf.NotAfter.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+func (c *certReloader) current() *tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.certificate
+}
+
+// tlsConfig is the TLS config of the server. Every handshake gets the current certificate and client CAs.
+func (c *certReloader) tlsConfig() (*tls.Config, error) {
+	minVersion, err := tlsVersion(c.conf.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := cipherSuites(c.conf.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := clientAuthType(c.conf.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if clientAuth != tls.NoClientCert && c.conf.ClientCAFile == "" {
+		return nil, fmt.Errorf("the client auth '%s' needs the client CA file", c.conf.ClientAuth)
+	}
+
+	template := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+		ClientAuth:   clientAuth,
+		NextProtos:   []string{"http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return c.current(), nil
+		},
+	}
+	if c.conf.HTTP2 {
+		template.NextProtos = []string{"h2", "http/1.1"}
+	}
+	// the client CAs can only be swapped with the whole config
+	server := template.Clone()
+	server.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		config := template.Clone()
+		c.mu.RLock()
+		config.ClientCAs = c.clientCAs
+		c.mu.RUnlock()
+		return config, nil
+	}
+	return server, nil
+}
+
+func tlsVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported minimum TLS version '%s', use 1.2 or 1.3", version)
+}
+
+// cipherSuites are the TLS 1.2 cipher suites of the names, nil leaves them to Go. Only the suites Go considers secure
+// are accepted.
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	secure := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := secure[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite '%s'", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func clientAuthType(clientAuth string) (tls.ClientAuthType, error) {
+	switch clientAuth {
+	case "", config.NoClientAuth:
+		return tls.NoClientCert, nil
+	case config.OptionalClientAuth:
+		return tls.VerifyClientCertIfGiven, nil
+	case config.RequireClientAuth:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return 0, fmt.Errorf("unsupported client auth '%s', use none, optional or require", clientAuth)
+}
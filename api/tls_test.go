@@ -0,0 +1,249 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+// testCA issues the certificates of the tests
+type testCA struct {
+	t           *testing.T
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	serial      int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	ca := &testCA{t: t}
+	ca.certificate, ca.key = ca.issue(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	return ca
+}
+
+// issue signs the template with the CA, or with its own key while there is no CA
+func (ca *testCA) issue(template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		ca.t.Fatalf("failed to generate a key: %v", err)
+	}
+	ca.serial++
+	template.SerialNumber = big.NewInt(ca.serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, signer := template, key
+	if ca.certificate != nil {
+		parent, signer = ca.certificate, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		ca.t.Fatalf("failed to create a certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		ca.t.Fatalf("failed to parse the certificate: %v", err)
+	}
+	return certificate, key
+}
+
+func (ca *testCA) serverCertificate() (*x509.Certificate, *ecdsa.PrivateKey) {
+	return ca.issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+}
+
+func (ca *testCA) clientCertificate(name string) tls.Certificate {
+	certificate, key := ca.issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return tls.Certificate{Certificate: [][]byte{certificate.Raw}, PrivateKey: key}
+}
+
+// writePEM writes the certificate and the key, with a modification time of its own so that the change is seen
+func writePEM(t *testing.T, certFile string, keyFile string, certificate *x509.Certificate, key *ecdsa.PrivateKey, modified time.Time) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal the key: %v", err)
+	}
+	files := map[string][]byte{
+		certFile: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}),
+		keyFile:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+	}
+	for file, content := range files {
+		if err := os.WriteFile(file, content, 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", file, err)
+		}
+		if err := os.Chtimes(file, modified, modified); err != nil {
+			t.Fatalf("failed to touch %s: %v", file, err)
+		}
+	}
+}
+
+func newTestTLSConfig(t *testing.T, ca *testCA) config.TLSConfig {
+	dir := t.TempDir()
+	conf := config.TLSConfig{
+		Enabled:      true,
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		MinVersion:   "1.2",
+		HTTP2:        true,
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	certificate, key := ca.serverCertificate()
+	writePEM(t, conf.CertFile, conf.KeyFile, certificate, key, time.Now().Add(-time.Minute))
+	if err := os.WriteFile(conf.ClientCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw}), 0600); err != nil {
+		t.Fatalf("failed to write the CA: %v", err)
+	}
+	return conf
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t)
+	conf := newTestTLSConfig(t, ca)
+	reloader, err := newCertReloader(conf)
+	if err != nil {
+		t.Fatalf("failed to load the certificate: %v", err)
+	}
+	first := reloader.current().Leaf.SerialNumber
+	if reloaded, err := reloader.reload(); reloaded || err != nil {
+		t.Errorf("expected nothing to reload, got %v %v", reloaded, err)
+	}
+
+	// a renewed certificate is picked up
+	certificate, key := ca.serverCertificate()
+	writePEM(t, conf.CertFile, conf.KeyFile, certificate, key, time.Now())
+	if reloaded, err := reloader.reload(); !reloaded || err != nil {
+		t.Fatalf("expected the new certificate to be loaded, got %v %v", reloaded, err)
+	}
+	if serial := reloader.current().Leaf.SerialNumber; serial.Cmp(first) == 0 || serial.Cmp(certificate.SerialNumber) != 0 {
+		t.Errorf("expected the new certificate, got the serial %v", serial)
+	}
+	tlsConfig, err := reloader.tlsConfig()
+	if err != nil {
+		t.Fatalf("failed to get the TLS config: %v", err)
+	}
+	served, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || served.Leaf.SerialNumber.Cmp(certificate.SerialNumber) != 0 {
+		t.Errorf("expected the handshakes to get the new certificate, got %v", err)
+	}
+
+	// a certificate whose key is not written yet keeps the current one, it is tried again the next time
+	other, _ := ca.serverCertificate()
+	writePEM(t, conf.CertFile, filepath.Join(t.TempDir(), "other.key"), other, key, time.Now().Add(time.Minute))
+	if reloaded, err := reloader.reload(); reloaded || err == nil {
+		t.Errorf("expected the mismatched key to fail, got %v %v", reloaded, err)
+	}
+	if serial := reloader.current().Leaf.SerialNumber; serial.Cmp(certificate.SerialNumber) != 0 {
+		t.Errorf("expected the current certificate to be kept, got the serial %v", serial)
+	}
+	if _, err := reloader.reload(); err == nil {
+		t.Errorf("expected the mismatched key to be tried again")
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	for _, test := range []struct {
+		name   string
+		change func(conf *config.TLSConfig)
+		valid  bool
+	}{
+		{"the defaults", func(conf *config.TLSConfig) {}, true},
+		{"TLS 1.3", func(conf *config.TLSConfig) { conf.MinVersion = "1.3" }, true},
+		{"TLS 1.1", func(conf *config.TLSConfig) { conf.MinVersion = "1.1" }, false},
+		{"a cipher suite", func(conf *config.TLSConfig) {
+			conf.CipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+		}, true},
+		{"an insecure cipher suite", func(conf *config.TLSConfig) { conf.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"} }, false},
+		{"the required client auth", func(conf *config.TLSConfig) { conf.ClientAuth = config.RequireClientAuth }, true},
+		{"an unknown client auth", func(conf *config.TLSConfig) { conf.ClientAuth = "maybe" }, false},
+		{"the client auth without CAs", func(conf *config.TLSConfig) {
+			conf.ClientAuth, conf.ClientCAFile = config.OptionalClientAuth, ""
+		}, false},
+	} {
+		conf := newTestTLSConfig(t, ca)
+		test.change(&conf)
+		reloader, err := newCertReloader(conf)
+		if err != nil {
+			t.Fatalf("%s: failed to load the certificate: %v", test.name, err)
+		}
+		if _, err := reloader.tlsConfig(); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestTLSServer(t *testing.T) {
+	ca := newTestCA(t)
+	ws := newTestWebService()
+	ws.conf.Server.TLS = newTestTLSConfig(t, ca)
+	ws.conf.Server.TLS.ClientAuth = config.OptionalClientAuth
+	ws.conf.Server.TLS.Services = map[string]config.ServiceConfig{"indexer": {UserID: 7, Permissions: []string{utils.ReadAnyBlogPermission}}}
+	handler := ws.authMiddleware.authorize(utils.ReadAnyBlogPermission, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-User-Id", strconv.FormatInt(r.Context().Value("viewer").(*domain.Viewer).UserID, 10))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	server, reloader, err := ws.newServer(handler)
+	if err != nil || reloader == nil {
+		t.Fatalf("failed to create the server: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	send := func(certificates ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certificates},
+			ForceAttemptHTTP2: true,
+		}}
+		response, err := client.Get("https://" + listener.Addr().String() + "/v2/blogs")
+		if err == nil {
+			response.Body.Close()
+		}
+		return response, err
+	}
+
+	response, err := send(ca.clientCertificate("indexer"))
+	if err != nil || response.StatusCode != http.StatusNoContent || response.ProtoMajor != 2 || response.Header.Get("X-User-Id") != "7" {
+		t.Fatalf("expected the service to be let in over HTTP/2, got %+v %v", response, err)
+	}
+	for _, certificates := range [][]tls.Certificate{nil, {ca.clientCertificate("unknown")}} {
+		if response, err := send(certificates...); err != nil || response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected a 401 without the certificate of a service, got %+v %v", response, err)
+		}
+	}
+	// a certificate of another CA does not get through the handshake
+	if _, err := send(newTestCA(t).clientCertificate("indexer")); err == nil {
+		t.Errorf("expected the certificate of another CA to be turned down")
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/gateways/memory"
+	"github.com/bipuldutta/blogzilla/usecases"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	spansOnce sync.Once
+	spans     *tracetest.InMemoryExporter
+)
+
+// recordSpans installs a tracer provider which keeps the spans in memory. The global tracer sticks to the first
+// provider installed, so every test of the package shares the one exporter and starts with it emptied.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	spansOnce.Do(func() {
+		spans = utils.NewInMemoryExporter()
+		otel.SetTracerProvider(utils.NewTracerProvider(config.TracingConfig{SampleRatio: 1}, spans, true))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	spans.Reset()
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	ctx := context.Background()
+	ws := newTestWebService()
+	ws.conf.DefaultUser.Password = "admin"
+	store := memory.NewStore()
+	authRepo := memory.NewAuthRepo(ws.conf)
+	userRepo := memory.NewUserRepo(store, authRepo)
+	err := usecases.NewDatabaseManager(ws.conf, memory.NewTxManager(store), memory.NewDatabaseRepo(ws.conf, store), userRepo).Initialize(ctx)
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	ws.userManager = usecases.NewUserManager(memory.NewTxManager(store), userRepo)
+	router := ws.router()
+	exporter := recordSpans(t)
+
+	// the caller's trace is joined
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	body := `{"username": "` + ws.conf.DefaultUser.Username + `", "password": "` + ws.conf.DefaultUser.Password + `"}`
+	request := httptest.NewRequest("POST", "/v1/login", strings.NewReader(body))
+	request.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected to log in, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	ended := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		ended[span.Name] = span
+	}
+	route, ok := ended["POST /v1/login"]
+	if !ok || route.SpanKind != trace.SpanKindServer || route.SpanContext.TraceID().String() != traceID ||
+		route.Parent.SpanID().String() != parentID || !route.Parent.IsRemote() {
+		t.Fatalf("expected the span of the route in the caller's trace, got %+v", exporter.GetSpans())
+	}
+	login, ok := ended["UserManager.Login"]
+	if !ok || login.Parent.SpanID() != route.SpanContext.SpanID() || login.SpanContext.TraceID() != route.SpanContext.TraceID() {
+		t.Errorf("expected the span of the use case under the one of the route, got %+v", login)
+	}
+	if bcrypt, ok := ended["bcrypt.CompareHashAndPassword"]; !ok || bcrypt.Parent.SpanID() != login.SpanContext.SpanID() {
+		t.Errorf("expected the span of the password check under the one of the use case, got %+v", bcrypt)
+	}
+	for _, attribute := range route.Attributes {
+		if attribute.Key == "http.status_code" && attribute.Value.AsInt64() != http.StatusOK {
+			t.Errorf("expected the status code on the span of the route, got %v", attribute.Value.Emit())
+		}
+	}
+
+	// without a caller's trace the span of the route starts one
+	exporter.Reset()
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/v2/login", strings.NewReader(`{"username": "nobody", "password": "secret"}`)))
+	ended = map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		ended[span.Name] = span
+	}
+	if route, ok := ended["POST /v2/login"]; !ok || route.Parent.IsValid() || recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected a new trace for the route, got %d %+v", recorder.Code, exporter.GetSpans())
+	}
+	if login, ok := ended["UserManager.Login"]; !ok || login.Status.Code.String() != "Error" {
+		t.Errorf("expected the failed login to be marked on the span of the use case, got %+v", login)
+	}
+}
@@ -5,26 +5,31 @@ import (
 )
 
 type LoginRequestV1 struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required,max=100"`
+	Password string `json:"password" validate:"required,max=100"`
 }
 
 type LoginResponseV1 struct {
 	Token string `json:"token"`
 }
 
+// SessionResponseV1 the token goes into the session cookie, the CSRF token has to be sent in the X-CSRF-Token header
+type SessionResponseV1 struct {
+	CSRFToken string `json:"csrfToken"`
+}
+
 type CreateUserRequestV1 struct {
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
+	Username  string `json:"username" validate:"required,min=3,max=30,pattern=username"`
+	Password  string `json:"password" validate:"required,min=8,max=72"`
+	FirstName string `json:"firstName" validate:"required,max=50"`
+	LastName  string `json:"lastName" validate:"required,max=50"`
 }
 
 type UpdateUserRequestV1 struct {
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
+	Username  string `json:"username" validate:"min=3,max=30,pattern=username"`
+	Password  string `json:"password" validate:"min=8,max=72"`
+	FirstName string `json:"firstName" validate:"max=50"`
+	LastName  string `json:"lastName" validate:"max=50"`
 }
 
 type UserResponseV1 struct {
@@ -36,34 +41,226 @@ type UserResponseV1 struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// CreateBlogRequestV1 ContentFormat is markdown, html or plaintext (the default). Visibility is public, unlisted,
+// members-only (the default) or private.
 type CreateBlogRequestV1 struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Tags    string `json:"tags"`
+	Title         string `json:"title" validate:"required,max=200"`
+	Content       string `json:"content" validate:"required,max=100000"`
+	ContentFormat string `json:"contentFormat" validate:"oneof=markdown html plaintext"`
+	Tags          string `json:"tags" validate:"max=500"`
+	Visibility    string `json:"visibility" validate:"oneof=public unlisted members-only private"`
 }
 
 type CreateBlogResponseV1 struct {
 	ID int64 `json:"id"`
 }
 
+// UpdateBlogRequestV1 an empty ContentFormat or Visibility leaves the format or the visibility of the blog as it is
 type UpdateBlogRequestV1 struct {
-	ID      int64    `json:"id"`
-	Title   string   `json:"title"`
-	Content string   `json:"content"`
-	Tags    []string `json:"tags"`
+	ID            int64    `json:"id" validate:"required,min=1"`
+	Title         string   `json:"title" validate:"required,max=200"`
+	Content       string   `json:"content" validate:"required,max=100000"`
+	ContentFormat string   `json:"contentFormat" validate:"oneof=markdown html plaintext"`
+	Tags          []string `json:"tags" validate:"max=20,dive,required,max=50,pattern=tag"`
+	Visibility    string   `json:"visibility" validate:"oneof=public unlisted members-only private"`
 }
 
+// BlogResponseV1 Reactions is reaction type -> count, only the types with at least one reaction are present. Creator
+// is left out when the author no longer exists.
 type BlogResponseV1 struct {
-	ID        int64          `json:"id"`
-	Creator   *BlogCreatorV1 `json:"creator"`
-	Title     string         `json:"title"`
-	Content   string         `json:"content"`
-	Tags      string         `json:"tags"`
-	CreatedAt time.Time      `json:"createdAt"`
-	UpdatedAt time.Time      `json:"updatedAt"`
+	ID              int64            `json:"id"`
+	UserID          int64            `json:"userId"`
+	Creator         *BlogCreatorV1   `json:"creator,omitempty"`
+	Title           string           `json:"title"`
+	Slug            string           `json:"slug"`
+	Content         string           `json:"content"`
+	ContentFormat   string           `json:"contentFormat"`
+	ContentHTML     string           `json:"contentHtml"` // the content rendered to sanitized HTML
+	Tags            string           `json:"tags"`
+	CommentsEnabled bool             `json:"commentsEnabled"`
+	Visibility      string           `json:"visibility"`
+	Reactions       map[string]int64 `json:"reactions"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt"`
 }
 
 type BlogCreatorV1 struct {
+	Username  string `json:"username"`
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
 }
+
+// BlogListResponseV1 is a page of blogs along with where it is in the whole list
+type BlogListResponseV1 struct {
+	Blogs      []*BlogResponseV1 `json:"blogs"`
+	Pagination *PaginationV1     `json:"pagination"`
+}
+
+// CreateBlogRequestV2 is CreateBlogRequestV1 with the tags as a list, Status is draft or published (the default). A
+// draft is only readable by its author.
+type CreateBlogRequestV2 struct {
+	Title         string   `json:"title" validate:"required,max=200"`
+	Content       string   `json:"content" validate:"required,max=100000"`
+	ContentFormat string   `json:"contentFormat" validate:"oneof=markdown html plaintext"`
+	Tags          []string `json:"tags" validate:"max=20,dive,required,max=50,pattern=tag"`
+	Visibility    string   `json:"visibility" validate:"oneof=public unlisted members-only private"`
+	Status        string   `json:"status" validate:"oneof=draft published"`
+}
+
+// UpdateBlogRequestV2 an empty ContentFormat, Visibility or Status leaves the format, the visibility or the status of
+// the blog as it is
+type UpdateBlogRequestV2 struct {
+	ID            int64    `json:"id" validate:"required,min=1"`
+	Title         string   `json:"title" validate:"required,max=200"`
+	Content       string   `json:"content" validate:"required,max=100000"`
+	ContentFormat string   `json:"contentFormat" validate:"oneof=markdown html plaintext"`
+	Tags          []string `json:"tags" validate:"max=20,dive,required,max=50,pattern=tag"`
+	Visibility    string   `json:"visibility" validate:"oneof=public unlisted members-only private"`
+	Status        string   `json:"status" validate:"oneof=draft published"`
+}
+
+// BlogResponseV2 is BlogResponseV1 with the tags as a list and the status of the blog
+type BlogResponseV2 struct {
+	ID              int64            `json:"id"`
+	UserID          int64            `json:"userId"`
+	Creator         *BlogCreatorV1   `json:"creator,omitempty"`
+	Title           string           `json:"title"`
+	Slug            string           `json:"slug"`
+	Status          string           `json:"status"`
+	Content         string           `json:"content"`
+	ContentFormat   string           `json:"contentFormat"`
+	ContentHTML     string           `json:"contentHtml"` // the content rendered to sanitized HTML
+	Tags            []string         `json:"tags"`
+	CommentsEnabled bool             `json:"commentsEnabled"`
+	Visibility      string           `json:"visibility"`
+	Reactions       map[string]int64 `json:"reactions"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt"`
+}
+
+type BlogListResponseV2 struct {
+	Blogs      []*BlogResponseV2 `json:"blogs"`
+	Pagination *PaginationV1     `json:"pagination"`
+}
+
+// PaginationV1 Count is the number of items on the page. NextOffset is passed as the offset query parameter to get
+// the next page, it is left out on the last page.
+type PaginationV1 struct {
+	Offset     int  `json:"offset"`
+	Limit      int  `json:"limit"`
+	Count      int  `json:"count"`
+	HasMore    bool `json:"hasMore"`
+	NextOffset int  `json:"nextOffset,omitempty"`
+}
+
+type LogLevelV1 struct {
+	Level string `json:"level" validate:"required"`
+}
+
+// ProblemV1 is the RFC 7807 (application/problem+json) body returned for every error.
+// Code is a stable machine readable error code, Errors lists the offending fields of a validation error.
+type ProblemV1 struct {
+	Type     string           `json:"type"`
+	Title    string           `json:"title"`
+	Status   int              `json:"status"`
+	Detail   string           `json:"detail,omitempty"`
+	Instance string           `json:"instance,omitempty"`
+	Code     string           `json:"code"`
+	Errors   []ProblemFieldV1 `json:"errors,omitempty"`
+}
+
+type ProblemFieldV1 struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type CreateCommentRequestV1 struct {
+	Content  string `json:"content" validate:"required"`
+	ParentID int64  `json:"parentId" validate:"min=0"` // 0 or missing for a top level comment
+}
+
+type UpdateCommentRequestV1 struct {
+	Content string `json:"content" validate:"required"`
+}
+
+type CommentStatusRequestV1 struct {
+	Status string `json:"status" validate:"required,oneof=pending approved spam removed"`
+}
+
+type CommentSettingsRequestV1 struct {
+	Enabled bool `json:"enabled"`
+}
+
+type CommentResponseV1 struct {
+	ID        int64     `json:"id"`
+	BlogID    int64     `json:"blogId"`
+	UserID    int64     `json:"userId"`
+	ParentID  int64     `json:"parentId,omitempty"`
+	Depth     int       `json:"depth"`
+	Content   string    `json:"content"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ReactionCountsV1 struct {
+	Reactions map[string]int64 `json:"reactions"`
+}
+
+type ReactionResponseV1 struct {
+	UserID    int64     `json:"userId"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FollowResponseV1 UserID is the other user, i.e. the follower in a list of followers
+type FollowResponseV1 struct {
+	UserID    int64     `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type FollowCountsV1 struct {
+	Followers int64 `json:"followers"`
+	Following int64 `json:"following"`
+}
+
+// FeedResponseV1 NextCursor is passed as the cursor query parameter to get the next page, it is left out on the last page
+type FeedResponseV1 struct {
+	Blogs      []*BlogResponseV1 `json:"blogs"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+type FeedResponseV2 struct {
+	Blogs      []*BlogResponseV2 `json:"blogs"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// MediaResponseV1 URL is where the content is served, BlogID is 0 until the media is attached to a blog. Width and
+// Height are the dimensions of an image. Srcset has the width variants of an image by format, ready for the srcset
+// attribute of an <img>, or of a <source> in a <picture> to offer WebP with a fallback to JPEG.
+type MediaResponseV1 struct {
+	ID          int64             `json:"id"`
+	UserID      int64             `json:"userId"`
+	BlogID      int64             `json:"blogId"`
+	URL         string            `json:"url"`
+	ContentType string            `json:"contentType"`
+	Size        int64             `json:"size"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	Variants    []*MediaVariantV1 `json:"variants,omitempty"`
+	Srcset      map[string]string `json:"srcset,omitempty"`
+}
+
+type MediaVariantV1 struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ContentType string `json:"contentType"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+type AttachMediaRequestV1 struct {
+	BlogID int64 `json:"blogId" validate:"required,min=1"`
+}
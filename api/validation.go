@@ -0,0 +1,327 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+// maxRequestSize is the largest JSON body accepted, the uploads have their own limit
+const maxRequestSize = 1 << 20
+
+/*
+The request types declare their rules in a validate tag, e.g. `validate:"required,max=200"`, which are checked before
+the request reaches a use case:
+
+	required       a string which is not blank, a number which is not 0, a list which is not empty
+	min=N, max=N   the length of a string in characters, the value of a number, the number of items of a list
+	oneof=a b c    one of the values, separated by spaces
+	pattern=name   matches the named pattern of validationPatterns
+	dive           the rules after it apply to every item of a list
+
+The rules besides required are skipped for an empty value, so an optional field has no required. The OpenAPI document
+shows the rules in the schemas of the types.
+*/
+
+// validationPattern is a pattern and the message telling what it accepts
+type validationPattern struct {
+	regexp  *regexp.Regexp
+	message string
+}
+
+var validationPatterns = map[string]validationPattern{
+	"username": {regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`), "may only contain letters, digits, '.', '_' and '-' and must start with a letter or a digit"},
+	// the tags of a blog are stored comma separated
+	"tag": {regexp.MustCompile(`^[^,]*$`), "must not contain a comma"},
+}
+
+type validationRule struct {
+	name  string
+	value string
+	limit int
+}
+
+// fieldRules are the rules of one field, items the rules of its items after a dive
+type fieldRules struct {
+	index int
+	name  string
+	rules []validationRule
+	items []validationRule
+}
+
+// typeRules caches the parsed rules by the request type
+var typeRules sync.Map
+
+// decodeRequest decodes the JSON body into the request and validates it. When the body is malformed (400), too large
+// (413), or has unknown fields or violates the rules of the request type (422) it writes the problem and returns
+// false. The unknown fields and every violation are reported at once.
+func decodeRequest(w http.ResponseWriter, r *http.Request, request any) bool {
+	body, ok := readBody(w, r)
+	if !ok {
+		return false
+	}
+
+	validationErr := domain.NewValidationError()
+	err := json.Unmarshal(body, request)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		// the other fields are decoded anyway, the field is reported along with the other violations
+		validationErr.Add(typeErr.Field, "invalid_type", fmt.Sprintf("must be a %s", jsonTypeName(typeErr.Type)))
+	} else if err != nil {
+		setMalformedRequest(w, r, "failed to decode request body, expected a JSON object")
+		return false
+	}
+
+	addUnknownFields(body, request, validationErr)
+	validate(request, validationErr)
+	if err := validationErr.OrNil(); err != nil {
+		setErrorResponse(w, r, err)
+		return false
+	}
+	return true
+}
+
+// readBody reads the JSON body of at most maxRequestSize bytes, otherwise it writes the problem and returns false
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			setProblem(w, r, http.StatusRequestEntityTooLarge, payloadTooLargeCode,
+				fmt.Sprintf("the request body must not be larger than %d bytes", maxRequestSize))
+			return nil, false
+		}
+		setMalformedRequest(w, r, "failed to read request body")
+		return nil, false
+	}
+	return body, true
+}
+
+// addUnknownFields reports the fields of the body the request type does not have
+func addUnknownFields(body []byte, request any, validationErr *domain.ValidationError) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return
+	}
+	known := map[string]bool{}
+	requestType := reflect.TypeOf(request).Elem()
+	for i := 0; i < requestType.NumField(); i++ {
+		if name, ok := jsonName(requestType.Field(i)); ok {
+			known[name] = true
+		}
+	}
+	var unknown []string
+	for name := range fields {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		validationErr.Add(name, "unknown_field", "is not a known field")
+	}
+}
+
+// validate checks the request, a pointer to a struct, against the rules of its type. The fields which already have
+// an error, e.g. of the wrong type, are not checked again.
+func validate(request any, validationErr *domain.ValidationError) {
+	reported := map[string]bool{}
+	for _, field := range validationErr.Fields {
+		reported[field.Field] = true
+	}
+	value := reflect.ValueOf(request).Elem()
+	for _, field := range rulesOf(value.Type()) {
+		if reported[field.name] {
+			continue
+		}
+		fieldValue := value.Field(field.index)
+		if !checkRules(field.name, fieldValue, field.rules, validationErr) || field.items == nil {
+			continue
+		}
+		for i := 0; i < fieldValue.Len(); i++ {
+			checkRules(fmt.Sprintf("%s[%d]", field.name, i), fieldValue.Index(i), field.items, validationErr)
+		}
+	}
+}
+
+// checkRules adds the first violation of the value, if any, and tells whether it had none
+func checkRules(name string, value reflect.Value, rules []validationRule, validationErr *domain.ValidationError) bool {
+	if isEmpty(value) {
+		for _, rule := range rules {
+			if rule.name == "required" {
+				validationErr.Add(name, "required", "must not be empty")
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, rule := range rules {
+		code, message := checkRule(value, rule)
+		if code != "" {
+			validationErr.Add(name, code, message)
+			return false
+		}
+	}
+	return true
+}
+
+// checkRule returns the code and the message of the violation, an empty code when there is none
+func checkRule(value reflect.Value, rule validationRule) (string, string) {
+	switch rule.name {
+	case "min", "max":
+		switch value.Kind() {
+		case reflect.String:
+			length := utf8.RuneCountInString(value.String())
+			if rule.name == "min" && length < rule.limit {
+				return "too_short", fmt.Sprintf("must be at least %d characters long", rule.limit)
+			}
+			if rule.name == "max" && length > rule.limit {
+				return "too_long", fmt.Sprintf("must not be longer than %d characters", rule.limit)
+			}
+		case reflect.Slice:
+			if rule.name == "min" && value.Len() < rule.limit {
+				return "too_few", fmt.Sprintf("must have at least %d items", rule.limit)
+			}
+			if rule.name == "max" && value.Len() > rule.limit {
+				return "too_many", fmt.Sprintf("must not have more than %d items", rule.limit)
+			}
+		default:
+			if rule.name == "min" && value.Int() < int64(rule.limit) {
+				return "out_of_range", fmt.Sprintf("must be at least %d", rule.limit)
+			}
+			if rule.name == "max" && value.Int() > int64(rule.limit) {
+				return "out_of_range", fmt.Sprintf("must not be more than %d", rule.limit)
+			}
+		}
+	case "oneof":
+		values := strings.Fields(rule.value)
+		for _, allowed := range values {
+			if value.String() == allowed {
+				return "", ""
+			}
+		}
+		return "invalid", "must be one of " + strings.Join(values, ", ")
+	case "pattern":
+		pattern := validationPatterns[rule.value]
+		if !pattern.regexp.MatchString(value.String()) {
+			return "invalid", pattern.message
+		}
+	}
+	return "", ""
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// rulesOf parses the validate tags of the struct type once, a tag which can not be parsed is a programming error
+func rulesOf(structType reflect.Type) []fieldRules {
+	if cached, ok := typeRules.Load(structType); ok {
+		return cached.([]fieldRules)
+	}
+	var fields []fieldRules
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		name, named := jsonName(field)
+		if !ok || !named {
+			continue
+		}
+		rules, err := parseRules(field.Type, tag)
+		if err != nil {
+			panic(fmt.Sprintf("invalid validate tag of %s.%s: %v", structType.Name(), field.Name, err))
+		}
+		fields = append(fields, fieldRules{index: i, name: name, rules: rules.rules, items: rules.items})
+	}
+	typeRules.Store(structType, fields)
+	return fields
+}
+
+func parseRules(fieldType reflect.Type, tag string) (*fieldRules, error) {
+	parsed := &fieldRules{}
+	current := &parsed.rules
+	kind := fieldType.Kind()
+	for _, part := range strings.Split(tag, ",") {
+		name, value, _ := strings.Cut(part, "=")
+		rule := validationRule{name: name, value: value}
+		switch name {
+		case "required":
+		case "min", "max":
+			limit, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s needs a number", name)
+			}
+			if kind != reflect.String && kind != reflect.Slice && (kind < reflect.Int || kind > reflect.Int64) {
+				return nil, fmt.Errorf("%s needs a string, a list or an integer field", name)
+			}
+			rule.limit = limit
+		case "oneof":
+			if kind != reflect.String || value == "" {
+				return nil, fmt.Errorf("oneof needs values and a string field")
+			}
+		case "pattern":
+			if _, ok := validationPatterns[value]; !ok || kind != reflect.String {
+				return nil, fmt.Errorf("unknown pattern '%s' or no string field", value)
+			}
+		case "dive":
+			if kind != reflect.Slice || current == &parsed.items {
+				return nil, fmt.Errorf("dive needs a list")
+			}
+			current = &parsed.items
+			kind = fieldType.Elem().Kind()
+			parsed.items = []validationRule{}
+			continue
+		default:
+			return nil, fmt.Errorf("unknown rule '%s'", name)
+		}
+		*current = append(*current, rule)
+	}
+	return parsed, nil
+}
+
+// jsonName is the name of the field in the JSON, false when encoding/json skips it
+func jsonName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return "number"
+}
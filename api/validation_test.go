@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		request  any
+		body     string
+		expected []ProblemFieldV1
+	}{
+		{"valid", &CreateBlogRequestV1{}, `{"title": "Hello", "content": "World", "contentFormat": "markdown"}`, nil},
+		{"optional fields left out", &UpdateUserRequestV1{}, `{}`, nil},
+		{"required", &CreateBlogRequestV1{}, `{"title": "  ", "contentFormat": ""}`, []ProblemFieldV1{
+			{Field: "title", Code: "required", Message: "must not be empty"},
+			{Field: "content", Code: "required", Message: "must not be empty"},
+		}},
+		{"lengths in characters", &CreateUserRequestV1{}, `{"username": "ab", "password": "ü` + strings.Repeat("x", 72) + `", "firstName": "` + strings.Repeat("ü", 50) + `", "lastName": "L"}`, []ProblemFieldV1{
+			{Field: "username", Code: "too_short", Message: "must be at least 3 characters long"},
+			{Field: "password", Code: "too_long", Message: "must not be longer than 72 characters"},
+		}},
+		{"pattern", &CreateUserRequestV1{}, `{"username": "-bob smith", "password": "password", "firstName": "F", "lastName": "L"}`, []ProblemFieldV1{
+			{Field: "username", Code: "invalid", Message: validationPatterns["username"].message},
+		}},
+		{"oneof", &CreateBlogRequestV1{}, `{"title": "T", "content": "C", "visibility": "everyone"}`, []ProblemFieldV1{
+			{Field: "visibility", Code: "invalid", Message: "must be one of public, unlisted, members-only, private"},
+		}},
+		{"numbers", &UpdateBlogRequestV1{}, `{"id": -1, "title": "T", "content": "C"}`, []ProblemFieldV1{
+			{Field: "id", Code: "out_of_range", Message: "must be at least 1"},
+		}},
+		{"list items", &UpdateBlogRequestV1{}, `{"id": 1, "title": "T", "content": "C", "tags": ["go", "", "` + strings.Repeat("x", 51) + `", "a,b"]}`, []ProblemFieldV1{
+			{Field: "tags[1]", Code: "required", Message: "must not be empty"},
+			{Field: "tags[2]", Code: "too_long", Message: "must not be longer than 50 characters"},
+			{Field: "tags[3]", Code: "invalid", Message: validationPatterns["tag"].message},
+		}},
+		{"too many items", &UpdateBlogRequestV1{}, `{"id": 1, "title": "T", "content": "C", "tags": [` + strings.Repeat(`"go",`, 20) + `"go"]}`, []ProblemFieldV1{
+			{Field: "tags", Code: "too_many", Message: "must not have more than 20 items"},
+		}},
+		{"unknown fields with the other violations", &CreateBlogRequestV1{}, `{"title": "", "content": "C", "tilte": "T", "author": 1}`, []ProblemFieldV1{
+			{Field: "author", Code: "unknown_field", Message: "is not a known field"},
+			{Field: "tilte", Code: "unknown_field", Message: "is not a known field"},
+			{Field: "title", Code: "required", Message: "must not be empty"},
+		}},
+		{"v2 tags", &CreateBlogRequestV2{}, `{"title": "T", "content": "C", "tags": ["go", "a,b"], "status": "archived"}`, []ProblemFieldV1{
+			{Field: "tags[1]", Code: "invalid", Message: validationPatterns["tag"].message},
+			{Field: "status", Code: "invalid", Message: "must be one of draft, published"},
+		}},
+		{"invalid type", &AttachMediaRequestV1{}, `{"blogId": "1"}`, []ProblemFieldV1{
+			{Field: "blogId", Code: "invalid_type", Message: "must be a number"},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ok := decodeRequest(recorder, httptest.NewRequest(http.MethodPost, "/v1/test", strings.NewReader(test.body)), test.request)
+			if test.expected == nil {
+				if !ok {
+					t.Fatalf("expected the request to be valid, got %d %s", recorder.Code, recorder.Body)
+				}
+				return
+			}
+			if ok || recorder.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("expected a 422, got %d", recorder.Code)
+			}
+			var problem ProblemV1
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("failed to decode the problem: %v", err)
+			}
+			if problem.Code != validationFailedCode || !reflect.DeepEqual(problem.Errors, test.expected) {
+				t.Errorf("expected the errors %+v, got %s %+v", test.expected, problem.Code, problem.Errors)
+			}
+		})
+	}
+}
+
+func TestDecodeRequestRejectsBodies(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"not json", `{"title": `, http.StatusBadRequest, malformedRequestCode},
+		{"not an object", `["title"]`, http.StatusBadRequest, malformedRequestCode},
+		{"too large", `{"content": "` + strings.Repeat("x", maxRequestSize) + `"}`, http.StatusRequestEntityTooLarge, payloadTooLargeCode},
+	} {
+		recorder := httptest.NewRecorder()
+		var request CreateBlogRequestV1
+		if decodeRequest(recorder, httptest.NewRequest(http.MethodPost, "/v1/blogs", strings.NewReader(test.body)), &request) {
+			t.Fatalf("%s: expected the body to be rejected", test.name)
+		}
+		var problem ProblemV1
+		if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil || recorder.Code != test.status || problem.Code != test.code {
+			t.Errorf("%s: expected %d %s, got %d %s", test.name, test.status, test.code, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+// TestValidateTags parses the rules of every documented request type, a broken tag would only panic on the first request
+func TestValidateTags(t *testing.T) {
+	for _, operation := range versionedOperations(apiOperations, newTestWebService().apiVersions()) {
+		if operation.request != nil {
+			rulesOf(reflect.TypeOf(operation.request))
+		}
+	}
+
+	for _, tag := range []string{"max=ten", "oneof=a b", "pattern=phone", "dive", "min=1,dive,dive", "unique"} {
+		if _, err := parseRules(reflect.TypeOf(int64(0)), tag); err == nil {
+			t.Errorf("expected the tag %q of an integer field to be rejected", tag)
+		}
+	}
+	if _, err := parseRules(reflect.TypeOf(true), "max=1"); err == nil {
+		t.Errorf("expected max of a boolean field to be rejected")
+	}
+
+	schema := structSchema(reflect.TypeOf(UpdateBlogRequestV1{}), map[string]any{})
+	properties := schema["properties"].(map[string]any)
+	if !reflect.DeepEqual(schema["required"], []string{"id", "title", "content"}) {
+		t.Errorf("expected the required fields in the schema, got %v", schema["required"])
+	}
+	tags := properties["tags"].(map[string]any)
+	if tags["maxItems"] != 20 || tags["items"].(map[string]any)["maxLength"] != 50 {
+		t.Errorf("expected the rules of the tags and of their items in the schema, got %v", tags)
+	}
+}
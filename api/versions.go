@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*
+Every route is served under each version of the API by the same handlers, which share the use cases. The few handlers
+whose representation changed between the versions look the version up with requestVersion, the errors are the same
+problem documents in every version.
+
+	v1  deprecated, the tags of a blog are one comma separated string and the blogs have no status
+	v2  the tags are a list and a blog is a draft or published
+
+The responses of a deprecated version carry the Deprecation (RFC 9745) and Sunset (RFC 8594) headers and a Link to the
+same route in the latest version, and every request is counted per version so that we can tell when nobody uses v1
+any more.
+*/
+
+const (
+	apiV1         = "v1"
+	apiV2         = "v2"
+	latestVersion = apiV2
+)
+
+var apiVersionRequestCount = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "http_api_version_requests_total",
+		Help: "Count of requests per version of the API.",
+	},
+	[]string{"version", "method", "route"},
+)
+
+// apiVersion is a version of the API, deprecated and sunset are zero unless the version is on its way out
+type apiVersion struct {
+	name       string
+	deprecated time.Time
+	sunset     time.Time
+}
+
+func (ws *WebService) apiVersions() []apiVersion {
+	return []apiVersion{
+		{name: apiV1, deprecated: ws.conf.API.V1.Deprecated, sunset: ws.conf.API.V1.Sunset},
+		{name: apiV2},
+	}
+}
+
+// versionPrefix is the start of the paths of the version, e.g. /v2
+func versionPrefix(version string) string {
+	return "/" + version
+}
+
+// requestVersion is the version of the API the request came in through, v1 for a request outside the versions
+func requestVersion(r *http.Request) string {
+	if version, ok := r.Context().Value("apiVersion").(string); ok {
+		return version
+	}
+	return apiV1
+}
+
+// middleware keeps the version in the request context, announces its deprecation and counts its requests
+func (v apiVersion) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiVersionRequestCount.WithLabelValues(v.name, r.Method, routeName(r)).Inc()
+
+		if !v.deprecated.IsZero() {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", v.deprecated.Unix()))
+			successor := versionPrefix(latestVersion) + strings.TrimPrefix(r.URL.Path, versionPrefix(v.name))
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		}
+		if !v.sunset.IsZero() {
+			w.Header().Set("Sunset", v.sunset.UTC().Format(http.TimeFormat))
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "apiVersion", v.name)))
+	})
+}
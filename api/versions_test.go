@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestVersionHeaders(t *testing.T) {
+	ws := newTestWebService()
+	router := ws.router()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/v1/blogs/x?q=1", nil))
+	if deprecation := recorder.Header().Get("Deprecation"); deprecation != "@1792368000" {
+		t.Errorf("expected the deprecation date of the config, got %q", deprecation)
+	}
+	if sunset := recorder.Header().Get("Sunset"); sunset != "Fri, 30 Apr 2027 00:00:00 GMT" {
+		t.Errorf("expected the sunset date of the config, got %q", sunset)
+	}
+	if link := recorder.Header().Get("Link"); link != `</v2/blogs/x>; rel="successor-version"` {
+		t.Errorf("expected a link to the route in v2, got %q", link)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/v2/blogs/x", nil))
+	for _, header := range []string{"Deprecation", "Sunset", "Link"} {
+		if value := recorder.Header().Get(header); value != "" {
+			t.Errorf("expected no %s header in v2, got %q", header, value)
+		}
+	}
+}
+
+func TestVersionMetrics(t *testing.T) {
+	router := newTestWebService().router()
+	count := func(version string) float64 {
+		return testutil.ToFloat64(apiVersionRequestCount.WithLabelValues(version, "GET", "/"+version+"/blogs/{id}"))
+	}
+	v1, v2 := count(apiV1), count(apiV2)
+
+	// the request fails before it gets to a manager, it is counted all the same
+	for _, path := range []string{"/v1/blogs/x", "/v2/blogs/x", "/v2/blogs/x"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	if count(apiV1) != v1+1 || count(apiV2) != v2+2 {
+		t.Errorf("expected one more v1 and two more v2 requests, got %v and %v", count(apiV1)-v1, count(apiV2)-v2)
+	}
+}
+
+func TestRequestVersion(t *testing.T) {
+	var version string
+	handler := apiVersion{name: apiV2}.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version = requestVersion(r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v2/blogs", nil))
+	if version != apiV2 {
+		t.Errorf("expected the version of the middleware, got %s", version)
+	}
+	if version := requestVersion(httptest.NewRequest("GET", "/docs", nil)); version != apiV1 {
+		t.Errorf("expected v1 outside the versions, got %s", version)
+	}
+
+	document := servedDocument(t)
+	if !strings.Contains(string(document.Paths["/v1/blogs"]["post"].RequestBody), "CreateBlogRequestV1") ||
+		!strings.Contains(string(document.Paths["/v2/blogs"]["post"].RequestBody), "CreateBlogRequestV2") {
+		t.Errorf("expected the blog requests of their versions in the document")
+	}
+}
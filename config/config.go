@@ -2,8 +2,8 @@ package config
 
 import (
 	_ "embed"
-	"fmt"
 	"log"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,10 +12,27 @@ import (
 var configData []byte
 
 type Config struct {
+	Storage     StorageConfig     `yaml:"storage"`
 	Postgres    PostgresConfig    `yaml:"postgres"`
+	SQLite      SQLiteConfig      `yaml:"sqlite"`
 	DefaultUser DefaultUserConfig `yaml:"defaultuser"`
 	Login       LoginConfig       `yaml:"login"`
 	Server      ServerConfig      `yaml:"server"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Logging     LoggingConfig     `yaml:"logging"`
+	Comments    CommentsConfig    `yaml:"comments"`
+	Reactions   ReactionsConfig   `yaml:"reactions"`
+	Syndication SyndicationConfig `yaml:"syndication"`
+	Render      RenderConfig      `yaml:"render"`
+	Media       MediaConfig       `yaml:"media"`
+	API         APIConfig         `yaml:"api"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	RateLimit   RateLimitConfig   `yaml:"ratelimit"`
+	Cache       CacheConfig       `yaml:"cache"`
+	CORS        CORSConfig        `yaml:"cors"`
+	Security    SecurityConfig    `yaml:"securityheaders"`
+	Sessions    SessionsConfig    `yaml:"sessions"`
+	Redis       RedisConfig       `yaml:"redis"`
 }
 
 func NewConfig() *Config {
@@ -24,10 +41,32 @@ func NewConfig() *Config {
 	if err := yaml.Unmarshal(configData, &conf); err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println(conf.Postgres.Host)
 	return &conf
 }
 
+const (
+	PostgresDriver = "postgres"
+	SQLiteDriver   = "sqlite"
+
+	LocalBlobStore = "local"
+	S3BlobStore    = "s3"
+
+	MemoryRateLimitStore = "memory"
+	RedisRateLimitStore  = "redis"
+
+	MemoryCacheStore = "memory"
+	RedisCacheStore  = "redis"
+
+	NoClientAuth       = "none"
+	OptionalClientAuth = "optional"
+	RequireClientAuth  = "require"
+)
+
+// StorageConfig Driver selects where the data is kept, either "postgres" (the default) or "sqlite"
+type StorageConfig struct {
+	Driver string `yaml:"driver"`
+}
+
 type PostgresConfig struct {
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
@@ -36,9 +75,14 @@ type PostgresConfig struct {
 	Database string `yaml:"database"`
 }
 
-// DefaultUserConfig a default admin user which will be created during database
-// initialization stage when the service startsup for the first time.
-// We recommend changing the password asap
+// SQLiteConfig Path is the database file, it is created on the first start
+type SQLiteConfig struct {
+	Path string `yaml:"path"`
+}
+
+// DefaultUserConfig an admin user which is created during the database initialization when the
+// service starts up for the first time, only when a password is given. The password is empty by
+// default, the first admin is created with the `user create` command of the server binary.
 type DefaultUserConfig struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
@@ -50,5 +94,208 @@ type LoginConfig struct {
 }
 
 type ServerConfig struct {
-	Port int `yaml:"port"`
+	Port int       `yaml:"port"`
+	TLS  TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig serves HTTPS, and HTTP/2 along with it unless HTTP2 is off. CertFile and KeyFile are PEM files, they are
+// read again when they change, checked every ReloadSeconds, so short-lived certificates are renewed without a restart.
+// MinVersion is "1.2" or "1.3", CipherSuites are the names of the TLS 1.2 cipher suites (Go's secure defaults when
+// empty), TLS 1.3 has its own.
+// ClientAuth asks the callers for a certificate signed by a CA of ClientCAFile: "none", "optional" (the callers
+// without one authenticate as usual) or "require". Services maps the common names of the client certificates to
+// the user and permissions the services act with.
+type TLSConfig struct {
+	Enabled       bool                     `yaml:"enabled"`
+	CertFile      string                   `yaml:"certfile"`
+	KeyFile       string                   `yaml:"keyfile"`
+	MinVersion    string                   `yaml:"minversion"`
+	CipherSuites  []string                 `yaml:"ciphersuites"`
+	HTTP2         bool                     `yaml:"http2"`
+	ClientAuth    string                   `yaml:"clientauth"`
+	ClientCAFile  string                   `yaml:"clientcafile"`
+	Services      map[string]ServiceConfig `yaml:"services"`
+	ReloadSeconds int                      `yaml:"reloadseconds"`
+}
+
+// ServiceConfig UserID is the user a service caller acts as, Permissions are its permissions
+type ServiceConfig struct {
+	UserID      int64    `yaml:"userid"`
+	Permissions []string `yaml:"permissions"`
+}
+
+// TracingConfig controls the OpenTelemetry spans emitted by the service. Exporter can be
+// "otlp" (sends spans to an OTLP/HTTP collector) or "noop" (drops them). SampleRatio is the
+// fraction of new traces which get recorded, requests which already carry a sampled parent are
+// always recorded.
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sampleratio"`
+	ServiceName string  `yaml:"servicename"`
+}
+
+// LoggingConfig Format is either "text" or "json", Level is the initial log level which can be changed
+// at runtime through the admin endpoint. AccessLogSampleRate is the fraction of successful requests which
+// get an access log line, failed requests (4xx/5xx) are always logged.
+type LoggingConfig struct {
+	Format              string  `yaml:"format"`
+	Level               string  `yaml:"level"`
+	AccessLogSampleRate float64 `yaml:"accesslogsamplerate"`
+}
+
+// CommentsConfig MaxDepth is how deep the replies can be nested, a top level comment has depth 0 so a MaxDepth
+// of 0 allows no replies at all. MaxLength is the maximum number of characters of a comment. When RequireApproval
+// is set the new comments are pending until a moderator approves them, otherwise they are visible right away.
+type CommentsConfig struct {
+	MaxDepth        int  `yaml:"maxdepth"`
+	MaxLength       int  `yaml:"maxlength"`
+	RequireApproval bool `yaml:"requireapproval"`
+}
+
+// ReactionsConfig Emojis are the reactions available next to the like
+type ReactionsConfig struct {
+	Emojis []string `yaml:"emojis"`
+}
+
+// SyndicationConfig Title is the title of the site feed, the author and tag feeds append their name to it.
+// BaseURL is the public address of the service which the feeds link to, Items is how many of the newest
+// blogs a feed contains.
+type SyndicationConfig struct {
+	Title   string `yaml:"title"`
+	BaseURL string `yaml:"baseurl"`
+	Items   int    `yaml:"items"`
+}
+
+// RenderConfig CacheSize is how many rendered blog contents are kept in memory, 0 turns the cache off
+type RenderConfig struct {
+	CacheSize int `yaml:"cachesize"`
+}
+
+// MediaConfig MaxSize is the largest upload in bytes and MaxPixels the largest image in pixels, which keeps a small
+// file with huge dimensions from taking the memory of the server when it is decoded, 0 for no limit. Types are the accepted content types, which are sniffed from
+// the content rather than taken from the client. Store is either "local" (the files go under Local.Dir) or "s3"
+// (any S3 compatible service, e.g. MinIO). The uploads not attached to a blog within OrphanHours are deleted by a
+// job which runs every CleanupMinutes, 0 turns the job off.
+type MediaConfig struct {
+	Store          string          `yaml:"store"`
+	MaxSize        int64           `yaml:"maxsize"`
+	MaxPixels      int64           `yaml:"maxpixels"`
+	Types          []string        `yaml:"types"`
+	OrphanHours    int             `yaml:"orphanhours"`
+	CleanupMinutes int             `yaml:"cleanupminutes"`
+	Variants       VariantsConfig  `yaml:"variants"`
+	Local          LocalBlobConfig `yaml:"local"`
+	S3             S3BlobConfig    `yaml:"s3"`
+}
+
+// VariantsConfig the images get a square Thumbnail, 0 for none, and a variant for each of the Widths smaller than
+// the image, in each of the Formats the server can encode. Quality is the quality of the lossy encoders, 1 to 100.
+type VariantsConfig struct {
+	Thumbnail int      `yaml:"thumbnail"`
+	Widths    []int    `yaml:"widths"`
+	Formats   []string `yaml:"formats"`
+	Quality   int      `yaml:"quality"`
+}
+
+type LocalBlobConfig struct {
+	Dir string `yaml:"dir"`
+}
+
+// S3BlobConfig Endpoint is the host and port of the service, without the scheme
+type S3BlobConfig struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"accesskey"`
+	SecretKey string `yaml:"secretkey"`
+	UseSSL    bool   `yaml:"usessl"`
+}
+
+// IdempotencyConfig TTLHours is how long the response of a request made with an Idempotency-Key is replayed to its
+// retries, the expired responses are deleted by a job which runs every CleanupMinutes, 0 turns the job off. A request
+// which is still running after LeaseSeconds is taken over by its retry, e.g. when the server died while running it.
+type IdempotencyConfig struct {
+	TTLHours       int `yaml:"ttlhours"`
+	CleanupMinutes int `yaml:"cleanupminutes"`
+	LeaseSeconds   int `yaml:"leaseseconds"`
+}
+
+// APIConfig the versions of the API which are on their way out, the latest version has no entry
+type APIConfig struct {
+	V1 APIVersionConfig `yaml:"v1"`
+}
+
+// APIVersionConfig Deprecated is when the version was deprecated and Sunset when it stops being served, the responses
+// of the version announce both in their Deprecation and Sunset headers. A zero date leaves its header out.
+type APIVersionConfig struct {
+	Deprecated time.Time `yaml:"deprecated"`
+	Sunset     time.Time `yaml:"sunset"`
+}
+
+// RateLimitConfig Store is either "memory" (every server counts on its own, fine for a single node) or "redis" (the
+// servers of a cluster share the buckets). A client is told apart by its user when it sends a valid token, by its
+// service when it calls with the client certificate of a service, otherwise by its IP address. TrustedProxies are the
+// networks (CIDRs) of the reverse proxies whose X-Forwarded-For header is believed, for everybody else the address of
+// the connection counts. Routes have the policies of the routes which
+// do not get the Default one, keyed by the method and the path template within a version, e.g. "POST /login".
+type RateLimitConfig struct {
+	Enabled        bool                       `yaml:"enabled"`
+	Store          string                     `yaml:"store"`
+	TrustedProxies []string                   `yaml:"trustedproxies"`
+	Default        RateLimitPolicy            `yaml:"default"`
+	Routes         map[string]RateLimitPolicy `yaml:"routes"`
+}
+
+// RateLimitPolicy a client can make Burst requests at once and PerMinute requests a minute in the long run, a
+// PerMinute of 0 turns the limit off
+type RateLimitPolicy struct {
+	PerMinute int `yaml:"perminute"`
+	Burst     int `yaml:"burst"`
+}
+
+// CacheConfig the blogs are read through a cache when it is enabled. Store is either "memory" (the Size most recently
+// read blogs of every server, fine for a single node as a server does not hear about the changes made by the others)
+// or "redis" (shared by the servers of a cluster). A cached blog is read again after TTLSeconds at the latest. The
+// pages of the blog searches are kept for SearchTTLSeconds, every change of a blog drops them, 0 leaves them out.
+type CacheConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	Store            string `yaml:"store"`
+	Size             int    `yaml:"size"`
+	TTLSeconds       int    `yaml:"ttlseconds"`
+	SearchTTLSeconds int    `yaml:"searchttlseconds"`
+}
+
+// CORSConfig AllowedOrigins are the origins of the browser apps which may call the API, e.g. https://app.example.com,
+// "*" lets every origin in but without the session cookie. AllowCredentials lets the listed origins send the session
+// cookie. The browsers keep the answer to a preflight request for MaxAgeSeconds.
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowedorigins"`
+	AllowCredentials bool     `yaml:"allowcredentials"`
+	MaxAgeSeconds    int      `yaml:"maxageseconds"`
+}
+
+// SecurityConfig ContentSecurityPolicy goes on every response but the docs page, which has its own. HSTSSeconds is
+// the max-age of Strict-Transport-Security, 0 leaves the header out.
+type SecurityConfig struct {
+	ContentSecurityPolicy string `yaml:"contentsecuritypolicy"`
+	HSTSSeconds           int    `yaml:"hstsseconds"`
+}
+
+// SessionsConfig lets the browser apps log in with an HttpOnly cookie rather than keep the token themselves, next to
+// the Authorization header. Secure sends the cookies over HTTPS only, SameSite is "lax", "strict" or "none", the
+// latter for an app on another site which needs Secure.
+type SessionsConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Secure   bool   `yaml:"secure"`
+	SameSite string `yaml:"samesite"`
+}
+
+// RedisConfig Addr is the host and port of the Redis server
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
 }
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+	These are the typed errors returned by the use cases and repositories. The API layer maps each type to
+	an HTTP status and a stable error code, anything else is treated as an internal error.
+*/
+
+// NotFoundError the requested entity does not exist
+type NotFoundError struct {
+	Entity string
+	ID     any
+}
+
+func NewNotFoundError(entity string, id any) error {
+	return &NotFoundError{Entity: entity, ID: id}
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s '%v' not found", e.Entity, e.ID)
+}
+
+// ConflictError the entity clashes with an existing one, e.g. a duplicate username
+type ConflictError struct {
+	Entity  string
+	Message string
+}
+
+func NewConflictError(entity string, message string) error {
+	return &ConflictError{Entity: entity, Message: message}
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// FieldError describes what is wrong with a single input field
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// ValidationError the input is not acceptable, Fields holds every violation found
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func NewValidationError(fields ...FieldError) *ValidationError {
+	return &ValidationError{Fields: fields}
+}
+
+// Add records one more violation
+func (e *ValidationError) Add(field string, code string, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// OrNil returns nil when no violation has been recorded, so that the validation functions can
+// collect the violations and return the result in one go
+func (e *ValidationError) OrNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, fmt.Sprintf("%s: %s", field.Field, field.Message))
+	}
+	return "validation failed: " + strings.Join(messages, ", ")
+}
+
+// ForbiddenError the caller is known but is not allowed to do this
+type ForbiddenError struct {
+	Message string
+}
+
+func NewForbiddenError(message string) error {
+	return &ForbiddenError{Message: message}
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Message
+}
+
+// UnauthorizedError the caller could not be authenticated
+type UnauthorizedError struct {
+	Message string
+}
+
+func NewUnauthorizedError(message string) error {
+	return &UnauthorizedError{Message: message}
+}
+
+func (e *UnauthorizedError) Error() string {
+	return e.Message
+}
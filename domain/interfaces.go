@@ -1,25 +1,177 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// TxManager lets the use cases group several repository calls into one transaction. Every repository call
+// made with the context handed to fn takes part in it, the transaction is committed when fn returns nil and
+// rolled back otherwise. Calling WithinTx with a context which already carries a transaction joins it.
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
 
 type DatabaseRepo interface {
 	Initialize(ctx context.Context) error
 }
 
 type UserRepo interface {
+	// Create stores the password as it is, the use cases hash it before their transactions as bcrypt is slow
 	Create(ctx context.Context, user *User) (*User, error)
 	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	GetUserByID(ctx context.Context, userID int64) (*User, error)
+	// GetUsersByIDs returns the users by their IDs in one lookup, the IDs of no user are left out
+	GetUsersByIDs(ctx context.Context, userIDs ...int64) (map[int64]*User, error)
+	// ListUsers returns the users ordered by their IDs
+	ListUsers(ctx context.Context, offset int, limit int) ([]*User, error)
 	GetRoleByName(ctx context.Context, roleName string) (*Role, error)
+	// GetUserRoles returns the names of the roles of the user, sorted
+	GetUserRoles(ctx context.Context, userID int64) ([]string, error)
 	AssignRoles(ctx context.Context, userID int64, roleIDs ...int64) error
+	// RevokeRoles takes the roles from the user, it is a conflict error when the user does not have one of them
+	RevokeRoles(ctx context.Context, userID int64, roleIDs ...int64) error
+	// GetPermissions returns the permissions of the roles of the user, the ones the tokens carry
+	GetPermissions(ctx context.Context, userID int64) (map[string]any, error)
+	// SetPassword replaces the user's password with the hashed one
+	SetPassword(ctx context.Context, userID int64, hashedPassword string) error
+	SetDisabled(ctx context.Context, userID int64, disabled bool) error
+	// RevokeTokens bumps the token version of the user, which revokes the tokens the user already has
+	RevokeTokens(ctx context.Context, userID int64) error
+	// Login is a forbidden error for a disabled user with the right password
 	Login(ctx context.Context, username string, password string) (string, error)
 }
 
 type AuthRepo interface {
-	GetToken(ctx context.Context, userID int64, permissions map[string]any) (string, error)
+	// GetToken issues a token of the user, tokenVersion is the current one of the user
+	GetToken(ctx context.Context, userID int64, tokenVersion int, permissions map[string]any) (string, error)
 }
 
+// BlogRepo the lists (Search, Feed and Latest) only return the blogs the access allows, Get returns any blog
 type BlogRepo interface {
 	Create(ctx context.Context, blog *Blog) (int64, error)
 	Get(ctx context.Context, blogID int64) (*Blog, error)
-	Search(ctx context.Context, offset int, limit int, search string) ([]*Blog, error)
+	// GetBySlug finds the blog by its current slug or by one of its previous ones
+	GetBySlug(ctx context.Context, slug string) (*Blog, error)
+	// Update changes the title, the content and the tags, and the status, the visibility and the content format
+	// unless they are empty. The slug is changed by SetSlug.
+	Update(ctx context.Context, blog *Blog) error
+	// SetSlug makes the slug the current one of the blog, keeping the previous ones. It is a conflict error when
+	// the slug is (or was) another blog's.
+	SetSlug(ctx context.Context, blogID int64, slug string) error
+	// WithoutSlug returns the oldest blogs created before there were slugs
+	WithoutSlug(ctx context.Context, limit int) ([]*Blog, error)
+	Search(ctx context.Context, access BlogAccess, offset int, limit int, search string) ([]*Blog, error)
+	SetCommentsEnabled(ctx context.Context, blogID int64, enabled bool) error
+	// Feed returns the blogs of the authors the user follows, newest first, starting right after the cursor
+	// (from the newest when it is nil)
+	Feed(ctx context.Context, userID int64, access BlogAccess, after *FeedCursor, limit int) ([]*Blog, error)
+	// Latest returns the newest blogs matching the filter
+	Latest(ctx context.Context, access BlogAccess, filter BlogFilter, limit int) ([]*Blog, error)
+	// Reindex rebuilds the search index of the blogs and returns how many blogs there are
+	Reindex(ctx context.Context) (int, error)
+}
+
+// CommentRepo lists the comments of a blog in thread order, i.e. every comment is followed by its replies,
+// oldest first on every level
+type CommentRepo interface {
+	Create(ctx context.Context, comment *Comment) (int64, error)
+	Get(ctx context.Context, commentID int64) (*Comment, error)
+	UpdateContent(ctx context.Context, commentID int64, content string) error
+	UpdateStatus(ctx context.Context, commentID int64, status CommentStatus) error
+	ListByBlog(ctx context.Context, blogID int64, status CommentStatus, offset int, limit int) ([]*Comment, error)
+	ListByStatus(ctx context.Context, status CommentStatus, offset int, limit int) ([]*Comment, error)
+}
+
+// ReactionRepo keeps a counter per blog and reaction type next to the reactions themselves, the counters are
+// changed along with the reactions so that reading them never needs to count the reactions
+type ReactionRepo interface {
+	// Add returns false when the user has already reacted with this type
+	Add(ctx context.Context, reaction *Reaction) (bool, error)
+	// Remove returns false when there was no such reaction
+	Remove(ctx context.Context, reaction *Reaction) (bool, error)
+	// Counts returns the non zero counters of the blogs, blog id -> reaction type -> count
+	Counts(ctx context.Context, blogIDs ...int64) (map[int64]map[string]int64, error)
+	// List returns the reactions of the blog newest first, optionally only the ones of a type
+	List(ctx context.Context, blogID int64, reactionType string, offset int, limit int) ([]*Reaction, error)
+}
+
+// FollowRepo the lists are newest first
+type FollowRepo interface {
+	// Follow returns false when the user already follows the other one
+	Follow(ctx context.Context, follow *Follow) (bool, error)
+	// Unfollow returns false when the user did not follow the other one
+	Unfollow(ctx context.Context, follow *Follow) (bool, error)
+	Followers(ctx context.Context, userID int64, offset int, limit int) ([]*Follow, error)
+	Following(ctx context.Context, userID int64, offset int, limit int) ([]*Follow, error)
+	Counts(ctx context.Context, userID int64) (followers int64, following int64, err error)
+}
+
+// IdempotencyRepo keeps the responses of the requests made with an Idempotency-Key until they expire
+type IdempotencyRepo interface {
+	// Reserve stores the request, which has no response yet, unless the user has an unexpired request with the key.
+	// That request is returned instead and nothing is stored, so only one of the requests with a key gets to run. A
+	// request with the same fingerprint which has been running for longer than the lease is taken over though.
+	Reserve(ctx context.Context, request *IdempotentRequest, lease time.Duration) (*IdempotentRequest, error)
+	// Complete stores the response of the reserved request
+	Complete(ctx context.Context, request *IdempotentRequest) error
+	// Release deletes the request, so that it can be made again with the same key
+	Release(ctx context.Context, userID int64, key string) error
+	// DeleteExpired deletes the requests which expired before the given time and returns how many there were
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+}
+
+// RateLimiter keeps a token bucket per key, a key which was not seen yet starts with a full bucket. The buckets are
+// shared by every server using the same limiter, e.g. the same Redis.
+type RateLimiter interface {
+	// Allow takes a token from the bucket of the key, if it has one
+	Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// Cache keeps values for a while, a value may be gone before its ttl is over. Get of an unknown key is not an error,
+// it returns false.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// ContentRenderer turns the content of a blog into HTML which is safe to embed in a page
+type ContentRenderer interface {
+	Render(ctx context.Context, format ContentFormat, content string) (string, error)
+}
+
+// MediaRepo the lists are oldest first
+type MediaRepo interface {
+	Create(ctx context.Context, media *Media) (int64, error)
+	Get(ctx context.Context, mediaID int64) (*Media, error)
+	// Attach links the media to the blog
+	Attach(ctx context.Context, mediaID int64, blogID int64) error
+	ListByBlog(ctx context.Context, blogID int64) ([]*Media, error)
+	// Orphans returns the media created before the time which are not attached to any blog
+	Orphans(ctx context.Context, before time.Time, limit int) ([]*Media, error)
+	// DeleteOrphan returns false when the media has been attached to a blog in the meantime
+	DeleteOrphan(ctx context.Context, mediaID int64) (bool, error)
+}
+
+// ImageProcessor makes the variants of the uploaded images. The images are passed as a whole, they are never larger
+// than media.maxsize nor media.maxpixels.
+type ImageProcessor interface {
+	// Inspect returns the size the image is displayed at, i.e. after the rotation its metadata asks for
+	Inspect(data []byte) (width int, height int, err error)
+	// StripLocation removes the GPS position from the metadata of the image, the data is changed in place
+	StripLocation(data []byte)
+	// Encode scales the image to the variant and encodes it in the format of the variant, without any metadata
+	Encode(data []byte, variant MediaVariant) ([]byte, error)
+	// Formats are the formats Encode supports
+	Formats() []string
+}
+
+// BlobStore keeps the bytes of the uploaded files, the keys are chosen by the caller. Get of an unknown key is a
+// not found error, Delete of an unknown key is not an error.
+type BlobStore interface {
+	Put(ctx context.Context, key string, contentType string, size int64, content io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
 }
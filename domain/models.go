@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -16,8 +17,12 @@ type User struct {
 	Password  string
 	FirstName string
 	LastName  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	// Disabled users can not log in, nor use the tokens they already have
+	Disabled bool
+	// TokenVersion is carried by the tokens of the user, a token of an older version is revoked
+	TokenVersion int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
 type Role struct {
@@ -28,19 +33,271 @@ type Role struct {
 }
 
 type Blog struct {
+	ID              int64
+	UserID          int64
+	Title           string
+	Slug            string // the current slug, the slugs of the previous titles still lead to the blog
+	Content         string
+	ContentFormat   ContentFormat
+	ContentHTML     string // the rendered and sanitized content, filled in by the BlogManager
+	Tags            string // comma separated
+	CommentsEnabled bool
+	Visibility      Visibility
+	Status          BlogStatus
+	Reactions       map[string]int64 // reaction type -> count, filled in by the BlogManager
+	Creator         *User            // the author, filled in by the BlogManager
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// ContentFormat is how the content of a blog is written, it is always rendered to HTML for the readers
+type ContentFormat string
+
+const (
+	FormatMarkdown  ContentFormat = "markdown"
+	FormatHTML      ContentFormat = "html"
+	FormatPlaintext ContentFormat = "plaintext"
+
+	// DefaultContentFormat is the format of the blogs created without one, and of the blogs from before there was one
+	DefaultContentFormat = FormatPlaintext
+)
+
+func (f ContentFormat) IsValid() bool {
+	switch f {
+	case FormatMarkdown, FormatHTML, FormatPlaintext:
+		return true
+	}
+	return false
+}
+
+// Visibility decides who can read a blog. Public and unlisted blogs are readable without logging in, but only the
+// public ones are listed. Members-only blogs need the read_blog permission, private ones are readable only by the
+// author and the users with the read_any_blog permission.
+type Visibility string
+
+const (
+	VisibilityPublic      Visibility = "public"
+	VisibilityUnlisted    Visibility = "unlisted"
+	VisibilityMembersOnly Visibility = "members-only"
+	VisibilityPrivate     Visibility = "private"
+
+	// DefaultVisibility is the visibility of the blogs created without one, and of the blogs from before there was one
+	DefaultVisibility = VisibilityMembersOnly
+)
+
+func (v Visibility) IsValid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityMembersOnly, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// BlogStatus tells whether a blog is out. A draft is readable only by its author and the users with the
+// read_any_blog permission, whatever its visibility, and is left out of the lists of the others.
+type BlogStatus string
+
+const (
+	StatusDraft     BlogStatus = "draft"
+	StatusPublished BlogStatus = "published"
+
+	// DefaultStatus is the status of the blogs created without one, and of the blogs from before there was one
+	DefaultStatus = StatusPublished
+)
+
+func (s BlogStatus) IsValid() bool {
+	switch s {
+	case StatusDraft, StatusPublished:
+		return true
+	}
+	return false
+}
+
+// Viewer is the reader of the blogs, the zero value is an anonymous reader
+type Viewer struct {
+	UserID      int64
+	Permissions map[string]any
+}
+
+func (v *Viewer) IsAnonymous() bool {
+	return v.UserID == 0
+}
+
+func (v *Viewer) HasPermission(permission string) bool {
+	_, ok := v.Permissions[permission]
+	return ok
+}
+
+// BlogAccess selects the blogs a reader gets in a list: the published blogs with one of the visibilities and the
+// reader's own blogs, whatever their visibility and status
+type BlogAccess struct {
+	Visibilities []Visibility
+	UserID       int64
+}
+
+func (a BlogAccess) Allows(blog *Blog) bool {
+	if a.UserID != 0 && blog.UserID == a.UserID {
+		return true
+	}
+	if blog.Status == StatusDraft {
+		return false
+	}
+	for _, visibility := range a.Visibilities {
+		if blog.Visibility == visibility {
+			return true
+		}
+	}
+	return false
+}
+
+// BlogFilter selects blogs, the zero value of a field matches every blog. Tag matches one of the comma
+// separated tags, ignoring the case and the surrounding spaces.
+type BlogFilter struct {
+	UserID int64
+	Tag    string
+}
+
+func (f BlogFilter) Matches(blog *Blog) bool {
+	if f.UserID != 0 && blog.UserID != f.UserID {
+		return false
+	}
+	tag := strings.TrimSpace(f.Tag)
+	if tag == "" {
+		return true
+	}
+	for _, blogTag := range strings.Split(blog.Tags, ",") {
+		if strings.EqualFold(strings.TrimSpace(blogTag), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedCursor is a position in a feed, the next page starts with the blogs right after it
+type FeedCursor struct {
+	CreatedAt time.Time
+	BlogID    int64
+}
+
+// Follow the follower gets the blogs of the followee in the feed
+type Follow struct {
+	FollowerID int64
+	FolloweeID int64
+	CreatedAt  time.Time
+}
+
+// LikeReaction is always available, the emoji reactions are configured
+const LikeReaction = "like"
+
+// Reaction of a user to a blog, a user reacts at most once with each type
+type Reaction struct {
+	BlogID    int64
+	UserID    int64
+	Type      string
+	CreatedAt time.Time
+}
+
+type CommentStatus string
+
+const (
+	CommentPending  CommentStatus = "pending"
+	CommentApproved CommentStatus = "approved"
+	CommentSpam     CommentStatus = "spam"
+	CommentRemoved  CommentStatus = "removed"
+)
+
+func (s CommentStatus) IsValid() bool {
+	switch s {
+	case CommentPending, CommentApproved, CommentSpam, CommentRemoved:
+		return true
+	}
+	return false
+}
+
+// Comment on a blog, replies point to their parent comment. Depth is 0 for a top level comment.
+type Comment struct {
 	ID        int64
+	BlogID    int64
 	UserID    int64
-	Title     string
+	ParentID  int64 // 0 for a top level comment
+	Depth     int
 	Content   string
-	Tags      string // comma separated
+	Status    CommentStatus
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
-// CustomClaims represents the custom claims for the JWT token.
-type CustomClaims struct {
+// Media is a file uploaded by a user, e.g. an image for a blog. The bytes are kept in the BlobStore under Key, a
+// media which has not been attached to a blog yet has BlogID 0. Width and Height are 0 when it is not an image,
+// otherwise they are the size the image is displayed at. Variants are not stored, the MediaManager fills them in.
+type Media struct {
+	ID          int64
 	UserID      int64
-	Permissions map[string]any
+	BlogID      int64
+	Key         string
+	ContentType string
+	Size        int64
+	Width       int
+	Height      int
+	CreatedAt   time.Time
+	Variants    []MediaVariant
+}
+
+// MediaVariant is a smaller copy of an image, e.g. "w640" in "webp". A cropped variant is cut from the center of the
+// image, the others keep its aspect ratio.
+type MediaVariant struct {
+	Name   string
+	Format string
+	Width  int
+	Height int
+	Crop   bool
+}
+
+func (v MediaVariant) ContentType() string {
+	return "image/" + v.Format
+}
+
+// IdempotentRequest is a request made with an Idempotency-Key, the user and the key identify it. Fingerprint is the
+// hash of what was asked, a retry with the same key has to ask the same. Status, ContentType and Body are the response,
+// the status is 0 while the first request is still running.
+type IdempotentRequest struct {
+	UserID      int64
+	Key         string
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// Done tells whether the response is there to be replayed
+func (r *IdempotentRequest) Done() bool {
+	return r.Status != 0
+}
+
+// RateLimit is a token bucket, it holds up to Burst tokens and gets one back every Interval. A request takes a token,
+// so Burst requests can come at once and then one every Interval.
+type RateLimit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// RateLimitResult is what the bucket said about a request. Remaining is how many tokens are left, RetryAfter when the
+// next one is back if the request was turned down, and ResetAfter when the bucket is full again.
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
+
+// CustomClaims represents the custom claims for the JWT token. TokenVersion is the one of the user when the token was
+// issued.
+type CustomClaims struct {
+	UserID       int64
+	TokenVersion int
+	Permissions  map[string]any
 	jwt.RegisteredClaims
 }
 
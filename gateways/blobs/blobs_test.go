@@ -0,0 +1,149 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+// s3EndpointEnv points the tests at an existing S3 compatible service, e.g. localhost:9000 for a MinIO with the
+// default minioadmin credentials. When it is not set the tests start a throwaway MinIO container if docker is
+// available, otherwise the S3 tests are skipped.
+const s3EndpointEnv = "BLOGZILLA_TEST_S3_ENDPOINT"
+
+var (
+	s3Endpoint  string
+	bucketCount int64
+)
+
+func TestMain(m *testing.M) {
+	s3Endpoint = os.Getenv(s3EndpointEnv)
+	stop := func() {}
+	if s3Endpoint == "" {
+		var err error
+		s3Endpoint, stop, err = startMinIOContainer()
+		if err != nil {
+			fmt.Printf("minio is not available, the s3 tests will be skipped: %v\n", err)
+		}
+	}
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create the store: %v", err)
+	}
+	testStore(t, store)
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../outside", ".."} {
+		if err := store.Put(context.Background(), key, "text/plain", 1, strings.NewReader("x")); err == nil {
+			t.Errorf("expected the key %q to be rejected", key)
+		}
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	if s3Endpoint == "" {
+		t.Skipf("set %s or install docker to run the S3 tests", s3EndpointEnv)
+	}
+	// every run gets its own bucket, so the tests do not see each other's objects
+	store, err := NewS3Store(context.Background(), config.S3BlobConfig{
+		Endpoint:  s3Endpoint,
+		Region:    "us-east-1",
+		Bucket:    fmt.Sprintf("blogzilla-test-%d-%d", time.Now().Unix(), atomic.AddInt64(&bucketCount, 1)),
+		AccessKey: "minioadmin",
+		SecretKey: "minioadmin",
+	})
+	if err != nil {
+		t.Fatalf("failed to create the store: %v", err)
+	}
+	testStore(t, store)
+}
+
+func testStore(t *testing.T, store domain.BlobStore) {
+	ctx := context.Background()
+	content := "not really a png"
+	if err := store.Put(ctx, "media/ab/cd.png", "image/png", int64(len(content)), strings.NewReader(content)); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	reader, err := store.Get(ctx, "media/ab/cd.png")
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	read, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(read) != content {
+		t.Errorf("expected %q, got %q, %v", content, read, err)
+	}
+
+	var notFoundErr *domain.NotFoundError
+	if _, err := store.Get(ctx, "media/ab/missing.png"); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	if err := store.Delete(ctx, "media/ab/cd.png"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "media/ab/cd.png"); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error after the delete, got %v", err)
+	}
+	if err := store.Delete(ctx, "media/ab/cd.png"); err != nil {
+		t.Errorf("expected deleting a missing blob to succeed, got %v", err)
+	}
+}
+
+func startMinIOContainer() (string, func(), error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", func() {}, err
+	}
+	out, err := exec.Command("docker", "run", "--detach", "--rm",
+		"--publish", "127.0.0.1::9000",
+		"minio/minio", "server", "/data").Output()
+	if err != nil {
+		return "", func() {}, fmt.Errorf("failed to start the minio container: %w", err)
+	}
+	containerID := strings.TrimSpace(string(out))
+	stop := func() {
+		exec.Command("docker", "stop", containerID).Run()
+	}
+
+	out, err = exec.Command("docker", "port", containerID, "9000/tcp").Output()
+	if err != nil {
+		stop()
+		return "", func() {}, fmt.Errorf("failed to get the minio port: %w", err)
+	}
+	endpoint := strings.TrimSpace(strings.Split(string(out), "\n")[0])
+
+	// wait for minio to accept requests
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		response, err := http.Get("http://" + endpoint + "/minio/health/ready")
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode == http.StatusOK {
+				return endpoint, stop, nil
+			}
+			err = fmt.Errorf("status %d", response.StatusCode)
+		}
+		if time.Now().After(deadline) {
+			stop()
+			return "", func() {}, fmt.Errorf("minio did not become ready: %w", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Package blobs has the implementations of the domain BlobStore, the files on the local disk for a single node and
+any S3 compatible service (AWS S3, MinIO, ...) when the nodes have to share the uploads.
+*/
+package blobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+var logger = utils.Logger()
+
+// LocalStore keeps every blob in a file under the directory, the key is its path relative to the directory
+type LocalStore struct {
+	dir string
+}
+
+func NewLocalStore(dir string) (domain.BlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create the media directory: %v", err)
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, contentType string, size int64, content io.Reader) error {
+	file, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	// the readers never see a partly written file
+	temp, err := os.CreateTemp(filepath.Dir(file), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	written, err := io.Copy(temp, content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("expected %d bytes, got %d", size, written)
+	}
+	if err != nil {
+		logger.WithError(err).Errorf("failed to write blob. key: %s", key)
+		return err
+	}
+	return os.Rename(temp.Name(), file)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, domain.NewNotFoundError("blob", key)
+	}
+	return content, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	file, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path rejects the keys which would end up outside of the directory
+func (s *LocalStore) path(key string) (string, error) {
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return "", fmt.Errorf("invalid blob key '%s'", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,79 @@
+package blobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Store keeps the blobs as the objects of a bucket of an S3 compatible service
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Store creates the bucket when it does not exist yet
+func NewS3Store(ctx context.Context, conf config.S3BlobConfig) (domain.BlobStore, error) {
+	client, err := minio.New(conf.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(conf.AccessKey, conf.SecretKey, ""),
+		Secure: conf.UseSSL,
+		Region: conf.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 config: %v", err)
+	}
+
+	exists, err := client.BucketExists(ctx, conf.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach the s3 bucket: %v", err)
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, conf.Bucket, minio.MakeBucketOptions{Region: conf.Region})
+		if err != nil {
+			return nil, fmt.Errorf("unable to create the s3 bucket: %v", err)
+		}
+	}
+	return &S3Store{client: client, bucket: conf.Bucket}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, contentType string, size int64, content io.Reader) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, content, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		logger.WithError(err).Errorf("failed to write blob. key: %s", key)
+	}
+	return err
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err == nil {
+		// GetObject does not send the request until the object is read
+		_, err = object.Stat()
+	}
+	if err != nil {
+		if object != nil {
+			object.Close()
+		}
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, domain.NewNotFoundError("blob", key)
+		}
+		logger.WithError(err).Errorf("failed to read blob. key: %s", key)
+		return nil, err
+	}
+	return object, nil
+}
+
+// Delete S3 does not complain about a missing object either
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil {
+		logger.WithError(err).Errorf("failed to delete blob. key: %s", key)
+	}
+	return err
+}
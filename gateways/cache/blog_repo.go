@@ -0,0 +1,268 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+// searchGenerationKey has the generation of the cached searches, the searches are cached under it
+const searchGenerationKey = "blog-search-generation"
+
+/*
+CachedBlogRepo reads the blogs by id and by slug through the cache, and the pages of the searches too when searchTTL
+is not 0. The feeds go to the repository every time. The blogs are cached as JSON, so that the callers which fill in
+the rest of a blog do not change the cached one.
+
+A change of a blog deletes it from the cache right away and, when it was made in a transaction of the TxManager of
+this package, once more after the transaction is over. A blog read while the transaction was running could have been
+cached in between, the second delete drops it. The reads within a transaction go to the repository and are not cached,
+they see the changes of the transaction which may never be committed. A slug always leads to the same blog, it is
+cached as the id.
+
+Any change of any blog may change any search, so the searches are cached under a generation which a change deletes
+like a blog, the next search starts a new one. The searches of the old generation are left to expire, searchTTL is
+kept short as every change throws all of them away.
+*/
+type CachedBlogRepo struct {
+	domain.BlogRepo
+	cache     domain.Cache
+	ttl       time.Duration
+	searchTTL time.Duration
+}
+
+func NewCachedBlogRepo(next domain.BlogRepo, cache domain.Cache, ttl time.Duration, searchTTL time.Duration) domain.BlogRepo {
+	return &CachedBlogRepo{
+		BlogRepo:  next,
+		cache:     cache,
+		ttl:       ttl,
+		searchTTL: searchTTL,
+	}
+}
+
+func blogKey(blogID int64) string {
+	return fmt.Sprintf("blog:%d", blogID)
+}
+
+func slugKey(slug string) string {
+	return "blog-slug:" + slug
+}
+
+func (r *CachedBlogRepo) Get(ctx context.Context, blogID int64) (*domain.Blog, error) {
+	if inTx(ctx) {
+		return r.BlogRepo.Get(ctx, blogID)
+	}
+	if cached, ok := r.get(ctx, blogKey(blogID)); ok {
+		var blog domain.Blog
+		if err := json.Unmarshal(cached, &blog); err == nil {
+			return &blog, nil
+		}
+	}
+	blog, err := r.BlogRepo.Get(ctx, blogID)
+	if err != nil {
+		return nil, err
+	}
+	r.setBlog(ctx, blog)
+	return blog, nil
+}
+
+func (r *CachedBlogRepo) GetBySlug(ctx context.Context, slug string) (*domain.Blog, error) {
+	if inTx(ctx) {
+		return r.BlogRepo.GetBySlug(ctx, slug)
+	}
+	if cached, ok := r.get(ctx, slugKey(slug)); ok {
+		if blogID, err := strconv.ParseInt(string(cached), 10, 64); err == nil {
+			return r.Get(ctx, blogID)
+		}
+	}
+	blog, err := r.BlogRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	r.set(ctx, slugKey(slug), []byte(strconv.FormatInt(blog.ID, 10)))
+	r.setBlog(ctx, blog)
+	return blog, nil
+}
+
+// searchKey tells the searches apart by everything which decides their blogs, within the generation
+func searchKey(generation string, access domain.BlogAccess, offset int, limit int, search string) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%v\x00%d\x00%d\x00%d\x00%s", access.Visibilities, access.UserID, offset, limit, search)))
+	return "blog-search:" + generation + ":" + hex.EncodeToString(hash[:16])
+}
+
+func (r *CachedBlogRepo) Search(ctx context.Context, access domain.BlogAccess, offset int, limit int, search string) ([]*domain.Blog, error) {
+	if r.searchTTL <= 0 || inTx(ctx) {
+		return r.BlogRepo.Search(ctx, access, offset, limit, search)
+	}
+	generation, ok := r.searchGeneration(ctx)
+	if !ok {
+		return r.BlogRepo.Search(ctx, access, offset, limit, search)
+	}
+	key := searchKey(generation, access, offset, limit, search)
+	if cached, ok := r.get(ctx, key); ok {
+		var blogs []*domain.Blog
+		if err := json.Unmarshal(cached, &blogs); err == nil {
+			return blogs, nil
+		}
+	}
+	blogs, err := r.BlogRepo.Search(ctx, access, offset, limit, search)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(blogs)
+	if err != nil {
+		logger.WithError(err).Error("failed to encode the search for the cache")
+		return blogs, nil
+	}
+	if err := r.cache.Set(ctx, key, value, r.searchTTL); err != nil {
+		logger.WithError(err).Warnf("failed to write to the cache. key: %s", key)
+	}
+	return blogs, nil
+}
+
+// searchGeneration is the current generation of the searches, a new one when a change deleted it. The searches are not
+// cached when the cache fails.
+func (r *CachedBlogRepo) searchGeneration(ctx context.Context) (string, bool) {
+	if generation, ok := r.get(ctx, searchGenerationKey); ok {
+		return string(generation), true
+	}
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", false
+	}
+	generation := hex.EncodeToString(random)
+	// it outlives the searches cached under it
+	if err := r.cache.Set(ctx, searchGenerationKey, []byte(generation), r.ttl+r.searchTTL); err != nil {
+		logger.WithError(err).Warnf("failed to write to the cache. key: %s", searchGenerationKey)
+		return "", false
+	}
+	return generation, true
+}
+
+func (r *CachedBlogRepo) Create(ctx context.Context, blog *domain.Blog) (int64, error) {
+	defer r.searchesChanged(ctx)
+	return r.BlogRepo.Create(ctx, blog)
+}
+
+func (r *CachedBlogRepo) Reindex(ctx context.Context) (int, error) {
+	defer r.searchesChanged(ctx)
+	return r.BlogRepo.Reindex(ctx)
+}
+
+func (r *CachedBlogRepo) Update(ctx context.Context, blog *domain.Blog) error {
+	defer r.changed(ctx, blog.ID)
+	return r.BlogRepo.Update(ctx, blog)
+}
+
+func (r *CachedBlogRepo) SetSlug(ctx context.Context, blogID int64, slug string) error {
+	defer r.changed(ctx, blogID)
+	return r.BlogRepo.SetSlug(ctx, blogID, slug)
+}
+
+func (r *CachedBlogRepo) SetCommentsEnabled(ctx context.Context, blogID int64, enabled bool) error {
+	defer r.changed(ctx, blogID)
+	return r.BlogRepo.SetCommentsEnabled(ctx, blogID, enabled)
+}
+
+// get is a miss when the cache fails, the blog is read from the repository instead
+func (r *CachedBlogRepo) get(ctx context.Context, key string) ([]byte, bool) {
+	value, ok, err := r.cache.Get(ctx, key)
+	if err != nil {
+		logger.WithError(err).Warnf("failed to read from the cache. key: %s", key)
+		return nil, false
+	}
+	return value, ok
+}
+
+func (r *CachedBlogRepo) setBlog(ctx context.Context, blog *domain.Blog) {
+	value, err := json.Marshal(blog)
+	if err != nil {
+		logger.WithError(err).Errorf("failed to encode blog for the cache. id: %d", blog.ID)
+		return
+	}
+	r.set(ctx, blogKey(blog.ID), value)
+}
+
+func (r *CachedBlogRepo) set(ctx context.Context, key string, value []byte) {
+	if err := r.cache.Set(ctx, key, value, r.ttl); err != nil {
+		logger.WithError(err).Warnf("failed to write to the cache. key: %s", key)
+	}
+}
+
+// changed deletes the blog and the searches from the cache, and again after the transaction when there is one
+func (r *CachedBlogRepo) changed(ctx context.Context, blogID int64) {
+	r.deleteChanged(ctx, blogKey(blogID), searchGenerationKey)
+}
+
+// searchesChanged deletes the searches from the cache, see changed
+func (r *CachedBlogRepo) searchesChanged(ctx context.Context) {
+	r.deleteChanged(ctx, searchGenerationKey)
+}
+
+func (r *CachedBlogRepo) deleteChanged(ctx context.Context, keys ...string) {
+	if changes, inTx := ctx.Value(txChangesKey{}).(*txChanges); inTx {
+		changes.add(keys...)
+	}
+	deleteKeys(ctx, r.cache, keys...)
+}
+
+func deleteKeys(ctx context.Context, cache domain.Cache, keys ...string) {
+	if err := cache.Delete(ctx, keys...); err != nil {
+		// the blog is read again after the ttl at the latest
+		logger.WithError(err).Errorf("failed to delete from the cache. keys: %v", keys)
+	}
+}
+
+type txChangesKey struct{}
+
+// inTx tells whether the context carries a transaction of the TxManager
+func inTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txChangesKey{}).(*txChanges)
+	return ok
+}
+
+// txChanges are the keys changed within a transaction
+type txChanges struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (c *txChanges) add(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = append(c.keys, keys...)
+}
+
+// TxManager deletes the blogs changed within a transaction from the cache once the transaction is over, committed
+// or not, see CachedBlogRepo
+type TxManager struct {
+	next  domain.TxManager
+	cache domain.Cache
+}
+
+func NewTxManager(next domain.TxManager, cache domain.Cache) domain.TxManager {
+	return &TxManager{
+		next:  next,
+		cache: cache,
+	}
+}
+
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if inTx(ctx) {
+		return m.next.WithinTx(ctx, fn)
+	}
+	changes := &txChanges{}
+	err := m.next.WithinTx(context.WithValue(ctx, txChangesKey{}, changes), fn)
+	if len(changes.keys) > 0 {
+		deleteKeys(ctx, m.cache, changes.keys...)
+	}
+	return err
+}
@@ -0,0 +1,261 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/gateways/contract"
+	"github.com/bipuldutta/blogzilla/gateways/memory"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// TestContract the blogs read through the cache behave like the ones of the repository
+func TestContract(t *testing.T) {
+	contract.Run(t, func(t *testing.T, conf *config.Config) contract.Repos {
+		return cachedMemoryRepos(conf, NewMemoryCache(100))
+	})
+}
+
+func TestRedisContract(t *testing.T) {
+	contract.Run(t, func(t *testing.T, conf *config.Config) contract.Repos {
+		return cachedMemoryRepos(conf, newRedisCache(t, miniredis.RunT(t)))
+	})
+}
+
+func cachedMemoryRepos(conf *config.Config, cache domain.Cache) contract.Repos {
+	store := memory.NewStore()
+	authRepo := memory.NewAuthRepo(conf)
+	return contract.Repos{
+		Tx:          NewTxManager(memory.NewTxManager(store), cache),
+		Database:    memory.NewDatabaseRepo(conf, store),
+		Users:       memory.NewUserRepo(store, authRepo),
+		Blogs:       NewCachedBlogRepo(memory.NewBlogRepo(store), cache, time.Minute, time.Minute),
+		Comments:    memory.NewCommentRepo(store),
+		Reactions:   memory.NewReactionRepo(store),
+		Follows:     memory.NewFollowRepo(store),
+		Media:       memory.NewMediaRepo(store),
+		Idempotency: memory.NewIdempotencyRepo(store),
+		Auth:        authRepo,
+	}
+}
+
+func newRedisCache(t *testing.T, server *miniredis.Miniredis) domain.Cache {
+	cache, err := NewRedisCache(context.Background(), config.RedisConfig{Addr: server.Addr()})
+	if err != nil {
+		t.Fatalf("failed to create the cache: %v", err)
+	}
+	return cache
+}
+
+func TestMemoryCache(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryCache(2).(*MemoryCache)
+	cache.now = func() time.Time { return now }
+	testCache(t, cache, func(d time.Duration) { now = now.Add(d) })
+
+	// the least recently used value makes room
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set(ctx, key, []byte(key), time.Minute)
+	}
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Errorf("expected the oldest value to be dropped")
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	testCache(t, newRedisCache(t, server), server.FastForward)
+}
+
+func testCache(t *testing.T, cache domain.Cache, advance func(d time.Duration)) {
+	ctx := context.Background()
+	if _, ok, err := cache.Get(ctx, "unknown"); ok || err != nil {
+		t.Errorf("expected a miss without an error, got %v %v", ok, err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if err := cache.Set(ctx, key, []byte("value of "+key), time.Minute); err != nil {
+			t.Fatalf("failed to set %s: %v", key, err)
+		}
+	}
+	if value, ok, err := cache.Get(ctx, "a"); !ok || err != nil || string(value) != "value of a" {
+		t.Errorf("expected the value of a, got %q %v %v", value, ok, err)
+	}
+
+	if err := cache.Delete(ctx, "a", "unknown"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Errorf("expected a to be deleted")
+	}
+	if _, ok, _ := cache.Get(ctx, "b"); !ok {
+		t.Errorf("expected b to be kept")
+	}
+
+	advance(time.Minute)
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Errorf("expected b to expire")
+	}
+}
+
+// countingBlogRepo counts the reads which get to the repository
+type countingBlogRepo struct {
+	domain.BlogRepo
+	reads    int
+	searches int
+}
+
+func (r *countingBlogRepo) Get(ctx context.Context, blogID int64) (*domain.Blog, error) {
+	r.reads++
+	return r.BlogRepo.Get(ctx, blogID)
+}
+
+func (r *countingBlogRepo) GetBySlug(ctx context.Context, slug string) (*domain.Blog, error) {
+	r.reads++
+	return r.BlogRepo.GetBySlug(ctx, slug)
+}
+
+func (r *countingBlogRepo) Search(ctx context.Context, access domain.BlogAccess, offset int, limit int, search string) ([]*domain.Blog, error) {
+	r.searches++
+	return r.BlogRepo.Search(ctx, access, offset, limit, search)
+}
+
+func TestCachedBlogRepo(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	cache := NewMemoryCache(100)
+	next := &countingBlogRepo{BlogRepo: memory.NewBlogRepo(store)}
+	repo := NewCachedBlogRepo(next, cache, time.Minute, time.Minute)
+	txManager := NewTxManager(memory.NewTxManager(store), cache)
+
+	user, err := memory.NewUserRepo(store, memory.NewAuthRepo(config.NewConfig())).Create(ctx, &domain.User{Username: "gina", Password: "secret"})
+	if err != nil {
+		t.Fatalf("failed to create the user: %v", err)
+	}
+	blogID, err := repo.Create(ctx, &domain.Blog{UserID: user.ID, Title: "Title", Content: "Content", Status: domain.StatusPublished})
+	if err != nil {
+		t.Fatalf("failed to create the blog: %v", err)
+	}
+	if err := repo.SetSlug(ctx, blogID, "title"); err != nil {
+		t.Fatalf("failed to set the slug: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		blog, err := repo.Get(ctx, blogID)
+		if err != nil || blog.Title != "Title" {
+			t.Fatalf("expected the blog, got %+v %v", blog, err)
+		}
+		// the callers fill in the blog, the cached one stays as it was
+		blog.Title = "changed by the caller"
+	}
+	if blog, err := repo.GetBySlug(ctx, "title"); err != nil || blog.ID != blogID {
+		t.Errorf("expected the blog by its slug, got %+v %v", blog, err)
+	}
+	repo.GetBySlug(ctx, "title")
+	if next.reads != 2 {
+		t.Errorf("expected a read by id and one by slug to get to the repository, got %d", next.reads)
+	}
+
+	err = txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := repo.Update(ctx, &domain.Blog{ID: blogID, Title: "Rolled back", Content: "Content"}); err != nil {
+			return err
+		}
+		// the transaction sees its own change, which is not cached
+		if blog, err := repo.Get(ctx, blogID); err != nil || blog.Title != "Rolled back" {
+			t.Errorf("expected the change of the transaction, got %+v %v", blog, err)
+		}
+		// somebody else caches the blog before the transaction is over
+		repo.Get(context.Background(), blogID)
+		return errors.New("roll back")
+	})
+	if err == nil {
+		t.Fatalf("expected the transaction to fail")
+	}
+	reads := next.reads
+	if blog, err := repo.Get(ctx, blogID); err != nil || blog.Title != "Title" || next.reads != reads+1 {
+		t.Errorf("expected the blog to be read again after the transaction, got %+v %v after %d reads", blog, err, next.reads-reads)
+	}
+
+	if err := repo.Update(ctx, &domain.Blog{ID: blogID, Title: "Updated", Content: "Content"}); err != nil {
+		t.Fatalf("failed to update the blog: %v", err)
+	}
+	if blog, err := repo.GetBySlug(ctx, "title"); err != nil || blog.Title != "Updated" {
+		t.Errorf("expected the update to be seen by slug, got %+v %v", blog, err)
+	}
+	if err := repo.SetCommentsEnabled(ctx, blogID, false); err != nil {
+		t.Fatalf("failed to turn the comments off: %v", err)
+	}
+	if blog, err := repo.Get(ctx, blogID); err != nil || blog.CommentsEnabled {
+		t.Errorf("expected the comments to be off, got %+v %v", blog, err)
+	}
+
+	// the searches are cached apart by everything which decides their blogs, until a blog changes
+	public := domain.BlogAccess{Visibilities: []domain.Visibility{domain.VisibilityPublic, domain.VisibilityMembersOnly}}
+	search := func(ctx context.Context, access domain.BlogAccess, offset int, query string) []*domain.Blog {
+		t.Helper()
+		blogs, err := repo.Search(ctx, access, offset, 10, query)
+		if err != nil {
+			t.Fatalf("failed to search: %v", err)
+		}
+		return blogs
+	}
+	for _, tc := range []struct {
+		name     string
+		access   domain.BlogAccess
+		offset   int
+		query    string
+		blogs    int
+		searches int // the searches which got to the repository so far
+	}{
+		{"first", public, 0, "", 1, 1},
+		{"same", public, 0, "", 1, 1},
+		{"other query", public, 0, "nothing", 0, 2},
+		{"other offset", public, 1, "", 0, 3},
+		{"other viewer", domain.BlogAccess{Visibilities: public.Visibilities, UserID: user.ID}, 0, "", 1, 4},
+		{"same again", public, 0, "", 1, 4},
+	} {
+		if blogs := search(ctx, tc.access, tc.offset, tc.query); len(blogs) != tc.blogs || next.searches != tc.searches {
+			t.Errorf("%s: expected %d blogs after %d searches, got %d after %d", tc.name, tc.blogs, tc.searches, len(blogs), next.searches)
+		}
+	}
+	search(ctx, public, 0, "")[0].Title = "changed by the caller"
+	if blogs := search(ctx, public, 0, ""); blogs[0].Title != "Updated" {
+		t.Errorf("expected the cached search to stay as it was, got %+v", blogs[0])
+	}
+
+	if _, err := repo.Create(ctx, &domain.Blog{UserID: user.ID, Title: "Second", Content: "Content", Status: domain.StatusPublished}); err != nil {
+		t.Fatalf("failed to create the blog: %v", err)
+	}
+	if blogs := search(ctx, public, 0, ""); len(blogs) != 2 || next.searches != 5 {
+		t.Errorf("expected a new blog to be found right away, got %d blogs after %d searches", len(blogs), next.searches)
+	}
+	err = txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := repo.Update(ctx, &domain.Blog{ID: blogID, Title: "Renamed", Content: "Content"}); err != nil {
+			return err
+		}
+		// the transaction searches the repository, somebody else caches the search before it is over
+		if blogs := search(ctx, public, 0, "Renamed"); len(blogs) != 1 {
+			t.Errorf("expected the change of the transaction, got %+v", blogs)
+		}
+		search(context.Background(), public, 0, "Renamed")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to update the blog: %v", err)
+	}
+	if blogs := search(ctx, public, 0, "Renamed"); len(blogs) != 1 {
+		t.Errorf("expected the search to see the committed change, got %+v", blogs)
+	}
+
+	uncached := NewCachedBlogRepo(next, cache, time.Minute, 0)
+	searches := next.searches
+	uncached.Search(ctx, public, 0, 10, "")
+	uncached.Search(ctx, public, 0, 10, "")
+	if next.searches != searches+2 {
+		t.Errorf("expected the searches to go to the repository without a search ttl, got %d", next.searches-searches)
+	}
+}
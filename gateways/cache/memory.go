@@ -0,0 +1,57 @@
+/*
+Package cache has the implementations of the domain Cache, the most recently used values in memory for a single node
+and Redis when the nodes of a cluster have to share them, and the read-through cache of the blogs on top of them.
+*/
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+var logger = utils.Logger()
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// MemoryCache keeps the most recently used values, the least recently used one is dropped once it is full
+type MemoryCache struct {
+	entries *utils.LRU[string, memoryEntry]
+	now     func() time.Time
+}
+
+func NewMemoryCache(size int) domain.Cache {
+	return &MemoryCache{
+		entries: utils.NewLRU[string, memoryEntry](size),
+		now:     time.Now,
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if !c.now().Before(entry.expires) {
+		c.entries.Remove(key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.entries.Add(key, memoryEntry{value: value, expires: c.now().Add(ttl)})
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		c.entries.Remove(key)
+	}
+	return nil
+}
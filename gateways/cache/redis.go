@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix keeps the cached values apart from anything else in the Redis
+const redisKeyPrefix = "blogzilla:cache:"
+
+// RedisCache keeps the values in Redis, so that the servers of a cluster share them and see each other's deletes
+type RedisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache fails when the Redis can not be reached
+func NewRedisCache(ctx context.Context, conf config.RedisConfig) (domain.Cache, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.Addr,
+		Password: conf.Password,
+		DB:       conf.DB,
+	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("unable to reach redis: %v", err)
+	}
+	return &RedisCache{client: client}, nil
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, redisKeyPrefix+key, value, ttl).Err()
+}
+
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = redisKeyPrefix + key
+	}
+	return c.client.Del(ctx, prefixed...).Err()
+}
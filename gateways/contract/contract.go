@@ -0,0 +1,1361 @@
+/*
+Package contract is the behaviour every implementation of the domain repositories has to follow. The test
+files of each implementation call Run with a factory that hands out a fresh, empty set of repositories.
+*/
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/usecases"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+// Repos is one complete set of repositories sharing the same storage
+type Repos struct {
+	Tx          domain.TxManager
+	Database    domain.DatabaseRepo
+	Users       domain.UserRepo
+	Blogs       domain.BlogRepo
+	Comments    domain.CommentRepo
+	Reactions   domain.ReactionRepo
+	Follows     domain.FollowRepo
+	Media       domain.MediaRepo
+	Idempotency domain.IdempotencyRepo
+	Auth        domain.AuthRepo
+}
+
+// Factory returns repositories backed by empty storage, it is called once per test
+type Factory func(t *testing.T, conf *config.Config) Repos
+
+// Run runs the whole contract suite against the repositories created by the factory
+func Run(t *testing.T, factory Factory) {
+	t.Run("Initialize", func(t *testing.T) { testInitialize(t, factory) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, factory) })
+	t.Run("ConcurrentRegistration", func(t *testing.T) { testConcurrentRegistration(t, factory) })
+	t.Run("Login", func(t *testing.T) { testLogin(t, factory) })
+	t.Run("Administration", func(t *testing.T) { testAdministration(t, factory) })
+	t.Run("Transactions", func(t *testing.T) { testTransactions(t, factory) })
+	t.Run("Blogs", func(t *testing.T) { testBlogs(t, factory) })
+	t.Run("Search", func(t *testing.T) { testSearch(t, factory) })
+	t.Run("Comments", func(t *testing.T) { testComments(t, factory) })
+	t.Run("Reactions", func(t *testing.T) { testReactions(t, factory) })
+	t.Run("ConcurrentReactions", func(t *testing.T) { testConcurrentReactions(t, factory) })
+	t.Run("Follows", func(t *testing.T) { testFollows(t, factory) })
+	t.Run("Feed", func(t *testing.T) { testFeed(t, factory) })
+	t.Run("Latest", func(t *testing.T) { testLatest(t, factory) })
+	t.Run("Visibility", func(t *testing.T) { testVisibility(t, factory) })
+	t.Run("Drafts", func(t *testing.T) { testDrafts(t, factory) })
+	t.Run("ContentFormats", func(t *testing.T) { testContentFormats(t, factory) })
+	t.Run("Slugs", func(t *testing.T) { testSlugs(t, factory) })
+	t.Run("Media", func(t *testing.T) { testMedia(t, factory) })
+	t.Run("Idempotency", func(t *testing.T) { testIdempotency(t, factory) })
+	t.Run("ConcurrentIdempotentRequests", func(t *testing.T) { testConcurrentIdempotentRequests(t, factory) })
+}
+
+// setUp creates the repositories and initializes the storage the same way the server does on start up
+func setUp(t *testing.T, factory Factory) (*config.Config, Repos) {
+	t.Helper()
+	conf := config.NewConfig()
+	// the tests log in as the default user, the shipped config has none
+	conf.DefaultUser.Password = "admin"
+	repos := factory(t, conf)
+	if err := newDatabaseManager(conf, repos).Initialize(context.Background()); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	return conf, repos
+}
+
+func newDatabaseManager(conf *config.Config, repos Repos) *usecases.DatabaseManager {
+	return usecases.NewDatabaseManager(conf, repos.Tx, repos.Database, repos.Users)
+}
+
+// everyBlog is the access of an admin, the lists have the blogs of every visibility
+var everyBlog = domain.BlogAccess{Visibilities: []domain.Visibility{
+	domain.VisibilityPublic, domain.VisibilityUnlisted, domain.VisibilityMembersOnly, domain.VisibilityPrivate}}
+
+// createUser registers a user the way the API does, i.e. along with the default roles
+func createUser(t *testing.T, repos Repos, username string) *domain.User {
+	t.Helper()
+	user, err := usecases.NewUserManager(repos.Tx, repos.Users).Create(context.Background(), &domain.User{
+		Username:  username,
+		Password:  "secret-" + username,
+		FirstName: "First " + username,
+		LastName:  "Last " + username,
+	})
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", username, err)
+	}
+	return user
+}
+
+func testInitialize(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	conf, repos := setUp(t, factory)
+
+	// a restart must not fail nor create a second admin
+	if err := newDatabaseManager(conf, repos).Initialize(ctx); err != nil {
+		t.Fatalf("second initialization failed: %v", err)
+	}
+
+	admin, err := repos.Users.GetUserByUsername(ctx, conf.DefaultUser.Username)
+	if err != nil || admin == nil {
+		t.Fatalf("expected the default user to exist, got %v, %v", admin, err)
+	}
+
+	for roleName, permission := range map[string]string{
+		utils.AdminRole:  utils.ManageSystemPermission,
+		utils.EditorRole: utils.CreateBlogPermission,
+		utils.ViewerRole: utils.ReadBlogPermission,
+	} {
+		role, err := repos.Users.GetRoleByName(ctx, roleName)
+		if err != nil {
+			t.Fatalf("failed to get role %s: %v", roleName, err)
+		}
+		if role.ID <= 0 || role.Name != roleName || !contains(role.Permissions, permission) {
+			t.Errorf("unexpected role %s: %+v", roleName, role)
+		}
+	}
+
+	_, err = repos.Users.GetRoleByName(ctx, "nobody")
+	var notFoundErr *domain.NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown role, got %v", err)
+	}
+
+	// the admin gets every admin permission on top of the editor/viewer ones
+	assertPermissions(t, conf, repos, conf.DefaultUser.Username, conf.DefaultUser.Password,
+		[]string{utils.ManageSystemPermission, utils.CreateUserPermission, utils.CreateBlogPermission}, nil)
+}
+
+func testUsers(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+
+	user := createUser(t, repos, "alice")
+	if user.ID <= 0 || user.Username != "alice" || user.FirstName != "First alice" || user.LastName != "Last alice" {
+		t.Errorf("unexpected created user: %+v", user)
+	}
+	if user.Password == "secret-alice" {
+		t.Errorf("the password must be stored hashed")
+	}
+	if user.CreatedAt.IsZero() || user.UpdatedAt.IsZero() {
+		t.Errorf("expected the timestamps to be set: %+v", user)
+	}
+
+	found, err := repos.Users.GetUserByUsername(ctx, "alice")
+	if err != nil || found == nil || found.ID != user.ID {
+		t.Fatalf("expected to find alice, got %+v, %v", found, err)
+	}
+
+	missing, err := repos.Users.GetUserByUsername(ctx, "bob")
+	if err != nil || missing != nil {
+		t.Errorf("expected no user and no error for an unknown username, got %+v, %v", missing, err)
+	}
+
+	// the unknown IDs are left out, the repeated ones found once
+	other := createUser(t, repos, "amy")
+	users, err := repos.Users.GetUsersByIDs(ctx, user.ID, other.ID, user.ID, other.ID+1000)
+	if err != nil || len(users) != 2 || users[user.ID].Username != "alice" || users[other.ID].LastName != "Last amy" || users[other.ID].CreatedAt.IsZero() {
+		t.Errorf("expected alice and amy, got %+v, %v", users, err)
+	}
+	if users, err := repos.Users.GetUsersByIDs(ctx); err != nil || len(users) != 0 {
+		t.Errorf("expected no users for no IDs, got %+v, %v", users, err)
+	}
+
+	var conflictErr *domain.ConflictError
+	if err := repos.Users.AssignRoles(ctx, user.ID, mustGetRole(t, repos, utils.EditorRole).ID); !errors.As(err, &conflictErr) {
+		t.Errorf("expected a conflict when assigning a role twice, got %v", err)
+	}
+
+	_, err = repos.Users.Create(ctx, &domain.User{Username: "alice", Password: "other"})
+	if !errors.As(err, &conflictErr) {
+		t.Errorf("expected a conflict for a duplicate username, got %v", err)
+	}
+
+	// the repo stores the hash the use case made before its transaction
+	hashedPassword, err := utils.HashPassword(ctx, "secret-hank")
+	if err != nil {
+		t.Fatalf("failed to hash the password: %v", err)
+	}
+	hank, err := repos.Users.Create(ctx, &domain.User{Username: "hank", Password: hashedPassword, FirstName: "Hank", LastName: "Hashed"})
+	if err != nil || hank.Password != hashedPassword {
+		t.Fatalf("expected hank to be created with the hash, got %+v, %v", hank, err)
+	}
+	if _, err := repos.Users.Login(ctx, "hank", "secret-hank"); err != nil {
+		t.Errorf("expected hank to log in with the hashed password, got %v", err)
+	}
+}
+
+func testConcurrentRegistration(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+
+	const attempts = 5
+	userManager := usecases.NewUserManager(repos.Tx, repos.Users)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := userManager.Create(ctx, &domain.User{
+				Username:  "carol",
+				Password:  fmt.Sprintf("secret%d", i),
+				FirstName: "Carol",
+				LastName:  "Concurrent",
+			})
+			if err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("expected exactly one of the concurrent registrations to succeed, got %d", created)
+	}
+}
+
+func testLogin(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	conf, repos := setUp(t, factory)
+	createUser(t, repos, "dave")
+
+	// new users are editors and viewers, nothing more
+	assertPermissions(t, conf, repos, "dave", "secret-dave",
+		[]string{utils.CreateBlogPermission, utils.ReadBlogPermission, utils.ReadUserPermission},
+		[]string{utils.CreateUserPermission, utils.ManageSystemPermission})
+
+	var unauthorizedErr *domain.UnauthorizedError
+	if _, err := repos.Users.Login(ctx, "dave", "wrong"); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected an unauthorized error for a wrong password, got %v", err)
+	}
+	if _, err := repos.Users.Login(ctx, "nobody", "secret"); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected an unauthorized error for an unknown user, got %v", err)
+	}
+}
+
+func testAdministration(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	conf, repos := setUp(t, factory)
+	olga := createUser(t, repos, "olga")
+	oscar := createUser(t, repos, "oscar")
+
+	// ordered by ID, after the default user
+	users, err := repos.Users.ListUsers(ctx, 1, 10)
+	if err != nil || len(users) != 2 || users[0].ID != olga.ID || users[1].ID != oscar.ID || users[1].LastName != "Last oscar" {
+		t.Fatalf("expected olga and oscar, got %+v, %v", users, err)
+	}
+	if users, err := repos.Users.ListUsers(ctx, 3, 10); err != nil || len(users) != 0 {
+		t.Errorf("expected no users past the end, got %+v, %v", users, err)
+	}
+
+	// a failed revocation is undone along with its transaction
+	if roles, err := repos.Users.GetUserRoles(ctx, olga.ID); err != nil || fmt.Sprint(roles) != fmt.Sprint([]string{utils.EditorRole, utils.ViewerRole}) {
+		t.Errorf("expected olga to be an editor and a viewer, got %v, %v", roles, err)
+	}
+	var conflictErr *domain.ConflictError
+	err = repos.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		return repos.Users.RevokeRoles(ctx, olga.ID, mustGetRole(t, repos, utils.EditorRole).ID, mustGetRole(t, repos, utils.AdminRole).ID)
+	})
+	if !errors.As(err, &conflictErr) {
+		t.Errorf("expected a conflict when revoking a role olga does not have, got %v", err)
+	}
+	if roles, err := repos.Users.GetUserRoles(ctx, olga.ID); err != nil || len(roles) != 2 {
+		t.Errorf("expected olga to keep both roles, got %v, %v", roles, err)
+	}
+	if err := repos.Users.RevokeRoles(ctx, olga.ID, mustGetRole(t, repos, utils.EditorRole).ID); err != nil {
+		t.Fatalf("failed to revoke the editor role: %v", err)
+	}
+	permissions, err := repos.Users.GetPermissions(ctx, olga.ID)
+	_, viewer := permissions[utils.ReadBlogPermission]
+	_, editor := permissions[utils.CreateBlogPermission]
+	if err != nil || !viewer || editor {
+		t.Errorf("expected the permissions of a viewer only, got %v, %v", permissions, err)
+	}
+
+	// a disabled user can not log in, not even with the right password
+	if err := repos.Users.SetDisabled(ctx, oscar.ID, true); err != nil {
+		t.Fatalf("failed to disable oscar: %v", err)
+	}
+	var forbiddenErr *domain.ForbiddenError
+	if _, err := repos.Users.Login(ctx, "oscar", "secret-oscar"); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected a forbidden error for a disabled user, got %v", err)
+	}
+	var unauthorizedErr *domain.UnauthorizedError
+	if _, err := repos.Users.Login(ctx, "oscar", "wrong"); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected an unauthorized error for a wrong password of a disabled user, got %v", err)
+	}
+	if user, err := repos.Users.GetUserByUsername(ctx, "oscar"); err != nil || !user.Disabled {
+		t.Errorf("expected oscar to be disabled, got %+v, %v", user, err)
+	}
+	if err := repos.Users.SetDisabled(ctx, oscar.ID, false); err != nil {
+		t.Fatalf("failed to enable oscar: %v", err)
+	}
+	assertPermissions(t, conf, repos, "oscar", "secret-oscar", []string{utils.CreateBlogPermission}, nil)
+
+	// the new password replaces the old one
+	hashedPassword, err := utils.HashPassword(ctx, "second-password")
+	if err != nil {
+		t.Fatalf("failed to hash the password: %v", err)
+	}
+	if err := repos.Users.SetPassword(ctx, olga.ID, hashedPassword); err != nil {
+		t.Fatalf("failed to set the password: %v", err)
+	}
+	if _, err := repos.Users.Login(ctx, "olga", "secret-olga"); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected the old password to be rejected, got %v", err)
+	}
+	if _, err := repos.Users.Login(ctx, "olga", "second-password"); err != nil {
+		t.Errorf("expected olga to log in with the new password, got %v", err)
+	}
+
+	// every revocation bumps the token version
+	for i := 0; i < 2; i++ {
+		if err := repos.Users.RevokeTokens(ctx, olga.ID); err != nil {
+			t.Fatalf("failed to revoke the tokens: %v", err)
+		}
+	}
+	if user, err := repos.Users.GetUserByID(ctx, olga.ID); err != nil || user.TokenVersion != olga.TokenVersion+2 {
+		t.Errorf("expected the token version %d, got %+v, %v", olga.TokenVersion+2, user, err)
+	}
+
+	var notFoundErr *domain.NotFoundError
+	for name, change := range map[string]func(userID int64) error{
+		"disabled":       func(userID int64) error { return repos.Users.SetDisabled(ctx, userID, true) },
+		"password":       func(userID int64) error { return repos.Users.SetPassword(ctx, userID, hashedPassword) },
+		"tokens revoked": func(userID int64) error { return repos.Users.RevokeTokens(ctx, userID) },
+	} {
+		if err := change(oscar.ID + 1000); !errors.As(err, &notFoundErr) {
+			t.Errorf("%s: expected a not found error for an unknown user, got %v", name, err)
+		}
+	}
+
+	// the search still finds the blogs after the reindex
+	if _, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: olga.ID, Title: "Reindexed", Content: "still searchable"}); err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	if count, err := repos.Blogs.Reindex(ctx); err != nil || count != 1 {
+		t.Fatalf("expected one blog to be reindexed, got %d, %v", count, err)
+	}
+	if blogs, err := repos.Blogs.Search(ctx, everyBlog, 0, 10, "searchable"); err != nil || len(blogs) != 1 {
+		t.Errorf("expected the blog to be found after the reindex, got %+v, %v", blogs, err)
+	}
+}
+
+func testTransactions(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	failure := errors.New("failure")
+
+	// a failure after several writes undoes all of them
+	err := repos.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := repos.Users.Create(ctx, &domain.User{Username: "gina", Password: "secret"})
+		if err != nil {
+			return err
+		}
+		if err := repos.Users.AssignRoles(ctx, user.ID, mustGetRole(t, repos, utils.ViewerRole).ID); err != nil {
+			return err
+		}
+		// joins the outer transaction, so its write is undone as well
+		err = repos.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			_, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: user.ID, Title: "Title", Content: "Content"})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected the error of the function, got %v", err)
+	}
+	if user, err := repos.Users.GetUserByUsername(ctx, "gina"); err != nil || user != nil {
+		t.Errorf("expected the user to be rolled back, got %+v, %v", user, err)
+	}
+	if blogs, err := repos.Blogs.Search(ctx, everyBlog, 0, 10, ""); err != nil || len(blogs) != 0 {
+		t.Errorf("expected the blog to be rolled back, got %d blogs, %v", len(blogs), err)
+	}
+
+	// a failed role assignment does not leave a user without roles behind
+	userManager := usecases.NewUserManager(repos.Tx, repos.Users)
+	err = repos.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := repos.Users.Create(ctx, &domain.User{Username: "gina", Password: "secret"})
+		if err != nil {
+			return err
+		}
+		return userManager.AssignRoles(ctx, user.ID, utils.ViewerRole, "nobody")
+	})
+	var notFoundErr *domain.NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		t.Fatalf("expected a not found error for the unknown role, got %v", err)
+	}
+	if user, err := repos.Users.GetUserByUsername(ctx, "gina"); err != nil || user != nil {
+		t.Errorf("expected the user to be rolled back, got %+v, %v", user, err)
+	}
+
+	// and a successful one is committed
+	err = repos.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := repos.Users.Create(ctx, &domain.User{Username: "gina", Password: "secret"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if user, err := repos.Users.GetUserByUsername(ctx, "gina"); err != nil || user == nil {
+		t.Errorf("expected the user to be committed, got %+v, %v", user, err)
+	}
+}
+
+func testBlogs(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	user := createUser(t, repos, "erin")
+
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: user.ID, Title: "Title", Content: "Content", Tags: "a,b"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+
+	blog, err := repos.Blogs.Get(ctx, blogID)
+	if err != nil {
+		t.Fatalf("failed to get blog: %v", err)
+	}
+	if blog.ID != blogID || blog.UserID != user.ID || blog.Title != "Title" || blog.Content != "Content" || blog.Tags != "a,b" {
+		t.Errorf("unexpected blog: %+v", blog)
+	}
+	if blog.CreatedAt.IsZero() || blog.UpdatedAt.IsZero() {
+		t.Errorf("expected the timestamps to be set: %+v", blog)
+	}
+	if !blog.CommentsEnabled {
+		t.Errorf("expected the comments to be enabled by default: %+v", blog)
+	}
+
+	if err := repos.Blogs.SetCommentsEnabled(ctx, blogID, false); err != nil {
+		t.Fatalf("failed to turn the comments off: %v", err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, blogID); err != nil || blog.CommentsEnabled {
+		t.Errorf("expected the comments to be turned off, got %+v, %v", blog, err)
+	}
+
+	_, err = repos.Blogs.Get(ctx, blogID+1000)
+	var notFoundErr *domain.NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown blog, got %v", err)
+	}
+
+	if _, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: user.ID + 1000, Title: "Orphan", Content: "Content"}); err == nil {
+		t.Errorf("expected an error when the creator does not exist")
+	}
+}
+
+func testSearch(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	user := createUser(t, repos, "frank")
+
+	// created oldest to newest
+	var ids []int64
+	for _, blog := range []domain.Blog{
+		{Title: "Go generics", Content: "type parameters", Tags: "go"},
+		{Title: "Cooking", Content: "how to bake bread", Tags: "food"},
+		{Title: "Concurrency", Content: "channels in GO", Tags: "go,channels"},
+		{Title: "Travel", Content: "Lisbon", Tags: "travel,GOals"},
+	} {
+		blog.UserID = user.ID
+		blogID, err := repos.Blogs.Create(ctx, &blog)
+		if err != nil {
+			t.Fatalf("failed to create blog: %v", err)
+		}
+		ids = append(ids, blogID)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		offset   int
+		limit    int
+		search   string
+		expected []int64
+	}{
+		{"everything newest first", 0, 10, "", []int64{ids[3], ids[2], ids[1], ids[0]}},
+		{"case insensitive over title, content and tags", 0, 10, "go", []int64{ids[3], ids[2], ids[0]}},
+		{"content only", 0, 10, "BREAD", []int64{ids[1]}},
+		{"first page", 0, 2, "go", []int64{ids[3], ids[2]}},
+		{"second page", 2, 2, "go", []int64{ids[0]}},
+		{"past the end", 4, 2, "", nil},
+		{"no match", 0, 10, "rust", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			blogs, err := repos.Blogs.Search(ctx, everyBlog, tc.offset, tc.limit, tc.search)
+			if err != nil {
+				t.Fatalf("search failed: %v", err)
+			}
+			var found []int64
+			for _, blog := range blogs {
+				found = append(found, blog.ID)
+			}
+			if fmt.Sprint(found) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, found)
+			}
+		})
+	}
+}
+
+func testComments(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	user := createUser(t, repos, "grace")
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: user.ID, Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	otherBlogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: user.ID, Title: "Other", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+
+	create := func(blogID int64, parent *domain.Comment, content string, status domain.CommentStatus) *domain.Comment {
+		t.Helper()
+		comment := &domain.Comment{BlogID: blogID, UserID: user.ID, Content: content, Status: status}
+		if parent != nil {
+			comment.ParentID, comment.Depth = parent.ID, parent.Depth+1
+		}
+		commentID, err := repos.Comments.Create(ctx, comment)
+		if err != nil {
+			t.Fatalf("failed to create comment: %v", err)
+		}
+		created, err := repos.Comments.Get(ctx, commentID)
+		if err != nil {
+			t.Fatalf("failed to get comment: %v", err)
+		}
+		return created
+	}
+
+	// created in this order, listed as first, reply, nested reply, second reply, second
+	first := create(blogID, nil, "first", domain.CommentApproved)
+	second := create(blogID, nil, "second", domain.CommentApproved)
+	reply := create(blogID, first, "reply", domain.CommentApproved)
+	nested := create(blogID, reply, "nested", domain.CommentApproved)
+	secondReply := create(blogID, first, "second reply", domain.CommentApproved)
+	pending := create(blogID, nil, "pending", domain.CommentPending)
+	create(otherBlogID, nil, "other blog", domain.CommentApproved)
+
+	if nested.BlogID != blogID || nested.UserID != user.ID || nested.ParentID != reply.ID || nested.Depth != 2 ||
+		nested.Content != "nested" || nested.Status != domain.CommentApproved || nested.CreatedAt.IsZero() || nested.UpdatedAt.IsZero() {
+		t.Errorf("unexpected comment: %+v", nested)
+	}
+	if first.ParentID != 0 || first.Depth != 0 {
+		t.Errorf("unexpected top level comment: %+v", first)
+	}
+
+	_, err = repos.Comments.Get(ctx, pending.ID+1000)
+	var notFoundErr *domain.NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown comment, got %v", err)
+	}
+	if _, err := repos.Comments.Create(ctx, &domain.Comment{BlogID: blogID + 1000, UserID: user.ID, Content: "x", Status: domain.CommentApproved}); err == nil {
+		t.Errorf("expected an error when the blog does not exist")
+	}
+
+	thread := []int64{first.ID, reply.ID, nested.ID, secondReply.ID, second.ID}
+	for _, tc := range []struct {
+		name     string
+		status   domain.CommentStatus
+		offset   int
+		limit    int
+		expected []int64
+	}{
+		{"thread order", domain.CommentApproved, 0, 10, thread},
+		{"first page", domain.CommentApproved, 0, 2, thread[:2]},
+		{"second page", domain.CommentApproved, 2, 2, thread[2:4]},
+		{"past the end", domain.CommentApproved, 5, 2, nil},
+		{"by status", domain.CommentPending, 0, 10, []int64{pending.ID}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			comments, err := repos.Comments.ListByBlog(ctx, blogID, tc.status, tc.offset, tc.limit)
+			if err != nil {
+				t.Fatalf("listing failed: %v", err)
+			}
+			if found := commentIDs(comments); fmt.Sprint(found) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, found)
+			}
+		})
+	}
+
+	if err := repos.Comments.UpdateContent(ctx, reply.ID, "edited"); err != nil {
+		t.Fatalf("failed to update comment: %v", err)
+	}
+	if err := repos.Comments.UpdateStatus(ctx, second.ID, domain.CommentSpam); err != nil {
+		t.Fatalf("failed to update comment: %v", err)
+	}
+	if edited, err := repos.Comments.Get(ctx, reply.ID); err != nil || edited.Content != "edited" || edited.UpdatedAt.Before(reply.UpdatedAt) {
+		t.Errorf("expected the content to be updated, got %+v, %v", edited, err)
+	}
+	if err := repos.Comments.UpdateStatus(ctx, pending.ID+1000, domain.CommentSpam); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown comment, got %v", err)
+	}
+
+	// the moderation queue is oldest first across the blogs
+	if err := repos.Comments.UpdateStatus(ctx, first.ID, domain.CommentSpam); err != nil {
+		t.Fatalf("failed to update comment: %v", err)
+	}
+	spam, err := repos.Comments.ListByStatus(ctx, domain.CommentSpam, 0, 10)
+	if err != nil {
+		t.Fatalf("listing failed: %v", err)
+	}
+	if found := commentIDs(spam); fmt.Sprint(found) != fmt.Sprint([]int64{first.ID, second.ID}) {
+		t.Errorf("expected %v, got %v", []int64{first.ID, second.ID}, found)
+	}
+}
+
+func testReactions(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	judy := createUser(t, repos, "judy")
+	ken := createUser(t, repos, "ken")
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: judy.ID, Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	otherBlogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: judy.ID, Title: "Other", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+
+	react := func(add bool, user *domain.User, blogID int64, reactionType string, expected bool) {
+		t.Helper()
+		reaction := &domain.Reaction{BlogID: blogID, UserID: user.ID, Type: reactionType}
+		change, action := repos.Reactions.Add, "adding"
+		if !add {
+			change, action = repos.Reactions.Remove, "removing"
+		}
+		if changed, err := change(ctx, reaction); err != nil || changed != expected {
+			t.Fatalf("expected %v when %s %+v, got %v, %v", expected, action, reaction, changed, err)
+		}
+	}
+	react(true, judy, blogID, domain.LikeReaction, true)
+	react(true, ken, blogID, domain.LikeReaction, true)
+	react(true, ken, blogID, "🎉", true)
+	react(true, ken, otherBlogID, "🎉", true)
+	// at most once per user and type
+	react(true, ken, blogID, domain.LikeReaction, false)
+	react(false, judy, otherBlogID, domain.LikeReaction, false)
+
+	counts, err := repos.Reactions.Counts(ctx, blogID, otherBlogID, otherBlogID+1000)
+	if err != nil {
+		t.Fatalf("failed to get counts: %v", err)
+	}
+	expected := map[int64]map[string]int64{blogID: {domain.LikeReaction: 2, "🎉": 1}, otherBlogID: {"🎉": 1}}
+	if fmt.Sprint(counts) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, counts)
+	}
+
+	reactions, err := repos.Reactions.List(ctx, blogID, "", 0, 10)
+	if err != nil {
+		t.Fatalf("failed to list reactions: %v", err)
+	}
+	if len(reactions) != 3 || reactions[0].UserID != ken.ID || reactions[2].UserID != judy.ID || reactions[2].Type != domain.LikeReaction || reactions[2].CreatedAt.IsZero() {
+		t.Errorf("expected the newest reaction first, got %v", reactions)
+	}
+	if likes, err := repos.Reactions.List(ctx, blogID, domain.LikeReaction, 1, 10); err != nil || len(likes) != 1 || likes[0].UserID != judy.ID {
+		t.Errorf("expected the second page of the likes to be judy's, got %v, %v", likes, err)
+	}
+
+	// a removed reaction no longer counts, a counter which drops to zero is left out
+	react(false, ken, blogID, "🎉", true)
+	react(false, ken, blogID, "🎉", false)
+	react(false, ken, otherBlogID, "🎉", true)
+	counts, err = repos.Reactions.Counts(ctx, blogID, otherBlogID)
+	if err != nil {
+		t.Fatalf("failed to get counts: %v", err)
+	}
+	expected = map[int64]map[string]int64{blogID: {domain.LikeReaction: 2}}
+	if fmt.Sprint(counts) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, counts)
+	}
+}
+
+func testConcurrentReactions(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+
+	const users = 5
+	var reactors []*domain.User
+	for i := 0; i < users; i++ {
+		reactors = append(reactors, createUser(t, repos, fmt.Sprintf("liker%d", i)))
+	}
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: reactors[0].ID, Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+
+	// every user likes the blog several times at once
+	var wg sync.WaitGroup
+	for _, user := range reactors {
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(userID int64) {
+				defer wg.Done()
+				if _, err := repos.Reactions.Add(ctx, &domain.Reaction{BlogID: blogID, UserID: userID, Type: domain.LikeReaction}); err != nil {
+					t.Errorf("failed to add reaction: %v", err)
+				}
+			}(user.ID)
+		}
+	}
+	wg.Wait()
+
+	counts, err := repos.Reactions.Counts(ctx, blogID)
+	if err != nil {
+		t.Fatalf("failed to get counts: %v", err)
+	}
+	if counts[blogID][domain.LikeReaction] != users {
+		t.Errorf("expected %d likes, got %v", users, counts)
+	}
+}
+
+func testFollows(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	leo := createUser(t, repos, "leo")
+	mia := createUser(t, repos, "mia")
+	ned := createUser(t, repos, "ned")
+
+	if user, err := repos.Users.GetUserByID(ctx, mia.ID); err != nil || user.Username != "mia" {
+		t.Errorf("expected to get mia by id, got %+v, %v", user, err)
+	}
+	var notFoundErr *domain.NotFoundError
+	if _, err := repos.Users.GetUserByID(ctx, ned.ID+1000); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown user, got %v", err)
+	}
+
+	follow := func(followerID int64, followeeID int64, expected bool) {
+		t.Helper()
+		added, err := repos.Follows.Follow(ctx, &domain.Follow{FollowerID: followerID, FolloweeID: followeeID})
+		if err != nil || added != expected {
+			t.Fatalf("expected %v when %d follows %d, got %v, %v", expected, followerID, followeeID, added, err)
+		}
+	}
+	follow(leo.ID, ned.ID, true)
+	follow(mia.ID, ned.ID, true)
+	follow(leo.ID, mia.ID, true)
+	follow(leo.ID, ned.ID, false)
+	if _, err := repos.Follows.Follow(ctx, &domain.Follow{FollowerID: leo.ID, FolloweeID: leo.ID}); err == nil {
+		t.Errorf("expected an error when following oneself")
+	}
+
+	followers, err := repos.Follows.Followers(ctx, ned.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("failed to list followers: %v", err)
+	}
+	if len(followers) != 2 || followers[0].FollowerID != mia.ID || followers[1].FollowerID != leo.ID || followers[0].FolloweeID != ned.ID || followers[0].CreatedAt.IsZero() {
+		t.Errorf("expected mia and leo to follow ned, newest first, got %v", followers)
+	}
+	following, err := repos.Follows.Following(ctx, leo.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("failed to list following: %v", err)
+	}
+	if len(following) != 1 || following[0].FolloweeID != ned.ID {
+		t.Errorf("expected the second page of leo's follows to be ned, got %v", following)
+	}
+	if followerCount, followingCount, err := repos.Follows.Counts(ctx, leo.ID); err != nil || followerCount != 0 || followingCount != 2 {
+		t.Errorf("expected leo to have 0 followers and 2 follows, got %d, %d, %v", followerCount, followingCount, err)
+	}
+
+	// only the first unfollow removes something
+	for _, expected := range []bool{true, false} {
+		removed, err := repos.Follows.Unfollow(ctx, &domain.Follow{FollowerID: leo.ID, FolloweeID: ned.ID})
+		if err != nil || removed != expected {
+			t.Errorf("expected %v when unfollowing, got %v, %v", expected, removed, err)
+		}
+	}
+	if followerCount, followingCount, err := repos.Follows.Counts(ctx, ned.ID); err != nil || followerCount != 1 || followingCount != 0 {
+		t.Errorf("expected ned to have 1 follower and no follows, got %d, %d, %v", followerCount, followingCount, err)
+	}
+}
+
+func testFeed(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	reader := createUser(t, repos, "olga")
+	followed := createUser(t, repos, "pete")
+	alsoFollowed := createUser(t, repos, "quinn")
+	stranger := createUser(t, repos, "rita")
+	for _, author := range []*domain.User{followed, alsoFollowed} {
+		if _, err := repos.Follows.Follow(ctx, &domain.Follow{FollowerID: reader.ID, FolloweeID: author.ID}); err != nil {
+			t.Fatalf("failed to follow: %v", err)
+		}
+	}
+
+	// created oldest to newest, the feed has them the other way round and without the stranger's
+	var expected []int64
+	for i, author := range []*domain.User{followed, stranger, alsoFollowed, followed, stranger, alsoFollowed, followed} {
+		blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: fmt.Sprintf("Blog %d", i), Content: "Content"})
+		if err != nil {
+			t.Fatalf("failed to create blog: %v", err)
+		}
+		if author != stranger {
+			expected = append([]int64{blogID}, expected...)
+		}
+	}
+	// nor with the blogs the access leaves out
+	if _, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: followed.ID, Title: "Draft", Content: "Content", Status: domain.StatusDraft}); err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+
+	// every page starts right after the last blog of the previous one
+	var found []int64
+	var after *domain.FeedCursor
+	for pages := 0; ; pages++ {
+		if pages > len(expected) {
+			t.Fatalf("the feed does not end")
+		}
+		blogs, err := repos.Blogs.Feed(ctx, reader.ID, everyBlog, after, 2)
+		if err != nil {
+			t.Fatalf("failed to get the feed: %v", err)
+		}
+		for _, blog := range blogs {
+			found = append(found, blog.ID)
+		}
+		if len(blogs) < 2 {
+			break
+		}
+		last := blogs[len(blogs)-1]
+		after = &domain.FeedCursor{CreatedAt: last.CreatedAt, BlogID: last.ID}
+	}
+	if fmt.Sprint(found) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+
+	if blogs, err := repos.Blogs.Feed(ctx, stranger.ID, everyBlog, nil, 10); err != nil || len(blogs) != 0 {
+		t.Errorf("expected an empty feed for a user who follows nobody, got %v, %v", blogs, err)
+	}
+}
+
+func testLatest(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	author := createUser(t, repos, "sam")
+	other := createUser(t, repos, "tina")
+
+	// created oldest to newest
+	var blogIDs []int64
+	for i, blog := range []*domain.Blog{
+		{UserID: author.ID, Tags: "Go, Databases"},
+		{UserID: other.ID, Tags: "golang,web"},
+		{UserID: author.ID, Tags: " web ,go "},
+		{UserID: other.ID, Tags: "GO"},
+		{UserID: author.ID},
+	} {
+		blog.Title, blog.Content, blog.Visibility = fmt.Sprintf("Blog %d", i), "Content", domain.VisibilityPublic
+		blogID, err := repos.Blogs.Create(ctx, blog)
+		if err != nil {
+			t.Fatalf("failed to create blog: %v", err)
+		}
+		blogIDs = append(blogIDs, blogID)
+	}
+	privateID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Hidden", Content: "Content", Tags: "go", Visibility: domain.VisibilityPrivate})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	public := domain.BlogAccess{Visibilities: []domain.Visibility{domain.VisibilityPublic}}
+
+	for _, tc := range []struct {
+		name     string
+		access   domain.BlogAccess
+		filter   domain.BlogFilter
+		limit    int
+		expected []int64
+	}{
+		{"everything", everyBlog, domain.BlogFilter{}, 10, []int64{privateID, blogIDs[4], blogIDs[3], blogIDs[2], blogIDs[1], blogIDs[0]}},
+		{"public", public, domain.BlogFilter{}, 10, []int64{blogIDs[4], blogIDs[3], blogIDs[2], blogIDs[1], blogIDs[0]}},
+		{"limited", public, domain.BlogFilter{}, 2, []int64{blogIDs[4], blogIDs[3]}},
+		{"author", public, domain.BlogFilter{UserID: author.ID}, 10, []int64{blogIDs[4], blogIDs[2], blogIDs[0]}},
+		// a whole tag, not a part of one, in any case
+		{"tag", public, domain.BlogFilter{Tag: "go"}, 10, []int64{blogIDs[3], blogIDs[2], blogIDs[0]}},
+		{"tag limited", public, domain.BlogFilter{Tag: "go"}, 1, []int64{blogIDs[3]}},
+		{"author and tag", public, domain.BlogFilter{UserID: other.ID, Tag: "Web"}, 10, []int64{blogIDs[1]}},
+		{"unknown tag", public, domain.BlogFilter{Tag: "rust"}, 10, nil},
+	} {
+		blogs, err := repos.Blogs.Latest(ctx, tc.access, tc.filter, tc.limit)
+		if err != nil {
+			t.Fatalf("%s: failed to get the latest blogs: %v", tc.name, err)
+		}
+		var found []int64
+		for _, blog := range blogs {
+			found = append(found, blog.ID)
+		}
+		if fmt.Sprint(found) != fmt.Sprint(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, found)
+		}
+	}
+}
+
+// testVisibility the lists leave out the blogs the access does not allow, except for the reader's own ones
+func testVisibility(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	author := createUser(t, repos, "uma")
+	reader := createUser(t, repos, "vic")
+	if _, err := repos.Follows.Follow(ctx, &domain.Follow{FollowerID: reader.ID, FolloweeID: author.ID}); err != nil {
+		t.Fatalf("failed to follow: %v", err)
+	}
+
+	blogIDs := make(map[domain.Visibility]int64)
+	for _, visibility := range []domain.Visibility{domain.VisibilityPublic, domain.VisibilityUnlisted, domain.VisibilityMembersOnly, domain.VisibilityPrivate} {
+		blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: string(visibility), Content: "Content", Visibility: visibility})
+		if err != nil {
+			t.Fatalf("failed to create blog: %v", err)
+		}
+		if blog, err := repos.Blogs.Get(ctx, blogID); err != nil || blog.Visibility != visibility {
+			t.Errorf("expected the visibility %s, got %+v, %v", visibility, blog, err)
+		}
+		blogIDs[visibility] = blogID
+	}
+
+	for _, tc := range []struct {
+		name     string
+		access   domain.BlogAccess
+		expected []int64
+	}{
+		{"public", domain.BlogAccess{Visibilities: []domain.Visibility{domain.VisibilityPublic}}, []int64{blogIDs[domain.VisibilityPublic]}},
+		{"members", domain.BlogAccess{Visibilities: []domain.Visibility{domain.VisibilityPublic, domain.VisibilityMembersOnly}, UserID: reader.ID},
+			[]int64{blogIDs[domain.VisibilityMembersOnly], blogIDs[domain.VisibilityPublic]}},
+		{"own", domain.BlogAccess{Visibilities: []domain.Visibility{domain.VisibilityPublic}, UserID: author.ID}, []int64{blogIDs[domain.VisibilityPrivate],
+			blogIDs[domain.VisibilityMembersOnly], blogIDs[domain.VisibilityUnlisted], blogIDs[domain.VisibilityPublic]}},
+	} {
+		for list, blogs := range map[string]func() ([]*domain.Blog, error){
+			"search": func() ([]*domain.Blog, error) { return repos.Blogs.Search(ctx, tc.access, 0, 10, "") },
+			"latest": func() ([]*domain.Blog, error) { return repos.Blogs.Latest(ctx, tc.access, domain.BlogFilter{}, 10) },
+		} {
+			found, err := blogs()
+			if err != nil {
+				t.Fatalf("%s %s: failed to list the blogs: %v", tc.name, list, err)
+			}
+			var ids []int64
+			for _, blog := range found {
+				ids = append(ids, blog.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tc.expected) {
+				t.Errorf("%s %s: expected %v, got %v", tc.name, list, tc.expected, ids)
+			}
+		}
+	}
+	members := domain.BlogAccess{Visibilities: []domain.Visibility{domain.VisibilityPublic, domain.VisibilityMembersOnly}, UserID: reader.ID}
+	if blogs, err := repos.Blogs.Feed(ctx, reader.ID, members, nil, 10); err != nil || len(blogs) != 2 {
+		t.Errorf("expected the public and the members-only blogs in the feed, got %v, %v", blogs, err)
+	}
+
+	// the visibility changes along with the rest of the blog, it stays as it is when none is given
+	blogID := blogIDs[domain.VisibilityMembersOnly]
+	if err := repos.Blogs.Update(ctx, &domain.Blog{ID: blogID, Title: "Title", Content: "Content", Visibility: domain.VisibilityPublic}); err != nil {
+		t.Fatalf("failed to update the blog: %v", err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, blogID); err != nil || blog.Visibility != domain.VisibilityPublic {
+		t.Errorf("expected the blog to become public, got %+v, %v", blog, err)
+	}
+	if err := repos.Blogs.Update(ctx, &domain.Blog{ID: blogID, Title: "Title", Content: "Edited"}); err != nil {
+		t.Fatalf("failed to update the blog: %v", err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, blogID); err != nil || blog.Visibility != domain.VisibilityPublic || blog.Content != "Edited" {
+		t.Errorf("expected the visibility to stay public, got %+v, %v", blog, err)
+	}
+}
+
+// testDrafts the drafts are left out of the lists of everybody but their authors
+func testDrafts(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	author := createUser(t, repos, "gil")
+	reader := createUser(t, repos, "hal")
+	if _, err := repos.Follows.Follow(ctx, &domain.Follow{FollowerID: reader.ID, FolloweeID: author.ID}); err != nil {
+		t.Fatalf("failed to follow: %v", err)
+	}
+
+	publishedID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Out", Content: "Content", Visibility: domain.VisibilityPublic,
+		Status: domain.StatusPublished})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	draftID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Soon", Content: "Content", Visibility: domain.VisibilityPublic,
+		Status: domain.StatusDraft})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, draftID); err != nil || blog.Status != domain.StatusDraft {
+		t.Errorf("expected a draft, got %+v, %v", blog, err)
+	}
+
+	ids := func(blogs []*domain.Blog, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("failed to list the blogs: %v", err)
+		}
+		var found []int64
+		for _, blog := range blogs {
+			found = append(found, blog.ID)
+		}
+		return fmt.Sprint(found)
+	}
+	own := domain.BlogAccess{Visibilities: []domain.Visibility{domain.VisibilityPublic}, UserID: author.ID}
+	if found := ids(repos.Blogs.Search(ctx, own, 0, 10, "")); found != fmt.Sprint([]int64{draftID, publishedID}) {
+		t.Errorf("expected the author to find the draft, got %s", found)
+	}
+	if found := ids(repos.Blogs.Search(ctx, everyBlog, 0, 10, "")); found != fmt.Sprint([]int64{publishedID}) {
+		t.Errorf("expected the draft to be left out of the search, got %s", found)
+	}
+	if found := ids(repos.Blogs.Feed(ctx, reader.ID, everyBlog, nil, 10)); found != fmt.Sprint([]int64{publishedID}) {
+		t.Errorf("expected the draft to be left out of the feed, got %s", found)
+	}
+	if found := ids(repos.Blogs.Latest(ctx, everyBlog, domain.BlogFilter{}, 10)); found != fmt.Sprint([]int64{publishedID}) {
+		t.Errorf("expected the draft to be left out of the latest blogs, got %s", found)
+	}
+
+	// an update without a status keeps it
+	if err := repos.Blogs.Update(ctx, &domain.Blog{ID: draftID, Title: "Soon", Content: "Edited"}); err != nil {
+		t.Fatalf("failed to update the blog: %v", err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, draftID); err != nil || blog.Status != domain.StatusDraft {
+		t.Errorf("expected the draft to stay a draft, got %+v, %v", blog, err)
+	}
+	if err := repos.Blogs.Update(ctx, &domain.Blog{ID: draftID, Title: "Now", Content: "Edited", Status: domain.StatusPublished}); err != nil {
+		t.Fatalf("failed to publish the draft: %v", err)
+	}
+	if found := ids(repos.Blogs.Search(ctx, everyBlog, 0, 10, "")); found != fmt.Sprint([]int64{draftID, publishedID}) {
+		t.Errorf("expected the published draft in the search, got %s", found)
+	}
+}
+
+func testContentFormats(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	author := createUser(t, repos, "wes")
+
+	// the raw content is kept, it is rendered when it is read
+	content := "# Title\n\n<script>alert(1)</script>"
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Markdown", Content: content, ContentFormat: domain.FormatMarkdown})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, blogID); err != nil || blog.Content != content || blog.ContentFormat != domain.FormatMarkdown {
+		t.Errorf("expected the raw markdown, got %+v, %v", blog, err)
+	}
+
+	// the format changes along with the rest of the blog, it stays as it is when none is given
+	for _, tc := range []struct {
+		format   domain.ContentFormat
+		expected domain.ContentFormat
+	}{
+		{domain.FormatHTML, domain.FormatHTML},
+		{"", domain.FormatHTML},
+		{domain.FormatPlaintext, domain.FormatPlaintext},
+	} {
+		if err := repos.Blogs.Update(ctx, &domain.Blog{ID: blogID, Title: "Markdown", Content: content, ContentFormat: tc.format}); err != nil {
+			t.Fatalf("failed to update the blog: %v", err)
+		}
+		if blog, err := repos.Blogs.Get(ctx, blogID); err != nil || blog.ContentFormat != tc.expected {
+			t.Errorf("expected the format %s after an update to %q, got %+v, %v", tc.expected, tc.format, blog, err)
+		}
+	}
+}
+
+func testSlugs(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	author := createUser(t, repos, "xia")
+
+	var blogIDs []int64
+	for _, title := range []string{"First", "Second", "Third"} {
+		blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: title, Content: "Content"})
+		if err != nil {
+			t.Fatalf("failed to create blog: %v", err)
+		}
+		blogIDs = append(blogIDs, blogID)
+	}
+
+	// the blogs without a slug are found oldest first
+	if blogs, err := repos.Blogs.WithoutSlug(ctx, 2); err != nil || len(blogs) != 2 || blogs[0].ID != blogIDs[0] || blogs[1].ID != blogIDs[1] {
+		t.Errorf("expected the first two blogs without a slug, got %+v, %v", blogs, err)
+	}
+	if err := repos.Blogs.SetSlug(ctx, blogIDs[0], "first"); err != nil {
+		t.Fatalf("failed to set the slug: %v", err)
+	}
+	if err := repos.Blogs.SetSlug(ctx, blogIDs[1], "second"); err != nil {
+		t.Fatalf("failed to set the slug: %v", err)
+	}
+	if blogs, err := repos.Blogs.WithoutSlug(ctx, 10); err != nil || len(blogs) != 1 || blogs[0].ID != blogIDs[2] {
+		t.Errorf("expected the third blog only, got %+v, %v", blogs, err)
+	}
+
+	// a new slug becomes the current one, the previous one still finds the blog and stays the blog's
+	if err := repos.Blogs.SetSlug(ctx, blogIDs[0], "renamed"); err != nil {
+		t.Fatalf("failed to set the slug: %v", err)
+	}
+	for _, slug := range []string{"first", "renamed"} {
+		if blog, err := repos.Blogs.GetBySlug(ctx, slug); err != nil || blog.ID != blogIDs[0] || blog.Slug != "renamed" {
+			t.Errorf("expected %s to find the renamed blog, got %+v, %v", slug, blog, err)
+		}
+	}
+	var conflictErr *domain.ConflictError
+	for _, slug := range []string{"first", "second"} {
+		if err := repos.Blogs.SetSlug(ctx, blogIDs[2], slug); !errors.As(err, &conflictErr) {
+			t.Errorf("expected a conflict for the slug %s of another blog, got %v", slug, err)
+		}
+	}
+	// taking a previous slug back
+	if err := repos.Blogs.SetSlug(ctx, blogIDs[0], "first"); err != nil {
+		t.Fatalf("failed to set the slug: %v", err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, blogIDs[0]); err != nil || blog.Slug != "first" {
+		t.Errorf("expected the previous slug back, got %+v, %v", blog, err)
+	}
+
+	var notFoundErr *domain.NotFoundError
+	if _, err := repos.Blogs.GetBySlug(ctx, "no-such-blog"); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown slug, got %v", err)
+	}
+	if err := repos.Blogs.SetSlug(ctx, blogIDs[2]+1000, "orphan"); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown blog, got %v", err)
+	}
+}
+
+func testMedia(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	author := createUser(t, repos, "zoe")
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Pictures", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+
+	create := func(blogID int64, key string) *domain.Media {
+		t.Helper()
+		mediaID, err := repos.Media.Create(ctx, &domain.Media{UserID: author.ID, BlogID: blogID, Key: key, ContentType: "image/png", Size: 42, Width: 3, Height: 2})
+		if err != nil {
+			t.Fatalf("failed to create media: %v", err)
+		}
+		media, err := repos.Media.Get(ctx, mediaID)
+		if err != nil {
+			t.Fatalf("failed to get media: %v", err)
+		}
+		return media
+	}
+	attached := create(blogID, "attached.png")
+	orphan := create(0, "orphan.png")
+	later := create(0, "later.png")
+	if attached.UserID != author.ID || attached.BlogID != blogID || attached.Key != "attached.png" || attached.ContentType != "image/png" ||
+		attached.Size != 42 || attached.Width != 3 || attached.Height != 2 || attached.CreatedAt.IsZero() {
+		t.Errorf("unexpected media %+v", attached)
+	}
+	if orphan.BlogID != 0 {
+		t.Errorf("expected the media not to be attached: %+v", orphan)
+	}
+	var notFoundErr *domain.NotFoundError
+	if _, err := repos.Media.Get(ctx, later.ID+1000); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for unknown media, got %v", err)
+	}
+	if _, err := repos.Media.Create(ctx, &domain.Media{UserID: author.ID, BlogID: blogID + 1000, Key: "x.png"}); err == nil {
+		t.Errorf("expected an error when the blog does not exist")
+	}
+
+	if err := repos.Media.Attach(ctx, later.ID, blogID); err != nil {
+		t.Fatalf("failed to attach: %v", err)
+	}
+	if list, err := repos.Media.ListByBlog(ctx, blogID); err != nil || len(list) != 2 || list[0].ID != attached.ID || list[1].ID != later.ID {
+		t.Errorf("expected both media of the blog, oldest first, got %+v, %v", list, err)
+	}
+	if err := repos.Media.Attach(ctx, later.ID+1000, blogID); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for attaching unknown media, got %v", err)
+	}
+
+	// only the unattached media created before the time are orphans, and only they are deleted
+	if orphans, err := repos.Media.Orphans(ctx, orphan.CreatedAt, 10); err != nil || len(orphans) != 0 {
+		t.Errorf("expected no orphans created before the orphan, got %+v, %v", orphans, err)
+	}
+	orphans, err := repos.Media.Orphans(ctx, time.Now().Add(time.Minute), 10)
+	if err != nil || len(orphans) != 1 || orphans[0].ID != orphan.ID {
+		t.Fatalf("expected the orphan, got %+v, %v", orphans, err)
+	}
+	for _, tc := range []struct {
+		media    *domain.Media
+		expected bool
+	}{
+		{attached, false},
+		{orphan, true},
+		{orphan, false},
+	} {
+		if deleted, err := repos.Media.DeleteOrphan(ctx, tc.media.ID); err != nil || deleted != tc.expected {
+			t.Errorf("expected %v when deleting %s, got %v, %v", tc.expected, tc.media.Key, deleted, err)
+		}
+	}
+	if _, err := repos.Media.Get(ctx, orphan.ID); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected the orphan to be gone, got %v", err)
+	}
+	if _, err := repos.Media.Get(ctx, attached.ID); err != nil {
+		t.Errorf("expected the attached media to be kept, got %v", err)
+	}
+}
+
+func testIdempotency(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	ann := createUser(t, repos, "ann")
+	bob := createUser(t, repos, "bob")
+	reserve := func(userID int64, key string, fingerprint string, lease time.Duration) (*domain.IdempotentRequest, error) {
+		return repos.Idempotency.Reserve(ctx, &domain.IdempotentRequest{UserID: userID, Key: key, Fingerprint: fingerprint, ExpiresAt: time.Now().Add(time.Hour)}, lease)
+	}
+
+	// the first request is reserved, the others get it back
+	if existing, err := reserve(ann.ID, "key-1", "create blog", time.Minute); err != nil || existing != nil {
+		t.Fatalf("expected the first request to be reserved, got %+v, %v", existing, err)
+	}
+	if existing, err := reserve(ann.ID, "key-1", "create blog", time.Minute); err != nil || existing == nil || existing.Done() || existing.Fingerprint != "create blog" {
+		t.Errorf("expected the running request, got %+v, %v", existing, err)
+	}
+	// the keys are per user
+	if existing, err := reserve(bob.ID, "key-1", "create comment", time.Minute); err != nil || existing != nil {
+		t.Errorf("expected the key of another user to be free, got %+v, %v", existing, err)
+	}
+
+	if err := repos.Idempotency.Complete(ctx, &domain.IdempotentRequest{UserID: ann.ID, Key: "key-1", Status: 201, ContentType: "application/json", Body: []byte(`{"id":7}`)}); err != nil {
+		t.Fatalf("failed to complete: %v", err)
+	}
+	existing, err := reserve(ann.ID, "key-1", "create blog", time.Minute)
+	if err != nil || existing == nil || existing.Status != 201 || existing.ContentType != "application/json" || string(existing.Body) != `{"id":7}` ||
+		existing.CreatedAt.IsZero() {
+		t.Errorf("expected the completed request, got %+v, %v", existing, err)
+	}
+
+	// a request running for longer than the lease is taken over by the same request, but not by another one
+	if _, err := reserve(ann.ID, "key-2", "create blog", time.Minute); err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	if existing, err := reserve(ann.ID, "key-2", "create comment", -time.Minute); err != nil || existing == nil {
+		t.Errorf("expected another request not to take over, got %+v, %v", existing, err)
+	}
+	if existing, err := reserve(ann.ID, "key-2", "create blog", -time.Minute); err != nil || existing != nil {
+		t.Errorf("expected the same request to take over after the lease, got %+v, %v", existing, err)
+	}
+	// a completed request is returned whatever the lease
+	if existing, err := reserve(ann.ID, "key-1", "create blog", -time.Minute); err != nil || existing == nil || existing.Status != 201 {
+		t.Errorf("expected the completed request, got %+v, %v", existing, err)
+	}
+
+	// a released key is free again
+	if err := repos.Idempotency.Release(ctx, ann.ID, "key-2"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if existing, err := reserve(ann.ID, "key-2", "create comment", time.Minute); err != nil || existing != nil {
+		t.Errorf("expected a released key to be free, got %+v, %v", existing, err)
+	}
+
+	// an expired request is replaced, and deleted along with the others which expired
+	expired := &domain.IdempotentRequest{UserID: ann.ID, Key: "key-3", Fingerprint: "old", ExpiresAt: time.Now().Add(-time.Minute)}
+	if existing, err := repos.Idempotency.Reserve(ctx, expired, time.Minute); err != nil || existing != nil {
+		t.Fatalf("failed to reserve: %+v, %v", existing, err)
+	}
+	if existing, err := reserve(ann.ID, "key-3", "new", time.Minute); err != nil || existing != nil {
+		t.Errorf("expected an expired key to be free, got %+v, %v", existing, err)
+	}
+	expired.Key = "key-4"
+	if _, err := repos.Idempotency.Reserve(ctx, expired, time.Minute); err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	if deleted, err := repos.Idempotency.DeleteExpired(ctx, time.Now()); err != nil || deleted != 1 {
+		t.Errorf("expected the expired request to be deleted, got %d, %v", deleted, err)
+	}
+	if existing, err := reserve(ann.ID, "key-1", "create blog", time.Minute); err != nil || existing == nil {
+		t.Errorf("expected the unexpired requests to survive the cleanup, got %+v, %v", existing, err)
+	}
+	var notFoundErr *domain.NotFoundError
+	if err := repos.Idempotency.Complete(ctx, &domain.IdempotentRequest{UserID: ann.ID, Key: "key-4", Status: 201}); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a deleted request not to be found, got %v", err)
+	}
+}
+
+func testConcurrentIdempotentRequests(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	_, repos := setUp(t, factory)
+	user := createUser(t, repos, "retrier")
+
+	// the same request reserved many times at once is reserved only once
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			existing, err := repos.Idempotency.Reserve(ctx, &domain.IdempotentRequest{UserID: user.ID, Key: "retried", Fingerprint: "create blog",
+				ExpiresAt: time.Now().Add(time.Hour)}, time.Minute)
+			if err != nil {
+				t.Errorf("failed to reserve: %v", err)
+				return
+			}
+			if existing == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 1 {
+		t.Errorf("expected the request to be reserved once, got %d", reserved)
+	}
+}
+func commentIDs(comments []*domain.Comment) []int64 {
+	var ids []int64
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	return ids
+}
+
+// assertPermissions logs in and checks the permissions carried by the token
+func assertPermissions(t *testing.T, conf *config.Config, repos Repos, username string, password string, granted []string, denied []string) {
+	t.Helper()
+	token, err := repos.Users.Login(context.Background(), username, password)
+	if err != nil {
+		t.Fatalf("failed to login as %s: %v", username, err)
+	}
+
+	authManager := usecases.NewAuthManager(conf, repos.Users)
+	for _, permission := range granted {
+		if _, err := authManager.ValidateToken(context.Background(), token, permission); err != nil {
+			t.Errorf("expected %s to have permission %s: %v", username, permission, err)
+		}
+	}
+	for _, permission := range denied {
+		if _, err := authManager.ValidateToken(context.Background(), token, permission); err == nil {
+			t.Errorf("expected %s not to have permission %s", username, permission)
+		}
+	}
+}
+
+func mustGetRole(t *testing.T, repos Repos, roleName string) *domain.Role {
+	t.Helper()
+	role, err := repos.Users.GetRoleByName(context.Background(), roleName)
+	if err != nil {
+		t.Fatalf("failed to get role %s: %v", roleName, err)
+	}
+	return role
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+)
+
+// the tags of the first IFD this package looks at
+const (
+	orientationTag = 0x0112
+	gpsInfoTag     = 0x8825
+)
+
+// the sizes of the TIFF field types by their number, the unknown types are 0
+var typeSizes = [...]uint32{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+/*
+exif is the TIFF structure with the EXIF metadata of an image, a slice of the image data, so the changes are made in
+place. Nothing is ever inserted or removed, which keeps the sizes of the segments and chunks around it. Malformed
+metadata is left alone.
+*/
+type exif struct {
+	data  []byte
+	order binary.ByteOrder
+	// changed updates the checksum of the chunk, if the format has one
+	changed func()
+}
+
+// findEXIF returns the EXIF metadata of a JPEG, PNG or WebP image, nil when it has none
+func findEXIF(data []byte) *exif {
+	var tiff []byte
+	changed := func() {}
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8")):
+		tiff = findJPEGEXIF(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		tiff, changed = findPNGEXIF(data)
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WEBP":
+		tiff = findWebPEXIF(data)
+	}
+	if len(tiff) < 8 {
+		return nil
+	}
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		return &exif{data: tiff, order: binary.LittleEndian, changed: changed}
+	case "MM\x00*":
+		return &exif{data: tiff, order: binary.BigEndian, changed: changed}
+	}
+	return nil
+}
+
+// findJPEGEXIF looks for the APP1 segment starting with "Exif\0\0"
+func findJPEGEXIF(data []byte) (tiff []byte) {
+	jpegSegments(data, func(marker byte, segment []byte) bool {
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			tiff = segment[6:]
+			return false
+		}
+		return true
+	})
+	return tiff
+}
+
+// findPNGEXIF looks for the eXIf chunk, the returned func updates the CRC of the chunk
+func findPNGEXIF(data []byte) (tiff []byte, changed func()) {
+	pngChunks(data, func(chunkType string, chunk []byte, updateCRC func()) bool {
+		if chunkType == "eXIf" {
+			tiff, changed = chunk, updateCRC
+			return false
+		}
+		return true
+	})
+	return tiff, changed
+}
+
+// findWebPEXIF looks for the EXIF chunk, some encoders start it with "Exif\0\0" like in JPEG
+func findWebPEXIF(data []byte) (tiff []byte) {
+	webpChunks(data, func(chunkType string, chunk []byte) bool {
+		if chunkType == "EXIF" {
+			tiff = bytes.TrimPrefix(chunk, []byte("Exif\x00\x00"))
+			return false
+		}
+		return true
+	})
+	return tiff
+}
+
+// jpegSegments calls visit with the marker and the content of each segment before the image data, until visit
+// returns false
+func jpegSegments(data []byte, visit func(marker byte, segment []byte) bool) {
+	position := 2
+	for position+4 <= len(data) && data[position] == 0xff {
+		marker := data[position+1]
+		if marker == 0xd8 || marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			// no length
+			position += 2
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			// the image data, no metadata follows
+			return
+		}
+		end := position + 2 + int(binary.BigEndian.Uint16(data[position+2:]))
+		if end > len(data) || end < position+4 {
+			return
+		}
+		if !visit(marker, data[position+4:end]) {
+			return
+		}
+		position = end
+	}
+}
+
+// pngChunks calls visit with the type and the data of each chunk before IEND, until visit returns false. The func
+// passed along updates the CRC of the chunk.
+func pngChunks(data []byte, visit func(chunkType string, chunk []byte, updateCRC func()) bool) {
+	position := 8
+	for position+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[position:]))
+		end := position + 8 + length
+		if length < 0 || end+4 > len(data) {
+			return
+		}
+		chunkType := string(data[position+4 : position+8])
+		if chunkType == "IEND" {
+			return
+		}
+		checked, crc := data[position+4:end], data[end:end+4]
+		if !visit(chunkType, data[position+8:end], func() { binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(checked)) }) {
+			return
+		}
+		position = end + 4
+	}
+}
+
+// webpChunks calls visit with the type and the data of each chunk, until visit returns false
+func webpChunks(data []byte, visit func(chunkType string, chunk []byte) bool) {
+	position := 12
+	for position+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[position+4:]))
+		end := position + 8 + size
+		if size < 0 || end > len(data) {
+			return
+		}
+		if !visit(string(data[position:position+4]), data[position+8:end]) {
+			return
+		}
+		// the chunks are padded to an even size
+		position = end + size%2
+	}
+}
+
+// orientation is the EXIF orientation of the image, 1 when it has none
+func orientation(data []byte) int {
+	metadata := findEXIF(data)
+	if metadata == nil {
+		return 1
+	}
+	ifd, count, ok := metadata.ifd(metadata.order.Uint32(metadata.data[4:]))
+	if !ok {
+		return 1
+	}
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + 12*i
+		if metadata.order.Uint16(metadata.data[entry:]) == orientationTag && metadata.order.Uint16(metadata.data[entry+2:]) == 3 {
+			if value := int(metadata.order.Uint16(metadata.data[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+		}
+	}
+	return 1
+}
+
+// ifd returns where the IFD at the offset starts and its number of entries, when all of it is within the data
+func (e *exif) ifd(offset uint32) (int, int, bool) {
+	if offset < 8 || uint64(offset)+2 > uint64(len(e.data)) {
+		return 0, 0, false
+	}
+	count := int(e.order.Uint16(e.data[offset:]))
+	if uint64(offset)+2+12*uint64(count)+4 > uint64(len(e.data)) {
+		return 0, 0, false
+	}
+	return int(offset), count, true
+}
+
+// stripGPS removes the GPS entry from the first IFD and blanks the GPS IFD with its values, true when it did
+func (e *exif) stripGPS() bool {
+	ifd, count, ok := e.ifd(e.order.Uint32(e.data[4:]))
+	if !ok {
+		return false
+	}
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + 12*i
+		if e.order.Uint16(e.data[entry:]) != gpsInfoTag {
+			continue
+		}
+		gpsOffset := e.order.Uint32(e.data[entry+8:])
+
+		// the later entries and the offset of the next IFD move up, the entries stay sorted by their tags
+		end := ifd + 2 + 12*count + 4
+		copy(e.data[entry:], e.data[entry+12:end])
+		zero(e.data[end-12 : end])
+		e.order.PutUint16(e.data[ifd:], uint16(count-1))
+
+		if gps, gpsCount, ok := e.ifd(gpsOffset); ok {
+			for j := 0; j < gpsCount; j++ {
+				gpsEntry := gps + 2 + 12*j
+				fieldType := e.order.Uint16(e.data[gpsEntry+2:])
+				if int(fieldType) >= len(typeSizes) {
+					continue
+				}
+				// the values of up to 4 bytes are in the entry itself
+				size := uint64(typeSizes[fieldType]) * uint64(e.order.Uint32(e.data[gpsEntry+4:]))
+				valueOffset := uint64(e.order.Uint32(e.data[gpsEntry+8:]))
+				if size > 4 && valueOffset+size <= uint64(len(e.data)) {
+					zero(e.data[valueOffset : valueOffset+size])
+				}
+			}
+			zero(e.data[gps : gps+2+12*gpsCount+4])
+		}
+		return true
+	}
+	return false
+}
+
+func zero(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
+
+// swapsSides tells the orientations which turn the image by 90 degrees
+func swapsSides(orientation int) bool {
+	return orientation >= 5
+}
+
+// orient turns and mirrors the image the way the EXIF orientation asks for
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	bounds := image.Rect(0, 0, width, height)
+	if swapsSides(orientation) {
+		bounds = image.Rect(0, 0, height, width)
+	}
+	oriented := image.NewRGBA(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			// the pixel of the stored image which is displayed at x, y
+			var sourceX, sourceY int
+			switch orientation {
+			case 2:
+				sourceX, sourceY = width-1-x, y
+			case 3:
+				sourceX, sourceY = width-1-x, height-1-y
+			case 4:
+				sourceX, sourceY = x, height-1-y
+			case 5:
+				sourceX, sourceY = y, x
+			case 6:
+				sourceX, sourceY = y, height-1-x
+			case 7:
+				sourceX, sourceY = width-1-y, height-1-x
+			case 8:
+				sourceX, sourceY = width-1-y, x
+			}
+			copy(oriented.Pix[oriented.PixOffset(x, y):oriented.PixOffset(x, y)+4], img.Pix[img.PixOffset(sourceX, sourceY):img.PixOffset(sourceX, sourceY)+4])
+		}
+	}
+	return oriented
+}
@@ -0,0 +1,148 @@
+/*
+Package imaging has the implementation of the domain ImageProcessor on top of the standard image packages. The
+variants are scaled with Catmull-Rom and encoded without any metadata, JPEG always and WebP when the server is built
+with cgo, which the WebP encoder needs.
+*/
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"sort"
+
+	"github.com/bipuldutta/blogzilla/domain"
+
+	xdraw "golang.org/x/image/draw"
+
+	// the formats of the uploads
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	JPEG = "jpeg"
+	WebP = "webp"
+)
+
+// encoder writes the image in one format, quality is 1 to 100
+type encoder func(w io.Writer, img image.Image, quality int) error
+
+type Processor struct {
+	quality   int
+	maxPixels int64
+	encoders  map[string]encoder
+}
+
+// NewProcessor maxPixels is the largest image Encode decodes, 0 for no limit
+func NewProcessor(quality int, maxPixels int64) domain.ImageProcessor {
+	encoders := map[string]encoder{JPEG: encodeJPEG}
+	if webpEncoder != nil {
+		encoders[WebP] = webpEncoder
+	}
+	return &Processor{quality: quality, maxPixels: maxPixels, encoders: encoders}
+}
+
+func (p *Processor) Inspect(data []byte) (int, int, error) {
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	if swapsSides(orientation(data)) {
+		return imageConfig.Height, imageConfig.Width, nil
+	}
+	return imageConfig.Width, imageConfig.Height, nil
+}
+
+func (p *Processor) StripLocation(data []byte) {
+	if metadata := findEXIF(data); metadata != nil {
+		if metadata.stripGPS() {
+			metadata.changed()
+		}
+	}
+	for _, packet := range findXMP(data) {
+		if packet.stripGPS() {
+			packet.changed()
+		}
+	}
+}
+
+func (p *Processor) Encode(data []byte, variant domain.MediaVariant) ([]byte, error) {
+	encode, ok := p.encoders[variant.Format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported image format '%s'", variant.Format)
+	}
+	if variant.Width <= 0 || variant.Height <= 0 {
+		return nil, fmt.Errorf("invalid variant size %dx%d", variant.Width, variant.Height)
+	}
+	// the header tells how much memory the decoded image takes before any of it is allocated
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if pixels := int64(imageConfig.Width) * int64(imageConfig.Height); p.maxPixels > 0 && pixels > p.maxPixels {
+		return nil, fmt.Errorf("the image has %d pixels, more than the %d allowed", pixels, p.maxPixels)
+	}
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// the image is scaled as it is stored and rotated afterwards, rotating the smaller image is cheaper
+	rotation := orientation(data)
+	width, height := variant.Width, variant.Height
+	if swapsSides(rotation) {
+		width, height = height, width
+	}
+	from := source.Bounds()
+	if variant.Crop {
+		from = centerCrop(from, width, height)
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	op := draw.Src
+	if variant.Format == JPEG {
+		// JPEG has no transparency, the transparent parts become white instead of black
+		draw.Draw(scaled, scaled.Bounds(), image.White, image.Point{}, draw.Src)
+		op = draw.Over
+	}
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), source, from, op, nil)
+
+	var buffer bytes.Buffer
+	err = encode(&buffer, orient(scaled, rotation), p.quality)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (p *Processor) Formats() []string {
+	formats := make([]string, 0, len(p.encoders))
+	for format := range p.encoders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func encodeJPEG(w io.Writer, img image.Image, quality int) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
+
+// centerCrop is the largest part of the bounds with the aspect ratio of width and height, from the center
+func centerCrop(bounds image.Rectangle, width int, height int) image.Rectangle {
+	boundsWidth, boundsHeight := bounds.Dx(), bounds.Dy()
+	if boundsWidth*height > boundsHeight*width {
+		cropped := boundsHeight * width / height
+		left := bounds.Min.X + (boundsWidth-cropped)/2
+		return image.Rect(left, bounds.Min.Y, left+cropped, bounds.Max.Y)
+	}
+	cropped := boundsWidth * height / width
+	top := bounds.Min.Y + (boundsHeight-cropped)/2
+	return image.Rect(bounds.Min.X, top, bounds.Max.X, top+cropped)
+}
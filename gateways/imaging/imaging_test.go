@@ -0,0 +1,213 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+func TestOrientations(t *testing.T) {
+	// a 3x2 image whose pixels are all different, displayed as the stored image asks for
+	stored := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := range stored.Pix {
+		stored.Pix[i] = byte(i / 4)
+	}
+	// the pixels of the stored image by their number, row by row, as they are displayed
+	for orientation, expected := range map[int][][]byte{
+		1: {{0, 1, 2}, {3, 4, 5}},
+		2: {{2, 1, 0}, {5, 4, 3}},
+		3: {{5, 4, 3}, {2, 1, 0}},
+		4: {{3, 4, 5}, {0, 1, 2}},
+		5: {{0, 3}, {1, 4}, {2, 5}},
+		6: {{3, 0}, {4, 1}, {5, 2}},
+		7: {{5, 2}, {4, 1}, {3, 0}},
+		8: {{2, 5}, {1, 4}, {0, 3}},
+	} {
+		oriented := orient(stored, orientation)
+		for y, row := range expected {
+			for x, pixel := range row {
+				if got := oriented.RGBAAt(x, y).R; got != pixel {
+					t.Errorf("orientation %d: expected pixel %d at %d,%d, got %d", orientation, pixel, x, y, got)
+				}
+			}
+		}
+	}
+}
+
+func TestStripLocation(t *testing.T) {
+	processor := NewProcessor(80, 0)
+	tiff := newTIFF(8, "GPS SECRET")
+
+	var pngImage bytes.Buffer
+	if err := png.Encode(&pngImage, image.NewGray(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	// the eXIf chunk goes right after the IHDR chunk
+	header := pngImage.Bytes()[:8+25]
+	withEXIF := append(append([]byte{}, header...), pngChunk("eXIf", tiff)...)
+	withEXIF = append(withEXIF, pngImage.Bytes()[len(header):]...)
+
+	webpImage := append([]byte("RIFF\x00\x00\x00\x00WEBPEXIF"), binary.LittleEndian.AppendUint32(nil, uint32(len(tiff)))...)
+	webpImage = append(webpImage, tiff...)
+
+	for name, data := range map[string][]byte{"png": withEXIF, "webp": webpImage} {
+		if orientation(data) != 8 {
+			t.Errorf("%s: expected the orientation 8, got %d", name, orientation(data))
+		}
+		size := len(data)
+		processor.StripLocation(data)
+		if len(data) != size || bytes.Contains(data, []byte("GPS SECRET")) {
+			t.Errorf("%s: expected the GPS data to be gone in place", name)
+		}
+		if orientation(data) != 8 {
+			t.Errorf("%s: expected the orientation to be kept, got %d", name, orientation(data))
+		}
+	}
+
+	// the checksum of the chunk is updated
+	if _, err := png.Decode(bytes.NewReader(withEXIF)); err != nil {
+		t.Errorf("expected the png to stay readable, got %v", err)
+	}
+	if width, height, err := processor.Inspect(withEXIF); err != nil || width != 2 || height != 4 {
+		t.Errorf("expected the turned png to be 2x4, got %dx%d, %v", width, height, err)
+	}
+	encoded, err := processor.Encode(withEXIF, domain.MediaVariant{Name: "w1", Format: JPEG, Width: 1, Height: 2})
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	if img, _, err := image.Decode(bytes.NewReader(encoded)); err != nil || img.Bounds().Dx() != 1 || img.Bounds().Dy() != 2 {
+		t.Errorf("expected a 1x2 jpeg, got %v, %v", img, err)
+	}
+
+	// malformed metadata is left alone
+	broken := append([]byte("\xff\xd8\xff\xe1\x00\x10Exif\x00\x00II*\x00\xff\xff\xff\xff"), 0xff, 0xd9)
+	copied := append([]byte{}, broken...)
+	processor.StripLocation(copied)
+	if !bytes.Equal(broken, copied) || orientation(copied) != 1 {
+		t.Errorf("expected the malformed metadata to be left alone")
+	}
+}
+
+func TestStripXMPLocation(t *testing.T) {
+	processor := NewProcessor(80, 0)
+	// the GPS properties as attributes and as elements, in both kinds of quotes
+	const packet = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" ` +
+		`xmp:CreatorTool="Camera" exif:GPSLatitude="41,24.5N" exif:GPSLongitude = '2,10.2E'>` +
+		`<exif:GPSAltitude>1234/10</exif:GPSAltitude><exif:GPSTimeStamp>2026-10-19T10:00:00Z</exif:GPSTimeStamp>` +
+		`</rdf:Description></rdf:RDF></x:xmpmeta>`
+	secrets := []string{"41,24.5N", "2,10.2E", "1234/10", "2026-10-19T10:00:00Z"}
+
+	var jpegImage bytes.Buffer
+	if err := jpeg.Encode(&jpegImage, image.NewGray(image.Rect(0, 0, 4, 2)), nil); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	segment := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), packet...)
+	withJPEGXMP := append([]byte("\xff\xd8\xff\xe1"), binary.BigEndian.AppendUint16(nil, uint16(2+len(segment)))...)
+	withJPEGXMP = append(append(withJPEGXMP, segment...), jpegImage.Bytes()[2:]...)
+
+	var pngImage bytes.Buffer
+	if err := png.Encode(&pngImage, image.NewGray(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	header := pngImage.Bytes()[:8+25]
+	withPNGXMP := append(append([]byte{}, header...), pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"+packet))...)
+	withPNGXMP = append(withPNGXMP, pngImage.Bytes()[len(header):]...)
+
+	webpImage := append([]byte("RIFF\x00\x00\x00\x00WEBPXMP "), binary.LittleEndian.AppendUint32(nil, uint32(len(packet)))...)
+	webpImage = append(webpImage, packet...)
+
+	for name, data := range map[string][]byte{"jpeg": withJPEGXMP, "png": withPNGXMP, "webp": webpImage} {
+		size := len(data)
+		processor.StripLocation(data)
+		if len(data) != size {
+			t.Errorf("%s: expected the size to be kept, got %d instead of %d", name, len(data), size)
+		}
+		for _, secret := range secrets {
+			if bytes.Contains(data, []byte(secret)) {
+				t.Errorf("%s: expected %s to be gone", name, secret)
+			}
+		}
+		if !bytes.Contains(data, []byte(`xmp:CreatorTool="Camera"`)) {
+			t.Errorf("%s: expected the other properties to be kept", name)
+		}
+		// the packet stays well formed
+		decoder := xml.NewDecoder(bytes.NewReader(data[bytes.Index(data, []byte("<x:xmpmeta")) : bytes.Index(data, []byte("</x:xmpmeta>"))+12]))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%s: expected the XMP to stay readable, got %v", name, err)
+				break
+			}
+		}
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(withJPEGXMP)); err != nil {
+		t.Errorf("expected the jpeg to stay readable, got %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(withPNGXMP)); err != nil {
+		t.Errorf("expected the png to stay readable, got %v", err)
+	}
+
+	// a compressed packet goes as a whole
+	compressed := append(append([]byte{}, header...), pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x01\x00\x00\x00compressed"))...)
+	compressed = append(compressed, pngImage.Bytes()[len(header):]...)
+	processor.StripLocation(compressed)
+	if bytes.Contains(compressed, []byte("compressed")) {
+		t.Errorf("expected the compressed XMP to be zeroed")
+	}
+	if _, err := png.Decode(bytes.NewReader(compressed)); err != nil {
+		t.Errorf("expected the png to stay readable, got %v", err)
+	}
+}
+
+func TestMaxPixels(t *testing.T) {
+	var pngImage bytes.Buffer
+	if err := png.Encode(&pngImage, image.NewGray(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	// the header claims 60000x60000 pixels, the gigabytes are never allocated
+	huge := pngImage.Bytes()
+	binary.BigEndian.PutUint32(huge[16:], 60000)
+	binary.BigEndian.PutUint32(huge[20:], 60000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+
+	processor := NewProcessor(80, 50_000_000)
+	if width, height, err := processor.Inspect(huge); err != nil || width != 60000 || height != 60000 {
+		t.Errorf("expected the dimensions of the header, got %dx%d, %v", width, height, err)
+	}
+	if _, err := processor.Encode(huge, domain.MediaVariant{Name: "w1", Format: JPEG, Width: 1, Height: 1}); err == nil {
+		t.Errorf("expected the image to be turned down")
+	}
+}
+
+// newTIFF is EXIF metadata with the orientation and a GPS IFD with one text entry
+func newTIFF(orientation uint16, gpsText string) []byte {
+	const gpsIFD = 8 + 2 + 2*12 + 4
+	const gpsValue = gpsIFD + 2 + 12 + 4
+	var tiff bytes.Buffer
+	for _, value := range []any{
+		[]byte("II*\x00"), uint32(8),
+		uint16(2), uint16(orientationTag), uint16(3), uint32(1), orientation, uint16(0), uint16(gpsInfoTag), uint16(4), uint32(1), uint32(gpsIFD), uint32(0),
+		uint16(1), uint16(0x001b), uint16(7), uint32(len(gpsText)), uint32(gpsValue), uint32(0),
+		[]byte(gpsText),
+	} {
+		binary.Write(&tiff, binary.LittleEndian, value)
+	}
+	return tiff.Bytes()
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
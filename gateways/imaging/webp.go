@@ -0,0 +1,14 @@
+//go:build cgo
+
+package imaging
+
+import (
+	"image"
+	"io"
+
+	"github.com/chai2010/webp"
+)
+
+var webpEncoder encoder = func(w io.Writer, img image.Image, quality int) error {
+	return webp.Encode(w, img, &webp.Options{Quality: float32(quality)})
+}
@@ -0,0 +1,6 @@
+//go:build !cgo
+
+package imaging
+
+// webpEncoder there is no WebP encoder without cgo, the variants are JPEG only
+var webpEncoder encoder
@@ -0,0 +1,143 @@
+package imaging
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// the signatures of the JPEG APP1 segments with XMP, the main packet and the extensions of a large one
+var jpegXMPSignatures = [][]byte{[]byte("http://ns.adobe.com/xap/1.0/\x00"), []byte("http://ns.adobe.com/xmp/extension/\x00")}
+
+// gpsProperty matches the names of the GPS properties, e.g. exif:GPSLatitude, some cameras have their own ones, e.g.
+// drone-dji:GpsLongitude
+var gpsProperty = regexp.MustCompile(`[\w.-]+:(?i:gps)[\w.-]*`)
+
+/*
+xmp is an XMP packet of an image, XML text which is a slice of the image data like the EXIF metadata, so the GPS
+properties are blanked out in place rather than removed. A compressed packet can not be changed in place and is
+zeroed as a whole.
+*/
+type xmp struct {
+	data       []byte
+	compressed bool
+	// changed updates the checksum of the chunk, if the format has one
+	changed func()
+}
+
+// findXMP returns the XMP packets of a JPEG, PNG or WebP image
+func findXMP(data []byte) []*xmp {
+	var packets []*xmp
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8")):
+		jpegSegments(data, func(marker byte, segment []byte) bool {
+			for _, signature := range jpegXMPSignatures {
+				if marker == 0xe1 && bytes.HasPrefix(segment, signature) {
+					packets = append(packets, &xmp{data: segment[len(signature):], changed: func() {}})
+				}
+			}
+			return true
+		})
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		pngChunks(data, func(chunkType string, chunk []byte, updateCRC func()) bool {
+			if chunkType == "iTXt" {
+				if text, compressed, ok := pngXMP(chunk); ok {
+					packets = append(packets, &xmp{data: text, compressed: compressed, changed: updateCRC})
+				}
+			}
+			return true
+		})
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WEBP":
+		webpChunks(data, func(chunkType string, chunk []byte) bool {
+			if chunkType == "XMP " {
+				packets = append(packets, &xmp{data: chunk, changed: func() {}})
+			}
+			return true
+		})
+	}
+	return packets
+}
+
+// pngXMP returns the text of an iTXt chunk with the keyword of XMP: the keyword, the compression flag and method,
+// the language tag and the translated keyword come before it
+func pngXMP(chunk []byte) ([]byte, bool, bool) {
+	keyword := []byte("XML:com.adobe.xmp\x00")
+	if !bytes.HasPrefix(chunk, keyword) || len(chunk) < len(keyword)+2 {
+		return nil, false, false
+	}
+	rest := chunk[len(keyword):]
+	compressed := rest[0] != 0
+	rest = rest[2:]
+	for i := 0; i < 2; i++ {
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			return nil, false, false
+		}
+		rest = rest[end+1:]
+	}
+	return rest, compressed, true
+}
+
+// stripGPS blanks out the values of the GPS properties, written either as attributes or as elements, with spaces,
+// true when it did
+func (x *xmp) stripGPS() bool {
+	if x.compressed {
+		zero(x.data)
+		return len(x.data) > 0
+	}
+	stripped := false
+	position := 0
+	for {
+		match := gpsProperty.FindIndex(x.data[position:])
+		if match == nil {
+			return stripped
+		}
+		start, end := position+match[0], position+match[1]
+		position = end
+		name := x.data[start:end]
+		if bytes.HasPrefix(name, []byte("xmlns:")) || bytes.HasSuffix(x.data[:start], []byte("</")) {
+			// the declaration of a namespace or the end of an element
+			continue
+		}
+
+		if bytes.HasSuffix(x.data[:start], []byte("<")) {
+			// an element, its content goes up to the end tag with the same name
+			open := bytes.IndexByte(x.data[end:], '>')
+			if open < 0 || (open > 0 && x.data[end+open-1] == '/') {
+				continue
+			}
+			content := x.data[end+open+1:]
+			closing := bytes.Index(content, append(append([]byte("</"), name...), '>'))
+			if closing < 0 {
+				continue
+			}
+			blank(content[:closing])
+			position = end + open + 1 + closing
+			stripped = true
+			continue
+		}
+
+		// an attribute, its value is in quotes after the equals sign
+		rest := bytes.TrimLeft(x.data[end:], " \t\r\n")
+		if len(rest) == 0 || rest[0] != '=' {
+			continue
+		}
+		rest = bytes.TrimLeft(rest[1:], " \t\r\n")
+		if len(rest) == 0 || (rest[0] != '"' && rest[0] != '\'') {
+			continue
+		}
+		closing := bytes.IndexByte(rest[1:], rest[0])
+		if closing < 0 {
+			continue
+		}
+		blank(rest[1 : 1+closing])
+		position = len(x.data) - len(rest) + 1 + closing
+		stripped = true
+	}
+}
+
+// blank overwrites the text with spaces, which keeps the XML around it well formed
+func blank(text []byte) {
+	for i := range text {
+		text[i] = ' '
+	}
+}
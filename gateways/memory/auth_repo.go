@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AuthRepo issues the same JWT tokens as the real one, so that they can be validated by the AuthManager
+type AuthRepo struct {
+	conf *config.Config
+}
+
+func NewAuthRepo(conf *config.Config) domain.AuthRepo {
+	return &AuthRepo{
+		conf: conf,
+	}
+}
+
+func (r *AuthRepo) GetToken(ctx context.Context, userID int64, tokenVersion int, permissions map[string]any) (string, error) {
+	currentTime := time.Now().UTC()
+	claims := domain.CustomClaims{
+		UserID:       userID,
+		TokenVersion: tokenVersion,
+		Permissions:  permissions,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(currentTime.Add(time.Minute * time.Duration(r.conf.Login.Expiry))),
+			IssuedAt:  jwt.NewNumericDate(currentTime),
+			NotBefore: jwt.NewNumericDate(currentTime),
+			Issuer:    "blogzilla",
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(r.conf.Login.Secret))
+}
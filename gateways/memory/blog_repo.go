@@ -0,0 +1,289 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+type BlogRepo struct {
+	store *Store
+}
+
+func NewBlogRepo(store *Store) domain.BlogRepo {
+	return &BlogRepo{
+		store: store,
+	}
+}
+
+func (r *BlogRepo) Create(ctx context.Context, newBlog *domain.Blog) (int64, error) {
+	blogID := int64(-1)
+	err := r.store.write(ctx, func() error {
+		// the blogs.user_id foreign key
+		if _, ok := r.store.users[newBlog.UserID]; !ok {
+			return fmt.Errorf("user %d does not exist", newBlog.UserID)
+		}
+
+		r.store.lastBlogID++
+		blogID = r.store.lastBlogID
+		createdAt := now()
+		r.store.blogs[blogID] = &domain.Blog{
+			ID:      blogID,
+			UserID:  newBlog.UserID,
+			Title:   newBlog.Title,
+			Content: newBlog.Content,
+			Tags:    newBlog.Tags,
+			// the column defaults
+			ContentFormat:   contentFormatOrDefault(newBlog.ContentFormat),
+			CommentsEnabled: true,
+			Visibility:      visibilityOrDefault(newBlog.Visibility),
+			Status:          statusOrDefault(newBlog.Status),
+			CreatedAt:       createdAt,
+			UpdatedAt:       createdAt,
+		}
+		return nil
+	})
+	return blogID, err
+}
+
+func (r *BlogRepo) Get(ctx context.Context, blogID int64) (*domain.Blog, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	blog, ok := r.store.blogs[blogID]
+	if !ok {
+		return nil, domain.NewNotFoundError("blog", blogID)
+	}
+	found := *blog
+	return &found, nil
+}
+
+func (r *BlogRepo) GetBySlug(ctx context.Context, slug string) (*domain.Blog, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	blogID, ok := r.store.blogSlugs[slug]
+	if !ok {
+		return nil, domain.NewNotFoundError("blog", slug)
+	}
+	found := *r.store.blogs[blogID]
+	return &found, nil
+}
+
+func (r *BlogRepo) Update(ctx context.Context, blog *domain.Blog) error {
+	return r.store.write(ctx, func() error {
+		stored, ok := r.store.blogs[blog.ID]
+		if !ok {
+			return domain.NewNotFoundError("blog", blog.ID)
+		}
+		updated := *stored
+		updated.Title = blog.Title
+		updated.Content = blog.Content
+		updated.Tags = blog.Tags
+		if blog.Status != "" {
+			updated.Status = blog.Status
+		}
+		if blog.Visibility != "" {
+			updated.Visibility = blog.Visibility
+		}
+		if blog.ContentFormat != "" {
+			updated.ContentFormat = blog.ContentFormat
+		}
+		updated.UpdatedAt = now()
+		r.store.blogs[blog.ID] = &updated
+		return nil
+	})
+}
+
+func (r *BlogRepo) SetSlug(ctx context.Context, blogID int64, slug string) error {
+	return r.store.write(ctx, func() error {
+		blog, ok := r.store.blogs[blogID]
+		if !ok {
+			return domain.NewNotFoundError("blog", blogID)
+		}
+		// the primary key of blog_slugs
+		if ownerID, ok := r.store.blogSlugs[slug]; ok && ownerID != blogID {
+			return domain.NewConflictError("blog", fmt.Sprintf("slug '%s' is already taken", slug))
+		}
+		r.store.blogSlugs[slug] = blogID
+		updated := *blog
+		updated.Slug = slug
+		r.store.blogs[blogID] = &updated
+		return nil
+	})
+}
+
+func (r *BlogRepo) WithoutSlug(ctx context.Context, limit int) ([]*domain.Blog, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+
+	r.store.mu.RLock()
+	var matches []*domain.Blog
+	for _, blog := range r.store.blogs {
+		if blog.Slug == "" {
+			found := *blog
+			matches = append(matches, &found)
+		}
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return page(matches, 0, limit), nil
+}
+
+func (r *BlogRepo) SetCommentsEnabled(ctx context.Context, blogID int64, enabled bool) error {
+	return r.store.write(ctx, func() error {
+		blog, ok := r.store.blogs[blogID]
+		if !ok {
+			return domain.NewNotFoundError("blog", blogID)
+		}
+		updated := *blog
+		updated.CommentsEnabled = enabled
+		r.store.blogs[blogID] = &updated
+		return nil
+	})
+}
+
+func (r *BlogRepo) Feed(ctx context.Context, userID int64, access domain.BlogAccess, after *domain.FeedCursor, limit int) ([]*domain.Blog, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+
+	r.store.mu.RLock()
+	var matches []*domain.Blog
+	for _, blog := range r.store.blogs {
+		if _, ok := r.store.follows[userID][blog.UserID]; !ok {
+			continue
+		}
+		if !access.Allows(blog) || (after != nil && !isOlder(blog, after)) {
+			continue
+		}
+		found := *blog
+		matches = append(matches, &found)
+	}
+	r.store.mu.RUnlock()
+
+	sortNewestFirst(matches)
+	return page(matches, 0, limit), nil
+}
+
+func (r *BlogRepo) Latest(ctx context.Context, access domain.BlogAccess, filter domain.BlogFilter, limit int) ([]*domain.Blog, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+
+	r.store.mu.RLock()
+	var matches []*domain.Blog
+	for _, blog := range r.store.blogs {
+		if access.Allows(blog) && filter.Matches(blog) {
+			found := *blog
+			matches = append(matches, &found)
+		}
+	}
+	r.store.mu.RUnlock()
+
+	sortNewestFirst(matches)
+	return page(matches, 0, limit), nil
+}
+
+// isOlder is the row comparison (created_at, id) < (cursor.CreatedAt, cursor.BlogID)
+func isOlder(blog *domain.Blog, cursor *domain.FeedCursor) bool {
+	if !blog.CreatedAt.Equal(cursor.CreatedAt) {
+		return blog.CreatedAt.Before(cursor.CreatedAt)
+	}
+	return blog.ID < cursor.BlogID
+}
+
+func sortNewestFirst(blogs []*domain.Blog) {
+	sort.Slice(blogs, func(i, j int) bool {
+		if !blogs[i].CreatedAt.Equal(blogs[j].CreatedAt) {
+			return blogs[i].CreatedAt.After(blogs[j].CreatedAt)
+		}
+		return blogs[i].ID > blogs[j].ID
+	})
+}
+
+// Search matches the search text against the title, content and tags with the same rules as the Postgres
+// ILIKE '%search%' (case insensitive, % and _ are wildcards) and returns the newest blogs first
+func (r *BlogRepo) Search(ctx context.Context, access domain.BlogAccess, offset int, limit int, search string) ([]*domain.Blog, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+	matcher, err := likePattern(search)
+	if err != nil {
+		return nil, err
+	}
+
+	r.store.mu.RLock()
+	var matches []*domain.Blog
+	for _, blog := range r.store.blogs {
+		if access.Allows(blog) && matcher.MatchString(blog.Title+" "+blog.Content+" "+blog.Tags) {
+			found := *blog
+			matches = append(matches, &found)
+		}
+	}
+	r.store.mu.RUnlock()
+
+	sortNewestFirst(matches)
+	return page(matches, offset, limit), nil
+}
+
+// Reindex the blogs are searched as they are, there is no index to rebuild
+func (r *BlogRepo) Reindex(ctx context.Context) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	return len(r.store.blogs), nil
+}
+
+// likePattern translates "ILIKE '%' || search || '%'" into a regular expression
+func likePattern(search string) (*regexp.Regexp, error) {
+	var pattern strings.Builder
+	pattern.WriteString("(?is)^.*")
+	escaped := false
+	for _, c := range search {
+		switch {
+		case escaped:
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '%':
+			pattern.WriteString(".*")
+		case c == '_':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	pattern.WriteString(".*$")
+	return regexp.Compile(pattern.String())
+}
+
+// visibilityOrDefault the blogs created without a visibility get the column default
+func visibilityOrDefault(visibility domain.Visibility) domain.Visibility {
+	if visibility == "" {
+		return domain.DefaultVisibility
+	}
+	return visibility
+}
+
+// contentFormatOrDefault the blogs created without a content format get the column default
+func contentFormatOrDefault(format domain.ContentFormat) domain.ContentFormat {
+	if format == "" {
+		return domain.DefaultContentFormat
+	}
+	return format
+}
+
+// statusOrDefault the blogs created without a status get the column default
+func statusOrDefault(status domain.BlogStatus) domain.BlogStatus {
+	if status == "" {
+		return domain.DefaultStatus
+	}
+	return status
+}
@@ -0,0 +1,159 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+type CommentRepo struct {
+	store *Store
+}
+
+func NewCommentRepo(store *Store) domain.CommentRepo {
+	return &CommentRepo{
+		store: store,
+	}
+}
+
+func (r *CommentRepo) Create(ctx context.Context, comment *domain.Comment) (int64, error) {
+	commentID := int64(-1)
+	err := r.store.write(ctx, func() error {
+		// the foreign keys
+		if _, ok := r.store.blogs[comment.BlogID]; !ok {
+			return fmt.Errorf("blog %d does not exist", comment.BlogID)
+		}
+		if _, ok := r.store.users[comment.UserID]; !ok {
+			return fmt.Errorf("user %d does not exist", comment.UserID)
+		}
+		parentPath := ""
+		if comment.ParentID != 0 {
+			if _, ok := r.store.comments[comment.ParentID]; !ok {
+				return fmt.Errorf("comment %d does not exist", comment.ParentID)
+			}
+			parentPath = r.store.commentPaths[comment.ParentID]
+		}
+
+		r.store.lastCommentID++
+		commentID = r.store.lastCommentID
+		createdAt := now()
+		r.store.comments[commentID] = &domain.Comment{
+			ID:        commentID,
+			BlogID:    comment.BlogID,
+			UserID:    comment.UserID,
+			ParentID:  comment.ParentID,
+			Depth:     comment.Depth,
+			Content:   comment.Content,
+			Status:    comment.Status,
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		}
+		r.store.commentPaths[commentID] = parentPath + fmt.Sprintf("%012d/", commentID)
+		return nil
+	})
+	return commentID, err
+}
+
+func (r *CommentRepo) Get(ctx context.Context, commentID int64) (*domain.Comment, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	comment, ok := r.store.comments[commentID]
+	if !ok {
+		return nil, domain.NewNotFoundError("comment", commentID)
+	}
+	found := *comment
+	return &found, nil
+}
+
+func (r *CommentRepo) UpdateContent(ctx context.Context, commentID int64, content string) error {
+	return r.update(ctx, commentID, func(comment *domain.Comment) {
+		comment.Content = content
+	})
+}
+
+func (r *CommentRepo) UpdateStatus(ctx context.Context, commentID int64, status domain.CommentStatus) error {
+	return r.update(ctx, commentID, func(comment *domain.Comment) {
+		comment.Status = status
+	})
+}
+
+func (r *CommentRepo) update(ctx context.Context, commentID int64, change func(comment *domain.Comment)) error {
+	return r.store.write(ctx, func() error {
+		comment, ok := r.store.comments[commentID]
+		if !ok {
+			return domain.NewNotFoundError("comment", commentID)
+		}
+		updated := *comment
+		change(&updated)
+		updated.UpdatedAt = now()
+		r.store.comments[commentID] = &updated
+		return nil
+	})
+}
+
+// ListByBlog returns the comments in thread order, i.e. ordered by their paths
+func (r *CommentRepo) ListByBlog(ctx context.Context, blogID int64, status domain.CommentStatus, offset int, limit int) ([]*domain.Comment, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+
+	r.store.mu.RLock()
+	var matches []*domain.Comment
+	paths := make(map[int64]string)
+	for id, comment := range r.store.comments {
+		if comment.BlogID == blogID && comment.Status == status {
+			found := *comment
+			matches = append(matches, &found)
+			paths[id] = r.store.commentPaths[id]
+		}
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		return paths[matches[i].ID] < paths[matches[j].ID]
+	})
+	return page(matches, offset, limit), nil
+}
+
+// ListByStatus returns the oldest comments first
+func (r *CommentRepo) ListByStatus(ctx context.Context, status domain.CommentStatus, offset int, limit int) ([]*domain.Comment, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+
+	r.store.mu.RLock()
+	var matches []*domain.Comment
+	for _, comment := range r.store.comments {
+		if comment.Status == status {
+			found := *comment
+			matches = append(matches, &found)
+		}
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.Before(matches[j].CreatedAt)
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	return page(matches, offset, limit), nil
+}
+
+// page applies OFFSET and LIMIT, an empty page is nil just like a query without rows
+func page[T any](matches []T, offset int, limit int) []T {
+	if offset >= len(matches) {
+		return nil
+	}
+	matches = matches[offset:]
+	if limit < len(matches) {
+		matches = matches[:limit]
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches
+}
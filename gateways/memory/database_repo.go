@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+// DatabaseRepo creates the built-in roles, the admin user is created by the DatabaseManager
+type DatabaseRepo struct {
+	conf  *config.Config
+	store *Store
+}
+
+func NewDatabaseRepo(conf *config.Config, store *Store) domain.DatabaseRepo {
+	return &DatabaseRepo{
+		conf:  conf,
+		store: store,
+	}
+}
+
+func (r *DatabaseRepo) Initialize(ctx context.Context) error {
+	return r.store.write(ctx, r.syncRoles)
+}
+
+// syncRoles creates the missing built-in roles and resets the permissions of the existing ones
+func (r *DatabaseRepo) syncRoles() error {
+	for _, builtIn := range utils.BuiltInRoles {
+		role := domain.Role{
+			Name:        builtIn.Name,
+			Description: builtIn.Description,
+			Permissions: append([]string(nil), builtIn.Permissions...),
+		}
+		if roleID, ok := r.store.roleNames[role.Name]; ok {
+			role.ID = roleID
+		} else {
+			r.store.lastRoleID++
+			role.ID = r.store.lastRoleID
+			r.store.roleNames[role.Name] = role.ID
+		}
+		r.store.roles[role.ID] = &role
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+type FollowRepo struct {
+	store *Store
+}
+
+func NewFollowRepo(store *Store) domain.FollowRepo {
+	return &FollowRepo{
+		store: store,
+	}
+}
+
+func (r *FollowRepo) Follow(ctx context.Context, follow *domain.Follow) (bool, error) {
+	added := false
+	err := r.store.write(ctx, func() error {
+		// the foreign keys and the check constraint
+		for _, userID := range []int64{follow.FollowerID, follow.FolloweeID} {
+			if _, ok := r.store.users[userID]; !ok {
+				return fmt.Errorf("user %d does not exist", userID)
+			}
+		}
+		if follow.FollowerID == follow.FolloweeID {
+			return fmt.Errorf("user %d can not follow itself", follow.FollowerID)
+		}
+
+		if _, ok := r.store.follows[follow.FollowerID][follow.FolloweeID]; ok {
+			return nil
+		}
+		if r.store.follows[follow.FollowerID] == nil {
+			r.store.follows[follow.FollowerID] = make(map[int64]*domain.Follow)
+		}
+		r.store.follows[follow.FollowerID][follow.FolloweeID] = &domain.Follow{
+			FollowerID: follow.FollowerID,
+			FolloweeID: follow.FolloweeID,
+			CreatedAt:  now(),
+		}
+		added = true
+		return nil
+	})
+	return added, err
+}
+
+func (r *FollowRepo) Unfollow(ctx context.Context, follow *domain.Follow) (bool, error) {
+	removed := false
+	err := r.store.write(ctx, func() error {
+		if _, ok := r.store.follows[follow.FollowerID][follow.FolloweeID]; ok {
+			delete(r.store.follows[follow.FollowerID], follow.FolloweeID)
+			removed = true
+		}
+		return nil
+	})
+	return removed, err
+}
+
+func (r *FollowRepo) Followers(ctx context.Context, userID int64, offset int, limit int) ([]*domain.Follow, error) {
+	return r.list(offset, limit, func(follow *domain.Follow) bool { return follow.FolloweeID == userID },
+		func(follow *domain.Follow) int64 { return follow.FollowerID })
+}
+
+func (r *FollowRepo) Following(ctx context.Context, userID int64, offset int, limit int) ([]*domain.Follow, error) {
+	return r.list(offset, limit, func(follow *domain.Follow) bool { return follow.FollowerID == userID },
+		func(follow *domain.Follow) int64 { return follow.FolloweeID })
+}
+
+// list returns the matching follows newest first, the ties are broken by the id of the other user
+func (r *FollowRepo) list(offset int, limit int, match func(*domain.Follow) bool, otherID func(*domain.Follow) int64) ([]*domain.Follow, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+
+	r.store.mu.RLock()
+	var matches []*domain.Follow
+	for _, follows := range r.store.follows {
+		for _, follow := range follows {
+			if match(follow) {
+				found := *follow
+				matches = append(matches, &found)
+			}
+		}
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+		return otherID(matches[i]) > otherID(matches[j])
+	})
+	return page(matches, offset, limit), nil
+}
+
+func (r *FollowRepo) Counts(ctx context.Context, userID int64) (followers int64, following int64, err error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for followerID, follows := range r.store.follows {
+		if followerID == userID {
+			following = int64(len(follows))
+		}
+		if _, ok := follows[userID]; ok {
+			followers++
+		}
+	}
+	return followers, following, nil
+}
@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+type IdempotencyRepo struct {
+	store *Store
+}
+
+func NewIdempotencyRepo(store *Store) domain.IdempotencyRepo {
+	return &IdempotencyRepo{
+		store: store,
+	}
+}
+
+func (r *IdempotencyRepo) Reserve(ctx context.Context, request *domain.IdempotentRequest, lease time.Duration) (*domain.IdempotentRequest, error) {
+	var existing *domain.IdempotentRequest
+	err := r.store.write(ctx, func() error {
+		key := idempotencyKey{userID: request.UserID, key: request.Key}
+		createdAt := now()
+		if stored, ok := r.store.idempotentRequests[key]; ok && stored.ExpiresAt.After(createdAt) {
+			// the same request is taken over when it has been running since before the end of its lease
+			if stored.Done() || stored.Fingerprint != request.Fingerprint || !stored.CreatedAt.Before(createdAt.Add(-lease)) {
+				existing = copyIdempotentRequest(stored)
+				return nil
+			}
+		}
+		reserved := copyIdempotentRequest(request)
+		reserved.Status, reserved.ContentType, reserved.Body = 0, "", nil
+		reserved.CreatedAt = createdAt
+		reserved.ExpiresAt = request.ExpiresAt.UTC().Truncate(time.Microsecond)
+		r.store.idempotentRequests[key] = reserved
+		return nil
+	})
+	return existing, err
+}
+
+func (r *IdempotencyRepo) Complete(ctx context.Context, request *domain.IdempotentRequest) error {
+	return r.store.write(ctx, func() error {
+		key := idempotencyKey{userID: request.UserID, key: request.Key}
+		stored, ok := r.store.idempotentRequests[key]
+		if !ok {
+			return domain.NewNotFoundError("idempotent request", request.Key)
+		}
+		completed := *stored
+		completed.Status = request.Status
+		completed.ContentType = request.ContentType
+		completed.Body = append([]byte{}, request.Body...)
+		r.store.idempotentRequests[key] = &completed
+		return nil
+	})
+}
+
+func (r *IdempotencyRepo) Release(ctx context.Context, userID int64, key string) error {
+	return r.store.write(ctx, func() error {
+		delete(r.store.idempotentRequests, idempotencyKey{userID: userID, key: key})
+		return nil
+	})
+}
+
+func (r *IdempotencyRepo) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	deleted := 0
+	err := r.store.write(ctx, func() error {
+		for key, request := range r.store.idempotentRequests {
+			if request.ExpiresAt.Before(before) {
+				delete(r.store.idempotentRequests, key)
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// copyIdempotentRequest the body is copied as well, the stored requests are never shared with the callers
+func copyIdempotentRequest(request *domain.IdempotentRequest) *domain.IdempotentRequest {
+	copied := *request
+	if request.Body != nil {
+		copied.Body = append([]byte{}, request.Body...)
+	}
+	return &copied
+}
@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+type MediaRepo struct {
+	store *Store
+}
+
+func NewMediaRepo(store *Store) domain.MediaRepo {
+	return &MediaRepo{
+		store: store,
+	}
+}
+
+func (r *MediaRepo) Create(ctx context.Context, media *domain.Media) (int64, error) {
+	mediaID := int64(-1)
+	err := r.store.write(ctx, func() error {
+		// the foreign keys
+		if _, ok := r.store.users[media.UserID]; !ok {
+			return fmt.Errorf("user %d does not exist", media.UserID)
+		}
+		if _, ok := r.store.blogs[media.BlogID]; media.BlogID != 0 && !ok {
+			return fmt.Errorf("blog %d does not exist", media.BlogID)
+		}
+
+		r.store.lastMediaID++
+		mediaID = r.store.lastMediaID
+		created := *media
+		created.ID = mediaID
+		created.CreatedAt = now()
+		r.store.media[mediaID] = &created
+		return nil
+	})
+	return mediaID, err
+}
+
+func (r *MediaRepo) Get(ctx context.Context, mediaID int64) (*domain.Media, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	media, ok := r.store.media[mediaID]
+	if !ok {
+		return nil, domain.NewNotFoundError("media", mediaID)
+	}
+	found := *media
+	return &found, nil
+}
+
+func (r *MediaRepo) Attach(ctx context.Context, mediaID int64, blogID int64) error {
+	return r.store.write(ctx, func() error {
+		media, ok := r.store.media[mediaID]
+		if !ok {
+			return domain.NewNotFoundError("media", mediaID)
+		}
+		if _, ok := r.store.blogs[blogID]; !ok {
+			return fmt.Errorf("blog %d does not exist", blogID)
+		}
+		updated := *media
+		updated.BlogID = blogID
+		r.store.media[mediaID] = &updated
+		return nil
+	})
+}
+
+func (r *MediaRepo) ListByBlog(ctx context.Context, blogID int64) ([]*domain.Media, error) {
+	return r.list(func(media *domain.Media) bool { return media.BlogID == blogID }, -1), nil
+}
+
+func (r *MediaRepo) Orphans(ctx context.Context, before time.Time, limit int) ([]*domain.Media, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+	return r.list(func(media *domain.Media) bool { return media.BlogID == 0 && media.CreatedAt.Before(before) }, limit), nil
+}
+
+func (r *MediaRepo) DeleteOrphan(ctx context.Context, mediaID int64) (bool, error) {
+	deleted := false
+	err := r.store.write(ctx, func() error {
+		if media, ok := r.store.media[mediaID]; ok && media.BlogID == 0 {
+			delete(r.store.media, mediaID)
+			deleted = true
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// list returns the matching media oldest first, all of them when the limit is negative
+func (r *MediaRepo) list(matches func(media *domain.Media) bool, limit int) []*domain.Media {
+	r.store.mu.RLock()
+	var found []*domain.Media
+	for _, media := range r.store.media {
+		if matches(media) {
+			copied := *media
+			found = append(found, &copied)
+		}
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	if limit >= 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	return found
+}
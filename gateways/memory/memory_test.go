@@ -0,0 +1,28 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/gateways/contract"
+)
+
+func TestContract(t *testing.T) {
+	contract.Run(t, func(t *testing.T, conf *config.Config) contract.Repos {
+		store := NewStore()
+		authRepo := NewAuthRepo(conf)
+		userRepo := NewUserRepo(store, authRepo)
+		return contract.Repos{
+			Tx:          NewTxManager(store),
+			Database:    NewDatabaseRepo(conf, store),
+			Users:       userRepo,
+			Blogs:       NewBlogRepo(store),
+			Comments:    NewCommentRepo(store),
+			Reactions:   NewReactionRepo(store),
+			Follows:     NewFollowRepo(store),
+			Media:       NewMediaRepo(store),
+			Idempotency: NewIdempotencyRepo(store),
+			Auth:        authRepo,
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+type ReactionRepo struct {
+	store *Store
+}
+
+func NewReactionRepo(store *Store) domain.ReactionRepo {
+	return &ReactionRepo{
+		store: store,
+	}
+}
+
+func (r *ReactionRepo) Add(ctx context.Context, reaction *domain.Reaction) (bool, error) {
+	added := false
+	err := r.store.write(ctx, func() error {
+		// the foreign keys
+		if _, ok := r.store.blogs[reaction.BlogID]; !ok {
+			return fmt.Errorf("blog %d does not exist", reaction.BlogID)
+		}
+		if _, ok := r.store.users[reaction.UserID]; !ok {
+			return fmt.Errorf("user %d does not exist", reaction.UserID)
+		}
+
+		key := reactionKey{userID: reaction.UserID, reactionType: reaction.Type}
+		if _, ok := r.store.reactions[reaction.BlogID][key]; ok {
+			return nil
+		}
+		if r.store.reactions[reaction.BlogID] == nil {
+			r.store.reactions[reaction.BlogID] = make(map[reactionKey]*domain.Reaction)
+			r.store.reactionCounts[reaction.BlogID] = make(map[string]int64)
+		}
+		r.store.reactions[reaction.BlogID][key] = &domain.Reaction{
+			BlogID:    reaction.BlogID,
+			UserID:    reaction.UserID,
+			Type:      reaction.Type,
+			CreatedAt: now(),
+		}
+		r.store.reactionCounts[reaction.BlogID][reaction.Type]++
+		added = true
+		return nil
+	})
+	return added, err
+}
+
+func (r *ReactionRepo) Remove(ctx context.Context, reaction *domain.Reaction) (bool, error) {
+	removed := false
+	err := r.store.write(ctx, func() error {
+		key := reactionKey{userID: reaction.UserID, reactionType: reaction.Type}
+		if _, ok := r.store.reactions[reaction.BlogID][key]; !ok {
+			return nil
+		}
+		delete(r.store.reactions[reaction.BlogID], key)
+		r.store.reactionCounts[reaction.BlogID][reaction.Type]--
+		removed = true
+		return nil
+	})
+	return removed, err
+}
+
+func (r *ReactionRepo) Counts(ctx context.Context, blogIDs ...int64) (map[int64]map[string]int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	counts := make(map[int64]map[string]int64, len(blogIDs))
+	for _, blogID := range blogIDs {
+		for reactionType, count := range r.store.reactionCounts[blogID] {
+			if count <= 0 {
+				continue
+			}
+			if counts[blogID] == nil {
+				counts[blogID] = make(map[string]int64)
+			}
+			counts[blogID][reactionType] = count
+		}
+	}
+	return counts, nil
+}
+
+// List returns the newest reactions first
+func (r *ReactionRepo) List(ctx context.Context, blogID int64, reactionType string, offset int, limit int) ([]*domain.Reaction, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+
+	r.store.mu.RLock()
+	var matches []*domain.Reaction
+	for _, reaction := range r.store.reactions[blogID] {
+		if reactionType == "" || reaction.Type == reactionType {
+			found := *reaction
+			matches = append(matches, &found)
+		}
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+		if matches[i].UserID != matches[j].UserID {
+			return matches[i].UserID > matches[j].UserID
+		}
+		return matches[i].Type < matches[j].Type
+	})
+	return page(matches, offset, limit), nil
+}
@@ -0,0 +1,214 @@
+/*
+Package memory is an in-memory implementation of the repositories defined in the domain package. It follows
+the same semantics as the Postgres implementation (unique usernames, role permissions, search ordering and
+pagination) and is safe for concurrent use, which makes it a fast stand-in for tests and local experiments.
+All the repositories created from the same Store share its data, just like the Postgres ones share a database.
+*/
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+// Store holds the "tables", guarded by a single lock. txMu serializes the transactions with each other
+// and with the writes made outside of a transaction, so that a rollback never throws away somebody else's
+// write. Reads are not isolated from a running transaction.
+type Store struct {
+	mu   sync.RWMutex
+	txMu sync.Mutex
+
+	users     map[int64]*domain.User
+	usernames map[string]int64
+	roles     map[int64]*domain.Role
+	roleNames map[string]int64
+	userRoles map[int64]map[int64]struct{}
+	blogs     map[int64]*domain.Blog
+	// every slug a blog has had -> blog id, like the blog_slugs table
+	blogSlugs map[string]int64
+	comments  map[int64]*domain.Comment
+	// comment id -> the zero padded ids of the ancestors and of the comment itself, see the Postgres CommentRepo
+	commentPaths map[int64]string
+	// blog id -> user id + type -> reaction, the counters are kept next to them like in the other repositories
+	reactions      map[int64]map[reactionKey]*domain.Reaction
+	reactionCounts map[int64]map[string]int64
+	// follower id -> followee id -> follow
+	follows map[int64]map[int64]*domain.Follow
+	media   map[int64]*domain.Media
+	// user id + key -> request
+	idempotentRequests map[idempotencyKey]*domain.IdempotentRequest
+
+	// mimic the SERIAL columns
+	lastUserID    int64
+	lastRoleID    int64
+	lastBlogID    int64
+	lastCommentID int64
+	lastMediaID   int64
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:     make(map[int64]*domain.User),
+		usernames: make(map[string]int64),
+		roles:     make(map[int64]*domain.Role),
+		roleNames: make(map[string]int64),
+		userRoles: make(map[int64]map[int64]struct{}),
+		blogs:     make(map[int64]*domain.Blog),
+		blogSlugs: make(map[string]int64),
+		comments:  make(map[int64]*domain.Comment),
+
+		commentPaths: make(map[int64]string),
+
+		reactions:      make(map[int64]map[reactionKey]*domain.Reaction),
+		reactionCounts: make(map[int64]map[string]int64),
+		follows:        make(map[int64]map[int64]*domain.Follow),
+		media:          make(map[int64]*domain.Media),
+
+		idempotentRequests: make(map[idempotencyKey]*domain.IdempotentRequest),
+	}
+}
+
+type reactionKey struct {
+	userID       int64
+	reactionType string
+}
+
+type idempotencyKey struct {
+	userID int64
+	key    string
+}
+
+// now returns the current time the way it comes back from a Postgres TIMESTAMP column
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+type txKey struct{}
+
+func inTx(ctx context.Context) bool {
+	return ctx.Value(txKey{}) != nil
+}
+
+// write runs fn under the store lock, waiting for the running transaction unless it is part of it
+func (s *Store) write(ctx context.Context, fn func() error) error {
+	if !inTx(ctx) {
+		s.txMu.Lock()
+		defer s.txMu.Unlock()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn()
+}
+
+// snapshot copies the data so that a transaction can be rolled back, the caller holds the lock
+func (s *Store) snapshot() *Store {
+	snapshot := &Store{
+		users:     make(map[int64]*domain.User, len(s.users)),
+		usernames: make(map[string]int64, len(s.usernames)),
+		roles:     make(map[int64]*domain.Role, len(s.roles)),
+		roleNames: make(map[string]int64, len(s.roleNames)),
+		userRoles: make(map[int64]map[int64]struct{}, len(s.userRoles)),
+		blogs:     make(map[int64]*domain.Blog, len(s.blogs)),
+		blogSlugs: make(map[string]int64, len(s.blogSlugs)),
+		comments:  make(map[int64]*domain.Comment, len(s.comments)),
+
+		commentPaths:   make(map[int64]string, len(s.commentPaths)),
+		reactions:      make(map[int64]map[reactionKey]*domain.Reaction, len(s.reactions)),
+		reactionCounts: make(map[int64]map[string]int64, len(s.reactionCounts)),
+		follows:        make(map[int64]map[int64]*domain.Follow, len(s.follows)),
+		media:          make(map[int64]*domain.Media, len(s.media)),
+
+		idempotentRequests: make(map[idempotencyKey]*domain.IdempotentRequest, len(s.idempotentRequests)),
+		lastUserID:         s.lastUserID,
+		lastRoleID:         s.lastRoleID,
+		lastBlogID:         s.lastBlogID,
+		lastCommentID:      s.lastCommentID,
+		lastMediaID:        s.lastMediaID,
+	}
+	// the stored entities are replaced rather than modified, so copying the pointers is enough
+	for k, v := range s.users {
+		snapshot.users[k] = v
+	}
+	for k, v := range s.usernames {
+		snapshot.usernames[k] = v
+	}
+	for k, v := range s.roles {
+		snapshot.roles[k] = v
+	}
+	for k, v := range s.roleNames {
+		snapshot.roleNames[k] = v
+	}
+	for k, v := range s.userRoles {
+		roleIDs := make(map[int64]struct{}, len(v))
+		for roleID := range v {
+			roleIDs[roleID] = struct{}{}
+		}
+		snapshot.userRoles[k] = roleIDs
+	}
+	for k, v := range s.blogs {
+		snapshot.blogs[k] = v
+	}
+	for k, v := range s.blogSlugs {
+		snapshot.blogSlugs[k] = v
+	}
+	for k, v := range s.comments {
+		snapshot.comments[k] = v
+	}
+	for k, v := range s.commentPaths {
+		snapshot.commentPaths[k] = v
+	}
+	for k, v := range s.reactions {
+		reactions := make(map[reactionKey]*domain.Reaction, len(v))
+		for key, reaction := range v {
+			reactions[key] = reaction
+		}
+		snapshot.reactions[k] = reactions
+	}
+	for k, v := range s.reactionCounts {
+		counts := make(map[string]int64, len(v))
+		for reactionType, count := range v {
+			counts[reactionType] = count
+		}
+		snapshot.reactionCounts[k] = counts
+	}
+	for k, v := range s.follows {
+		follows := make(map[int64]*domain.Follow, len(v))
+		for followeeID, follow := range v {
+			follows[followeeID] = follow
+		}
+		snapshot.follows[k] = follows
+	}
+	for k, v := range s.media {
+		snapshot.media[k] = v
+	}
+	for k, v := range s.idempotentRequests {
+		snapshot.idempotentRequests[k] = v
+	}
+	return snapshot
+}
+
+// restore puts the data of the snapshot back, the caller holds the lock
+func (s *Store) restore(snapshot *Store) {
+	s.users = snapshot.users
+	s.usernames = snapshot.usernames
+	s.roles = snapshot.roles
+	s.roleNames = snapshot.roleNames
+	s.userRoles = snapshot.userRoles
+	s.blogs = snapshot.blogs
+	s.blogSlugs = snapshot.blogSlugs
+	s.comments = snapshot.comments
+	s.commentPaths = snapshot.commentPaths
+	s.reactions = snapshot.reactions
+	s.reactionCounts = snapshot.reactionCounts
+	s.follows = snapshot.follows
+	s.media = snapshot.media
+	s.idempotentRequests = snapshot.idempotentRequests
+	s.lastUserID = snapshot.lastUserID
+	s.lastRoleID = snapshot.lastRoleID
+	s.lastBlogID = snapshot.lastBlogID
+	s.lastCommentID = snapshot.lastCommentID
+	s.lastMediaID = snapshot.lastMediaID
+}
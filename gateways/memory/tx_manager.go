@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+// TxManager runs one transaction at a time and rolls back by restoring a snapshot of the store
+type TxManager struct {
+	store *Store
+}
+
+func NewTxManager(store *Store) domain.TxManager {
+	return &TxManager{
+		store: store,
+	}
+}
+
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if inTx(ctx) {
+		return fn(ctx)
+	}
+
+	m.store.txMu.Lock()
+	defer m.store.txMu.Unlock()
+
+	m.store.mu.RLock()
+	snapshot := m.store.snapshot()
+	m.store.mu.RUnlock()
+
+	err := fn(context.WithValue(ctx, txKey{}, true))
+	if err != nil {
+		m.store.mu.Lock()
+		m.store.restore(snapshot)
+		m.store.mu.Unlock()
+	}
+	return err
+}
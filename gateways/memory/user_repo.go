@@ -0,0 +1,248 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+type UserRepo struct {
+	store       *Store
+	sessionRepo domain.AuthRepo
+}
+
+func NewUserRepo(store *Store, sessionRepo domain.AuthRepo) domain.UserRepo {
+	return &UserRepo{
+		store:       store,
+		sessionRepo: sessionRepo,
+	}
+}
+
+// Create only inserts the user with the hashed password, the use case takes care of the roles within the same transaction
+func (r *UserRepo) Create(ctx context.Context, newUser *domain.User) (*domain.User, error) {
+	var createdUser domain.User
+	err := r.store.write(ctx, func() error {
+		if _, ok := r.store.usernames[newUser.Username]; ok {
+			return domain.NewConflictError("user", fmt.Sprintf("username '%s' is already taken", newUser.Username))
+		}
+
+		r.store.lastUserID++
+		createdAt := now()
+		user := &domain.User{
+			ID:        r.store.lastUserID,
+			Username:  newUser.Username,
+			Password:  newUser.Password,
+			FirstName: newUser.FirstName,
+			LastName:  newUser.LastName,
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		}
+		r.store.users[user.ID] = user
+		r.store.usernames[user.Username] = user.ID
+		r.store.userRoles[user.ID] = make(map[int64]struct{})
+		createdUser = *user
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &createdUser, nil
+}
+
+func (r *UserRepo) AssignRoles(ctx context.Context, userID int64, roleIDs ...int64) error {
+	return r.store.write(ctx, func() error {
+		// check everything first so that nothing is assigned when one of them fails
+		if _, ok := r.store.users[userID]; !ok {
+			return domain.NewNotFoundError("user", userID)
+		}
+		for _, roleID := range roleIDs {
+			if _, ok := r.store.roles[roleID]; !ok {
+				return domain.NewNotFoundError("role", roleID)
+			}
+			if _, ok := r.store.userRoles[userID][roleID]; ok {
+				return domain.NewConflictError("role", fmt.Sprintf("role %d is already assigned to user %d", roleID, userID))
+			}
+		}
+		for _, roleID := range roleIDs {
+			r.store.userRoles[userID][roleID] = struct{}{}
+		}
+		return nil
+	})
+}
+
+// RevokeRoles checks everything first like AssignRoles, so that nothing is revoked when one of them fails
+func (r *UserRepo) RevokeRoles(ctx context.Context, userID int64, roleIDs ...int64) error {
+	return r.store.write(ctx, func() error {
+		if _, ok := r.store.users[userID]; !ok {
+			return domain.NewNotFoundError("user", userID)
+		}
+		for _, roleID := range roleIDs {
+			if _, ok := r.store.userRoles[userID][roleID]; !ok {
+				return domain.NewConflictError("role", fmt.Sprintf("role %d is not assigned to user %d", roleID, userID))
+			}
+		}
+		for _, roleID := range roleIDs {
+			delete(r.store.userRoles[userID], roleID)
+		}
+		return nil
+	})
+}
+
+func (r *UserRepo) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var roleNames []string
+	for roleID := range r.store.userRoles[userID] {
+		roleNames = append(roleNames, r.store.roles[roleID].Name)
+	}
+	sort.Strings(roleNames)
+	return roleNames, nil
+}
+
+func (r *UserRepo) GetRoleByName(ctx context.Context, roleName string) (*domain.Role, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	roleID, ok := r.store.roleNames[roleName]
+	if !ok {
+		return nil, domain.NewNotFoundError("role", roleName)
+	}
+	role := *r.store.roles[roleID]
+	role.Permissions = append([]string(nil), role.Permissions...)
+	return &role, nil
+}
+
+func (r *UserRepo) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	userID, ok := r.store.usernames[username]
+	if !ok {
+		// user not found
+		return nil, nil
+	}
+	user := *r.store.users[userID]
+	return &user, nil
+}
+
+func (r *UserRepo) GetUserByID(ctx context.Context, userID int64) (*domain.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[userID]
+	if !ok {
+		return nil, domain.NewNotFoundError("user", userID)
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *UserRepo) GetUsersByIDs(ctx context.Context, userIDs ...int64) (map[int64]*domain.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	users := make(map[int64]*domain.User, len(userIDs))
+	for _, userID := range userIDs {
+		if user, ok := r.store.users[userID]; ok {
+			found := *user
+			users[userID] = &found
+		}
+	}
+	return users, nil
+}
+
+func (r *UserRepo) ListUsers(ctx context.Context, offset int, limit int) ([]*domain.User, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+
+	r.store.mu.RLock()
+	users := make([]*domain.User, 0, len(r.store.users))
+	for _, user := range r.store.users {
+		found := *user
+		users = append(users, &found)
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return page(users, offset, limit), nil
+}
+
+func (r *UserRepo) SetPassword(ctx context.Context, userID int64, hashedPassword string) error {
+	return r.updateUser(ctx, userID, func(user *domain.User) {
+		user.Password = hashedPassword
+	})
+}
+
+func (r *UserRepo) SetDisabled(ctx context.Context, userID int64, disabled bool) error {
+	return r.updateUser(ctx, userID, func(user *domain.User) {
+		user.Disabled = disabled
+	})
+}
+
+func (r *UserRepo) RevokeTokens(ctx context.Context, userID int64) error {
+	return r.updateUser(ctx, userID, func(user *domain.User) {
+		user.TokenVersion++
+	})
+}
+
+// updateUser changes a copy of the user, the snapshot of a transaction keeps the old one
+func (r *UserRepo) updateUser(ctx context.Context, userID int64, update func(user *domain.User)) error {
+	return r.store.write(ctx, func() error {
+		user, ok := r.store.users[userID]
+		if !ok {
+			return domain.NewNotFoundError("user", userID)
+		}
+		updated := *user
+		update(&updated)
+		updated.UpdatedAt = now()
+		r.store.users[userID] = &updated
+		return nil
+	})
+}
+
+func (r *UserRepo) Login(ctx context.Context, username string, password string) (string, error) {
+	user, err := r.GetUserByUsername(ctx, username)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user by name")
+	}
+	if user == nil {
+		// do not tell the caller which of the two was wrong
+		return "", domain.NewUnauthorizedError("invalid username or password")
+	}
+
+	err = utils.ComparePassword(ctx, user.Password, password)
+	if err != nil {
+		return "", domain.NewUnauthorizedError("invalid username or password")
+	}
+	if user.Disabled {
+		return "", domain.NewForbiddenError("the user is disabled")
+	}
+
+	token, err := r.sessionRepo.GetToken(ctx, user.ID, user.TokenVersion, r.getUserPermissions(user.ID))
+	if err != nil {
+		return "", fmt.Errorf("failed to set the session information")
+	}
+	return token, nil
+}
+
+func (r *UserRepo) GetPermissions(ctx context.Context, userID int64) (map[string]any, error) {
+	return r.getUserPermissions(userID), nil
+}
+
+func (r *UserRepo) getUserPermissions(userID int64) map[string]any {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	permissions := make(map[string]any)
+	for roleID := range r.store.userRoles[userID] {
+		for _, permission := range r.store.roles[roleID].Permissions {
+			permissions[permission] = nil
+		}
+	}
+	return permissions
+}
@@ -0,0 +1,71 @@
+/*
+Package ratelimit has the implementations of the domain RateLimiter, the buckets in memory for a single node and in
+Redis when the nodes of a cluster have to share them.
+*/
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+var logger = utils.Logger()
+
+// maxBuckets is how many buckets the MemoryLimiter keeps, the least recently used one is dropped first. A dropped
+// bucket starts full again, which only ever lets a client in sooner.
+const maxBuckets = 100000
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// MemoryLimiter keeps the buckets in the memory of the server, every server of a cluster would count on its own
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets *utils.LRU[string, *bucket]
+	now     func() time.Time
+}
+
+func NewMemoryLimiter() domain.RateLimiter {
+	return newMemoryLimiter(time.Now)
+}
+
+func newMemoryLimiter(now func() time.Time) *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: utils.NewLRU[string, *bucket](maxBuckets),
+		now:     now,
+	}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit domain.RateLimit) (domain.RateLimitResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets.Get(key)
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), at: now}
+		l.buckets.Add(key, b)
+	}
+	// the tokens which came back since the last request, the bucket does not hold more than the burst
+	tokens := b.tokens + float64(now.Sub(b.at))/float64(limit.Interval)
+	if tokens > float64(limit.Burst) {
+		tokens = float64(limit.Burst)
+	}
+
+	result := domain.RateLimitResult{Allowed: tokens >= 1}
+	if result.Allowed {
+		tokens--
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) * float64(limit.Interval))
+	}
+	result.Remaining = int(tokens)
+	result.ResetAfter = time.Duration((float64(limit.Burst) - tokens) * float64(limit.Interval))
+	b.tokens, b.at = tokens, now
+	return result, nil
+}
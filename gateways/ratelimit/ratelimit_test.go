@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newMemoryLimiter(func() time.Time { return now })
+	testLimiter(t, limiter, func(d time.Duration) { now = now.Add(d) })
+	testConcurrentRequests(t, NewMemoryLimiter())
+}
+
+// TestRedisLimiter runs against miniredis, which runs the Lua scripts like a Redis does
+func TestRedisLimiter(t *testing.T) {
+	server := miniredis.RunT(t)
+	now := time.Now()
+	server.SetTime(now)
+	limiter, err := NewRedisLimiter(context.Background(), config.RedisConfig{Addr: server.Addr()})
+	if err != nil {
+		t.Fatalf("failed to create the limiter: %v", err)
+	}
+	testLimiter(t, limiter, func(d time.Duration) {
+		now = now.Add(d)
+		server.SetTime(now)
+		server.FastForward(d)
+	})
+	if server.Exists(redisKeyPrefix + "user:1") {
+		t.Errorf("expected the full bucket to expire")
+	}
+	testConcurrentRequests(t, limiter)
+
+	server.Close()
+	if _, err := limiter.Allow(context.Background(), "user:1", domain.RateLimit{Burst: 1, Interval: time.Second}); err == nil {
+		t.Errorf("expected an error when redis is gone")
+	}
+}
+
+func testLimiter(t *testing.T, limiter domain.RateLimiter, advance func(d time.Duration)) {
+	ctx := context.Background()
+	limit := domain.RateLimit{Burst: 3, Interval: time.Second}
+	allow := func(key string) domain.RateLimitResult {
+		t.Helper()
+		result, err := limiter.Allow(ctx, key, limit)
+		if err != nil {
+			t.Fatalf("failed to take a token: %v", err)
+		}
+		return result
+	}
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		if result := allow("user:1"); !result.Allowed || result.Remaining != remaining {
+			t.Errorf("expected the burst to be allowed with %d remaining, got %+v", remaining, result)
+		}
+	}
+	result := allow("user:1")
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != time.Second || result.ResetAfter != 3*time.Second {
+		t.Errorf("expected the request after the burst to wait for a second, got %+v", result)
+	}
+	if result := allow("user:2"); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("expected another key to have its own bucket, got %+v", result)
+	}
+
+	advance(time.Second)
+	if result := allow("user:1"); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("expected a token back after a second, got %+v", result)
+	}
+	if result := allow("user:1"); result.Allowed {
+		t.Errorf("expected only one token back, got %+v", result)
+	}
+
+	advance(time.Minute)
+	if result := allow("user:2"); !result.Allowed || result.Remaining != 2 || result.ResetAfter != time.Second {
+		t.Errorf("expected the bucket to be full again but not more, got %+v", result)
+	}
+	advance(time.Minute)
+}
+
+// testConcurrentRequests only the burst gets through when the requests come at once
+func testConcurrentRequests(t *testing.T, limiter domain.RateLimiter) {
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := limiter.Allow(context.Background(), "ip:192.0.2.1", domain.RateLimit{Burst: 5, Interval: time.Hour})
+			if err != nil {
+				t.Errorf("failed to take a token: %v", err)
+			}
+			if result.Allowed {
+				atomic.AddInt64(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Errorf("expected 5 of the concurrent requests to be allowed, got %d", allowed)
+	}
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix keeps the buckets apart from anything else in the Redis
+const redisKeyPrefix = "blogzilla:ratelimit:"
+
+/*
+takeScript does what the MemoryLimiter does, within Redis so that the servers taking from the same bucket at once do
+not miss each other's tokens. The time is the one of the Redis rather than of the servers, whose clocks may differ.
+A bucket is a hash of its tokens and the time in milliseconds it last had them, it expires once it is full again.
+
+	KEYS[1] the bucket, ARGV[1] the burst, ARGV[2] the milliseconds until a token comes back
+	returns whether the request is allowed, the tokens remaining, and the milliseconds until a token is back and
+	until the bucket is full
+*/
+var takeScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local tokens = burst
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+if bucket[1] then
+  tokens = math.min(burst, tonumber(bucket[1]) + (now - tonumber(bucket[2])) / interval)
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) * interval)
+end
+local reset = math.ceil((burst - tokens) * interval)
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'at', tostring(now))
+redis.call('PEXPIRE', KEYS[1], reset + 1)
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// RedisLimiter keeps the buckets in Redis, so that the servers of a cluster share them
+type RedisLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisLimiter fails when the Redis can not be reached
+func NewRedisLimiter(ctx context.Context, conf config.RedisConfig) (domain.RateLimiter, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.Addr,
+		Password: conf.Password,
+		DB:       conf.DB,
+	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("unable to reach redis: %v", err)
+	}
+	return &RedisLimiter{client: client}, nil
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit domain.RateLimit) (domain.RateLimitResult, error) {
+	interval := float64(limit.Interval) / float64(time.Millisecond)
+	values, err := takeScript.Run(ctx, l.client, []string{redisKeyPrefix + key}, limit.Burst, interval).Int64Slice()
+	if err != nil {
+		logger.WithError(err).Errorf("failed to take a token. key: %s", key)
+		return domain.RateLimitResult{}, err
+	}
+	return domain.RateLimitResult{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
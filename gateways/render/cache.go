@@ -0,0 +1,42 @@
+package render
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+// CachedRenderer keeps the most recently rendered contents, the key is a hash of the format and the content so an
+// edited blog is rendered again and equal contents are rendered once
+type CachedRenderer struct {
+	next  domain.ContentRenderer
+	cache *utils.LRU[string, string]
+}
+
+func NewCachedRenderer(next domain.ContentRenderer, size int) domain.ContentRenderer {
+	return &CachedRenderer{
+		next:  next,
+		cache: utils.NewLRU[string, string](size),
+	}
+}
+
+func (r *CachedRenderer) Render(ctx context.Context, format domain.ContentFormat, content string) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(format))
+	hash.Write([]byte{0})
+	hash.Write([]byte(content))
+	key := hex.EncodeToString(hash.Sum(nil))
+
+	if rendered, ok := r.cache.Get(key); ok {
+		return rendered, nil
+	}
+	rendered, err := r.next.Render(ctx, format, content)
+	if err != nil {
+		return "", err
+	}
+	r.cache.Add(key, rendered)
+	return rendered, nil
+}
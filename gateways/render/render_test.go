@@ -0,0 +1,132 @@
+package render
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+func TestRender(t *testing.T) {
+	renderer := NewRenderer()
+	for _, tc := range []struct {
+		name     string
+		format   domain.ContentFormat
+		content  string
+		contains []string
+		excludes []string
+	}{
+		{"markdown script", domain.FormatMarkdown,
+			"Some **bold** text <script>alert(1)</script>",
+			[]string{"<strong>bold</strong>"},
+			[]string{"<script", "alert(1)"}},
+		{"html script", domain.FormatHTML,
+			`<p>Hi</p><script src="https://evil.example/x.js"></script>`,
+			[]string{"<p>Hi</p>"},
+			[]string{"<script", "evil.example"}},
+		{"markdown onerror", domain.FormatMarkdown,
+			`An image <img src="x.png" onerror="steal()">`,
+			[]string{`<img src="x.png">`},
+			[]string{"onerror", "steal()"}},
+		{"html event handlers", domain.FormatHTML,
+			`<p onclick="steal()" onmouseover="steal()">Hi</p>`,
+			[]string{"<p>Hi</p>"},
+			[]string{"onclick", "onmouseover", "steal()"}},
+		{"markdown javascript link", domain.FormatMarkdown,
+			"[there](javascript:steal())",
+			nil,
+			[]string{"javascript:", "<a "}},
+		{"html javascript link", domain.FormatHTML,
+			`<a href="javascript:steal()">there</a> <a href="https://example.com">here</a>`,
+			[]string{`<a href="https://example.com" rel="nofollow">here</a>`},
+			[]string{"javascript:"}},
+		{"heading anchors", domain.FormatMarkdown,
+			"# Getting Started\n\n## Getting Started\n\n### Ünïcode & more",
+			[]string{`<h1 id="getting-started">Getting Started</h1>`, `<h2 id="getting-started-1">Getting Started</h2>`, `<h3 id=`},
+			nil},
+		{"highlighted code", domain.FormatMarkdown,
+			"```go\nfunc main() {}\n```\n",
+			[]string{`<pre class="chroma">`, `<span class="kd">func</span>`},
+			[]string{"style="}},
+		{"highlight classes only", domain.FormatHTML,
+			`<span class="x&quot; onclick=&quot;steal()">a</span><span class="k" style="color:red">b</span>`,
+			[]string{`<span class="k">b</span>`},
+			[]string{"onclick", "style="}},
+		{"plaintext", domain.FormatPlaintext,
+			"1 < 2 & <b>not bold</b>\r\nnext line\n\n\n<script>alert(1)</script>",
+			[]string{"<p>1 &lt; 2 &amp; &lt;b&gt;not bold&lt;/b&gt;<br>\nnext line</p>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+			[]string{"<script", "\r"}},
+	} {
+		rendered, err := renderer.Render(context.Background(), tc.format, tc.content)
+		if err != nil {
+			t.Fatalf("%s: failed to render: %v", tc.name, err)
+		}
+		for _, expected := range tc.contains {
+			if !strings.Contains(rendered, expected) {
+				t.Errorf("%s: expected %q in %q", tc.name, expected, rendered)
+			}
+		}
+		for _, unexpected := range tc.excludes {
+			if strings.Contains(rendered, unexpected) {
+				t.Errorf("%s: did not expect %q in %q", tc.name, unexpected, rendered)
+			}
+		}
+	}
+
+	if _, err := renderer.Render(context.Background(), "rtf", "text"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestCachedRenderer(t *testing.T) {
+	counting := &countingRenderer{next: NewRenderer()}
+	cached := NewCachedRenderer(counting, 2)
+	for _, tc := range []struct {
+		name    string
+		format  domain.ContentFormat
+		content string
+		renders int // the renders so far
+	}{
+		{"first", domain.FormatMarkdown, "same", 1},
+		{"same content", domain.FormatMarkdown, "same", 1},
+		{"other content", domain.FormatMarkdown, "other", 2},
+		{"same content again", domain.FormatMarkdown, "same", 2},
+		{"other format", domain.FormatPlaintext, "same", 3},
+		// the cache holds 2 contents, "other" was used the longest time ago
+		{"evicted", domain.FormatMarkdown, "other", 4},
+		{"kept", domain.FormatPlaintext, "same", 4},
+	} {
+		rendered, err := cached.Render(context.Background(), tc.format, tc.content)
+		if err != nil {
+			t.Fatalf("%s: failed to render: %v", tc.name, err)
+		}
+		if expected, _ := NewRenderer().Render(context.Background(), tc.format, tc.content); rendered != expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, expected, rendered)
+		}
+		if counting.calls != tc.renders {
+			t.Errorf("%s: expected %d renders, got %d", tc.name, tc.renders, counting.calls)
+		}
+	}
+
+	// a failed render is not cached
+	for i := 0; i < 2; i++ {
+		if _, err := cached.Render(context.Background(), "rtf", "same"); err == nil {
+			t.Error("expected an error for an unknown format")
+		}
+	}
+	if counting.calls != 6 {
+		t.Errorf("expected the failed renders to be tried again, got %d renders", counting.calls)
+	}
+}
+
+// countingRenderer counts the contents which get past the cache
+type countingRenderer struct {
+	next  domain.ContentRenderer
+	calls int
+}
+
+func (r *countingRenderer) Render(ctx context.Context, format domain.ContentFormat, content string) (string, error) {
+	r.calls++
+	return r.next.Render(ctx, format, content)
+}
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/bipuldutta/blogzilla/domain"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// the classes of the syntax highlighting, the styles come from a chroma style sheet of the client's choice
+var highlightClass = regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)
+
+var paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+
+/*
+Renderer turns markdown, HTML and plain text into sanitized HTML. The markdown may contain raw HTML, both go through
+the same allowlist which drops the scripts, the event handler (on*) attributes and anything else not known to be
+safe. The plain text is escaped. The headings get an id to link to and the fenced code blocks are highlighted
+with CSS classes rather than inline styles.
+*/
+type Renderer struct {
+	markdown goldmark.Markdown
+	policy   *bluemonday.Policy
+}
+
+func NewRenderer() domain.ContentRenderer {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("class").Matching(highlightClass).OnElements("pre", "code", "span")
+
+	return &Renderer{
+		markdown: goldmark.New(
+			goldmark.WithExtensions(
+				extension.GFM,
+				highlighting.NewHighlighting(highlighting.WithFormatOptions(chromahtml.WithClasses(true))),
+			),
+			goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+			// the raw HTML is kept here and sanitized along with the rest
+			goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+		),
+		policy: policy,
+	}
+}
+
+func (r *Renderer) Render(ctx context.Context, format domain.ContentFormat, content string) (string, error) {
+	switch format {
+	case domain.FormatMarkdown:
+		var rendered bytes.Buffer
+		if err := r.markdown.Convert([]byte(content), &rendered); err != nil {
+			return "", err
+		}
+		return r.policy.Sanitize(rendered.String()), nil
+	case domain.FormatHTML:
+		return r.policy.Sanitize(content), nil
+	case domain.FormatPlaintext:
+		return plaintextHTML(content), nil
+	}
+	return "", fmt.Errorf("unknown content format '%s'", format)
+}
+
+// plaintextHTML keeps the paragraphs (separated by blank lines) and the line breaks of the text
+func plaintextHTML(content string) string {
+	var rendered strings.Builder
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	for _, paragraph := range paragraphBreak.Split(content, -1) {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		rendered.WriteString("<p>")
+		rendered.WriteString(strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>\n"))
+		rendered.WriteString("</p>\n")
+	}
+	return rendered.String()
+}
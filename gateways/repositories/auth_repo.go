@@ -11,7 +11,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var authLogger = *utils.Logger()
+var authLogger = utils.Logger()
 
 type AuthRepo struct {
 	conf *config.Config
@@ -23,11 +23,12 @@ func NewAuthRepo(conf *config.Config) domain.AuthRepo {
 	}
 }
 
-func (r *AuthRepo) GetToken(ctx context.Context, userID int64, permissions map[string]any) (string, error) {
+func (r *AuthRepo) GetToken(ctx context.Context, userID int64, tokenVersion int, permissions map[string]any) (string, error) {
 	currentTime := time.Now().UTC()
 	claims := domain.CustomClaims{
-		UserID:      userID,
-		Permissions: permissions,
+		UserID:       userID,
+		TokenVersion: tokenVersion,
+		Permissions:  permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
 			// A usual scenario is to set the expiration time relative to the current time
 			ExpiresAt: jwt.NewNumericDate(currentTime.Add(time.Minute * time.Duration(r.conf.Login.Expiry))),
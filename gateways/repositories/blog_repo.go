@@ -2,29 +2,82 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/bipuldutta/blogzilla/config"
 	"github.com/bipuldutta/blogzilla/domain"
 	"github.com/bipuldutta/blogzilla/utils"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 const (
-	createBlogQuery = `INSERT INTO blogs (user_id, title, content, tags) VALUES ($1, $2, $3, $4) RETURNING id`
+	blogColumns     = `b.id, b.user_id, b.title, COALESCE(b.slug, ''), b.content, b.content_format, b.tags, b.comments_enabled, b.visibility, b.status, b.created_at, b.updated_at`
+	createBlogQuery = `INSERT INTO blogs (user_id, title, content, content_format, tags, visibility, status) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
 	getBlogQuery    = `
-		SELECT id, user_id, title, content, tags, created_at, updated_at FROM blogs 
-		WHERE id = $1
+		SELECT ` + blogColumns + ` FROM blogs b
+		WHERE b.id = $1
     `
-	searchBlogQuery = `
-		SELECT id, user_id, title, content, tags, created_at, updated_at FROM blogs 
-		WHERE (COALESCE(title, '') || ' ' || COALESCE(content, '') || ' ' || COALESCE(tags, '')) ILIKE '%' || $1 || '%'
-		ORDER BY created_at DESC 
+	getBlogBySlugQuery = `
+		SELECT ` + blogColumns + ` FROM blog_slugs s JOIN blogs b ON b.id = s.blog_id
+		WHERE s.slug = $1
+    `
+	updateBlogQuery = `
+		UPDATE blogs SET title = $2, content = $3, tags = $4, status = COALESCE(NULLIF($5, ''), status),
+		visibility = COALESCE(NULLIF($6, ''), visibility), content_format = COALESCE(NULLIF($7, ''), content_format),
+		updated_at = NOW() WHERE id = $1
+	`
+	setSlugQuery = `UPDATE blogs SET slug = $2 WHERE id = $1`
+	// a slug of the blog itself is taken over again, a slug of another blog is left alone
+	addSlugQuery = `
+		INSERT INTO blog_slugs (slug, blog_id) VALUES ($1, $2)
+		ON CONFLICT (slug) DO UPDATE SET blog_id = EXCLUDED.blog_id WHERE blog_slugs.blog_id = EXCLUDED.blog_id
+	`
+	withoutSlugQuery = `SELECT ` + blogColumns + ` FROM blogs b WHERE b.slug IS NULL ORDER BY b.id LIMIT $1`
+	searchBlogQuery  = `
+		SELECT ` + blogColumns + ` FROM blogs b
+		WHERE (COALESCE(b.title, '') || ' ' || COALESCE(b.content, '') || ' ' || COALESCE(b.tags, '')) ILIKE '%' || $1 || '%'
+		AND ((b.status = 'published' AND b.visibility = ANY($4::text[])) OR b.user_id = $5)
+		ORDER BY b.created_at DESC, b.id DESC
 		OFFSET $2 LIMIT $3
     `
+	countBlogsQuery         = `SELECT COUNT(*) FROM blogs`
+	setCommentsEnabledQuery = `UPDATE blogs SET comments_enabled = $2 WHERE id = $1`
+	// the lateral join reads at most a page of blogs per followed author straight from the blogs_user_created_idx
+	// index and merges them, so the cost depends on the number of followed authors and the page size only
+	feedQuery = `
+		SELECT ` + blogColumns + `
+		FROM follows f
+		CROSS JOIN LATERAL (
+			SELECT * FROM blogs
+			WHERE user_id = f.followee_id AND (created_at, id) < ($2::timestamp, $3::bigint)
+			AND ((status = 'published' AND visibility = ANY($5::text[])) OR user_id = $6)
+			ORDER BY created_at DESC, id DESC
+			LIMIT $4
+		) b
+		WHERE f.follower_id = $1
+		ORDER BY b.created_at DESC, b.id DESC
+		LIMIT $4
+	`
+	latestBlogsQuery = `
+		SELECT ` + blogColumns + ` FROM blogs b
+		WHERE ($1::bigint = 0 OR b.user_id = $1)
+		AND ($2::text = '' OR lower($2) = ANY(regexp_split_to_array(lower(trim(COALESCE(b.tags, ''))), '\s*,\s*')))
+		AND ((b.status = 'published' AND b.visibility = ANY($4::text[])) OR b.user_id = $5)
+		ORDER BY b.created_at DESC, b.id DESC
+		LIMIT $3
+	`
 )
 
-var blogLogger = *utils.Logger()
+// the cursor of the first page of a feed, i.e. before every blog
+var feedStart = domain.FeedCursor{CreatedAt: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), BlogID: math.MaxInt64}
+
+var blogLogger = utils.Logger()
 
 type BlogRepo struct {
 	conf   *config.Config
@@ -41,7 +94,8 @@ func NewBlogRepo(conf *config.Config, client *pgxpool.Pool) domain.BlogRepo {
 func (r *BlogRepo) Create(ctx context.Context, newBlog *domain.Blog) (int64, error) {
 	var blogID int64
 	// create blog and return its id
-	err := r.client.QueryRow(ctx, createBlogQuery, newBlog.UserID, newBlog.Title, newBlog.Content, newBlog.Tags).Scan(&blogID)
+	err := conn(ctx, r.client).QueryRow(ctx, createBlogQuery, newBlog.UserID, newBlog.Title, newBlog.Content,
+		contentFormatOrDefault(newBlog.ContentFormat), newBlog.Tags, visibilityOrDefault(newBlog.Visibility), statusOrDefault(newBlog.Status)).Scan(&blogID)
 	if err != nil {
 		blogLogger.WithError(err).Error("failed to create blog")
 		return -1, err
@@ -50,36 +104,216 @@ func (r *BlogRepo) Create(ctx context.Context, newBlog *domain.Blog) (int64, err
 }
 
 func (r *BlogRepo) Get(ctx context.Context, blogID int64) (*domain.Blog, error) {
-	rows := r.client.QueryRow(ctx, getBlogQuery, blogID)
-	var blog domain.Blog
-	err := rows.Scan(&blog.ID, &blog.UserID, &blog.Title, &blog.Content, &blog.Tags, &blog.CreatedAt, &blog.UpdatedAt)
+	blog, err := scanBlog(conn(ctx, r.client).QueryRow(ctx, getBlogQuery, blogID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.NewNotFoundError("blog", blogID)
+	}
 	if err != nil {
 		blogLogger.WithError(err).Errorf("failed to get blog. blog id: %d", blogID)
 		return nil, err
 	}
 
-	return &blog, nil
+	return blog, nil
+}
+
+func (r *BlogRepo) GetBySlug(ctx context.Context, slug string) (*domain.Blog, error) {
+	blog, err := scanBlog(conn(ctx, r.client).QueryRow(ctx, getBlogBySlugQuery, slug))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.NewNotFoundError("blog", slug)
+	}
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to get blog. slug: %s", slug)
+		return nil, err
+	}
+	return blog, nil
+}
+
+func (r *BlogRepo) Update(ctx context.Context, blog *domain.Blog) error {
+	tag, err := conn(ctx, r.client).Exec(ctx, updateBlogQuery, blog.ID, blog.Title, blog.Content, blog.Tags, string(blog.Status), string(blog.Visibility),
+		string(blog.ContentFormat))
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to update blog. blog id: %d", blog.ID)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewNotFoundError("blog", blog.ID)
+	}
+	return nil
+}
+
+func (r *BlogRepo) SetSlug(ctx context.Context, blogID int64, slug string) error {
+	tag, err := conn(ctx, r.client).Exec(ctx, setSlugQuery, blogID, slug)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to set the slug. blog id: %d", blogID)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewNotFoundError("blog", blogID)
+	}
+	tag, err = conn(ctx, r.client).Exec(ctx, addSlugQuery, slug, blogID)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to set the slug. blog id: %d", blogID)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewConflictError("blog", fmt.Sprintf("slug '%s' is already taken", slug))
+	}
+	return nil
+}
+
+func (r *BlogRepo) WithoutSlug(ctx context.Context, limit int) ([]*domain.Blog, error) {
+	rows, err := conn(ctx, r.client).Query(ctx, withoutSlugQuery, limit)
+	if err != nil {
+		blogLogger.WithError(err).Error("failed to query the blogs without a slug")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blogs []*domain.Blog
+	for rows.Next() {
+		blog, err := scanBlog(rows)
+		if err != nil {
+			blogLogger.WithError(err).Error("failed to query the blogs without a slug")
+			return nil, err
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, rows.Err()
+}
+
+func (r *BlogRepo) Feed(ctx context.Context, userID int64, access domain.BlogAccess, after *domain.FeedCursor, limit int) ([]*domain.Blog, error) {
+	if after == nil {
+		after = &feedStart
+	}
+	rows, err := conn(ctx, r.client).Query(ctx, feedQuery, userID, after.CreatedAt, after.BlogID, limit, visibilities(access), access.UserID)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to query the feed. user id: %d", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blogs []*domain.Blog
+	for rows.Next() {
+		blog, err := scanBlog(rows)
+		if err != nil {
+			blogLogger.WithError(err).Errorf("failed to query the feed. user id: %d", userID)
+			return nil, err
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, rows.Err()
 }
 
-func (r *BlogRepo) Search(ctx context.Context, offset int, limit int, search string) ([]*domain.Blog, error) {
+func (r *BlogRepo) Latest(ctx context.Context, access domain.BlogAccess, filter domain.BlogFilter, limit int) ([]*domain.Blog, error) {
+	rows, err := conn(ctx, r.client).Query(ctx, latestBlogsQuery, filter.UserID, strings.TrimSpace(filter.Tag), limit, visibilities(access), access.UserID)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to query the latest blogs. limit: %d", limit)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blogs []*domain.Blog
+	for rows.Next() {
+		blog, err := scanBlog(rows)
+		if err != nil {
+			blogLogger.WithError(err).Errorf("failed to query the latest blogs. limit: %d", limit)
+			return nil, err
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, rows.Err()
+}
+
+func (r *BlogRepo) Search(ctx context.Context, access domain.BlogAccess, offset int, limit int, search string) ([]*domain.Blog, error) {
 	var blogs []*domain.Blog
 
-	rows, err := r.client.Query(ctx, searchBlogQuery, search, offset, limit)
+	rows, err := conn(ctx, r.client).Query(ctx, searchBlogQuery, search, offset, limit, visibilities(access), access.UserID)
 	if err != nil {
-		blogLogger.WithError(err).Errorf("failed to query blogs. offset: %d, limit: %d, search: %s", offset, limit, search)
+		blogLogger.WithError(err).Errorf("failed to query blogs. offset: %d, limit: %d", offset, limit)
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var blog domain.Blog
-		err = rows.Scan(&blog.ID, &blog.UserID, &blog.Title, &blog.Content, &blog.Tags, &blog.CreatedAt, &blog.UpdatedAt)
+		blog, err := scanBlog(rows)
 		if err != nil {
-			blogLogger.WithError(err).Errorf("failed to query blogs. offset: %d, limit: %d, search: %s", offset, limit, search)
+			blogLogger.WithError(err).Errorf("failed to query blogs. offset: %d, limit: %d", offset, limit)
 			return nil, err
 		}
-		blogs = append(blogs, &blog)
+		blogs = append(blogs, blog)
 	}
 
 	return blogs, nil
 }
+
+func (r *BlogRepo) SetCommentsEnabled(ctx context.Context, blogID int64, enabled bool) error {
+	tag, err := conn(ctx, r.client).Exec(ctx, setCommentsEnabledQuery, blogID, enabled)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to update blog. blog id: %d", blogID)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewNotFoundError("blog", blogID)
+	}
+	return nil
+}
+
+// Reindex the search scans the blogs with ILIKE, so this only rebuilds the indexes of the blogs and their slugs, e.g.
+// after they bloated or were corrupted
+func (r *BlogRepo) Reindex(ctx context.Context) (int, error) {
+	for _, table := range []string{"blogs", "blog_slugs"} {
+		if _, err := conn(ctx, r.client).Exec(ctx, "REINDEX TABLE "+table); err != nil {
+			blogLogger.WithError(err).Errorf("failed to reindex the %s", table)
+			return 0, err
+		}
+	}
+	var count int
+	err := conn(ctx, r.client).QueryRow(ctx, countBlogsQuery).Scan(&count)
+	return count, err
+}
+
+func scanBlog(row pgx.Row) (*domain.Blog, error) {
+	var blog domain.Blog
+	var contentFormat, visibility, status string
+	err := row.Scan(&blog.ID, &blog.UserID, &blog.Title, &blog.Slug, &blog.Content, &contentFormat, &blog.Tags, &blog.CommentsEnabled, &visibility,
+		&status, &blog.CreatedAt, &blog.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	blog.ContentFormat = domain.ContentFormat(contentFormat)
+	blog.Visibility = domain.Visibility(visibility)
+	blog.Status = domain.BlogStatus(status)
+	return &blog, nil
+}
+
+func visibilities(access domain.BlogAccess) []string {
+	values := make([]string, 0, len(access.Visibilities))
+	for _, visibility := range access.Visibilities {
+		values = append(values, string(visibility))
+	}
+	return values
+}
+
+// visibilityOrDefault the blogs created without a visibility get the column default
+func visibilityOrDefault(visibility domain.Visibility) domain.Visibility {
+	if visibility == "" {
+		return domain.DefaultVisibility
+	}
+	return visibility
+}
+
+// contentFormatOrDefault the blogs created without a content format get the column default
+func contentFormatOrDefault(format domain.ContentFormat) domain.ContentFormat {
+	if format == "" {
+		return domain.DefaultContentFormat
+	}
+	return format
+}
+
+// statusOrDefault the blogs created without a status get the column default
+func statusOrDefault(status domain.BlogStatus) domain.BlogStatus {
+	if status == "" {
+		return domain.DefaultStatus
+	}
+	return status
+}
@@ -0,0 +1,139 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+/*
+	The comments keep a materialized path, i.e. the zero padded ids of all the ancestors and of the comment itself,
+	so that ordering by the path lists every comment right after its parent, oldest first on every level.
+*/
+
+const (
+	commentColumns = `id, blog_id, user_id, COALESCE(parent_id, 0), depth, content, status, created_at, updated_at`
+	// the id is taken up front as it is part of the path
+	createCommentQuery = `
+		WITH next AS (SELECT nextval('comments_id_seq') AS id)
+		INSERT INTO comments (id, blog_id, user_id, parent_id, depth, path, content, status)
+		SELECT next.id, $1, $2, NULLIF($3, 0), $4,
+			COALESCE((SELECT path FROM comments WHERE id = $3), '') || lpad(next.id::text, 12, '0') || '/', $5, $6
+		FROM next
+		RETURNING id
+	`
+	getCommentQuery           = `SELECT ` + commentColumns + ` FROM comments WHERE id = $1`
+	updateCommentContentQuery = `UPDATE comments SET content = $2, updated_at = NOW() WHERE id = $1`
+	updateCommentStatusQuery  = `UPDATE comments SET status = $2, updated_at = NOW() WHERE id = $1`
+	listBlogCommentsQuery     = `SELECT ` + commentColumns + ` FROM comments
+		WHERE blog_id = $1 AND status = $2
+		ORDER BY path
+		OFFSET $3 LIMIT $4`
+	listCommentsByStatusQuery = `SELECT ` + commentColumns + ` FROM comments
+		WHERE status = $1
+		ORDER BY created_at, id
+		OFFSET $2 LIMIT $3`
+)
+
+var commentLogger = utils.Logger()
+
+type CommentRepo struct {
+	conf   *config.Config
+	client *pgxpool.Pool
+}
+
+func NewCommentRepo(conf *config.Config, client *pgxpool.Pool) domain.CommentRepo {
+	return &CommentRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *CommentRepo) Create(ctx context.Context, comment *domain.Comment) (int64, error) {
+	var commentID int64
+	err := conn(ctx, r.client).QueryRow(ctx, createCommentQuery,
+		comment.BlogID, comment.UserID, comment.ParentID, comment.Depth, comment.Content, string(comment.Status)).Scan(&commentID)
+	if err != nil {
+		commentLogger.WithError(err).Errorf("failed to create comment. blog id: %d", comment.BlogID)
+		return -1, err
+	}
+	return commentID, nil
+}
+
+func (r *CommentRepo) Get(ctx context.Context, commentID int64) (*domain.Comment, error) {
+	comment, err := scanComment(conn(ctx, r.client).QueryRow(ctx, getCommentQuery, commentID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.NewNotFoundError("comment", commentID)
+	}
+	if err != nil {
+		commentLogger.WithError(err).Errorf("failed to get comment. comment id: %d", commentID)
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (r *CommentRepo) UpdateContent(ctx context.Context, commentID int64, content string) error {
+	return r.update(ctx, updateCommentContentQuery, commentID, content)
+}
+
+func (r *CommentRepo) UpdateStatus(ctx context.Context, commentID int64, status domain.CommentStatus) error {
+	return r.update(ctx, updateCommentStatusQuery, commentID, string(status))
+}
+
+func (r *CommentRepo) update(ctx context.Context, query string, commentID int64, value string) error {
+	tag, err := conn(ctx, r.client).Exec(ctx, query, commentID, value)
+	if err != nil {
+		commentLogger.WithError(err).Errorf("failed to update comment. comment id: %d", commentID)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewNotFoundError("comment", commentID)
+	}
+	return nil
+}
+
+func (r *CommentRepo) ListByBlog(ctx context.Context, blogID int64, status domain.CommentStatus, offset int, limit int) ([]*domain.Comment, error) {
+	return r.list(ctx, listBlogCommentsQuery, blogID, string(status), offset, limit)
+}
+
+func (r *CommentRepo) ListByStatus(ctx context.Context, status domain.CommentStatus, offset int, limit int) ([]*domain.Comment, error) {
+	return r.list(ctx, listCommentsByStatusQuery, string(status), offset, limit)
+}
+
+func (r *CommentRepo) list(ctx context.Context, query string, args ...any) ([]*domain.Comment, error) {
+	rows, err := conn(ctx, r.client).Query(ctx, query, args...)
+	if err != nil {
+		commentLogger.WithError(err).Error("failed to query comments")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*domain.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			commentLogger.WithError(err).Error("failed to query comments")
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+func scanComment(row pgx.Row) (*domain.Comment, error) {
+	var comment domain.Comment
+	var status string
+	err := row.Scan(&comment.ID, &comment.BlogID, &comment.UserID, &comment.ParentID, &comment.Depth,
+		&comment.Content, &status, &comment.CreatedAt, &comment.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	comment.Status = domain.CommentStatus(status)
+	return &comment, nil
+}
@@ -44,86 +44,178 @@ const (
 	  PRIMARY KEY (user_id, role_id)
 	);`
 
-	rolesData = `INSERT INTO roles (name, description, permissions) VALUES
-	('admin', 'Administrator', ARRAY['create_user', 'read_user', 'update_user', 'delete_user', 'create_blog', 'read_blog', 'update_blog', 'delete_blog']),
-	('editor', 'Editor', ARRAY['create_blog', 'read_blog', 'update_blog', 'delete_blog']),
-	('viewer', 'Viewer', ARRAY['read_user', 'read_blog']) ON CONFLICT DO NOTHING;`
+	// schema changes made after the first release, every statement must be safe to run again
+	blogsCommentsEnabledColumn = `ALTER TABLE blogs ADD COLUMN IF NOT EXISTS comments_enabled BOOLEAN NOT NULL DEFAULT TRUE;`
+
+	commentsTable = `CREATE TABLE IF NOT EXISTS comments (
+	  id SERIAL PRIMARY KEY,
+	  blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+	  user_id INTEGER NOT NULL REFERENCES users(id),
+	  parent_id INTEGER REFERENCES comments(id),
+	  depth INTEGER NOT NULL DEFAULT 0,
+	  path TEXT NOT NULL,
+	  content TEXT NOT NULL,
+	  status TEXT NOT NULL,
+	  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	  updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);`
+
+	commentsIndexes = `CREATE INDEX IF NOT EXISTS comments_blog_idx ON comments (blog_id, status, path);
+	CREATE INDEX IF NOT EXISTS comments_status_idx ON comments (status, created_at);`
+
+	reactionsTable = `CREATE TABLE IF NOT EXISTS reactions (
+	  blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+	  user_id INTEGER NOT NULL REFERENCES users(id),
+	  type TEXT NOT NULL,
+	  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	  PRIMARY KEY (blog_id, user_id, type)
+	);
+	CREATE INDEX IF NOT EXISTS reactions_blog_idx ON reactions (blog_id, created_at);`
+
+	// maintained by the ReactionRepo along with the reactions
+	reactionCountsTable = `CREATE TABLE IF NOT EXISTS reaction_counts (
+	  blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+	  type TEXT NOT NULL,
+	  count BIGINT NOT NULL DEFAULT 0,
+	  PRIMARY KEY (blog_id, type)
+	);`
+
+	followsTable = `CREATE TABLE IF NOT EXISTS follows (
+	  follower_id INTEGER NOT NULL REFERENCES users(id),
+	  followee_id INTEGER NOT NULL REFERENCES users(id),
+	  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	  PRIMARY KEY (follower_id, followee_id),
+	  CHECK (follower_id <> followee_id)
+	);
+	CREATE INDEX IF NOT EXISTS follows_follower_idx ON follows (follower_id, created_at);
+	CREATE INDEX IF NOT EXISTS follows_followee_idx ON follows (followee_id, created_at);`
+
+	// the feed reads the newest blogs of every followed author from this index
+	blogsUserIndex = `CREATE INDEX IF NOT EXISTS blogs_user_created_idx ON blogs (user_id, created_at DESC, id DESC);`
+
+	// the blogs from before the visibility were readable by the members only
+	blogsVisibilityColumn = `ALTER TABLE blogs ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'members-only'
+	  CHECK (visibility IN ('public', 'unlisted', 'members-only', 'private'));`
+
+	// the blogs from before the content format were written as plain text
+	blogsContentFormatColumn = `ALTER TABLE blogs ADD COLUMN IF NOT EXISTS content_format TEXT NOT NULL DEFAULT 'plaintext'
+	  CHECK (content_format IN ('markdown', 'html', 'plaintext'));`
+
+	// blogs.slug is the current slug, blog_slugs has every slug a blog has had so that the links with an old slug
+	// keep working. The existing blogs get their slugs from the BlogManager on start.
+	blogSlugsTable = `ALTER TABLE blogs ADD COLUMN IF NOT EXISTS slug TEXT;
+	CREATE TABLE IF NOT EXISTS blog_slugs (
+	  slug TEXT PRIMARY KEY,
+	  blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+	  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS blog_slugs_blog_idx ON blog_slugs (blog_id);`
+
+	// the bytes of the media are in the BlobStore, a media without a blog is an orphan once it is old enough
+	mediaTable = `CREATE TABLE IF NOT EXISTS media (
+	  id SERIAL PRIMARY KEY,
+	  user_id INTEGER NOT NULL REFERENCES users(id),
+	  blog_id INTEGER REFERENCES blogs(id) ON DELETE SET NULL,
+	  blob_key TEXT NOT NULL UNIQUE,
+	  content_type TEXT NOT NULL,
+	  size BIGINT NOT NULL,
+	  width INTEGER NOT NULL DEFAULT 0,
+	  height INTEGER NOT NULL DEFAULT 0,
+	  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS media_blog_idx ON media (blog_id);
+	CREATE INDEX IF NOT EXISTS media_orphans_idx ON media (created_at) WHERE blog_id IS NULL;`
+
+	// the blogs from before the drafts were published
+	blogsStatusColumn = `ALTER TABLE blogs ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'published'
+	  CHECK (status IN ('draft', 'published'));`
+
+	// the responses of the requests made with an Idempotency-Key, status is 0 while the first request runs
+	idempotentRequestsTable = `CREATE TABLE IF NOT EXISTS idempotent_requests (
+	  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	  idempotency_key TEXT NOT NULL,
+	  fingerprint TEXT NOT NULL,
+	  status INTEGER NOT NULL DEFAULT 0,
+	  content_type TEXT NOT NULL DEFAULT '',
+	  body BYTEA,
+	  created_at TIMESTAMP NOT NULL,
+	  expires_at TIMESTAMP NOT NULL,
+	  PRIMARY KEY (user_id, idempotency_key)
+	);
+	CREATE INDEX IF NOT EXISTS idempotent_requests_expires_idx ON idempotent_requests (expires_at);`
+
+	// the disabled users, which can not log in
+	usersDisabledColumn = `ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;`
+
+	// the version of the tokens of the users, which revokes the older tokens when it is bumped
+	usersTokenVersionColumn = `ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INTEGER NOT NULL DEFAULT 0;`
+
+	// the built-in roles (utils.BuiltInRoles) are kept in sync on every start,
+	// so that new permissions reach the existing databases as well
+	upsertRoleQuery = `INSERT INTO roles (name, description, permissions) VALUES ($1, $2, $3)
+	ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description, permissions = EXCLUDED.permissions;`
 )
 
 var (
-	tables = []string{
-		usersTable,
-		blogsTable,
-		rolesTable,
-		userRolesTable,
+	// name -> schema statement, in execution order
+	tables = []struct {
+		name  string
+		query string
+	}{
+		{"users", usersTable},
+		{"blogs", blogsTable},
+		{"roles", rolesTable},
+		{"user_roles", userRolesTable},
+		{"blogs.comments_enabled", blogsCommentsEnabledColumn},
+		{"comments", commentsTable},
+		{"comments indexes", commentsIndexes},
+		{"reactions", reactionsTable},
+		{"reaction_counts", reactionCountsTable},
+		{"follows", followsTable},
+		{"blogs index", blogsUserIndex},
+		{"blogs.visibility", blogsVisibilityColumn},
+		{"blogs.content_format", blogsContentFormatColumn},
+		{"blog_slugs", blogSlugsTable},
+		{"media", mediaTable},
+		{"blogs.status", blogsStatusColumn},
+		{"idempotent_requests", idempotentRequestsTable},
+		{"users.disabled", usersDisabledColumn},
+		{"users.token_version", usersTokenVersionColumn},
 	}
 )
 
-var dbLogger = *utils.Logger()
+var dbLogger = utils.Logger()
 
 // DatabaseRepo functionalities of this repo is very specific to the initialization of the database tables
-// creating roles and an admin user.
+// and the roles. The admin user is created by the DatabaseManager.
 type DatabaseRepo struct {
-	conf     *config.Config
-	client   *pgxpool.Pool
-	userRepo domain.UserRepo
+	conf   *config.Config
+	client *pgxpool.Pool
 }
 
-func NewDatabaseRepo(conf *config.Config, client *pgxpool.Pool, userRepo domain.UserRepo) domain.DatabaseRepo {
+func NewDatabaseRepo(conf *config.Config, client *pgxpool.Pool) domain.DatabaseRepo {
 	return &DatabaseRepo{
-		conf:     conf,
-		client:   client,
-		userRepo: userRepo,
+		conf:   conf,
+		client: client,
 	}
 }
 
 func (r *DatabaseRepo) Initialize(ctx context.Context) error {
 	// check and initialize the database tables
-	for _, query := range tables {
-		dbLogger.Infof("attempting table creation if necessary, query: %s", query)
-		_, err := r.client.Exec(ctx, query)
+	for _, table := range tables {
+		dbLogger.Infof("attempting schema update if necessary: %s", table.name)
+		_, err := conn(ctx, r.client).Exec(ctx, table.query)
 		if err != nil {
-			dbLogger.WithError(err).Errorf("failed to execute query: %s", query)
+			dbLogger.WithError(err).Errorf("failed to update schema: %s", table.name)
 			return err
 		}
 	}
 
 	// if necessary create roles with permissions
-	_, err := r.client.Exec(ctx, rolesData)
-	if err != nil {
-		dbLogger.WithError(err).Error("failed to create user")
-		return err
-	}
-
-	// get the admin role ID
-	adminRole, err := r.userRepo.GetRoleByName(ctx, utils.AdminRole)
-	if err != nil {
-		dbLogger.WithError(err).Error("failed to get admin role")
-		return err
-	}
-
-	// check if we have already created the admin user, happens during restart
-	user, err := r.userRepo.GetUserByUsername(ctx, r.conf.DefaultUser.Username)
-	if err != nil {
-		dbLogger.WithError(err).Error("failed to check if the default user exists or not")
-		return err
-	}
-	// if the default user does not exists then only attempt creating
-	if user == nil {
-		adminUser := domain.User{
-			Username: r.conf.DefaultUser.Username,
-			Password: r.conf.DefaultUser.Password,
-		}
-		createdAdminUser, err := r.userRepo.Create(ctx, &adminUser)
-		if err != nil {
-			dbLogger.WithError(err).Error("failed to create admin user")
-			return err
-		}
-
-		// now assign the admin role id to the admin user
-		err = r.userRepo.AssignRoles(ctx, createdAdminUser.ID, adminRole.ID)
+	for _, role := range utils.BuiltInRoles {
+		_, err := conn(ctx, r.client).Exec(ctx, upsertRoleQuery, role.Name, role.Description, role.Permissions)
 		if err != nil {
-			dbLogger.WithError(err).Error("failed to assign admin role to the admin user")
+			dbLogger.WithError(err).Errorf("failed to create role: %s", role.Name)
 			return err
 		}
 	}
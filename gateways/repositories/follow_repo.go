@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	followQuery    = `INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	unfollowQuery  = `DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2`
+	followersQuery = `SELECT follower_id, followee_id, created_at FROM follows WHERE followee_id = $1
+		ORDER BY created_at DESC, follower_id DESC
+		OFFSET $2 LIMIT $3`
+	followingQuery = `SELECT follower_id, followee_id, created_at FROM follows WHERE follower_id = $1
+		ORDER BY created_at DESC, followee_id DESC
+		OFFSET $2 LIMIT $3`
+	followCountsQuery = `SELECT
+		(SELECT COUNT(*) FROM follows WHERE followee_id = $1),
+		(SELECT COUNT(*) FROM follows WHERE follower_id = $1)`
+)
+
+var followLogger = utils.Logger()
+
+type FollowRepo struct {
+	conf   *config.Config
+	client *pgxpool.Pool
+}
+
+func NewFollowRepo(conf *config.Config, client *pgxpool.Pool) domain.FollowRepo {
+	return &FollowRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *FollowRepo) Follow(ctx context.Context, follow *domain.Follow) (bool, error) {
+	tag, err := conn(ctx, r.client).Exec(ctx, followQuery, follow.FollowerID, follow.FolloweeID)
+	if err != nil {
+		followLogger.WithError(err).Errorf("failed to follow. follower id: %d, followee id: %d", follow.FollowerID, follow.FolloweeID)
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *FollowRepo) Unfollow(ctx context.Context, follow *domain.Follow) (bool, error) {
+	tag, err := conn(ctx, r.client).Exec(ctx, unfollowQuery, follow.FollowerID, follow.FolloweeID)
+	if err != nil {
+		followLogger.WithError(err).Errorf("failed to unfollow. follower id: %d, followee id: %d", follow.FollowerID, follow.FolloweeID)
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *FollowRepo) Followers(ctx context.Context, userID int64, offset int, limit int) ([]*domain.Follow, error) {
+	return r.list(ctx, followersQuery, userID, offset, limit)
+}
+
+func (r *FollowRepo) Following(ctx context.Context, userID int64, offset int, limit int) ([]*domain.Follow, error) {
+	return r.list(ctx, followingQuery, userID, offset, limit)
+}
+
+func (r *FollowRepo) list(ctx context.Context, query string, userID int64, offset int, limit int) ([]*domain.Follow, error) {
+	rows, err := conn(ctx, r.client).Query(ctx, query, userID, offset, limit)
+	if err != nil {
+		followLogger.WithError(err).Errorf("failed to query follows. user id: %d", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var follows []*domain.Follow
+	for rows.Next() {
+		var follow domain.Follow
+		if err := rows.Scan(&follow.FollowerID, &follow.FolloweeID, &follow.CreatedAt); err != nil {
+			followLogger.WithError(err).Errorf("failed to query follows. user id: %d", userID)
+			return nil, err
+		}
+		follows = append(follows, &follow)
+	}
+	return follows, rows.Err()
+}
+
+func (r *FollowRepo) Counts(ctx context.Context, userID int64) (followers int64, following int64, err error) {
+	err = conn(ctx, r.client).QueryRow(ctx, followCountsQuery, userID).Scan(&followers, &following)
+	if err != nil {
+		followLogger.WithError(err).Errorf("failed to count follows. user id: %d", userID)
+	}
+	return followers, following, err
+}
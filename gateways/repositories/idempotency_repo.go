@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	idempotentRequestColumns = `user_id, idempotency_key, fingerprint, status, content_type, body, created_at, expires_at`
+	// an expired request is replaced, so is the same request when it has been running since before the end of its
+	// lease ($6), an unexpired one is left as it is and nothing is affected
+	reserveIdempotentRequestQuery = `INSERT INTO idempotent_requests (user_id, idempotency_key, fingerprint, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, status = 0,
+			content_type = '', body = NULL, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		WHERE idempotent_requests.expires_at <= EXCLUDED.created_at OR (idempotent_requests.status = 0
+			AND idempotent_requests.fingerprint = EXCLUDED.fingerprint AND idempotent_requests.created_at < $6)`
+	getIdempotentRequestQuery = `SELECT ` + idempotentRequestColumns + ` FROM idempotent_requests
+		WHERE user_id = $1 AND idempotency_key = $2 AND expires_at > $3`
+	completeIdempotentRequestQuery = `UPDATE idempotent_requests SET status = $1, content_type = $2, body = $3
+		WHERE user_id = $4 AND idempotency_key = $5`
+	releaseIdempotentRequestQuery       = `DELETE FROM idempotent_requests WHERE user_id = $1 AND idempotency_key = $2`
+	deleteExpiredIdempotentRequestQuery = `DELETE FROM idempotent_requests WHERE expires_at < $1`
+)
+
+var idempotencyLogger = utils.Logger()
+
+type IdempotencyRepo struct {
+	conf   *config.Config
+	client *pgxpool.Pool
+}
+
+func NewIdempotencyRepo(conf *config.Config, client *pgxpool.Pool) domain.IdempotencyRepo {
+	return &IdempotencyRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *IdempotencyRepo) Reserve(ctx context.Context, request *domain.IdempotentRequest, lease time.Duration) (*domain.IdempotentRequest, error) {
+	// the request found by a failed insert can be released before it is read, the insert is tried again then
+	for attempt := 0; attempt < 3; attempt++ {
+		createdAt := time.Now().UTC()
+		tag, err := conn(ctx, r.client).Exec(ctx, reserveIdempotentRequestQuery,
+			request.UserID, request.Key, request.Fingerprint, createdAt, request.ExpiresAt.UTC(), createdAt.Add(-lease))
+		if err != nil {
+			idempotencyLogger.WithError(err).Errorf("failed to reserve the idempotency key. user id: %d", request.UserID)
+			return nil, err
+		}
+		if tag.RowsAffected() > 0 {
+			return nil, nil
+		}
+
+		existing, err := scanIdempotentRequest(conn(ctx, r.client).QueryRow(ctx, getIdempotentRequestQuery, request.UserID, request.Key, createdAt))
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return existing, err
+		}
+	}
+	return nil, domain.NewConflictError("idempotent request", "the idempotency key keeps changing hands")
+}
+
+func (r *IdempotencyRepo) Complete(ctx context.Context, request *domain.IdempotentRequest) error {
+	tag, err := conn(ctx, r.client).Exec(ctx, completeIdempotentRequestQuery,
+		request.Status, request.ContentType, request.Body, request.UserID, request.Key)
+	if err != nil {
+		idempotencyLogger.WithError(err).Errorf("failed to store the response of the idempotent request. user id: %d", request.UserID)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewNotFoundError("idempotent request", request.Key)
+	}
+	return nil
+}
+
+func (r *IdempotencyRepo) Release(ctx context.Context, userID int64, key string) error {
+	_, err := conn(ctx, r.client).Exec(ctx, releaseIdempotentRequestQuery, userID, key)
+	if err != nil {
+		idempotencyLogger.WithError(err).Errorf("failed to release the idempotency key. user id: %d", userID)
+	}
+	return err
+}
+
+func (r *IdempotencyRepo) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	tag, err := conn(ctx, r.client).Exec(ctx, deleteExpiredIdempotentRequestQuery, before.UTC())
+	if err != nil {
+		idempotencyLogger.WithError(err).Error("failed to delete the expired idempotent requests")
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func scanIdempotentRequest(row pgx.Row) (*domain.IdempotentRequest, error) {
+	var request domain.IdempotentRequest
+	err := row.Scan(&request.UserID, &request.Key, &request.Fingerprint, &request.Status, &request.ContentType,
+		&request.Body, &request.CreatedAt, &request.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
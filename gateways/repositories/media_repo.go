@@ -0,0 +1,123 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	mediaColumns     = `id, user_id, COALESCE(blog_id, 0), blob_key, content_type, size, width, height, created_at`
+	createMediaQuery = `INSERT INTO media (user_id, blog_id, blob_key, content_type, size, width, height)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7) RETURNING id`
+	getMediaQuery        = `SELECT ` + mediaColumns + ` FROM media WHERE id = $1`
+	attachMediaQuery     = `UPDATE media SET blog_id = $2 WHERE id = $1`
+	listMediaByBlogQuery = `SELECT ` + mediaColumns + ` FROM media WHERE blog_id = $1 ORDER BY id`
+	listOrphanMediaQuery = `SELECT ` + mediaColumns + ` FROM media WHERE blog_id IS NULL AND created_at < $1::timestamp
+		ORDER BY created_at, id
+		LIMIT $2`
+	deleteOrphanMediaQuery = `DELETE FROM media WHERE id = $1 AND blog_id IS NULL`
+)
+
+var mediaLogger = utils.Logger()
+
+type MediaRepo struct {
+	conf   *config.Config
+	client *pgxpool.Pool
+}
+
+func NewMediaRepo(conf *config.Config, client *pgxpool.Pool) domain.MediaRepo {
+	return &MediaRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *MediaRepo) Create(ctx context.Context, media *domain.Media) (int64, error) {
+	var mediaID int64
+	err := conn(ctx, r.client).QueryRow(ctx, createMediaQuery, media.UserID, media.BlogID, media.Key, media.ContentType,
+		media.Size, media.Width, media.Height).Scan(&mediaID)
+	if err != nil {
+		mediaLogger.WithError(err).Errorf("failed to create media. user id: %d", media.UserID)
+		return -1, err
+	}
+	return mediaID, nil
+}
+
+func (r *MediaRepo) Get(ctx context.Context, mediaID int64) (*domain.Media, error) {
+	media, err := scanMedia(conn(ctx, r.client).QueryRow(ctx, getMediaQuery, mediaID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.NewNotFoundError("media", mediaID)
+	}
+	if err != nil {
+		mediaLogger.WithError(err).Errorf("failed to get media. media id: %d", mediaID)
+		return nil, err
+	}
+	return media, nil
+}
+
+func (r *MediaRepo) Attach(ctx context.Context, mediaID int64, blogID int64) error {
+	tag, err := conn(ctx, r.client).Exec(ctx, attachMediaQuery, mediaID, blogID)
+	if err != nil {
+		mediaLogger.WithError(err).Errorf("failed to attach media. media id: %d, blog id: %d", mediaID, blogID)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewNotFoundError("media", mediaID)
+	}
+	return nil
+}
+
+func (r *MediaRepo) ListByBlog(ctx context.Context, blogID int64) ([]*domain.Media, error) {
+	return r.list(ctx, listMediaByBlogQuery, blogID)
+}
+
+func (r *MediaRepo) Orphans(ctx context.Context, before time.Time, limit int) ([]*domain.Media, error) {
+	return r.list(ctx, listOrphanMediaQuery, before.UTC(), limit)
+}
+
+func (r *MediaRepo) DeleteOrphan(ctx context.Context, mediaID int64) (bool, error) {
+	tag, err := conn(ctx, r.client).Exec(ctx, deleteOrphanMediaQuery, mediaID)
+	if err != nil {
+		mediaLogger.WithError(err).Errorf("failed to delete media. media id: %d", mediaID)
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *MediaRepo) list(ctx context.Context, query string, args ...any) ([]*domain.Media, error) {
+	rows, err := conn(ctx, r.client).Query(ctx, query, args...)
+	if err != nil {
+		mediaLogger.WithError(err).Error("failed to query media")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var found []*domain.Media
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			mediaLogger.WithError(err).Error("failed to query media")
+			return nil, err
+		}
+		found = append(found, media)
+	}
+	return found, rows.Err()
+}
+
+func scanMedia(row pgx.Row) (*domain.Media, error) {
+	var media domain.Media
+	err := row.Scan(&media.ID, &media.UserID, &media.BlogID, &media.Key, &media.ContentType, &media.Size, &media.Width, &media.Height,
+		&media.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
@@ -0,0 +1,16 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/jackc/pgconn"
+)
+
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const uniqueViolationCode = "23505"
+
+// isUniqueViolation reports whether Postgres rejected the statement because of a unique constraint
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode
+}
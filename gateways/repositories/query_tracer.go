@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer creates a span for every query executed through pgx. pgx v4 does not have a tracing hook,
+// but it reports each finished query to its logger along with the time it took, so we hook in there
+// and create the span after the fact with the correct start and end timestamps.
+type QueryTracer struct{}
+
+func NewQueryTracer() pgx.Logger {
+	return &QueryTracer{}
+}
+
+func (t *QueryTracer) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	elapsed, ok := data["time"].(time.Duration)
+	if !ok {
+		// not a query, e.g. connection life cycle messages
+		return
+	}
+	end := time.Now()
+
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(end.Add(-elapsed)),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL),
+	}
+	if sql, ok := data["sql"].(string); ok {
+		options = append(options, trace.WithAttributes(semconv.DBStatement(sql)))
+	}
+	_, span := utils.Tracer().Start(ctx, "pgx."+msg, options...)
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if level <= pgx.LogLevelError {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s failed", msg))
+	}
+	span.End(trace.WithTimestamp(end))
+}
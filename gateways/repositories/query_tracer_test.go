@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestQueryTracer(t *testing.T) {
+	exporter := utils.NewInMemoryExporter()
+	otel.SetTracerProvider(utils.NewTracerProvider(config.TracingConfig{SampleRatio: 1}, exporter, true))
+	queryTracer := NewQueryTracer()
+
+	ctx, parent := utils.Tracer().Start(context.Background(), "BlogManager.Get")
+	queryTracer.Log(ctx, pgx.LogLevelInfo, "Query", map[string]interface{}{"sql": "SELECT 1", "time": 20 * time.Millisecond})
+	queryTracer.Log(ctx, pgx.LogLevelError, "Exec", map[string]interface{}{"sql": "DELETE", "time": time.Millisecond, "err": errors.New("boom")})
+	// not a query, no span
+	queryTracer.Log(ctx, pgx.LogLevelInfo, "closed connection", map[string]interface{}{})
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected the spans of the two queries and their parent, got %+v", spans)
+	}
+	query, exec := spans[0], spans[1]
+	if query.Name != "pgx.Query" || query.SpanKind != trace.SpanKindClient || query.Parent.SpanID() != parent.SpanContext().SpanID() ||
+		query.EndTime.Sub(query.StartTime) != 20*time.Millisecond || query.Status.Code != codes.Unset {
+		t.Errorf("expected the span of the query under its parent, got %+v", query)
+	}
+	var statement string
+	for _, attribute := range query.Attributes {
+		if attribute.Key == "db.statement" {
+			statement = attribute.Value.AsString()
+		}
+	}
+	if statement != "SELECT 1" {
+		t.Errorf("expected the SQL on the span, got %q", statement)
+	}
+	if exec.Name != "pgx.Exec" || exec.Status.Code != codes.Error || exec.Status.Description != "boom" {
+		t.Errorf("expected the failed query to be marked, got %+v", exec)
+	}
+}
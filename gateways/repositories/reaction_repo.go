@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+/*
+	A reaction and its counter are changed by a single statement, so the counters stay right without a
+	transaction and under any number of concurrent reactions. A duplicate reaction does not touch the counter.
+*/
+
+const (
+	addReactionQuery = `
+		WITH added AS (
+			INSERT INTO reactions (blog_id, user_id, type) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+			RETURNING blog_id, type
+		)
+		INSERT INTO reaction_counts (blog_id, type, count) SELECT blog_id, type, 1 FROM added
+		ON CONFLICT (blog_id, type) DO UPDATE SET count = reaction_counts.count + 1
+	`
+	removeReactionQuery = `
+		WITH removed AS (
+			DELETE FROM reactions WHERE blog_id = $1 AND user_id = $2 AND type = $3
+			RETURNING blog_id, type
+		)
+		UPDATE reaction_counts c SET count = c.count - 1 FROM removed
+		WHERE c.blog_id = removed.blog_id AND c.type = removed.type
+	`
+	reactionCountsQuery = `SELECT blog_id, type, count FROM reaction_counts WHERE blog_id = ANY($1) AND count > 0`
+	listReactionsQuery  = `
+		SELECT blog_id, user_id, type, created_at FROM reactions
+		WHERE blog_id = $1 AND ($2 = '' OR type = $2)
+		ORDER BY created_at DESC, user_id DESC, type
+		OFFSET $3 LIMIT $4
+	`
+)
+
+var reactionLogger = utils.Logger()
+
+type ReactionRepo struct {
+	conf   *config.Config
+	client *pgxpool.Pool
+}
+
+func NewReactionRepo(conf *config.Config, client *pgxpool.Pool) domain.ReactionRepo {
+	return &ReactionRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *ReactionRepo) Add(ctx context.Context, reaction *domain.Reaction) (bool, error) {
+	tag, err := conn(ctx, r.client).Exec(ctx, addReactionQuery, reaction.BlogID, reaction.UserID, reaction.Type)
+	if err != nil {
+		reactionLogger.WithError(err).Errorf("failed to add reaction. blog id: %d", reaction.BlogID)
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *ReactionRepo) Remove(ctx context.Context, reaction *domain.Reaction) (bool, error) {
+	tag, err := conn(ctx, r.client).Exec(ctx, removeReactionQuery, reaction.BlogID, reaction.UserID, reaction.Type)
+	if err != nil {
+		reactionLogger.WithError(err).Errorf("failed to remove reaction. blog id: %d", reaction.BlogID)
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *ReactionRepo) Counts(ctx context.Context, blogIDs ...int64) (map[int64]map[string]int64, error) {
+	counts := make(map[int64]map[string]int64, len(blogIDs))
+	if len(blogIDs) == 0 {
+		return counts, nil
+	}
+
+	rows, err := conn(ctx, r.client).Query(ctx, reactionCountsQuery, blogIDs)
+	if err != nil {
+		reactionLogger.WithError(err).Error("failed to query reaction counts")
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var blogID, count int64
+		var reactionType string
+		if err := rows.Scan(&blogID, &reactionType, &count); err != nil {
+			reactionLogger.WithError(err).Error("failed to query reaction counts")
+			return nil, err
+		}
+		if counts[blogID] == nil {
+			counts[blogID] = make(map[string]int64)
+		}
+		counts[blogID][reactionType] = count
+	}
+	return counts, rows.Err()
+}
+
+func (r *ReactionRepo) List(ctx context.Context, blogID int64, reactionType string, offset int, limit int) ([]*domain.Reaction, error) {
+	rows, err := conn(ctx, r.client).Query(ctx, listReactionsQuery, blogID, reactionType, offset, limit)
+	if err != nil {
+		reactionLogger.WithError(err).Errorf("failed to query reactions. blog id: %d", blogID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []*domain.Reaction
+	for rows.Next() {
+		var reaction domain.Reaction
+		err := rows.Scan(&reaction.BlogID, &reaction.UserID, &reaction.Type, &reaction.CreatedAt)
+		if err != nil {
+			reactionLogger.WithError(err).Errorf("failed to query reactions. blog id: %d", blogID)
+			return nil, err
+		}
+		reactions = append(reactions, &reaction)
+	}
+	return reactions, rows.Err()
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/bipuldutta/blogzilla/domain"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// querier is what the repositories need from either the pool or a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+type txKey struct{}
+
+// conn returns the transaction carried by the context, or the pool when there is none
+func conn(ctx context.Context, client *pgxpool.Pool) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return client
+}
+
+type TxManager struct {
+	client *pgxpool.Pool
+}
+
+func NewTxManager(client *pgxpool.Pool) domain.TxManager {
+	return &TxManager{
+		client: client,
+	}
+}
+
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := m.client.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// a no-op once the transaction has been committed
+	defer tx.Rollback(ctx)
+
+	err = fn(context.WithValue(ctx, txKey{}, tx))
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -10,22 +10,31 @@ import (
 	"github.com/bipuldutta/blogzilla/domain"
 	"github.com/bipuldutta/blogzilla/utils"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
+	userColumns        = `id, username, password, first_name, last_name, disabled, token_version, created_at, updated_at`
 	createUserQuery    = `INSERT INTO users (username, password, first_name, last_name) VALUES ($1, $2, $3, $4) RETURNING id`
 	assignUserRoles    = `INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2)`
-	getUserByNameQuery = `SELECT id, username, password, first_name, last_name, created_at, updated_at FROM users WHERE username = $1`
+	revokeUserRole     = `DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2`
+	getUserByNameQuery = `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+	getUserByIDQuery   = `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	getUsersByIDsQuery = `SELECT ` + userColumns + ` FROM users WHERE id = ANY($1)`
+	listUsersQuery     = `SELECT ` + userColumns + ` FROM users ORDER BY id LIMIT $1 OFFSET $2`
+	setPasswordQuery   = `UPDATE users SET password = $2, updated_at = NOW() WHERE id = $1`
+	setDisabledQuery   = `UPDATE users SET disabled = $2, updated_at = NOW() WHERE id = $1`
+	revokeTokensQuery  = `UPDATE users SET token_version = token_version + 1, updated_at = NOW() WHERE id = $1`
 	getRoleByName      = `SELECT id, name, description, UNNEST(permissions) FROM roles WHERE name = $1`
+	getUserRolesQuery  = `SELECT r.name FROM roles r JOIN user_roles ur ON ur.role_id = r.id WHERE ur.user_id = $1 ORDER BY r.name`
 	permissionQuery    = `SELECT DISTINCT UNNEST(r.permissions)
 		FROM roles r
 		JOIN user_roles ur ON r.id = ur.role_id
 		WHERE ur.user_id = $1`
 )
 
-var userLogger = *utils.Logger()
+var userLogger = utils.Logger()
 
 type UserRepo struct {
 	conf        *config.Config
@@ -41,41 +50,20 @@ func NewUserRepo(conf *config.Config, client *pgxpool.Pool, sessionRepo domain.A
 	}
 }
 
+// Create only inserts the user with the hashed password, the use case takes care of the roles within the same transaction
 func (r *UserRepo) Create(ctx context.Context, newUser *domain.User) (*domain.User, error) {
-	// hash password
-	hashedPassword, err := r.hashPassword(newUser.Password)
-	if err != nil {
-		userLogger.WithError(err).Error("failed to hash password")
-		return nil, err
-	}
 	var userID int64
 	// create user and return its id
-	err = r.client.QueryRow(ctx, createUserQuery, newUser.Username, hashedPassword, newUser.FirstName, newUser.LastName).Scan(&userID)
+	err := conn(ctx, r.client).QueryRow(ctx, createUserQuery, newUser.Username, newUser.Password, newUser.FirstName, newUser.LastName).Scan(&userID)
+	if isUniqueViolation(err) {
+		return nil, domain.NewConflictError("user", fmt.Sprintf("username '%s' is already taken", newUser.Username))
+	}
 	if err != nil {
 		userLogger.WithError(err).Error("failed to create user")
 		return nil, err
 	}
 
-	// assign editor and viewer roles to this user
-	// at this point we are not going to deal with cases like what happens if this transaction fails
-	// but in production we should perhaps run these two with a transaction so that we can rollback.
-	// Also, we will do a batch query to get both roles in production
-	editorRole, err := r.GetRoleByName(ctx, utils.EditorRole)
-	if err != nil {
-		userLogger.WithError(err).Error("failed to get editor role")
-		return nil, err
-	}
-	viewerRole, err := r.GetRoleByName(ctx, utils.ViewerRole)
-	if err != nil {
-		userLogger.WithError(err).Error("failed to get viewer role")
-		return nil, err
-	}
-	err = r.AssignRoles(ctx, userID, editorRole.ID, viewerRole.ID)
-	if err != nil {
-		userLogger.WithError(err).Error("failed to assign roles to the user")
-		return nil, err
-	}
-	// since the create was successful, set it ID
+	// read it back to get the generated columns
 	createdUser, err := r.GetUserByUsername(ctx, newUser.Username)
 	if err != nil {
 		userLogger.WithError(err).Error("failed to get the user during creation")
@@ -86,9 +74,11 @@ func (r *UserRepo) Create(ctx context.Context, newUser *domain.User) (*domain.Us
 }
 
 func (r *UserRepo) AssignRoles(ctx context.Context, userID int64, roleIDs ...int64) error {
-	// create user and return its id
 	for _, roleID := range roleIDs {
-		_, err := r.client.Query(ctx, assignUserRoles, userID, roleID)
+		_, err := conn(ctx, r.client).Exec(ctx, assignUserRoles, userID, roleID)
+		if isUniqueViolation(err) {
+			return domain.NewConflictError("role", fmt.Sprintf("role %d is already assigned to user %d", roleID, userID))
+		}
 		if err != nil {
 			userLogger.WithError(err).Error("failed to assign roles to user")
 			return err
@@ -96,11 +86,43 @@ func (r *UserRepo) AssignRoles(ctx context.Context, userID int64, roleIDs ...int
 	}
 	return nil
 }
+
+func (r *UserRepo) RevokeRoles(ctx context.Context, userID int64, roleIDs ...int64) error {
+	for _, roleID := range roleIDs {
+		tag, err := conn(ctx, r.client).Exec(ctx, revokeUserRole, userID, roleID)
+		if err != nil {
+			userLogger.WithError(err).Error("failed to revoke roles of user")
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return domain.NewConflictError("role", fmt.Sprintf("role %d is not assigned to user %d", roleID, userID))
+		}
+	}
+	return nil
+}
+
+func (r *UserRepo) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	rows, err := conn(ctx, r.client).Query(ctx, getUserRolesQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var roleNames []string
+	for rows.Next() {
+		var roleName string
+		if err := rows.Scan(&roleName); err != nil {
+			return nil, err
+		}
+		roleNames = append(roleNames, roleName)
+	}
+	return roleNames, rows.Err()
+}
+
 func (r *UserRepo) GetRoleByName(ctx context.Context, roleName string) (*domain.Role, error) {
 	var id int64
 	var name, description string
 	var permissions []string
-	rows, err := r.client.Query(ctx, getRoleByName, roleName)
+	rows, err := conn(ctx, r.client).Query(ctx, getRoleByName, roleName)
 	if err != nil {
 		return nil, err
 	}
@@ -116,6 +138,10 @@ func (r *UserRepo) GetRoleByName(ctx context.Context, roleName string) (*domain.
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if len(permissions) == 0 {
+		// every role comes with at least one permission, so no rows means no role
+		return nil, domain.NewNotFoundError("role", roleName)
+	}
 	role := domain.Role{
 		ID:          id,
 		Name:        name,
@@ -126,12 +152,104 @@ func (r *UserRepo) GetRoleByName(ctx context.Context, roleName string) (*domain.
 }
 
 func (r *UserRepo) GetUserByUsername(ctx context.Context, uname string) (*domain.User, error) {
-	var userID int64
-	var username, password string
-	var firstName, lastName sql.NullString
-	var createdAt, updatedAt time.Time
+	return r.getUser(ctx, getUserByNameQuery, uname)
+}
 
-	rows, err := r.client.Query(ctx, getUserByNameQuery, uname)
+func (r *UserRepo) GetUserByID(ctx context.Context, userID int64) (*domain.User, error) {
+	user, err := r.getUser(ctx, getUserByIDQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.NewNotFoundError("user", userID)
+	}
+	return user, nil
+}
+
+func (r *UserRepo) GetUsersByIDs(ctx context.Context, userIDs ...int64) (map[int64]*domain.User, error) {
+	users := make(map[int64]*domain.User, len(userIDs))
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+
+	rows, err := conn(ctx, r.client).Query(ctx, getUsersByIDsQuery, userIDs)
+	if err != nil {
+		userLogger.WithError(err).Error("failed to query users")
+		return nil, fmt.Errorf("failed to query users")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			userLogger.WithError(err).Error("failed to read user data")
+			return nil, fmt.Errorf("failed to read user data")
+		}
+		users[user.ID] = user
+	}
+	return users, rows.Err()
+}
+
+func (r *UserRepo) ListUsers(ctx context.Context, offset int, limit int) ([]*domain.User, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+	rows, err := conn(ctx, r.client).Query(ctx, listUsersQuery, limit, offset)
+	if err != nil {
+		userLogger.WithError(err).Error("failed to list users")
+		return nil, fmt.Errorf("failed to list users")
+	}
+	defer rows.Close()
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			userLogger.WithError(err).Error("failed to read user data")
+			return nil, fmt.Errorf("failed to read user data")
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *UserRepo) SetPassword(ctx context.Context, userID int64, hashedPassword string) error {
+	tag, err := conn(ctx, r.client).Exec(ctx, setPasswordQuery, userID, hashedPassword)
+	if err != nil {
+		userLogger.WithError(err).Errorf("failed to set the password. user id: %d", userID)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewNotFoundError("user", userID)
+	}
+	return nil
+}
+
+func (r *UserRepo) SetDisabled(ctx context.Context, userID int64, disabled bool) error {
+	tag, err := conn(ctx, r.client).Exec(ctx, setDisabledQuery, userID, disabled)
+	if err != nil {
+		userLogger.WithError(err).Errorf("failed to disable the user. user id: %d", userID)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewNotFoundError("user", userID)
+	}
+	return nil
+}
+
+func (r *UserRepo) RevokeTokens(ctx context.Context, userID int64) error {
+	tag, err := conn(ctx, r.client).Exec(ctx, revokeTokensQuery, userID)
+	if err != nil {
+		userLogger.WithError(err).Errorf("failed to revoke the tokens. user id: %d", userID)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewNotFoundError("user", userID)
+	}
+	return nil
+}
+
+// getUser returns nil when the query finds no user
+func (r *UserRepo) getUser(ctx context.Context, query string, arg any) (*domain.User, error) {
+	rows, err := conn(ctx, r.client).Query(ctx, query, arg)
 	if err != nil {
 		userLogger.WithError(err).Error("failed to check username")
 		return nil, fmt.Errorf("failed to check username")
@@ -141,18 +259,34 @@ func (r *UserRepo) GetUserByUsername(ctx context.Context, uname string) (*domain
 		// user not found
 		return nil, nil
 	}
-	err = rows.Scan(&userID, &username, &password, &firstName, &lastName, &createdAt, &updatedAt)
+	user, err := scanUser(rows)
 	if err != nil {
 		userLogger.WithError(err).Error("failed to read user data")
 		return nil, fmt.Errorf("failed to read user data")
 	}
+	return user, nil
+}
+
+func scanUser(row pgx.Row) (*domain.User, error) {
+	var userID int64
+	var username, password string
+	var firstName, lastName sql.NullString
+	var disabled bool
+	var tokenVersion int
+	var createdAt, updatedAt time.Time
+	err := row.Scan(&userID, &username, &password, &firstName, &lastName, &disabled, &tokenVersion, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
 
 	user := &domain.User{
-		ID:        userID,
-		Username:  username,
-		Password:  password,
-		CreatedAt: createdAt,
-		UpdatedAt: updatedAt,
+		ID:           userID,
+		Username:     username,
+		Password:     password,
+		Disabled:     disabled,
+		TokenVersion: tokenVersion,
+		CreatedAt:    createdAt,
+		UpdatedAt:    updatedAt,
 	}
 	if firstName.Valid {
 		user.FirstName = firstName.String
@@ -170,32 +304,40 @@ func (r *UserRepo) Login(ctx context.Context, username string, password string)
 		return "", fmt.Errorf("failed to get user by name")
 	}
 	if user == nil {
-		return "", fmt.Errorf("user does not exists")
+		// do not tell the caller which of the two was wrong
+		return "", domain.NewUnauthorizedError("invalid username or password")
 	}
 
 	userID := user.ID
 	hashedPassword := user.Password
 
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	err = utils.ComparePassword(ctx, hashedPassword, password)
 	if err != nil {
-		return "", fmt.Errorf("invalid username or password")
+		return "", domain.NewUnauthorizedError("invalid username or password")
+	}
+	if user.Disabled {
+		return "", domain.NewForbiddenError("the user is disabled")
 	}
 
 	permissions, err := r.getUserPermissions(ctx, userID)
 	if err != nil {
 		return "", fmt.Errorf("failed to get user permissions")
 	}
-	token, err := r.sessionRepo.GetToken(ctx, userID, permissions)
+	token, err := r.sessionRepo.GetToken(ctx, userID, user.TokenVersion, permissions)
 	if err != nil {
 		return "", fmt.Errorf("failed to set the session information")
 	}
 	return token, nil
 }
 
+func (r *UserRepo) GetPermissions(ctx context.Context, userID int64) (map[string]any, error) {
+	return r.getUserPermissions(ctx, userID)
+}
+
 func (r *UserRepo) getUserPermissions(ctx context.Context, userID int64) (map[string]any, error) {
 	permissions := make(map[string]any)
 
-	rows, err := r.client.Query(ctx, permissionQuery, userID)
+	rows, err := conn(ctx, r.client).Query(ctx, permissionQuery, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -212,12 +354,3 @@ func (r *UserRepo) getUserPermissions(ctx context.Context, userID int64) (map[st
 	}
 	return permissions, nil
 }
-
-func (r *UserRepo) hashPassword(password string) (string, error) {
-	// hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", fmt.Errorf("error hashing password")
-	}
-	return string(hashedPassword), nil
-}
@@ -0,0 +1,334 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+const (
+	blogColumns     = `b.id, b.user_id, b.title, COALESCE(b.slug, ''), b.content, b.content_format, COALESCE(b.tags, ''), b.comments_enabled, b.visibility, b.status, b.created_at, b.updated_at`
+	createBlogQuery = `INSERT INTO blogs (user_id, title, content, content_format, tags, visibility, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	getBlogQuery       = `SELECT ` + blogColumns + ` FROM blogs b WHERE b.id = ?`
+	getBlogBySlugQuery = `SELECT ` + blogColumns + ` FROM blog_slugs s JOIN blogs b ON b.id = s.blog_id WHERE s.slug = ?`
+	updateBlogQuery    = `UPDATE blogs SET title = ?, content = ?, tags = ?, status = COALESCE(NULLIF(?, ''), status), visibility = COALESCE(NULLIF(?, ''), visibility), content_format = COALESCE(NULLIF(?, ''), content_format), updated_at = ? WHERE id = ?`
+	setSlugQuery       = `UPDATE blogs SET slug = ? WHERE id = ?`
+	// a slug of the blog itself is taken over again, a slug of another blog is left alone
+	addSlugQuery = `INSERT INTO blog_slugs (slug, blog_id, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (slug) DO UPDATE SET blog_id = excluded.blog_id WHERE blog_id = excluded.blog_id`
+	withoutSlugQuery = `SELECT ` + blogColumns + ` FROM blogs b WHERE b.slug IS NULL ORDER BY b.id LIMIT ?`
+	// the blogs the BlogAccess allows, the visibilities are passed as a JSON array
+	accessCondition = `((b.status = 'published' AND b.visibility IN (SELECT value FROM json_each(?))) OR b.user_id = ?)`
+	// the trigram index answers MATCH for plain search terms of at least 3 characters
+	matchBlogQuery = `SELECT ` + blogColumns + ` FROM blogs_fts f JOIN blogs b ON b.id = f.rowid
+		WHERE blogs_fts MATCH ? AND ` + accessCondition + `
+		ORDER BY b.created_at DESC, b.id DESC
+		LIMIT ? OFFSET ?`
+	// shorter terms and terms with LIKE wildcards are matched with LIKE on the same table
+	likeBlogQuery = `SELECT ` + blogColumns + ` FROM blogs_fts f JOIN blogs b ON b.id = f.rowid
+		WHERE f.document LIKE '%' || ? || '%' ESCAPE '\' AND ` + accessCondition + `
+		ORDER BY b.created_at DESC, b.id DESC
+		LIMIT ? OFFSET ?`
+	setCommentsEnabledQuery = `UPDATE blogs SET comments_enabled = ? WHERE id = ?`
+	// the triggers keep the index in sync, a rebuild repairs an index which is out of sync anyway, e.g. after a restore
+	reindexBlogsQuery = `DELETE FROM blogs_fts;
+	INSERT INTO blogs_fts (rowid, document) SELECT id, title || ' ' || content || ' ' || COALESCE(tags, '') FROM blogs;
+	INSERT INTO blogs_fts (blogs_fts) VALUES ('optimize');`
+	countBlogsQuery = `SELECT COUNT(*) FROM blogs`
+	// SQLite has no lateral joins, the followed authors are looked up through blogs_user_created_idx
+	feedQuery = `SELECT ` + blogColumns + ` FROM blogs b
+		WHERE b.user_id IN (SELECT followee_id FROM follows WHERE follower_id = ?) AND (b.created_at, b.id) < (?, ?)
+		AND ` + accessCondition + `
+		ORDER BY b.created_at DESC, b.id DESC
+		LIMIT ?`
+	// SQLite can not split the tags, the tag is only a substring here and the exact match is done in Go
+	latestBlogsQuery = `SELECT ` + blogColumns + ` FROM blogs b
+		WHERE (? = 0 OR b.user_id = ?) AND instr(lower(COALESCE(b.tags, '')), lower(?)) > 0
+		AND ` + accessCondition + `
+		ORDER BY b.created_at DESC, b.id DESC`
+)
+
+// the cursor of the first page of a feed, i.e. before every blog
+var feedStart = domain.FeedCursor{CreatedAt: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), BlogID: math.MaxInt64}
+
+var blogLogger = utils.Logger()
+
+type BlogRepo struct {
+	conf   *config.Config
+	client *sql.DB
+}
+
+func NewBlogRepo(conf *config.Config, client *sql.DB) domain.BlogRepo {
+	return &BlogRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *BlogRepo) Create(ctx context.Context, newBlog *domain.Blog) (int64, error) {
+	var blogID int64
+	createdAt := now()
+	err := conn(ctx, r.client).QueryRowContext(ctx, createBlogQuery, newBlog.UserID, newBlog.Title, newBlog.Content,
+		contentFormatOrDefault(newBlog.ContentFormat), newBlog.Tags, visibilityOrDefault(newBlog.Visibility), statusOrDefault(newBlog.Status), createdAt, createdAt).Scan(&blogID)
+	if err != nil {
+		blogLogger.WithError(err).Error("failed to create blog")
+		return -1, err
+	}
+	return blogID, nil
+}
+
+func (r *BlogRepo) Get(ctx context.Context, blogID int64) (*domain.Blog, error) {
+	blog, err := scanBlog(conn(ctx, r.client).QueryRowContext(ctx, getBlogQuery, blogID))
+	if err == sql.ErrNoRows {
+		return nil, domain.NewNotFoundError("blog", blogID)
+	}
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to get blog. blog id: %d", blogID)
+		return nil, err
+	}
+	return blog, nil
+}
+
+func (r *BlogRepo) GetBySlug(ctx context.Context, slug string) (*domain.Blog, error) {
+	blog, err := scanBlog(conn(ctx, r.client).QueryRowContext(ctx, getBlogBySlugQuery, slug))
+	if err == sql.ErrNoRows {
+		return nil, domain.NewNotFoundError("blog", slug)
+	}
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to get blog. slug: %s", slug)
+		return nil, err
+	}
+	return blog, nil
+}
+
+func (r *BlogRepo) Update(ctx context.Context, blog *domain.Blog) error {
+	result, err := conn(ctx, r.client).ExecContext(ctx, updateBlogQuery, blog.Title, blog.Content, blog.Tags, blog.Status, blog.Visibility, blog.ContentFormat, now(), blog.ID)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to update blog. blog id: %d", blog.ID)
+		return err
+	}
+	return requireRow(result, "blog", blog.ID)
+}
+
+func (r *BlogRepo) SetSlug(ctx context.Context, blogID int64, slug string) error {
+	result, err := conn(ctx, r.client).ExecContext(ctx, setSlugQuery, slug, blogID)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to set the slug. blog id: %d", blogID)
+		return err
+	}
+	if err := requireRow(result, "blog", blogID); err != nil {
+		return err
+	}
+	result, err = conn(ctx, r.client).ExecContext(ctx, addSlugQuery, slug, blogID, now())
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to set the slug. blog id: %d", blogID)
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.NewConflictError("blog", fmt.Sprintf("slug '%s' is already taken", slug))
+	}
+	return nil
+}
+
+func (r *BlogRepo) WithoutSlug(ctx context.Context, limit int) ([]*domain.Blog, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+	rows, err := conn(ctx, r.client).QueryContext(ctx, withoutSlugQuery, limit)
+	if err != nil {
+		blogLogger.WithError(err).Error("failed to query the blogs without a slug")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blogs []*domain.Blog
+	for rows.Next() {
+		blog, err := scanBlog(rows)
+		if err != nil {
+			blogLogger.WithError(err).Error("failed to query the blogs without a slug")
+			return nil, err
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, rows.Err()
+}
+
+// Search has the semantics of the Postgres ILIKE '%search%' over the title, content and tags
+func (r *BlogRepo) Search(ctx context.Context, access domain.BlogAccess, offset int, limit int, search string) ([]*domain.Blog, error) {
+	// SQLite treats a negative limit as "no limit", Postgres rejects it
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+
+	query, arg := likeBlogQuery, search
+	if utf8.RuneCountInString(search) >= 3 && !strings.ContainsAny(search, `%_\`) {
+		// a quoted FTS5 string is matched as a substring by the trigram tokenizer
+		query, arg = matchBlogQuery, `"`+strings.ReplaceAll(search, `"`, `""`)+`"`
+	}
+
+	visibilities, err := json.Marshal(access.Visibilities)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.client).QueryContext(ctx, query, arg, string(visibilities), access.UserID, limit, offset)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to query blogs. offset: %d, limit: %d", offset, limit)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blogs []*domain.Blog
+	for rows.Next() {
+		blog, err := scanBlog(rows)
+		if err != nil {
+			blogLogger.WithError(err).Errorf("failed to query blogs. offset: %d, limit: %d", offset, limit)
+			return nil, err
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, rows.Err()
+}
+
+func (r *BlogRepo) SetCommentsEnabled(ctx context.Context, blogID int64, enabled bool) error {
+	result, err := conn(ctx, r.client).ExecContext(ctx, setCommentsEnabledQuery, enabled, blogID)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to update blog. blog id: %d", blogID)
+		return err
+	}
+	return requireRow(result, "blog", blogID)
+}
+
+// Reindex rebuilds the FTS index of the search, it is meant to be called within a transaction
+func (r *BlogRepo) Reindex(ctx context.Context) (int, error) {
+	if _, err := conn(ctx, r.client).ExecContext(ctx, reindexBlogsQuery); err != nil {
+		blogLogger.WithError(err).Error("failed to rebuild the search index")
+		return 0, err
+	}
+	var count int
+	err := conn(ctx, r.client).QueryRowContext(ctx, countBlogsQuery).Scan(&count)
+	return count, err
+}
+
+func (r *BlogRepo) Feed(ctx context.Context, userID int64, access domain.BlogAccess, after *domain.FeedCursor, limit int) ([]*domain.Blog, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+	if after == nil {
+		after = &feedStart
+	}
+	visibilities, err := json.Marshal(access.Visibilities)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.client).QueryContext(ctx, feedQuery, userID, formatTime(after.CreatedAt), after.BlogID,
+		string(visibilities), access.UserID, limit)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to query the feed. user id: %d", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blogs []*domain.Blog
+	for rows.Next() {
+		blog, err := scanBlog(rows)
+		if err != nil {
+			blogLogger.WithError(err).Errorf("failed to query the feed. user id: %d", userID)
+			return nil, err
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, rows.Err()
+}
+
+func (r *BlogRepo) Latest(ctx context.Context, access domain.BlogAccess, filter domain.BlogFilter, limit int) ([]*domain.Blog, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+	visibilities, err := json.Marshal(access.Visibilities)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.client).QueryContext(ctx, latestBlogsQuery, filter.UserID, filter.UserID, strings.TrimSpace(filter.Tag),
+		string(visibilities), access.UserID)
+	if err != nil {
+		blogLogger.WithError(err).Errorf("failed to query the latest blogs. limit: %d", limit)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blogs []*domain.Blog
+	for len(blogs) < limit && rows.Next() {
+		blog, err := scanBlog(rows)
+		if err != nil {
+			blogLogger.WithError(err).Errorf("failed to query the latest blogs. limit: %d", limit)
+			return nil, err
+		}
+		if filter.Matches(blog) {
+			blogs = append(blogs, blog)
+		}
+	}
+	return blogs, rows.Err()
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanBlog(row scanner) (*domain.Blog, error) {
+	var blog domain.Blog
+	var contentFormat, visibility, status, createdAt, updatedAt string
+	err := row.Scan(&blog.ID, &blog.UserID, &blog.Title, &blog.Slug, &blog.Content, &contentFormat, &blog.Tags, &blog.CommentsEnabled, &visibility,
+		&status, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	blog.ContentFormat = domain.ContentFormat(contentFormat)
+	blog.Visibility = domain.Visibility(visibility)
+	blog.Status = domain.BlogStatus(status)
+	if blog.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if blog.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return nil, err
+	}
+	return &blog, nil
+}
+
+// visibilityOrDefault the blogs created without a visibility get the column default
+func visibilityOrDefault(visibility domain.Visibility) domain.Visibility {
+	if visibility == "" {
+		return domain.DefaultVisibility
+	}
+	return visibility
+}
+
+// contentFormatOrDefault the blogs created without a content format get the column default
+func contentFormatOrDefault(format domain.ContentFormat) domain.ContentFormat {
+	if format == "" {
+		return domain.DefaultContentFormat
+	}
+	return format
+}
+
+// statusOrDefault the blogs created without a status get the column default
+func statusOrDefault(status domain.BlogStatus) domain.BlogStatus {
+	if status == "" {
+		return domain.DefaultStatus
+	}
+	return status
+}
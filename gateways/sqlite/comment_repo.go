@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+const (
+	commentColumns     = `id, blog_id, user_id, COALESCE(parent_id, 0), depth, content, status, created_at, updated_at`
+	createCommentQuery = `INSERT INTO comments (blog_id, user_id, parent_id, depth, content, status, created_at, updated_at)
+		VALUES (?, ?, NULLIF(?, 0), ?, ?, ?, ?, ?) RETURNING id`
+	getCommentQuery           = `SELECT ` + commentColumns + ` FROM comments WHERE id = ?`
+	updateCommentContentQuery = `UPDATE comments SET content = ?, updated_at = ? WHERE id = ?`
+	updateCommentStatusQuery  = `UPDATE comments SET status = ?, updated_at = ? WHERE id = ?`
+	listBlogCommentsQuery     = `SELECT ` + commentColumns + ` FROM comments
+		WHERE blog_id = ? AND status = ?
+		ORDER BY path
+		LIMIT ? OFFSET ?`
+	listCommentsByStatusQuery = `SELECT ` + commentColumns + ` FROM comments
+		WHERE status = ?
+		ORDER BY created_at, id
+		LIMIT ? OFFSET ?`
+)
+
+var commentLogger = utils.Logger()
+
+type CommentRepo struct {
+	conf   *config.Config
+	client *sql.DB
+}
+
+func NewCommentRepo(conf *config.Config, client *sql.DB) domain.CommentRepo {
+	return &CommentRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *CommentRepo) Create(ctx context.Context, comment *domain.Comment) (int64, error) {
+	var commentID int64
+	createdAt := now()
+	err := conn(ctx, r.client).QueryRowContext(ctx, createCommentQuery, comment.BlogID, comment.UserID, comment.ParentID,
+		comment.Depth, comment.Content, string(comment.Status), createdAt, createdAt).Scan(&commentID)
+	if err != nil {
+		commentLogger.WithError(err).Errorf("failed to create comment. blog id: %d", comment.BlogID)
+		return -1, err
+	}
+	return commentID, nil
+}
+
+func (r *CommentRepo) Get(ctx context.Context, commentID int64) (*domain.Comment, error) {
+	comment, err := scanComment(conn(ctx, r.client).QueryRowContext(ctx, getCommentQuery, commentID))
+	if err == sql.ErrNoRows {
+		return nil, domain.NewNotFoundError("comment", commentID)
+	}
+	if err != nil {
+		commentLogger.WithError(err).Errorf("failed to get comment. comment id: %d", commentID)
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (r *CommentRepo) UpdateContent(ctx context.Context, commentID int64, content string) error {
+	return r.update(ctx, updateCommentContentQuery, commentID, content)
+}
+
+func (r *CommentRepo) UpdateStatus(ctx context.Context, commentID int64, status domain.CommentStatus) error {
+	return r.update(ctx, updateCommentStatusQuery, commentID, string(status))
+}
+
+func (r *CommentRepo) update(ctx context.Context, query string, commentID int64, value string) error {
+	result, err := conn(ctx, r.client).ExecContext(ctx, query, value, now(), commentID)
+	if err != nil {
+		commentLogger.WithError(err).Errorf("failed to update comment. comment id: %d", commentID)
+		return err
+	}
+	return requireRow(result, "comment", commentID)
+}
+
+func (r *CommentRepo) ListByBlog(ctx context.Context, blogID int64, status domain.CommentStatus, offset int, limit int) ([]*domain.Comment, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+	return r.list(ctx, listBlogCommentsQuery, blogID, string(status), limit, offset)
+}
+
+func (r *CommentRepo) ListByStatus(ctx context.Context, status domain.CommentStatus, offset int, limit int) ([]*domain.Comment, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+	return r.list(ctx, listCommentsByStatusQuery, string(status), limit, offset)
+}
+
+func (r *CommentRepo) list(ctx context.Context, query string, args ...any) ([]*domain.Comment, error) {
+	rows, err := conn(ctx, r.client).QueryContext(ctx, query, args...)
+	if err != nil {
+		commentLogger.WithError(err).Error("failed to query comments")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*domain.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			commentLogger.WithError(err).Error("failed to query comments")
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+func scanComment(row scanner) (*domain.Comment, error) {
+	var comment domain.Comment
+	var status, createdAt, updatedAt string
+	err := row.Scan(&comment.ID, &comment.BlogID, &comment.UserID, &comment.ParentID, &comment.Depth,
+		&comment.Content, &status, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	comment.Status = domain.CommentStatus(status)
+	if comment.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if comment.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
@@ -0,0 +1,271 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+// migrations are applied in order and only once, the index of the last applied one (plus one) is kept in
+// PRAGMA user_version. Never edit a released migration, append a new one instead.
+var migrations = []string{
+	// 1: the initial schema. Postgres keeps the role permissions in a TEXT[] column, here they get their own table.
+	// The blogs are indexed with an FTS5 trigram table, which gives the substring semantics of the Postgres ILIKE
+	// search, and is kept in sync by triggers.
+	`CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT UNIQUE NOT NULL,
+		password TEXT NOT NULL,
+		first_name TEXT,
+		last_name TEXT,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+
+	CREATE TABLE blogs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		title TEXT NOT NULL,
+		content TEXT NOT NULL,
+		tags TEXT,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	CREATE INDEX blogs_created_at_idx ON blogs (created_at DESC, id DESC);
+
+	CREATE TABLE roles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT
+	);
+
+	CREATE TABLE role_permissions (
+		role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+		permission TEXT NOT NULL,
+		PRIMARY KEY (role_id, permission)
+	);
+
+	CREATE TABLE user_roles (
+		user_id INTEGER REFERENCES users(id),
+		role_id INTEGER REFERENCES roles(id),
+		PRIMARY KEY (user_id, role_id)
+	);
+
+	CREATE VIRTUAL TABLE blogs_fts USING fts5(document, tokenize = 'trigram');
+
+	CREATE TRIGGER blogs_fts_insert AFTER INSERT ON blogs BEGIN
+		INSERT INTO blogs_fts (rowid, document) VALUES (new.id, new.title || ' ' || new.content || ' ' || COALESCE(new.tags, ''));
+	END;
+	CREATE TRIGGER blogs_fts_update AFTER UPDATE ON blogs BEGIN
+		DELETE FROM blogs_fts WHERE rowid = old.id;
+		INSERT INTO blogs_fts (rowid, document) VALUES (new.id, new.title || ' ' || new.content || ' ' || COALESCE(new.tags, ''));
+	END;
+	CREATE TRIGGER blogs_fts_delete AFTER DELETE ON blogs BEGIN
+		DELETE FROM blogs_fts WHERE rowid = old.id;
+	END;`,
+
+	// 2: comments. The path (the zero padded ids of the ancestors and of the comment itself) orders a thread
+	// the way it is displayed, it is filled in by a trigger as the id is only known after the insert.
+	`ALTER TABLE blogs ADD COLUMN comments_enabled INTEGER NOT NULL DEFAULT 1;
+
+	CREATE TABLE comments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		parent_id INTEGER REFERENCES comments(id),
+		depth INTEGER NOT NULL DEFAULT 0,
+		path TEXT NOT NULL DEFAULT '',
+		content TEXT NOT NULL,
+		status TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	CREATE INDEX comments_blog_idx ON comments (blog_id, status, path);
+	CREATE INDEX comments_status_idx ON comments (status, created_at);
+
+	CREATE TRIGGER comments_path AFTER INSERT ON comments BEGIN
+		UPDATE comments SET path = COALESCE((SELECT path FROM comments WHERE id = new.parent_id), '') || printf('%012d/', new.id)
+		WHERE id = new.id;
+	END;`,
+
+	// 3: reactions, the counters are maintained by triggers within the statement which changes the reactions
+	`CREATE TABLE reactions (
+		blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		type TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		PRIMARY KEY (blog_id, user_id, type)
+	);
+	CREATE INDEX reactions_blog_idx ON reactions (blog_id, created_at);
+
+	CREATE TABLE reaction_counts (
+		blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+		type TEXT NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (blog_id, type)
+	);
+
+	CREATE TRIGGER reaction_counts_insert AFTER INSERT ON reactions BEGIN
+		INSERT INTO reaction_counts (blog_id, type, count) VALUES (new.blog_id, new.type, 1)
+		ON CONFLICT (blog_id, type) DO UPDATE SET count = count + 1;
+	END;
+	CREATE TRIGGER reaction_counts_delete AFTER DELETE ON reactions BEGIN
+		UPDATE reaction_counts SET count = count - 1 WHERE blog_id = old.blog_id AND type = old.type;
+	END;`,
+
+	// 4: follows, and the index the feed reads the blogs of the followed authors from
+	`CREATE TABLE follows (
+		follower_id INTEGER NOT NULL REFERENCES users(id),
+		followee_id INTEGER NOT NULL REFERENCES users(id),
+		created_at TEXT NOT NULL,
+		PRIMARY KEY (follower_id, followee_id),
+		CHECK (follower_id <> followee_id)
+	);
+	CREATE INDEX follows_follower_idx ON follows (follower_id, created_at);
+	CREATE INDEX follows_followee_idx ON follows (followee_id, created_at);
+
+	CREATE INDEX blogs_user_created_idx ON blogs (user_id, created_at DESC, id DESC);`,
+	// 5: who can read a blog, the existing blogs were readable by the members only
+	`ALTER TABLE blogs ADD COLUMN visibility TEXT NOT NULL DEFAULT 'members-only'
+		CHECK (visibility IN ('public', 'unlisted', 'members-only', 'private'));`,
+	// 6: how the content is written, the existing blogs were plain text
+	`ALTER TABLE blogs ADD COLUMN content_format TEXT NOT NULL DEFAULT 'plaintext'
+		CHECK (content_format IN ('markdown', 'html', 'plaintext'));`,
+	// 7: slugs, blogs.slug is the current one and blog_slugs has every slug a blog has had, so that the links
+	// with an old slug keep working. The existing blogs get their slugs from the BlogManager on start.
+	`ALTER TABLE blogs ADD COLUMN slug TEXT;
+
+	CREATE TABLE blog_slugs (
+		slug TEXT PRIMARY KEY,
+		blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX blog_slugs_blog_idx ON blog_slugs (blog_id);`,
+	// 8: the uploaded media, the bytes are in the BlobStore. A media without a blog is an orphan once it is old
+	// enough, the partial index is what the cleanup job reads.
+	`CREATE TABLE media (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		blog_id INTEGER REFERENCES blogs(id) ON DELETE SET NULL,
+		blob_key TEXT NOT NULL UNIQUE,
+		content_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX media_blog_idx ON media (blog_id);
+	CREATE INDEX media_orphans_idx ON media (created_at) WHERE blog_id IS NULL;`,
+	// 9: drafts, the existing blogs were published
+	`ALTER TABLE blogs ADD COLUMN status TEXT NOT NULL DEFAULT 'published'
+		CHECK (status IN ('draft', 'published'));`,
+	// 10: the responses of the requests made with an Idempotency-Key, status is 0 while the first request runs
+	`CREATE TABLE idempotent_requests (
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		idempotency_key TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		content_type TEXT NOT NULL DEFAULT '',
+		body BLOB,
+		created_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		PRIMARY KEY (user_id, idempotency_key)
+	);
+	CREATE INDEX idempotent_requests_expires_idx ON idempotent_requests (expires_at);`,
+	// 11: the disabled users, which can not log in
+	`ALTER TABLE users ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0;`,
+	// 12: the version of the tokens of the users, which revokes the older tokens when it is bumped
+	`ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;`,
+}
+
+var dbLogger = utils.Logger()
+
+// DatabaseRepo runs the migrations and creates the roles, the admin user is created by the DatabaseManager
+type DatabaseRepo struct {
+	conf   *config.Config
+	client *sql.DB
+}
+
+func NewDatabaseRepo(conf *config.Config, client *sql.DB) domain.DatabaseRepo {
+	return &DatabaseRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *DatabaseRepo) Initialize(ctx context.Context) error {
+	err := r.migrate(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.syncRoles(ctx)
+	if err != nil {
+		dbLogger.WithError(err).Error("failed to create roles")
+		return err
+	}
+	return nil
+}
+
+func (r *DatabaseRepo) migrate(ctx context.Context) error {
+	var version int
+	err := r.client.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema version: %w", err)
+	}
+
+	for ; version < len(migrations); version++ {
+		dbLogger.Infof("applying migration %d", version+1)
+		tx, err := r.client.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, migrations[version])
+		if err == nil {
+			// PRAGMA does not take parameters
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			dbLogger.WithError(err).Errorf("failed to apply migration %d", version+1)
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncRoles creates the missing built-in roles and resets the permissions of the existing ones
+func (r *DatabaseRepo) syncRoles(ctx context.Context) error {
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, role := range utils.BuiltInRoles {
+		var roleID int64
+		err := tx.QueryRowContext(ctx, `INSERT INTO roles (name, description) VALUES (?, ?)
+			ON CONFLICT (name) DO UPDATE SET description = excluded.description RETURNING id`,
+			role.Name, role.Description).Scan(&roleID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = ?`, roleID); err != nil {
+			return err
+		}
+		for _, permission := range role.Permissions {
+			_, err := tx.ExecContext(ctx, `INSERT INTO role_permissions (role_id, permission) VALUES (?, ?)`, roleID, permission)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,72 @@
+/*
+Package sqlite is the SQLite implementation of the domain repositories, for single node and embedded deployments
+where running Postgres is not worth it. It uses the pure Go modernc.org/sqlite driver, so no cgo is needed.
+*/
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// timestamps are stored as fixed width UTC text so that they sort correctly and keep microsecond precision
+const timeLayout = "2006-01-02T15:04:05.000000Z"
+
+// Open opens (or creates) the database file. Foreign keys are enforced, writers wait for each other instead of
+// failing right away, and transactions take the write lock up front to avoid upgrade deadlocks.
+func Open(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?%s", path, params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to open database: %v", err)
+	}
+	return db, nil
+}
+
+func now() string {
+	return formatTime(time.Now())
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(timeLayout, value)
+}
+
+// isUniqueViolation reports whether SQLite rejected the statement because of a unique constraint
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+}
+
+// requireRow turns an update which did not match any row into a not found error
+func requireRow(result sql.Result, entity string, id int64) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.NewNotFoundError(entity, id)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+const (
+	followQuery    = `INSERT INTO follows (follower_id, followee_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`
+	unfollowQuery  = `DELETE FROM follows WHERE follower_id = ? AND followee_id = ?`
+	followersQuery = `SELECT follower_id, followee_id, created_at FROM follows WHERE followee_id = ?
+		ORDER BY created_at DESC, follower_id DESC
+		LIMIT ? OFFSET ?`
+	followingQuery = `SELECT follower_id, followee_id, created_at FROM follows WHERE follower_id = ?
+		ORDER BY created_at DESC, followee_id DESC
+		LIMIT ? OFFSET ?`
+	followCountsQuery = `SELECT
+		(SELECT COUNT(*) FROM follows WHERE followee_id = ?1),
+		(SELECT COUNT(*) FROM follows WHERE follower_id = ?1)`
+)
+
+var followLogger = utils.Logger()
+
+type FollowRepo struct {
+	conf   *config.Config
+	client *sql.DB
+}
+
+func NewFollowRepo(conf *config.Config, client *sql.DB) domain.FollowRepo {
+	return &FollowRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *FollowRepo) Follow(ctx context.Context, follow *domain.Follow) (bool, error) {
+	result, err := conn(ctx, r.client).ExecContext(ctx, followQuery, follow.FollowerID, follow.FolloweeID, now())
+	if err != nil {
+		followLogger.WithError(err).Errorf("failed to follow. follower id: %d, followee id: %d", follow.FollowerID, follow.FolloweeID)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *FollowRepo) Unfollow(ctx context.Context, follow *domain.Follow) (bool, error) {
+	result, err := conn(ctx, r.client).ExecContext(ctx, unfollowQuery, follow.FollowerID, follow.FolloweeID)
+	if err != nil {
+		followLogger.WithError(err).Errorf("failed to unfollow. follower id: %d, followee id: %d", follow.FollowerID, follow.FolloweeID)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *FollowRepo) Followers(ctx context.Context, userID int64, offset int, limit int) ([]*domain.Follow, error) {
+	return r.list(ctx, followersQuery, userID, offset, limit)
+}
+
+func (r *FollowRepo) Following(ctx context.Context, userID int64, offset int, limit int) ([]*domain.Follow, error) {
+	return r.list(ctx, followingQuery, userID, offset, limit)
+}
+
+func (r *FollowRepo) list(ctx context.Context, query string, userID int64, offset int, limit int) ([]*domain.Follow, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+	rows, err := conn(ctx, r.client).QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		followLogger.WithError(err).Errorf("failed to query follows. user id: %d", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var follows []*domain.Follow
+	for rows.Next() {
+		var follow domain.Follow
+		var createdAt string
+		if err := rows.Scan(&follow.FollowerID, &follow.FolloweeID, &createdAt); err != nil {
+			followLogger.WithError(err).Errorf("failed to query follows. user id: %d", userID)
+			return nil, err
+		}
+		if follow.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		follows = append(follows, &follow)
+	}
+	return follows, rows.Err()
+}
+
+func (r *FollowRepo) Counts(ctx context.Context, userID int64) (followers int64, following int64, err error) {
+	err = conn(ctx, r.client).QueryRowContext(ctx, followCountsQuery, userID).Scan(&followers, &following)
+	if err != nil {
+		followLogger.WithError(err).Errorf("failed to count follows. user id: %d", userID)
+	}
+	return followers, following, err
+}
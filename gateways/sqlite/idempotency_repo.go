@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+const (
+	idempotentRequestColumns = `user_id, idempotency_key, fingerprint, status, content_type, body, created_at, expires_at`
+	// an expired request is replaced, so is the same request when it has been running since before the end of its
+	// lease, an unexpired one is left as it is and nothing is affected
+	reserveIdempotentRequestQuery = `INSERT INTO idempotent_requests (user_id, idempotency_key, fingerprint, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE SET fingerprint = excluded.fingerprint, status = 0,
+			content_type = '', body = NULL, created_at = excluded.created_at, expires_at = excluded.expires_at
+		WHERE idempotent_requests.expires_at <= excluded.created_at OR (idempotent_requests.status = 0
+			AND idempotent_requests.fingerprint = excluded.fingerprint AND idempotent_requests.created_at < ?)`
+	getIdempotentRequestQuery = `SELECT ` + idempotentRequestColumns + ` FROM idempotent_requests
+		WHERE user_id = ? AND idempotency_key = ? AND expires_at > ?`
+	completeIdempotentRequestQuery = `UPDATE idempotent_requests SET status = ?, content_type = ?, body = ?
+		WHERE user_id = ? AND idempotency_key = ?`
+	releaseIdempotentRequestQuery       = `DELETE FROM idempotent_requests WHERE user_id = ? AND idempotency_key = ?`
+	deleteExpiredIdempotentRequestQuery = `DELETE FROM idempotent_requests WHERE expires_at < ?`
+)
+
+var idempotencyLogger = utils.Logger()
+
+type IdempotencyRepo struct {
+	conf   *config.Config
+	client *sql.DB
+}
+
+func NewIdempotencyRepo(conf *config.Config, client *sql.DB) domain.IdempotencyRepo {
+	return &IdempotencyRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *IdempotencyRepo) Reserve(ctx context.Context, request *domain.IdempotentRequest, lease time.Duration) (*domain.IdempotentRequest, error) {
+	// the request found by a failed insert can be released before it is read, the insert is tried again then
+	for attempt := 0; attempt < 3; attempt++ {
+		reservedAt := time.Now()
+		createdAt := formatTime(reservedAt)
+		result, err := conn(ctx, r.client).ExecContext(ctx, reserveIdempotentRequestQuery,
+			request.UserID, request.Key, request.Fingerprint, createdAt, formatTime(request.ExpiresAt), formatTime(reservedAt.Add(-lease)))
+		if err != nil {
+			idempotencyLogger.WithError(err).Errorf("failed to reserve the idempotency key. user id: %d", request.UserID)
+			return nil, err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+			return nil, err
+		}
+
+		existing, err := scanIdempotentRequest(conn(ctx, r.client).QueryRowContext(ctx, getIdempotentRequestQuery, request.UserID, request.Key, createdAt))
+		if !errors.Is(err, sql.ErrNoRows) {
+			return existing, err
+		}
+	}
+	return nil, domain.NewConflictError("idempotent request", "the idempotency key keeps changing hands")
+}
+
+func (r *IdempotencyRepo) Complete(ctx context.Context, request *domain.IdempotentRequest) error {
+	result, err := conn(ctx, r.client).ExecContext(ctx, completeIdempotentRequestQuery,
+		request.Status, request.ContentType, request.Body, request.UserID, request.Key)
+	if err != nil {
+		idempotencyLogger.WithError(err).Errorf("failed to store the response of the idempotent request. user id: %d", request.UserID)
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.NewNotFoundError("idempotent request", request.Key)
+	}
+	return nil
+}
+
+func (r *IdempotencyRepo) Release(ctx context.Context, userID int64, key string) error {
+	_, err := conn(ctx, r.client).ExecContext(ctx, releaseIdempotentRequestQuery, userID, key)
+	if err != nil {
+		idempotencyLogger.WithError(err).Errorf("failed to release the idempotency key. user id: %d", userID)
+	}
+	return err
+}
+
+func (r *IdempotencyRepo) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	result, err := conn(ctx, r.client).ExecContext(ctx, deleteExpiredIdempotentRequestQuery, formatTime(before))
+	if err != nil {
+		idempotencyLogger.WithError(err).Error("failed to delete the expired idempotent requests")
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+func scanIdempotentRequest(row *sql.Row) (*domain.IdempotentRequest, error) {
+	var request domain.IdempotentRequest
+	var createdAt, expiresAt string
+	err := row.Scan(&request.UserID, &request.Key, &request.Fingerprint, &request.Status, &request.ContentType,
+		&request.Body, &createdAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if request.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if request.ExpiresAt, err = parseTime(expiresAt); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
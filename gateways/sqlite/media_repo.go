@@ -0,0 +1,123 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+const (
+	mediaColumns     = `id, user_id, COALESCE(blog_id, 0), blob_key, content_type, size, width, height, created_at`
+	createMediaQuery = `INSERT INTO media (user_id, blog_id, blob_key, content_type, size, width, height, created_at)
+		VALUES (?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?) RETURNING id`
+	getMediaQuery          = `SELECT ` + mediaColumns + ` FROM media WHERE id = ?`
+	attachMediaQuery       = `UPDATE media SET blog_id = ? WHERE id = ?`
+	listMediaByBlogQuery   = `SELECT ` + mediaColumns + ` FROM media WHERE blog_id = ? ORDER BY id`
+	listOrphanMediaQuery   = `SELECT ` + mediaColumns + ` FROM media WHERE blog_id IS NULL AND created_at < ? ORDER BY created_at, id LIMIT ?`
+	deleteOrphanMediaQuery = `DELETE FROM media WHERE id = ? AND blog_id IS NULL`
+)
+
+var mediaLogger = utils.Logger()
+
+type MediaRepo struct {
+	conf   *config.Config
+	client *sql.DB
+}
+
+func NewMediaRepo(conf *config.Config, client *sql.DB) domain.MediaRepo {
+	return &MediaRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *MediaRepo) Create(ctx context.Context, media *domain.Media) (int64, error) {
+	var mediaID int64
+	err := conn(ctx, r.client).QueryRowContext(ctx, createMediaQuery, media.UserID, media.BlogID, media.Key, media.ContentType,
+		media.Size, media.Width, media.Height, now()).Scan(&mediaID)
+	if err != nil {
+		mediaLogger.WithError(err).Errorf("failed to create media. user id: %d", media.UserID)
+		return -1, err
+	}
+	return mediaID, nil
+}
+
+func (r *MediaRepo) Get(ctx context.Context, mediaID int64) (*domain.Media, error) {
+	media, err := scanMedia(conn(ctx, r.client).QueryRowContext(ctx, getMediaQuery, mediaID))
+	if err == sql.ErrNoRows {
+		return nil, domain.NewNotFoundError("media", mediaID)
+	}
+	if err != nil {
+		mediaLogger.WithError(err).Errorf("failed to get media. media id: %d", mediaID)
+		return nil, err
+	}
+	return media, nil
+}
+
+func (r *MediaRepo) Attach(ctx context.Context, mediaID int64, blogID int64) error {
+	result, err := conn(ctx, r.client).ExecContext(ctx, attachMediaQuery, blogID, mediaID)
+	if err != nil {
+		mediaLogger.WithError(err).Errorf("failed to attach media. media id: %d, blog id: %d", mediaID, blogID)
+		return err
+	}
+	return requireRow(result, "media", mediaID)
+}
+
+func (r *MediaRepo) ListByBlog(ctx context.Context, blogID int64) ([]*domain.Media, error) {
+	return r.list(ctx, listMediaByBlogQuery, blogID)
+}
+
+func (r *MediaRepo) Orphans(ctx context.Context, before time.Time, limit int) ([]*domain.Media, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+	return r.list(ctx, listOrphanMediaQuery, formatTime(before), limit)
+}
+
+func (r *MediaRepo) DeleteOrphan(ctx context.Context, mediaID int64) (bool, error) {
+	result, err := conn(ctx, r.client).ExecContext(ctx, deleteOrphanMediaQuery, mediaID)
+	if err != nil {
+		mediaLogger.WithError(err).Errorf("failed to delete media. media id: %d", mediaID)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *MediaRepo) list(ctx context.Context, query string, args ...any) ([]*domain.Media, error) {
+	rows, err := conn(ctx, r.client).QueryContext(ctx, query, args...)
+	if err != nil {
+		mediaLogger.WithError(err).Error("failed to query media")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var found []*domain.Media
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			mediaLogger.WithError(err).Error("failed to query media")
+			return nil, err
+		}
+		found = append(found, media)
+	}
+	return found, rows.Err()
+}
+
+func scanMedia(row scanner) (*domain.Media, error) {
+	var media domain.Media
+	var createdAt string
+	err := row.Scan(&media.ID, &media.UserID, &media.BlogID, &media.Key, &media.ContentType, &media.Size, &media.Width, &media.Height, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if media.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
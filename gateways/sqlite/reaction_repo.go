@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+const (
+	// the counters are kept up to date by the triggers of the reactions table
+	addReactionQuery    = `INSERT INTO reactions (blog_id, user_id, type, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`
+	removeReactionQuery = `DELETE FROM reactions WHERE blog_id = ? AND user_id = ? AND type = ?`
+	// the blog ids are passed as a JSON array
+	reactionCountsQuery = `SELECT blog_id, type, count FROM reaction_counts
+		WHERE blog_id IN (SELECT value FROM json_each(?)) AND count > 0`
+	listReactionsQuery = `SELECT blog_id, user_id, type, created_at FROM reactions
+		WHERE blog_id = ? AND (? = '' OR type = ?)
+		ORDER BY created_at DESC, user_id DESC, type
+		LIMIT ? OFFSET ?`
+)
+
+var reactionLogger = utils.Logger()
+
+type ReactionRepo struct {
+	conf   *config.Config
+	client *sql.DB
+}
+
+func NewReactionRepo(conf *config.Config, client *sql.DB) domain.ReactionRepo {
+	return &ReactionRepo{
+		conf:   conf,
+		client: client,
+	}
+}
+
+func (r *ReactionRepo) Add(ctx context.Context, reaction *domain.Reaction) (bool, error) {
+	result, err := conn(ctx, r.client).ExecContext(ctx, addReactionQuery, reaction.BlogID, reaction.UserID, reaction.Type, now())
+	if err != nil {
+		reactionLogger.WithError(err).Errorf("failed to add reaction. blog id: %d", reaction.BlogID)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *ReactionRepo) Remove(ctx context.Context, reaction *domain.Reaction) (bool, error) {
+	result, err := conn(ctx, r.client).ExecContext(ctx, removeReactionQuery, reaction.BlogID, reaction.UserID, reaction.Type)
+	if err != nil {
+		reactionLogger.WithError(err).Errorf("failed to remove reaction. blog id: %d", reaction.BlogID)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *ReactionRepo) Counts(ctx context.Context, blogIDs ...int64) (map[int64]map[string]int64, error) {
+	counts := make(map[int64]map[string]int64, len(blogIDs))
+	if len(blogIDs) == 0 {
+		return counts, nil
+	}
+	ids, err := json.Marshal(blogIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn(ctx, r.client).QueryContext(ctx, reactionCountsQuery, string(ids))
+	if err != nil {
+		reactionLogger.WithError(err).Error("failed to query reaction counts")
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var blogID, count int64
+		var reactionType string
+		if err := rows.Scan(&blogID, &reactionType, &count); err != nil {
+			reactionLogger.WithError(err).Error("failed to query reaction counts")
+			return nil, err
+		}
+		if counts[blogID] == nil {
+			counts[blogID] = make(map[string]int64)
+		}
+		counts[blogID][reactionType] = count
+	}
+	return counts, rows.Err()
+}
+
+func (r *ReactionRepo) List(ctx context.Context, blogID int64, reactionType string, offset int, limit int) ([]*domain.Reaction, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+	rows, err := conn(ctx, r.client).QueryContext(ctx, listReactionsQuery, blogID, reactionType, reactionType, limit, offset)
+	if err != nil {
+		reactionLogger.WithError(err).Errorf("failed to query reactions. blog id: %d", blogID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []*domain.Reaction
+	for rows.Next() {
+		var reaction domain.Reaction
+		var createdAt string
+		err := rows.Scan(&reaction.BlogID, &reaction.UserID, &reaction.Type, &createdAt)
+		if err != nil {
+			reactionLogger.WithError(err).Errorf("failed to query reactions. blog id: %d", blogID)
+			return nil, err
+		}
+		if reaction.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, &reaction)
+	}
+	return reactions, rows.Err()
+}
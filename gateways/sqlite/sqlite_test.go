@@ -0,0 +1,34 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/gateways/contract"
+	"github.com/bipuldutta/blogzilla/gateways/repositories"
+)
+
+func TestContract(t *testing.T) {
+	contract.Run(t, func(t *testing.T, conf *config.Config) contract.Repos {
+		db, err := Open(filepath.Join(t.TempDir(), "blogzilla.db"))
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		authRepo := repositories.NewAuthRepo(conf)
+		return contract.Repos{
+			Tx:          NewTxManager(db),
+			Database:    NewDatabaseRepo(conf, db),
+			Users:       NewUserRepo(conf, db, authRepo),
+			Blogs:       NewBlogRepo(conf, db),
+			Comments:    NewCommentRepo(conf, db),
+			Reactions:   NewReactionRepo(conf, db),
+			Follows:     NewFollowRepo(conf, db),
+			Media:       NewMediaRepo(conf, db),
+			Idempotency: NewIdempotencyRepo(conf, db),
+			Auth:        authRepo,
+		}
+	})
+}
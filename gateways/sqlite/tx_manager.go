@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+// querier is what the repositories need from either the database or a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txKey struct{}
+
+// conn returns the transaction carried by the context, or the database when there is none
+func conn(ctx context.Context, client *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return client
+}
+
+type TxManager struct {
+	client *sql.DB
+}
+
+func NewTxManager(client *sql.DB) domain.TxManager {
+	return &TxManager{
+		client: client,
+	}
+}
+
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := m.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	err = fn(context.WithValue(ctx, txKey{}, tx))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
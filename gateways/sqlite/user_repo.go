@@ -0,0 +1,325 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+const (
+	userColumns        = `id, username, password, first_name, last_name, disabled, token_version, created_at, updated_at`
+	createUserQuery    = `INSERT INTO users (username, password, first_name, last_name, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING id`
+	assignUserRoles    = `INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)`
+	revokeUserRole     = `DELETE FROM user_roles WHERE user_id = ? AND role_id = ?`
+	getUserByNameQuery = `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+	getUserByIDQuery   = `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	getUsersByIDsQuery = `SELECT ` + userColumns + ` FROM users
+		WHERE id IN (SELECT value FROM json_each(?))`
+	listUsersQuery    = `SELECT ` + userColumns + ` FROM users ORDER BY id LIMIT ? OFFSET ?`
+	setPasswordQuery  = `UPDATE users SET password = ?, updated_at = ? WHERE id = ?`
+	setDisabledQuery  = `UPDATE users SET disabled = ?, updated_at = ? WHERE id = ?`
+	revokeTokensQuery = `UPDATE users SET token_version = token_version + 1, updated_at = ? WHERE id = ?`
+	getRoleByName     = `SELECT r.id, r.name, COALESCE(r.description, ''), p.permission
+		FROM roles r
+		JOIN role_permissions p ON p.role_id = r.id
+		WHERE r.name = ?
+		ORDER BY p.permission`
+	getUserRolesQuery = `SELECT r.name FROM roles r JOIN user_roles ur ON ur.role_id = r.id WHERE ur.user_id = ? ORDER BY r.name`
+	permissionQuery   = `SELECT DISTINCT p.permission
+		FROM role_permissions p
+		JOIN user_roles ur ON p.role_id = ur.role_id
+		WHERE ur.user_id = ?`
+)
+
+var userLogger = utils.Logger()
+
+type UserRepo struct {
+	conf        *config.Config
+	client      *sql.DB
+	sessionRepo domain.AuthRepo
+}
+
+func NewUserRepo(conf *config.Config, client *sql.DB, sessionRepo domain.AuthRepo) domain.UserRepo {
+	return &UserRepo{
+		conf:        conf,
+		client:      client,
+		sessionRepo: sessionRepo,
+	}
+}
+
+// Create only inserts the user with the hashed password, the use case takes care of the roles within the same transaction
+func (r *UserRepo) Create(ctx context.Context, newUser *domain.User) (*domain.User, error) {
+	var userID int64
+	createdAt := now()
+	err := conn(ctx, r.client).QueryRowContext(ctx, createUserQuery, newUser.Username, newUser.Password, newUser.FirstName, newUser.LastName, createdAt, createdAt).Scan(&userID)
+	if isUniqueViolation(err) {
+		return nil, domain.NewConflictError("user", fmt.Sprintf("username '%s' is already taken", newUser.Username))
+	}
+	if err != nil {
+		userLogger.WithError(err).Error("failed to create user")
+		return nil, err
+	}
+
+	return r.GetUserByUsername(ctx, newUser.Username)
+}
+
+func (r *UserRepo) AssignRoles(ctx context.Context, userID int64, roleIDs ...int64) error {
+	for _, roleID := range roleIDs {
+		_, err := conn(ctx, r.client).ExecContext(ctx, assignUserRoles, userID, roleID)
+		if isUniqueViolation(err) {
+			return domain.NewConflictError("role", fmt.Sprintf("role %d is already assigned to user %d", roleID, userID))
+		}
+		if err != nil {
+			userLogger.WithError(err).Error("failed to assign roles to user")
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *UserRepo) RevokeRoles(ctx context.Context, userID int64, roleIDs ...int64) error {
+	for _, roleID := range roleIDs {
+		result, err := conn(ctx, r.client).ExecContext(ctx, revokeUserRole, userID, roleID)
+		if err != nil {
+			userLogger.WithError(err).Error("failed to revoke roles of user")
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return domain.NewConflictError("role", fmt.Sprintf("role %d is not assigned to user %d", roleID, userID))
+		}
+	}
+	return nil
+}
+
+func (r *UserRepo) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	rows, err := conn(ctx, r.client).QueryContext(ctx, getUserRolesQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var roleNames []string
+	for rows.Next() {
+		var roleName string
+		if err := rows.Scan(&roleName); err != nil {
+			return nil, err
+		}
+		roleNames = append(roleNames, roleName)
+	}
+	return roleNames, rows.Err()
+}
+
+func (r *UserRepo) GetRoleByName(ctx context.Context, roleName string) (*domain.Role, error) {
+	rows, err := conn(ctx, r.client).QueryContext(ctx, getRoleByName, roleName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var role *domain.Role
+	for rows.Next() {
+		var id int64
+		var name, description, permission string
+		if err := rows.Scan(&id, &name, &description, &permission); err != nil {
+			userLogger.WithError(err).Error("failed to get role by name")
+			return nil, err
+		}
+		if role == nil {
+			role = &domain.Role{ID: id, Name: name, Description: description}
+		}
+		role.Permissions = append(role.Permissions, permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, domain.NewNotFoundError("role", roleName)
+	}
+	return role, nil
+}
+
+func (r *UserRepo) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	return r.getUser(ctx, getUserByNameQuery, username)
+}
+
+func (r *UserRepo) GetUserByID(ctx context.Context, userID int64) (*domain.User, error) {
+	user, err := r.getUser(ctx, getUserByIDQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.NewNotFoundError("user", userID)
+	}
+	return user, nil
+}
+
+func (r *UserRepo) GetUsersByIDs(ctx context.Context, userIDs ...int64) (map[int64]*domain.User, error) {
+	users := make(map[int64]*domain.User, len(userIDs))
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+	ids, err := json.Marshal(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn(ctx, r.client).QueryContext(ctx, getUsersByIDsQuery, string(ids))
+	if err != nil {
+		userLogger.WithError(err).Error("failed to query users")
+		return nil, fmt.Errorf("failed to query users")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			userLogger.WithError(err).Error("failed to read user data")
+			return nil, fmt.Errorf("failed to read user data")
+		}
+		users[user.ID] = user
+	}
+	return users, rows.Err()
+}
+
+func (r *UserRepo) ListUsers(ctx context.Context, offset int, limit int) ([]*domain.User, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+	rows, err := conn(ctx, r.client).QueryContext(ctx, listUsersQuery, limit, offset)
+	if err != nil {
+		userLogger.WithError(err).Error("failed to list users")
+		return nil, fmt.Errorf("failed to list users")
+	}
+	defer rows.Close()
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			userLogger.WithError(err).Error("failed to read user data")
+			return nil, fmt.Errorf("failed to read user data")
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *UserRepo) SetPassword(ctx context.Context, userID int64, hashedPassword string) error {
+	result, err := conn(ctx, r.client).ExecContext(ctx, setPasswordQuery, hashedPassword, now(), userID)
+	if err != nil {
+		userLogger.WithError(err).Errorf("failed to set the password. user id: %d", userID)
+		return err
+	}
+	return requireRow(result, "user", userID)
+}
+
+func (r *UserRepo) SetDisabled(ctx context.Context, userID int64, disabled bool) error {
+	result, err := conn(ctx, r.client).ExecContext(ctx, setDisabledQuery, disabled, now(), userID)
+	if err != nil {
+		userLogger.WithError(err).Errorf("failed to disable the user. user id: %d", userID)
+		return err
+	}
+	return requireRow(result, "user", userID)
+}
+
+func (r *UserRepo) RevokeTokens(ctx context.Context, userID int64) error {
+	result, err := conn(ctx, r.client).ExecContext(ctx, revokeTokensQuery, now(), userID)
+	if err != nil {
+		userLogger.WithError(err).Errorf("failed to revoke the tokens. user id: %d", userID)
+		return err
+	}
+	return requireRow(result, "user", userID)
+}
+
+// getUser returns nil when the query finds no user
+func (r *UserRepo) getUser(ctx context.Context, query string, arg any) (*domain.User, error) {
+	user, err := scanUser(conn(ctx, r.client).QueryRowContext(ctx, query, arg))
+	if err == sql.ErrNoRows {
+		// user not found
+		return nil, nil
+	}
+	if err != nil {
+		userLogger.WithError(err).Error("failed to read user data")
+		return nil, fmt.Errorf("failed to read user data")
+	}
+	return user, nil
+}
+
+func scanUser(row scanner) (*domain.User, error) {
+	var user domain.User
+	var firstName, lastName sql.NullString
+	var createdAt, updatedAt string
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &firstName, &lastName, &user.Disabled, &user.TokenVersion, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	user.FirstName = firstName.String
+	user.LastName = lastName.String
+	if user.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if user.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *UserRepo) Login(ctx context.Context, username string, password string) (string, error) {
+	user, err := r.GetUserByUsername(ctx, username)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user by name")
+	}
+	if user == nil {
+		// do not tell the caller which of the two was wrong
+		return "", domain.NewUnauthorizedError("invalid username or password")
+	}
+
+	err = utils.ComparePassword(ctx, user.Password, password)
+	if err != nil {
+		return "", domain.NewUnauthorizedError("invalid username or password")
+	}
+	if user.Disabled {
+		return "", domain.NewForbiddenError("the user is disabled")
+	}
+
+	permissions, err := r.getUserPermissions(ctx, user.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user permissions")
+	}
+	token, err := r.sessionRepo.GetToken(ctx, user.ID, user.TokenVersion, permissions)
+	if err != nil {
+		return "", fmt.Errorf("failed to set the session information")
+	}
+	return token, nil
+}
+
+func (r *UserRepo) GetPermissions(ctx context.Context, userID int64) (map[string]any, error) {
+	return r.getUserPermissions(ctx, userID)
+}
+
+func (r *UserRepo) getUserPermissions(ctx context.Context, userID int64) (map[string]any, error) {
+	permissions := make(map[string]any)
+
+	rows, err := conn(ctx, r.client).QueryContext(ctx, permissionQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions[permission] = nil
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
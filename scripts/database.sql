@@ -1,4 +1,11 @@
 /*
+DROP TABLE idempotent_requests;
+DROP TABLE media;
+DROP TABLE blog_slugs;
+DROP TABLE follows;
+DROP TABLE reaction_counts;
+DROP TABLE reactions;
+DROP TABLE comments;
 DROP TABLE blogs;
 DROP TABLE user_roles;
 DROP TABLE users;
@@ -11,6 +18,8 @@ CREATE TABLE IF NOT EXISTS users (
     password VARCHAR(255) NOT NULL,
     first_name VARCHAR(255),
     last_name VARCHAR(255),
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    token_version INTEGER NOT NULL DEFAULT 0,
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
@@ -19,11 +28,24 @@ CREATE TABLE IF NOT EXISTS blogs (
   id SERIAL PRIMARY KEY,
   user_id INTEGER NOT NULL REFERENCES users(id),
   title TEXT NOT NULL,
+  slug TEXT,
   content TEXT NOT NULL,
+  content_format TEXT NOT NULL DEFAULT 'plaintext' CHECK (content_format IN ('markdown', 'html', 'plaintext')),
   tags TEXT,
+  comments_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  visibility TEXT NOT NULL DEFAULT 'members-only' CHECK (visibility IN ('public', 'unlisted', 'members-only', 'private')),
+  status TEXT NOT NULL DEFAULT 'published' CHECK (status IN ('draft', 'published')),
   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
   updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
+CREATE INDEX IF NOT EXISTS blogs_user_created_idx ON blogs (user_id, created_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS blog_slugs (
+  slug TEXT PRIMARY KEY,
+  blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS blog_slugs_blog_idx ON blog_slugs (blog_id);
 
 CREATE TABLE IF NOT EXISTS roles (
     id SERIAL PRIMARY KEY,
@@ -38,7 +60,75 @@ CREATE TABLE IF NOT EXISTS user_roles (
   PRIMARY KEY (user_id, role_id)
 );
 
+CREATE TABLE IF NOT EXISTS comments (
+  id SERIAL PRIMARY KEY,
+  blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  parent_id INTEGER REFERENCES comments(id),
+  depth INTEGER NOT NULL DEFAULT 0,
+  path TEXT NOT NULL,
+  content TEXT NOT NULL,
+  status TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS comments_blog_idx ON comments (blog_id, status, path);
+CREATE INDEX IF NOT EXISTS comments_status_idx ON comments (status, created_at);
+
+CREATE TABLE IF NOT EXISTS reactions (
+  blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  type TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (blog_id, user_id, type)
+);
+CREATE INDEX IF NOT EXISTS reactions_blog_idx ON reactions (blog_id, created_at);
+
+CREATE TABLE IF NOT EXISTS reaction_counts (
+  blog_id INTEGER NOT NULL REFERENCES blogs(id) ON DELETE CASCADE,
+  type TEXT NOT NULL,
+  count BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (blog_id, type)
+);
+
+CREATE TABLE IF NOT EXISTS follows (
+  follower_id INTEGER NOT NULL REFERENCES users(id),
+  followee_id INTEGER NOT NULL REFERENCES users(id),
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (follower_id, followee_id),
+  CHECK (follower_id <> followee_id)
+);
+CREATE INDEX IF NOT EXISTS follows_follower_idx ON follows (follower_id, created_at);
+CREATE INDEX IF NOT EXISTS follows_followee_idx ON follows (followee_id, created_at);
+
 INSERT INTO roles (name, permissions) VALUES
-('admin', ARRAY['create_user', 'read_user', 'update_user', 'delete_user', 'create_blog', 'read_blog', 'update_blog', 'delete_blog']),
-('editor', ARRAY['create_blog', 'read_blog', 'update_blog', 'delete_blog']),
-('viewer', ARRAY['read_user', 'read_blog']);
+('admin', ARRAY['create_user', 'read_user', 'update_user', 'delete_user', 'create_blog', 'read_blog', 'update_blog', 'delete_blog', 'read_any_blog', 'create_comment', 'moderate_comment', 'create_reaction', 'follow_user', 'manage_system']),
+('editor', ARRAY['create_blog', 'read_blog', 'update_blog', 'delete_blog', 'create_comment', 'create_reaction', 'follow_user']),
+('viewer', ARRAY['read_user', 'read_blog', 'create_comment', 'create_reaction', 'follow_user']);
+
+CREATE TABLE IF NOT EXISTS media (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  blog_id INTEGER REFERENCES blogs(id) ON DELETE SET NULL,
+  blob_key TEXT NOT NULL UNIQUE,
+  content_type TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  width INTEGER NOT NULL DEFAULT 0,
+  height INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS media_blog_idx ON media (blog_id);
+CREATE INDEX IF NOT EXISTS media_orphans_idx ON media (created_at) WHERE blog_id IS NULL;
+
+CREATE TABLE IF NOT EXISTS idempotent_requests (
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  idempotency_key TEXT NOT NULL,
+  fingerprint TEXT NOT NULL,
+  status INTEGER NOT NULL DEFAULT 0,
+  content_type TEXT NOT NULL DEFAULT '',
+  body BYTEA,
+  created_at TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (user_id, idempotency_key)
+);
+CREATE INDEX IF NOT EXISTS idempotent_requests_expires_idx ON idempotent_requests (expires_at);
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/gateways/repositories"
+	"github.com/bipuldutta/blogzilla/usecases"
+)
+
+const usage = `usage: server [command]
+
+Without a command the server starts. The commands work on the database of the config directly, the server does not
+have to run:
+
+  user create <username> -first-name <name> -last-name <name> [-role <role>]... [-password-stdin]
+  user list [-offset <n>] [-limit <n>]
+  user disable <username>
+  user enable <username>
+  user reset-password <username> [-password-stdin]
+  role assign <username> <role>...
+  role revoke <username> <role>...
+  blog reindex
+  token mint <username> [-expiry <minutes>]
+
+Without -password-stdin a password is generated and printed. The roles are admin, editor and viewer, a created user
+without -role is an editor and a viewer like a registered one.
+`
+
+// the limits of bcrypt and of the registration
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// cli runs the admin commands against the repositories, with what it prints going to out
+type cli struct {
+	conf         *config.Config
+	repos        *repos
+	adminManager *usecases.AdminManager
+	in           io.Reader
+	out          io.Writer
+}
+
+// runCommand runs the command of the arguments, i.e. of everything after the program name
+func runCommand(ctx context.Context, conf *config.Config, args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(out, usage)
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("missing the subcommand of '%s'\n\n%s", args[0], usage)
+	}
+	run, ok := map[string]func(c *cli, ctx context.Context, args []string) error{
+		"user create":         (*cli).createUser,
+		"user list":           (*cli).listUsers,
+		"user disable":        func(c *cli, ctx context.Context, args []string) error { return c.setDisabled(ctx, args, true) },
+		"user enable":         func(c *cli, ctx context.Context, args []string) error { return c.setDisabled(ctx, args, false) },
+		"user reset-password": (*cli).resetPassword,
+		"role assign":         (*cli).assignRoles,
+		"role revoke":         (*cli).revokeRoles,
+		"blog reindex":        (*cli).reindexBlogs,
+		"token mint":          (*cli).mintToken,
+	}[args[0]+" "+args[1]]
+	if !ok {
+		return fmt.Errorf("unknown command '%s %s'\n\n%s", args[0], args[1], usage)
+	}
+
+	c, err := newCLI(ctx, conf, in, out)
+	if err != nil {
+		return err
+	}
+	return run(c, ctx, args[2:])
+}
+
+// newCLI connects to the database and brings its tables up to date, without creating the default user
+func newCLI(ctx context.Context, conf *config.Config, in io.Reader, out io.Writer) (*cli, error) {
+	authRepo := repositories.NewAuthRepo(conf)
+	repos, err := initRepos(ctx, conf, authRepo)
+	if err != nil {
+		return nil, err
+	}
+	err = usecases.NewDatabaseManager(conf, repos.tx, repos.database, repos.user).Migrate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate the database: %w", err)
+	}
+	return &cli{
+		conf:         conf,
+		repos:        repos,
+		adminManager: usecases.NewAdminManager(repos.tx, repos.user, repos.blog, authRepo),
+		in:           in,
+		out:          out,
+	}, nil
+}
+
+func (c *cli) createUser(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	firstName := flags.String("first-name", "", "the first name of the user")
+	lastName := flags.String("last-name", "", "the last name of the user")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from the first line of stdin")
+	var roles roleNames
+	flags.Var(&roles, "role", "a role of the user, can be repeated")
+	usernames, err := parseFlags(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	password, generated, err := c.password(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.adminManager.CreateUser(ctx, &domain.User{
+		Username:  usernames[0],
+		Password:  password,
+		FirstName: *firstName,
+		LastName:  *lastName,
+	}, roles...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "created user '%s' with the ID %d\n", user.Username, user.ID)
+	if generated {
+		fmt.Fprintf(c.out, "password: %s\n", password)
+	}
+	return nil
+}
+
+func (c *cli) listUsers(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("user list", flag.ContinueOnError)
+	offset := flags.Int("offset", 0, "the number of users to skip")
+	limit := flags.Int("limit", 100, "the most users to list")
+	if _, err := parseFlags(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	users, roles, err := c.adminManager.ListUsers(ctx, *offset, *limit)
+	if err != nil {
+		return err
+	}
+	writer := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tUSERNAME\tNAME\tROLES\tDISABLED\tCREATED")
+	for _, user := range users {
+		fmt.Fprintf(writer, "%d\t%s\t%s %s\t%s\t%t\t%s\n", user.ID, user.Username, user.FirstName, user.LastName,
+			strings.Join(roles[user.ID], ","), user.Disabled, user.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return writer.Flush()
+}
+
+func (c *cli) setDisabled(ctx context.Context, args []string, disabled bool) error {
+	name := "user enable"
+	if disabled {
+		name = "user disable"
+	}
+	usernames, err := parseFlags(flag.NewFlagSet(name, flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.adminManager.SetDisabled(ctx, usernames[0], disabled); err != nil {
+		return err
+	}
+	if disabled {
+		fmt.Fprintf(c.out, "disabled user '%s' and revoked the tokens it already has\n", usernames[0])
+	} else {
+		fmt.Fprintf(c.out, "enabled user '%s'\n", usernames[0])
+	}
+	return nil
+}
+
+func (c *cli) resetPassword(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from the first line of stdin")
+	usernames, err := parseFlags(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	password, generated, err := c.password(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	if err := c.adminManager.ResetPassword(ctx, usernames[0], password); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "reset the password of user '%s' and revoked the tokens it already has\n", usernames[0])
+	if generated {
+		fmt.Fprintf(c.out, "password: %s\n", password)
+	}
+	return nil
+}
+
+func (c *cli) assignRoles(ctx context.Context, args []string) error {
+	names, err := parseFlags(flag.NewFlagSet("role assign", flag.ContinueOnError), args, 2, -1)
+	if err != nil {
+		return err
+	}
+	if err := c.adminManager.AssignRoles(ctx, names[0], names[1:]...); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "assigned %s to user '%s'\n", strings.Join(names[1:], ", "), names[0])
+	return nil
+}
+
+func (c *cli) revokeRoles(ctx context.Context, args []string) error {
+	names, err := parseFlags(flag.NewFlagSet("role revoke", flag.ContinueOnError), args, 2, -1)
+	if err != nil {
+		return err
+	}
+	if err := c.adminManager.RevokeRoles(ctx, names[0], names[1:]...); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "revoked %s from user '%s' along with the tokens it already has\n", strings.Join(names[1:], ", "), names[0])
+	return nil
+}
+
+func (c *cli) reindexBlogs(ctx context.Context, args []string) error {
+	if _, err := parseFlags(flag.NewFlagSet("blog reindex", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+	count, err := c.adminManager.ReindexBlogs(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "reindexed %d blogs\n", count)
+	return nil
+}
+
+func (c *cli) mintToken(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("token mint", flag.ContinueOnError)
+	expiry := flags.Int("expiry", c.conf.Login.Expiry, "the minutes until the token expires")
+	usernames, err := parseFlags(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *expiry <= 0 {
+		return fmt.Errorf("the expiry must be at least a minute")
+	}
+
+	// the expiry of this token only, the auth repo reads it from the config
+	conf := *c.conf
+	conf.Login.Expiry = *expiry
+	adminManager := usecases.NewAdminManager(c.repos.tx, c.repos.user, c.repos.blog, repositories.NewAuthRepo(&conf))
+	token, err := adminManager.MintToken(ctx, usernames[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, token)
+	return nil
+}
+
+// password reads the password from the first line of the input, or generates one. The passwords are never taken from
+// the arguments, which end up in the shell history and the process list.
+func (c *cli) password(fromInput bool) (password string, generated bool, err error) {
+	if !fromInput {
+		random := make([]byte, 18)
+		if _, err := rand.Read(random); err != nil {
+			return "", false, fmt.Errorf("failed to generate a password: %w", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(random), true, nil
+	}
+
+	line, err := bufio.NewReader(c.in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", false, fmt.Errorf("failed to read the password: %w", err)
+	}
+	password = strings.TrimRight(line, "\r\n")
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", false, fmt.Errorf("the password must have %d to %d characters", minPasswordLength, maxPasswordLength)
+	}
+	return password, false, nil
+}
+
+// parseFlags parses the flags wherever they are among the arguments and returns the other arguments, of which there
+// have to be at least min and at most max, or any number with a negative max
+func parseFlags(flags *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+	flags.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, fmt.Errorf("%s: %w\n\n%s", flags.Name(), err, usage)
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		return nil, fmt.Errorf("%s: wrong number of arguments\n\n%s", flags.Name(), usage)
+	}
+	return positional, nil
+}
+
+// roleNames is a flag which can be repeated, each value can also have several roles separated by commas
+type roleNames []string
+
+func (r *roleNames) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *roleNames) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*r = append(*r, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/gateways/repositories"
+	"github.com/bipuldutta/blogzilla/usecases"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+func TestCommands(t *testing.T) {
+	ctx := context.Background()
+	conf := config.NewConfig()
+	conf.Storage.Driver = config.SQLiteDriver
+	conf.SQLite.Path = filepath.Join(t.TempDir(), "blogzilla.db")
+	run := func(stdin string, args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runCommand(ctx, conf, args, strings.NewReader(stdin), &out)
+		return out.String(), err
+	}
+
+	// the flags go before or after the username, the password never on the command line
+	out, err := run("a-long-password\n", "user", "create", "-role", "admin,editor", "root", "-first-name", "Root", "-last-name", "Admin", "-password-stdin")
+	if err != nil || out != "created user 'root' with the ID 1\n" {
+		t.Fatalf("expected root to be created, got %s %v", out, err)
+	}
+	if out, err := run("short\n", "user", "create", "other", "-first-name", "O", "-last-name", "O", "-password-stdin"); err == nil {
+		t.Errorf("expected a short password to be turned down, got %s", out)
+	}
+	out, err = run("", "user", "create", "bob", "-first-name", "Bob", "-last-name", "Builder")
+	generated := strings.TrimPrefix(strings.Split(out, "\n")[1], "password: ")
+	if err != nil || len(generated) < minPasswordLength {
+		t.Fatalf("expected bob to get a generated password, got %s %v", out, err)
+	}
+	var conflictErr *domain.ConflictError
+	if _, err := run("", "user", "create", "bob", "-first-name", "Bob", "-last-name", "Builder"); !errors.As(err, &conflictErr) {
+		t.Errorf("expected a conflict for a second bob, got %v", err)
+	}
+
+	// nothing else ran the initialization, so there is no default user
+	out, err = run("", "user", "list")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if err != nil || len(lines) != 3 || !strings.Contains(lines[1], "root") || !strings.Contains(lines[1], "admin,editor") ||
+		!strings.Contains(lines[2], "editor,viewer") || !strings.Contains(lines[2], "false") {
+		t.Fatalf("expected root and bob, got %s %v", out, err)
+	}
+
+	// a disabled user gets no token, neither by logging in nor minted
+	if _, err := run("", "user", "disable", "bob"); err != nil {
+		t.Fatalf("failed to disable bob: %v", err)
+	}
+	var forbiddenErr *domain.ForbiddenError
+	if _, err := run("", "token", "mint", "bob"); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected no token for a disabled user, got %v", err)
+	}
+	if _, err := run("", "user", "enable", "bob"); err != nil {
+		t.Fatalf("failed to enable bob: %v", err)
+	}
+
+	if _, err := run("", "role", "assign", "bob", "admin"); err != nil {
+		t.Fatalf("failed to assign the admin role: %v", err)
+	}
+	if _, err := run("", "role", "revoke", "bob", "editor", "viewer"); err != nil {
+		t.Fatalf("failed to revoke the roles: %v", err)
+	}
+	if _, err := run("", "role", "revoke", "bob", "viewer"); !errors.As(err, &conflictErr) {
+		t.Errorf("expected a conflict when revoking a role bob does not have, got %v", err)
+	}
+	repos, err := initRepos(ctx, conf, repositories.NewAuthRepo(conf))
+	if err != nil {
+		t.Fatalf("failed to open the database: %v", err)
+	}
+	authManager := usecases.NewAuthManager(conf, repos.user)
+	mint := func() string {
+		t.Helper()
+		out, err := run("", "token", "mint", "bob", "-expiry", "5")
+		if err != nil {
+			t.Fatalf("failed to mint a token: %v", err)
+		}
+		return strings.TrimSpace(out)
+	}
+	token := mint()
+	if userID, err := authManager.ValidateToken(ctx, token, utils.ManageSystemPermission); err != nil || userID != 2 {
+		t.Errorf("expected an admin token of bob, got %d %v", userID, err)
+	}
+
+	// a new password, disabling the user and revoking a role revoke the tokens the user already has
+	var unauthorizedErr *domain.UnauthorizedError
+	out, err = run("", "user", "reset-password", "bob")
+	if err != nil || !strings.HasPrefix(out, "reset the password of user 'bob' and revoked the tokens it already has\npassword: ") {
+		t.Errorf("expected a new generated password, got %s %v", out, err)
+	}
+	if _, err := authManager.Authenticate(ctx, token); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected the token to be revoked by the new password, got %v", err)
+	}
+	token = mint()
+	if out, err := run("", "user", "disable", "bob"); err != nil || out != "disabled user 'bob' and revoked the tokens it already has\n" {
+		t.Fatalf("failed to disable bob: %s %v", out, err)
+	}
+	if _, err := run("", "user", "enable", "bob"); err != nil {
+		t.Fatalf("failed to enable bob: %v", err)
+	}
+	if _, err := authManager.Authenticate(ctx, token); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected the token to stay revoked after bob is enabled again, got %v", err)
+	}
+	token = mint()
+	if out, err := run("", "role", "revoke", "bob", "admin"); err != nil || out != "revoked admin from user 'bob' along with the tokens it already has\n" {
+		t.Fatalf("failed to revoke the admin role: %s %v", out, err)
+	}
+	if _, err := authManager.Authenticate(ctx, token); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected the token to be revoked along with the role, got %v", err)
+	}
+	if _, err := authManager.Authenticate(ctx, mint()); err != nil {
+		t.Errorf("expected a new token to be valid, got %v", err)
+	}
+	if out, err := run("", "blog", "reindex"); err != nil || out != "reindexed 0 blogs\n" {
+		t.Errorf("expected the blogs to be reindexed, got %s %v", out, err)
+	}
+
+	var notFoundErr *domain.NotFoundError
+	if _, err := run("", "user", "disable", "nobody"); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown user, got %v", err)
+	}
+	for _, args := range [][]string{{"user"}, {"user", "delete", "bob"}, {"user", "disable"}, {"user", "list", "extra"}, {"user", "list", "-unknown"}} {
+		if _, err := run("", args...); err == nil || !strings.Contains(err.Error(), "usage:") {
+			t.Errorf("expected the usage for %v, got %v", args, err)
+		}
+	}
+	if out, err := run("", "help"); err != nil || out != usage {
+		t.Errorf("expected the usage, got %s %v", out, err)
+	}
+}
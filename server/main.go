@@ -3,19 +3,29 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/bipuldutta/blogzilla/api"
 	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/gateways/blobs"
+	"github.com/bipuldutta/blogzilla/gateways/cache"
+	"github.com/bipuldutta/blogzilla/gateways/imaging"
+	"github.com/bipuldutta/blogzilla/gateways/ratelimit"
+	"github.com/bipuldutta/blogzilla/gateways/render"
 	"github.com/bipuldutta/blogzilla/gateways/repositories"
+	"github.com/bipuldutta/blogzilla/gateways/sqlite"
 	"github.com/bipuldutta/blogzilla/usecases"
 	"github.com/bipuldutta/blogzilla/utils"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 	_ "github.com/lib/pq"
+	"github.com/sirupsen/logrus"
 )
 
 // Create a new instance of the logger. You can have any number of instances.
-var logger = *utils.Logger()
+var logger = utils.Logger()
 
 /*
 This is the main file where our web service will start
@@ -25,26 +35,76 @@ func main() {
 
 	// Read the config
 	conf := config.NewConfig()
-	dbPool, err := initDB(ctx, conf.Postgres)
+	err := utils.ConfigureLogger(conf.Logging)
 	if err != nil {
-		logger.Fatal(err)
+		logger.WithError(err).Fatal("failed to configure logging")
+	}
+	// the admin commands print their results, the logs stay out of the way on stderr
+	if len(os.Args) > 1 {
+		logger.SetOutput(os.Stderr)
+		logger.SetLevel(logrus.WarnLevel)
+		if err := runCommand(ctx, conf, os.Args[1:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	shutdownTracer, err := utils.InitTracer(ctx, conf.Tracing)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to initialize tracing")
 	}
+	defer shutdownTracer(ctx)
+
 	authRepo := repositories.NewAuthRepo(conf)
-	authManager := usecases.NewAuthManager(conf)
-	userRepo := repositories.NewUserRepo(conf, dbPool, authRepo)
-	userManager := usecases.NewUserManager(userRepo)
-	databaseRepo := repositories.NewDatabaseRepo(conf, dbPool, userRepo)
-	databaseManager := usecases.NewDatabaseManager(databaseRepo)
-	blogRepo := repositories.NewBlogRepo(conf, dbPool)
-	blogManager := usecases.NewBlogManager(blogRepo)
+	repos, err := initRepos(ctx, conf, authRepo)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	authManager := usecases.NewAuthManager(conf, repos.user)
+	err = cacheBlogs(ctx, conf, repos)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	userManager := usecases.NewUserManager(repos.tx, repos.user)
+	databaseManager := usecases.NewDatabaseManager(conf, repos.tx, repos.database, repos.user)
+	renderer := newRenderer(conf)
+	blogManager := usecases.NewBlogManager(repos.tx, repos.blog, repos.user, repos.reaction, renderer)
+	commentManager := usecases.NewCommentManager(conf, repos.tx, repos.blog, repos.comment)
+	reactionManager := usecases.NewReactionManager(conf, repos.blog, repos.reaction)
+	followManager := usecases.NewFollowManager(repos.user, repos.follow)
+	syndicationManager := usecases.NewSyndicationManager(conf, repos.user, repos.blog, renderer)
+	blobStore, err := newBlobStore(ctx, conf)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	mediaManager := usecases.NewMediaManager(conf, repos.tx, repos.blog, repos.media, blobStore, imaging.NewProcessor(conf.Media.Variants.Quality, conf.Media.MaxPixels))
+	idempotencyManager := usecases.NewIdempotencyManager(conf, repos.idempotency)
+	rateLimiter, err := newRateLimiter(ctx, conf)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	// attempt initializing database tables and default roles, users etc.
 	err = databaseManager.Initialize(ctx)
 	if err != nil {
 		logger.WithError(err).Fatalf("failed to initialize database tables, roles, default user etc.")
 	}
+	// the blogs from before the slugs, only the first start after the upgrade finds any
+	assigned, err := blogManager.AssignMissingSlugs(ctx)
+	if err != nil {
+		logger.WithError(err).Fatalf("failed to assign the slugs of the existing blogs")
+	}
+	if assigned > 0 {
+		logger.Infof("assigned slugs to %d existing blogs", assigned)
+	}
+	if conf.Media.CleanupMinutes > 0 {
+		go cleanup(ctx, "orphaned media", mediaManager.CleanupOrphans, time.Duration(conf.Media.CleanupMinutes)*time.Minute)
+	}
+	if conf.Idempotency.CleanupMinutes > 0 {
+		go cleanup(ctx, "expired idempotent requests", idempotencyManager.CleanupExpired, time.Duration(conf.Idempotency.CleanupMinutes)*time.Minute)
+	}
 
-	webService := api.NewWebService(conf, authManager, userManager, blogManager)
+	webService := api.NewWebService(conf, authManager, userManager, blogManager, commentManager, reactionManager, followManager, syndicationManager, mediaManager, idempotencyManager, rateLimiter)
 	err = webService.Start()
 	if err != nil {
 		logger.WithError(err).Fatalf("failed to start server")
@@ -53,9 +113,150 @@ func main() {
 	fmt.Println(conf.Postgres.Database)
 }
 
+// newRenderer renders the blog contents, behind a cache unless it is turned off
+func newRenderer(conf *config.Config) domain.ContentRenderer {
+	renderer := render.NewRenderer()
+	if conf.Render.CacheSize > 0 {
+		renderer = render.NewCachedRenderer(renderer, conf.Render.CacheSize)
+	}
+	return renderer
+}
+
+// newBlobStore keeps the uploaded media where the media.store config says
+func newBlobStore(ctx context.Context, conf *config.Config) (domain.BlobStore, error) {
+	switch conf.Media.Store {
+	case config.LocalBlobStore, "":
+		logger.Printf("keeping the media in %s", conf.Media.Local.Dir)
+		return blobs.NewLocalStore(conf.Media.Local.Dir)
+	case config.S3BlobStore:
+		logger.Printf("keeping the media in the s3 bucket %s at %s", conf.Media.S3.Bucket, conf.Media.S3.Endpoint)
+		return blobs.NewS3Store(ctx, conf.Media.S3)
+	}
+	return nil, fmt.Errorf("unknown media store '%s'", conf.Media.Store)
+}
+
+// cacheBlogs reads the blogs through the cache when it is enabled, the transactions see to it that the changes they
+// made are not left in the cache
+func cacheBlogs(ctx context.Context, conf *config.Config, repos *repos) error {
+	if !conf.Cache.Enabled {
+		return nil
+	}
+	var blogCache domain.Cache
+	switch conf.Cache.Store {
+	case config.MemoryCacheStore, "":
+		blogCache = cache.NewMemoryCache(conf.Cache.Size)
+	case config.RedisCacheStore:
+		logger.Printf("caching the blogs in the redis at %s", conf.Redis.Addr)
+		var err error
+		blogCache, err = cache.NewRedisCache(ctx, conf.Redis)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown cache store '%s'", conf.Cache.Store)
+	}
+	repos.tx = cache.NewTxManager(repos.tx, blogCache)
+	repos.blog = cache.NewCachedBlogRepo(repos.blog, blogCache, time.Duration(conf.Cache.TTLSeconds)*time.Second,
+		time.Duration(conf.Cache.SearchTTLSeconds)*time.Second)
+	return nil
+}
+
+// newRateLimiter keeps the buckets of the rate limits where the ratelimit.store config says, none when they are off
+func newRateLimiter(ctx context.Context, conf *config.Config) (domain.RateLimiter, error) {
+	if !conf.RateLimit.Enabled {
+		return nil, nil
+	}
+	switch conf.RateLimit.Store {
+	case config.MemoryRateLimitStore, "":
+		return ratelimit.NewMemoryLimiter(), nil
+	case config.RedisRateLimitStore:
+		logger.Printf("keeping the rate limits in the redis at %s", conf.Redis.Addr)
+		return ratelimit.NewRedisLimiter(ctx, conf.Redis)
+	}
+	return nil, fmt.Errorf("unknown rate limit store '%s'", conf.RateLimit.Store)
+}
+
+// cleanup runs the cleanup of what every interval, a failed run is retried on the next one
+func cleanup(ctx context.Context, what string, run func(ctx context.Context) (int, error), interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := run(ctx)
+			if err != nil {
+				logger.WithError(err).Errorf("failed to clean up the %s", what)
+			} else if deleted > 0 {
+				logger.Infof("deleted %d %s", deleted, what)
+			}
+		}
+	}
+}
+
+// repos is the storage specific part of the application, selected by the storage.driver config
+type repos struct {
+	tx          domain.TxManager
+	user        domain.UserRepo
+	blog        domain.BlogRepo
+	comment     domain.CommentRepo
+	reaction    domain.ReactionRepo
+	follow      domain.FollowRepo
+	media       domain.MediaRepo
+	idempotency domain.IdempotencyRepo
+	database    domain.DatabaseRepo
+}
+
+func initRepos(ctx context.Context, conf *config.Config, authRepo domain.AuthRepo) (*repos, error) {
+	switch conf.Storage.Driver {
+	case config.PostgresDriver, "":
+		dbPool, err := initDB(ctx, conf.Postgres)
+		if err != nil {
+			return nil, err
+		}
+		return &repos{
+			tx:          repositories.NewTxManager(dbPool),
+			user:        repositories.NewUserRepo(conf, dbPool, authRepo),
+			blog:        repositories.NewBlogRepo(conf, dbPool),
+			comment:     repositories.NewCommentRepo(conf, dbPool),
+			reaction:    repositories.NewReactionRepo(conf, dbPool),
+			follow:      repositories.NewFollowRepo(conf, dbPool),
+			media:       repositories.NewMediaRepo(conf, dbPool),
+			idempotency: repositories.NewIdempotencyRepo(conf, dbPool),
+			database:    repositories.NewDatabaseRepo(conf, dbPool),
+		}, nil
+	case config.SQLiteDriver:
+		db, err := sqlite.Open(conf.SQLite.Path)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("using sqlite database %s", conf.SQLite.Path)
+		return &repos{
+			tx:          sqlite.NewTxManager(db),
+			user:        sqlite.NewUserRepo(conf, db, authRepo),
+			blog:        sqlite.NewBlogRepo(conf, db),
+			comment:     sqlite.NewCommentRepo(conf, db),
+			reaction:    sqlite.NewReactionRepo(conf, db),
+			follow:      sqlite.NewFollowRepo(conf, db),
+			media:       sqlite.NewMediaRepo(conf, db),
+			idempotency: sqlite.NewIdempotencyRepo(conf, db),
+			database:    sqlite.NewDatabaseRepo(conf, db),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown storage driver '%s'", conf.Storage.Driver)
+}
+
 func initDB(ctx context.Context, config config.PostgresConfig) (*pgxpool.Pool, error) {
 	connString := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", config.User, config.Password, config.Host, config.Port, config.Database)
-	dbpool, err := pgxpool.Connect(ctx, connString)
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database config: %v", err)
+	}
+	// every query gets its own span
+	poolConfig.ConnConfig.Logger = repositories.NewQueryTracer()
+
+	dbpool, err := pgxpool.ConnectConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %v", err)
 	}
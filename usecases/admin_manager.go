@@ -0,0 +1,200 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+/*
+AdminManager is the business logic of the operator commands of the server binary, which work on the repositories
+directly rather than through the API and its tokens, e.g. to create the first admin of an instance or to let a locked
+out one back in. The users are given by their usernames.
+*/
+type AdminManager struct {
+	txManager domain.TxManager
+	userRepo  domain.UserRepo
+	blogRepo  domain.BlogRepo
+	authRepo  domain.AuthRepo
+}
+
+func NewAdminManager(txManager domain.TxManager, userRepo domain.UserRepo, blogRepo domain.BlogRepo, authRepo domain.AuthRepo) *AdminManager {
+	return &AdminManager{
+		txManager: txManager,
+		userRepo:  userRepo,
+		blogRepo:  blogRepo,
+		authRepo:  authRepo,
+	}
+}
+
+// CreateUser creates the user along with the roles, without roles the user gets the ones of a registration
+func (m *AdminManager) CreateUser(ctx context.Context, newUser *domain.User, roleNames ...string) (user *domain.User, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "AdminManager.CreateUser")
+	defer func() { utils.EndSpan(span, err) }()
+
+	if err := validateNewUser(newUser); err != nil {
+		return nil, err
+	}
+	if len(roleNames) == 0 {
+		roleNames = []string{utils.EditorRole, utils.ViewerRole}
+	}
+	hashedUser, err := withHashedPassword(ctx, newUser)
+	if err != nil {
+		return nil, err
+	}
+	err = m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		user, err = m.userRepo.Create(ctx, hashedUser)
+		if err != nil {
+			return err
+		}
+		return assignRoles(ctx, m.userRepo, user.ID, roleNames...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUser is a not found error for an unknown username
+func (m *AdminManager) GetUser(ctx context.Context, username string) (user *domain.User, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "AdminManager.GetUser")
+	defer func() { utils.EndSpan(span, err) }()
+
+	user, err = m.userRepo.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.NewNotFoundError("user", username)
+	}
+	return user, nil
+}
+
+// ListUsers returns a page of the users and the names of their roles by user ID
+func (m *AdminManager) ListUsers(ctx context.Context, offset int, limit int) (users []*domain.User, roles map[int64][]string, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "AdminManager.ListUsers")
+	defer func() { utils.EndSpan(span, err) }()
+
+	users, err = m.userRepo.ListUsers(ctx, offset, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	roles = make(map[int64][]string, len(users))
+	for _, user := range users {
+		roles[user.ID], err = m.userRepo.GetUserRoles(ctx, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return users, roles, nil
+}
+
+// SetDisabled a disabled user can not log in anymore and the tokens it has are revoked, enabling it again does not
+// bring them back
+func (m *AdminManager) SetDisabled(ctx context.Context, username string, disabled bool) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "AdminManager.SetDisabled")
+	defer func() { utils.EndSpan(span, err) }()
+
+	return m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := m.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+		if err := m.userRepo.SetDisabled(ctx, user.ID, disabled); err != nil || !disabled {
+			return err
+		}
+		return m.userRepo.RevokeTokens(ctx, user.ID)
+	})
+}
+
+// ResetPassword revokes the tokens the user has, they may have been issued to whoever knew the old password
+func (m *AdminManager) ResetPassword(ctx context.Context, username string, password string) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "AdminManager.ResetPassword")
+	defer func() { utils.EndSpan(span, err) }()
+
+	if password == "" {
+		return domain.NewValidationError(domain.FieldError{Field: "password", Code: "required", Message: "must not be empty"})
+	}
+	hashedPassword, err := utils.HashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+	return m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := m.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+		if err := m.userRepo.SetPassword(ctx, user.ID, hashedPassword); err != nil {
+			return err
+		}
+		return m.userRepo.RevokeTokens(ctx, user.ID)
+	})
+}
+
+// AssignRoles gives the roles to the user, either all of them or none
+func (m *AdminManager) AssignRoles(ctx context.Context, username string, roleNames ...string) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "AdminManager.AssignRoles")
+	defer func() { utils.EndSpan(span, err) }()
+
+	return m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := m.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+		return assignRoles(ctx, m.userRepo, user.ID, roleNames...)
+	})
+}
+
+// RevokeRoles takes the roles from the user, either all of them or none. The tokens the user has are revoked, as they
+// carry the permissions of the roles.
+func (m *AdminManager) RevokeRoles(ctx context.Context, username string, roleNames ...string) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "AdminManager.RevokeRoles")
+	defer func() { utils.EndSpan(span, err) }()
+
+	return m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := m.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+		ids, err := roleIDs(ctx, m.userRepo, roleNames...)
+		if err != nil {
+			return err
+		}
+		if err := m.userRepo.RevokeRoles(ctx, user.ID, ids...); err != nil {
+			return err
+		}
+		return m.userRepo.RevokeTokens(ctx, user.ID)
+	})
+}
+
+// MintToken issues a token of the user with the permissions of its roles, like a login without the password
+func (m *AdminManager) MintToken(ctx context.Context, username string) (token string, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "AdminManager.MintToken")
+	defer func() { utils.EndSpan(span, err) }()
+
+	user, err := m.GetUser(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	if user.Disabled {
+		return "", domain.NewForbiddenError("the user is disabled")
+	}
+	permissions, err := m.userRepo.GetPermissions(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	return m.authRepo.GetToken(ctx, user.ID, user.TokenVersion, permissions)
+}
+
+// ReindexBlogs rebuilds the search index of the blogs and returns how many blogs there are
+func (m *AdminManager) ReindexBlogs(ctx context.Context) (count int, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "AdminManager.ReindexBlogs")
+	defer func() { utils.EndSpan(span, err) }()
+
+	err = m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		count, err = m.blogRepo.Reindex(ctx)
+		return err
+	})
+	return count, err
+}
@@ -0,0 +1,176 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+func TestAdminManager(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+	adminManager := NewAdminManager(repos.Tx, repos.Users, repos.Blogs, repos.Auth)
+
+	owner, err := adminManager.CreateUser(ctx, &domain.User{Username: "olga", Password: "first-password", FirstName: "Olga", LastName: "Owner"}, utils.AdminRole)
+	if err != nil {
+		t.Fatalf("failed to create olga: %v", err)
+	}
+	createUser(t, repos, "oscar")
+	if roles, err := repos.Users.GetUserRoles(ctx, owner.ID); err != nil || fmt.Sprint(roles) != fmt.Sprint([]string{utils.AdminRole}) {
+		t.Errorf("expected olga to be an admin only, got %v, %v", roles, err)
+	}
+	var validationErr *domain.ValidationError
+	if _, err := adminManager.CreateUser(ctx, &domain.User{Username: "", Password: "secret"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for a user without a username, got %v", err)
+	}
+	var notFoundErr *domain.NotFoundError
+	if _, err := adminManager.CreateUser(ctx, &domain.User{Username: "otto", Password: "secret", FirstName: "Otto", LastName: "Other"}, "nobody"); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown role, got %v", err)
+	}
+	if user, err := repos.Users.GetUserByUsername(ctx, "otto"); err != nil || user != nil {
+		t.Errorf("expected otto not to be created without the role, got %+v, %v", user, err)
+	}
+
+	// ordered by ID, after the default user
+	users, roles, err := adminManager.ListUsers(ctx, 1, 10)
+	if err != nil || len(users) != 2 || users[0].ID != owner.ID || users[1].Username != "oscar" ||
+		fmt.Sprint(roles[users[1].ID]) != fmt.Sprint([]string{utils.EditorRole, utils.ViewerRole}) {
+		t.Fatalf("expected olga and oscar, got %+v %v, %v", users, roles, err)
+	}
+	if users, err := repos.Users.ListUsers(ctx, 3, 10); err != nil || len(users) != 0 {
+		t.Errorf("expected no users past the end, got %+v, %v", users, err)
+	}
+
+	// a disabled user can not log in, not even with the right password
+	var forbiddenErr *domain.ForbiddenError
+	if err := adminManager.SetDisabled(ctx, "oscar", true); err != nil {
+		t.Fatalf("failed to disable oscar: %v", err)
+	}
+	if _, err := repos.Users.Login(ctx, "oscar", "secret-oscar"); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected a forbidden error for a disabled user, got %v", err)
+	}
+	var unauthorizedErr *domain.UnauthorizedError
+	if _, err := repos.Users.Login(ctx, "oscar", "wrong"); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected an unauthorized error for a wrong password of a disabled user, got %v", err)
+	}
+	if _, err := adminManager.MintToken(ctx, "oscar"); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected no token for a disabled user, got %v", err)
+	}
+	if user, err := adminManager.GetUser(ctx, "oscar"); err != nil || !user.Disabled {
+		t.Errorf("expected oscar to be disabled, got %+v, %v", user, err)
+	}
+	if err := adminManager.SetDisabled(ctx, "oscar", false); err != nil {
+		t.Fatalf("failed to enable oscar: %v", err)
+	}
+	assertPermissions(t, conf, repos, "oscar", "secret-oscar", []string{utils.CreateBlogPermission}, nil)
+	if err := adminManager.SetDisabled(ctx, "nobody", true); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown user, got %v", err)
+	}
+
+	// the new password is hashed and replaces the old one
+	if err := adminManager.ResetPassword(ctx, "olga", "second-password"); err != nil {
+		t.Fatalf("failed to reset the password: %v", err)
+	}
+	if user, err := adminManager.GetUser(ctx, "olga"); err != nil || user.Password == "second-password" {
+		t.Errorf("expected the password to be stored hashed, got %+v, %v", user, err)
+	}
+	if _, err := repos.Users.Login(ctx, "olga", "first-password"); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected the old password to be rejected, got %v", err)
+	}
+	assertPermissions(t, conf, repos, "olga", "second-password", []string{utils.ManageSystemPermission}, nil)
+
+	// the roles come and go all or nothing
+	if err := adminManager.AssignRoles(ctx, "olga", utils.EditorRole); err != nil {
+		t.Fatalf("failed to assign the editor role: %v", err)
+	}
+	var conflictErr *domain.ConflictError
+	if err := adminManager.RevokeRoles(ctx, "olga", utils.EditorRole, utils.ViewerRole); !errors.As(err, &conflictErr) {
+		t.Errorf("expected a conflict when revoking a role olga does not have, got %v", err)
+	}
+	if roles, err := repos.Users.GetUserRoles(ctx, owner.ID); err != nil || fmt.Sprint(roles) != fmt.Sprint([]string{utils.AdminRole, utils.EditorRole}) {
+		t.Errorf("expected olga to keep both roles, got %v, %v", roles, err)
+	}
+	if err := adminManager.RevokeRoles(ctx, "olga", utils.AdminRole); err != nil {
+		t.Fatalf("failed to revoke the admin role: %v", err)
+	}
+	permissions, err := repos.Users.GetPermissions(ctx, owner.ID)
+	_, editor := permissions[utils.CreateBlogPermission]
+	_, admin := permissions[utils.ManageSystemPermission]
+	if err != nil || !editor || admin {
+		t.Errorf("expected the permissions of an editor only, got %v, %v", permissions, err)
+	}
+
+	// a minted token carries the permissions of the roles
+	token, err := adminManager.MintToken(ctx, "olga")
+	if err != nil {
+		t.Fatalf("failed to mint a token: %v", err)
+	}
+	authManager := NewAuthManager(conf, repos.Users)
+	if userID, err := authManager.ValidateToken(ctx, token, utils.CreateBlogPermission); err != nil || userID != owner.ID {
+		t.Errorf("expected a token of olga, got %d, %v", userID, err)
+	}
+	if _, err := authManager.ValidateToken(ctx, token, utils.ManageSystemPermission); err == nil {
+		t.Errorf("expected the minted token not to have the revoked permissions")
+	}
+
+	// the tokens of a disabled user are turned down while it is disabled
+	if err := repos.Users.SetDisabled(ctx, owner.ID, true); err != nil {
+		t.Fatalf("failed to disable olga: %v", err)
+	}
+	if _, err := authManager.Authenticate(ctx, token); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected the token of a disabled user to be unauthorized, got %v", err)
+	}
+	if err := repos.Users.SetDisabled(ctx, owner.ID, false); err != nil {
+		t.Fatalf("failed to enable olga: %v", err)
+	}
+	if _, err := authManager.Authenticate(ctx, token); err != nil {
+		t.Errorf("expected the token to be valid again, got %v", err)
+	}
+
+	// disabling the user, resetting the password and revoking a role revoke the tokens the user already has
+	if err := adminManager.AssignRoles(ctx, "olga", utils.ViewerRole); err != nil {
+		t.Fatalf("failed to assign the viewer role: %v", err)
+	}
+	for name, revoke := range map[string]func() error{
+		"disabled": func() error {
+			if err := adminManager.SetDisabled(ctx, "olga", true); err != nil {
+				return err
+			}
+			// enabling the user again does not bring the tokens back
+			return adminManager.SetDisabled(ctx, "olga", false)
+		},
+		"password reset": func() error { return adminManager.ResetPassword(ctx, "olga", "third-password") },
+		"role revoked":   func() error { return adminManager.RevokeRoles(ctx, "olga", utils.ViewerRole) },
+	} {
+		token, err := adminManager.MintToken(ctx, "olga")
+		if err != nil {
+			t.Fatalf("failed to mint a token: %v", err)
+		}
+		if err := revoke(); err != nil {
+			t.Fatalf("%s: failed to revoke the tokens: %v", name, err)
+		}
+		if _, err := authManager.Authenticate(ctx, token); !errors.As(err, &unauthorizedErr) {
+			t.Errorf("%s: expected the token to be revoked, got %v", name, err)
+		}
+		if token, err := adminManager.MintToken(ctx, "olga"); err != nil {
+			t.Errorf("%s: failed to mint a new token: %v", name, err)
+		} else if _, err := authManager.Authenticate(ctx, token); err != nil {
+			t.Errorf("%s: expected a new token to be valid, got %v", name, err)
+		}
+	}
+
+	// the search still finds the blogs after the reindex
+	if _, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: owner.ID, Title: "Reindexed", Content: "still searchable"}); err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	if count, err := adminManager.ReindexBlogs(ctx); err != nil || count != 1 {
+		t.Fatalf("expected one blog to be reindexed, got %d, %v", count, err)
+	}
+	if blogs, err := repos.Blogs.Search(ctx, domain.BlogAccess{UserID: owner.ID}, 0, 10, "searchable"); err != nil || len(blogs) != 1 {
+		t.Errorf("expected the blog to be found after the reindex, got %+v, %v", blogs, err)
+	}
+}
@@ -1,54 +1,87 @@
 package usecases
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	"github.com/bipuldutta/blogzilla/config"
 	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AuthManager checks the tokens, the signature and the expiry as well as the user, whose tokens are revoked when it
+// is disabled or its token version is bumped
 type AuthManager struct {
-	conf *config.Config
+	conf     *config.Config
+	userRepo domain.UserRepo
 }
 
-func NewAuthManager(conf *config.Config) *AuthManager {
+func NewAuthManager(conf *config.Config, userRepo domain.UserRepo) *AuthManager {
 	return &AuthManager{
-		conf: conf,
+		conf:     conf,
+		userRepo: userRepo,
 	}
 }
 
-func (m *AuthManager) ValidateToken(tokenString string, permission string) (int64, error) {
+func (m *AuthManager) ValidateToken(ctx context.Context, tokenString string, permission string) (int64, error) {
+	viewer, err := m.Authenticate(ctx, tokenString)
+	if err != nil {
+		return -1, err
+	}
+
+	// Verify the permission.
+	if !viewer.HasPermission(permission) {
+		return -1, domain.NewForbiddenError("user does not have permission")
+	}
+
+	return viewer.UserID, nil
+}
+
+// Authenticate returns the user of a valid token along with the user's permissions. The token of a disabled user, of
+// a user which no longer exists or of an older token version is unauthorized.
+func (m *AuthManager) Authenticate(ctx context.Context, tokenString string) (viewer *domain.Viewer, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "AuthManager.Authenticate")
+	defer func() { utils.EndSpan(span, err) }()
+
 	// Parse the token without verifying the signature.
 	token, err := jwt.ParseWithClaims(tokenString, &domain.CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(m.conf.Login.Secret), nil
 	})
 	if err != nil {
-		return -1, fmt.Errorf("failed to parse token: %w", err)
+		// Verify the token signature and expiration.
+		if errors.Is(err, jwt.ErrTokenMalformed) {
+			return nil, domain.NewUnauthorizedError("malformed token")
+		} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			// Invalid signature
+			return nil, domain.NewUnauthorizedError("invalid signature")
+		} else if errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet) {
+			// Token is either expired or not active yet
+			return nil, domain.NewUnauthorizedError("expired or inactive token")
+		}
+		return nil, domain.NewUnauthorizedError(fmt.Sprintf("failed to parse token: %v", err))
 	}
-
-	// Verify the token signature, expiration, and permission.
 	if !token.Valid {
-		return -1, fmt.Errorf("invalid token")
-	} else if errors.Is(err, jwt.ErrTokenMalformed) {
-		return -1, fmt.Errorf("malformed token")
-	} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
-		// Invalid signature
-		return -1, fmt.Errorf("invalid signature")
-	} else if errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet) {
-		// Token is either expired or not active yet
-		return -1, fmt.Errorf("expired or inactive token")
+		return nil, domain.NewUnauthorizedError("invalid token")
 	}
 
 	claims, ok := token.Claims.(*domain.CustomClaims)
 	if !ok {
-		return -1, fmt.Errorf("invalid token claims")
+		return nil, domain.NewUnauthorizedError("invalid token claims")
 	}
 
-	if !claims.HasPermission(permission) {
-		return -1, fmt.Errorf("user does not have permission")
+	user, err := m.userRepo.GetUserByID(ctx, claims.UserID)
+	var notFoundErr *domain.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil, domain.NewUnauthorizedError("the user no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled || user.TokenVersion != claims.TokenVersion {
+		return nil, domain.NewUnauthorizedError("revoked token")
 	}
 
-	return claims.UserID, nil
+	return &domain.Viewer{UserID: claims.UserID, Permissions: claims.Permissions}, nil
 }
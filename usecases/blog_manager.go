@@ -2,12 +2,23 @@ package usecases
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/bipuldutta/blogzilla/domain"
 	"github.com/bipuldutta/blogzilla/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var blogLogger = *utils.Logger()
+var blogLogger = utils.Logger()
+
+// MaxFeedLimit is the largest page of a feed
+const MaxFeedLimit = 100
+
+// untitledSlug is the slug of a title with nothing to transliterate, e.g. only emojis
+const untitledSlug = "untitled"
 
 /*
 BlogManager is the actual business logic section for managing all blog related transactions
@@ -15,23 +26,340 @@ while this is a skeleton and just making calls to the repo layer at this time th
 actual BL we could implement at some point
 */
 type BlogManager struct {
-	blogRepo domain.BlogRepo
+	txManager    domain.TxManager
+	blogRepo     domain.BlogRepo
+	userRepo     domain.UserRepo
+	reactionRepo domain.ReactionRepo
+	renderer     domain.ContentRenderer
 }
 
-func NewBlogManager(blogRepo domain.BlogRepo) *BlogManager {
-	return &BlogManager{blogRepo: blogRepo}
+func NewBlogManager(txManager domain.TxManager, blogRepo domain.BlogRepo, userRepo domain.UserRepo, reactionRepo domain.ReactionRepo, renderer domain.ContentRenderer) *BlogManager {
+	return &BlogManager{
+		txManager:    txManager,
+		blogRepo:     blogRepo,
+		userRepo:     userRepo,
+		reactionRepo: reactionRepo,
+		renderer:     renderer,
+	}
 }
 
-func (m *BlogManager) Create(ctx context.Context, newBlog *domain.Blog) (int64, error) {
+func (m *BlogManager) Create(ctx context.Context, newBlog *domain.Blog) (blogID int64, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "BlogManager.Create")
+	defer func() { utils.EndSpan(span, err) }()
+
 	// TODO figure out what to validate about the blog data
-	return m.blogRepo.Create(ctx, newBlog)
+	validationErr := domain.NewValidationError()
+	if newBlog.Visibility == "" {
+		newBlog.Visibility = domain.DefaultVisibility
+	} else if !newBlog.Visibility.IsValid() {
+		validationErr.Add("visibility", "invalid", "must be one of public, unlisted, members-only or private")
+	}
+	if newBlog.ContentFormat == "" {
+		newBlog.ContentFormat = domain.DefaultContentFormat
+	} else if !newBlog.ContentFormat.IsValid() {
+		validationErr.Add("contentFormat", "invalid", "must be one of markdown, html or plaintext")
+	}
+	if newBlog.Status == "" {
+		newBlog.Status = domain.DefaultStatus
+	} else if !newBlog.Status.IsValid() {
+		validationErr.Add("status", "invalid", "must be one of draft or published")
+	}
+	if err := validationErr.OrNil(); err != nil {
+		return -1, err
+	}
+	// the blog and its slug, all or nothing
+	err = m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		blogID, err = m.blogRepo.Create(ctx, newBlog)
+		if err != nil {
+			return err
+		}
+		return m.assignSlug(ctx, blogID, newBlog.Title)
+	})
+	if err != nil {
+		return -1, err
+	}
+	return blogID, nil
+}
+
+// Update changes the title, the content and the tags of the user's own blog, and its status, its visibility and the
+// format of its content when they are given.
+// A new title gives the blog a new slug, the previous one keeps leading to the blog.
+func (m *BlogManager) Update(ctx context.Context, userID int64, changes *domain.Blog) (blog *domain.Blog, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "BlogManager.Update", trace.WithAttributes(attribute.Int64("blog.id", changes.ID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	validationErr := domain.NewValidationError()
+	if changes.Visibility != "" && !changes.Visibility.IsValid() {
+		validationErr.Add("visibility", "invalid", "must be one of public, unlisted, members-only or private")
+	}
+	if changes.ContentFormat != "" && !changes.ContentFormat.IsValid() {
+		validationErr.Add("contentFormat", "invalid", "must be one of markdown, html or plaintext")
+	}
+	if changes.Status != "" && !changes.Status.IsValid() {
+		validationErr.Add("status", "invalid", "must be one of draft or published")
+	}
+	if err := validationErr.OrNil(); err != nil {
+		return nil, err
+	}
+
+	err = m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		stored, err := m.blogRepo.Get(ctx, changes.ID)
+		if err != nil {
+			return err
+		}
+		if stored.UserID != userID {
+			return domain.NewForbiddenError("only the author of the blog can change it")
+		}
+		err = m.blogRepo.Update(ctx, changes)
+		if err != nil {
+			return err
+		}
+		if changes.Title == stored.Title && stored.Slug != "" {
+			return nil
+		}
+		return m.assignSlug(ctx, changes.ID, changes.Title)
+	})
+	if err != nil {
+		return nil, err
+	}
+	blog, err = m.blogRepo.Get(ctx, changes.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = m.complete(ctx, blog)
+	if err != nil {
+		return nil, err
+	}
+	return blog, nil
+}
+
+// GetBySlug returns the blog with the slug when the viewer can read it. The slug may be one the blog had before
+// its title changed, the caller compares it with blog.Slug to send the reader to the current one.
+func (m *BlogManager) GetBySlug(ctx context.Context, viewer *domain.Viewer, slug string) (blog *domain.Blog, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "BlogManager.GetBySlug", trace.WithAttributes(attribute.String("blog.slug", slug)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	blog, err = m.blogRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	err = checkReadable(viewer, blog, slug)
+	if err != nil {
+		return nil, err
+	}
+	err = m.complete(ctx, blog)
+	if err != nil {
+		return nil, err
+	}
+	return blog, nil
+}
+
+// AssignMissingSlugs gives a slug to every blog created before there were slugs, it returns how many it changed
+func (m *BlogManager) AssignMissingSlugs(ctx context.Context) (assigned int, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "BlogManager.AssignMissingSlugs")
+	defer func() { utils.EndSpan(span, err) }()
+
+	for {
+		blogs, err := m.blogRepo.WithoutSlug(ctx, MaxFeedLimit)
+		if err != nil {
+			return assigned, err
+		}
+		if len(blogs) == 0 {
+			return assigned, nil
+		}
+		for _, blog := range blogs {
+			err = m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+				return m.assignSlug(ctx, blog.ID, blog.Title)
+			})
+			if err != nil {
+				return assigned, err
+			}
+			assigned++
+		}
+	}
+}
+
+// assignSlug makes the slug of the title the current one of the blog. When another blog has (or had) it, the first
+// free one of slug-2, slug-3 and so on is taken.
+func (m *BlogManager) assignSlug(ctx context.Context, blogID int64, title string) error {
+	base := utils.Slugify(title)
+	if base == "" {
+		base = untitledSlug
+	}
+	slug := base
+	for suffix := 2; ; suffix++ {
+		err := m.blogRepo.SetSlug(ctx, blogID, slug)
+		var conflictErr *domain.ConflictError
+		if !errors.As(err, &conflictErr) {
+			return err
+		}
+		slug = fmt.Sprintf("%s-%d", base, suffix)
+	}
+}
+
+// Get returns the blog when the viewer can read it
+func (m *BlogManager) Get(ctx context.Context, viewer *domain.Viewer, blogID int64) (blog *domain.Blog, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "BlogManager.Get", trace.WithAttributes(attribute.Int64("blog.id", blogID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	blog, err = getReadableBlog(ctx, m.blogRepo, viewer, blogID)
+	if err != nil {
+		return nil, err
+	}
+	err = m.complete(ctx, blog)
+	if err != nil {
+		return nil, err
+	}
+	return blog, nil
+}
+
+// Search lists the public blogs, the members-only blogs when the viewer is a member, and the viewer's own blogs
+func (m *BlogManager) Search(ctx context.Context, viewer *domain.Viewer, offset int, limit int, search string) (blogs []*domain.Blog, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "BlogManager.Search", trace.WithAttributes(attribute.Int("offset", offset), attribute.Int("limit", limit)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	// the search text is user input, only its length goes to the log
+	blogLogger.Debugf("offset: %d, limit: %d, search length: %d", offset, limit, len(search))
+	blogs, err = m.blogRepo.Search(ctx, readAccess(viewer), offset, limit, search)
+	if err != nil {
+		return nil, err
+	}
+	err = m.complete(ctx, blogs...)
+	if err != nil {
+		return nil, err
+	}
+	return blogs, nil
+}
+
+// Feed returns a page of the blogs of the authors the viewer follows, newest first. The next cursor is nil
+// when there are no more blogs, otherwise it is passed back to get the next page.
+func (m *BlogManager) Feed(ctx context.Context, viewer *domain.Viewer, after *domain.FeedCursor, limit int) (blogs []*domain.Blog, next *domain.FeedCursor, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "BlogManager.Feed", trace.WithAttributes(attribute.Int("limit", limit)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if limit < 1 || limit > MaxFeedLimit {
+		return nil, nil, domain.NewValidationError(domain.FieldError{Field: "limit", Code: "out_of_range",
+			Message: fmt.Sprintf("must be between 1 and %d", MaxFeedLimit)})
+	}
+	blogs, err = m.blogRepo.Feed(ctx, viewer.UserID, readAccess(viewer), after, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = m.complete(ctx, blogs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(blogs) == limit {
+		last := blogs[len(blogs)-1]
+		next = &domain.FeedCursor{CreatedAt: last.CreatedAt, BlogID: last.ID}
+	}
+	return blogs, next, nil
+}
+
+// complete fills in what the blogs returned to the readers have on top of the stored fields
+func (m *BlogManager) complete(ctx context.Context, blogs ...*domain.Blog) error {
+	for _, blog := range blogs {
+		contentHTML, err := m.renderer.Render(ctx, blog.ContentFormat, blog.Content)
+		if err != nil {
+			return err
+		}
+		blog.ContentHTML = contentHTML
+	}
+	err := m.addCreators(ctx, blogs...)
+	if err != nil {
+		return err
+	}
+	return m.addReactionCounts(ctx, blogs...)
+}
+
+// addCreators looks up the authors of all the blogs at once, a page of blogs mostly repeats a few of them
+func (m *BlogManager) addCreators(ctx context.Context, blogs ...*domain.Blog) error {
+	if len(blogs) == 0 {
+		return nil
+	}
+	userIDs := make([]int64, 0, len(blogs))
+	seen := make(map[int64]bool, len(blogs))
+	for _, blog := range blogs {
+		if !seen[blog.UserID] {
+			seen[blog.UserID] = true
+			userIDs = append(userIDs, blog.UserID)
+		}
+	}
+	users, err := m.userRepo.GetUsersByIDs(ctx, userIDs...)
+	if err != nil {
+		return err
+	}
+	for _, blog := range blogs {
+		blog.Creator = users[blog.UserID]
+	}
+	return nil
+}
+
+// addReactionCounts reads the counters of all the blogs at once
+func (m *BlogManager) addReactionCounts(ctx context.Context, blogs ...*domain.Blog) error {
+	if len(blogs) == 0 {
+		return nil
+	}
+	blogIDs := make([]int64, 0, len(blogs))
+	for _, blog := range blogs {
+		blogIDs = append(blogIDs, blog.ID)
+	}
+	counts, err := m.reactionRepo.Counts(ctx, blogIDs...)
+	if err != nil {
+		return err
+	}
+	for _, blog := range blogs {
+		blog.Reactions = reactionCounts(counts, blog.ID)
+	}
+	return nil
+}
+
+// readAccess is what the viewer gets in the lists of blogs, the unlisted blogs of the others are left out
+func readAccess(viewer *domain.Viewer) domain.BlogAccess {
+	access := domain.BlogAccess{Visibilities: []domain.Visibility{domain.VisibilityPublic}, UserID: viewer.UserID}
+	switch {
+	case viewer.HasPermission(utils.ReadAnyBlogPermission):
+		access.Visibilities = append(access.Visibilities, domain.VisibilityUnlisted, domain.VisibilityMembersOnly, domain.VisibilityPrivate)
+	case viewer.HasPermission(utils.ReadBlogPermission):
+		access.Visibilities = append(access.Visibilities, domain.VisibilityMembersOnly)
+	}
+	return access
 }
 
-func (m *BlogManager) Get(ctx context.Context, blogID int64) (*domain.Blog, error) {
-	return m.blogRepo.Get(ctx, blogID)
+// getReadableBlog returns the blog when the viewer can read it. A private blog of somebody else is not found,
+// so that its existence does not leak.
+func getReadableBlog(ctx context.Context, blogRepo domain.BlogRepo, viewer *domain.Viewer, blogID int64) (*domain.Blog, error) {
+	blog, err := blogRepo.Get(ctx, blogID)
+	if err != nil {
+		return nil, err
+	}
+	err = checkReadable(viewer, blog, blogID)
+	if err != nil {
+		return nil, err
+	}
+	return blog, nil
 }
 
-func (m *BlogManager) Search(ctx context.Context, offset int, limit int, search string) ([]*domain.Blog, error) {
-	blogLogger.Infof("offset: %d, limit: %d, search: %s", offset, limit, search)
-	return m.blogRepo.Search(ctx, offset, limit, search)
+// checkReadable the not found error of a private blog names the blog the way it was asked for
+func checkReadable(viewer *domain.Viewer, blog *domain.Blog, ref any) error {
+	if (!viewer.IsAnonymous() && blog.UserID == viewer.UserID) || viewer.HasPermission(utils.ReadAnyBlogPermission) {
+		return nil
+	}
+	// a draft is not out yet, like a private blog it does not leak
+	if blog.Status == domain.StatusDraft {
+		return domain.NewNotFoundError("blog", ref)
+	}
+	switch blog.Visibility {
+	case domain.VisibilityPublic, domain.VisibilityUnlisted:
+		return nil
+	case domain.VisibilityMembersOnly:
+		if viewer.IsAnonymous() {
+			return domain.NewUnauthorizedError("the blog is for the members only")
+		}
+		if !viewer.HasPermission(utils.ReadBlogPermission) {
+			return domain.NewForbiddenError("user does not have permission")
+		}
+		return nil
+	}
+	return domain.NewNotFoundError("blog", ref)
 }
@@ -0,0 +1,417 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/gateways/render"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+func TestFeed(t *testing.T) {
+	ctx := context.Background()
+	_, repos := setUp(t)
+	reader := createUser(t, repos, "olga")
+	followed := createUser(t, repos, "pete")
+	stranger := createUser(t, repos, "rita")
+	if _, err := repos.Follows.Follow(ctx, &domain.Follow{FollowerID: reader.ID, FolloweeID: followed.ID}); err != nil {
+		t.Fatalf("failed to follow: %v", err)
+	}
+
+	// created oldest to newest, the feed has them the other way round and without the stranger's
+	var expected []int64
+	for i, author := range []*domain.User{followed, stranger, followed, followed, stranger, followed} {
+		blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: fmt.Sprintf("Blog %d", i), Content: "Content"})
+		if err != nil {
+			t.Fatalf("failed to create blog: %v", err)
+		}
+		if author != stranger {
+			expected = append([]int64{blogID}, expected...)
+		}
+	}
+
+	// the pages are chained by their cursors, the last one has none
+	blogManager := newBlogManager(repos)
+	var found []*domain.Blog
+	var after *domain.FeedCursor
+	for pages := 0; ; pages++ {
+		if pages > len(expected) {
+			t.Fatalf("the feed does not end")
+		}
+		blogs, next, err := blogManager.Feed(ctx, member(reader), after, 3)
+		if err != nil {
+			t.Fatalf("failed to get the feed: %v", err)
+		}
+		for _, blog := range blogs {
+			if blog.Reactions == nil || blog.Creator == nil || blog.ContentHTML == "" {
+				t.Errorf("expected the feed to come with the reaction counts, the creators and the HTML: %+v", blog)
+			}
+		}
+		found = append(found, blogs...)
+		if next == nil {
+			break
+		}
+		after = next
+	}
+	if blogIDs(found) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %s", expected, blogIDs(found))
+	}
+
+	var validationErr *domain.ValidationError
+	if _, _, err := blogManager.Feed(ctx, member(reader), nil, MaxFeedLimit+1); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for a page which is too large, got %v", err)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+	author := createUser(t, repos, "uma")
+	reader := createUser(t, repos, "vic")
+	anonymous := &domain.Viewer{}
+	admin := &domain.Viewer{UserID: reader.ID + 1000, Permissions: map[string]any{utils.ReadAnyBlogPermission: true}}
+
+	blogManager := newBlogManager(repos)
+	blogIDs := make(map[domain.Visibility]int64)
+	for _, visibility := range []domain.Visibility{domain.VisibilityPublic, domain.VisibilityUnlisted, domain.VisibilityMembersOnly, domain.VisibilityPrivate} {
+		blogID, err := blogManager.Create(ctx, &domain.Blog{UserID: author.ID, Title: string(visibility), Content: "Content", Visibility: visibility})
+		if err != nil {
+			t.Fatalf("failed to create blog: %v", err)
+		}
+		blogIDs[visibility] = blogID
+	}
+	// the blogs are members-only unless the author says otherwise
+	defaultID, err := blogManager.Create(ctx, &domain.Blog{UserID: author.ID, Title: "default", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, defaultID); err != nil || blog.Visibility != domain.DefaultVisibility {
+		t.Errorf("expected the default visibility, got %+v, %v", blog, err)
+	}
+	var validationErr *domain.ValidationError
+	if _, err := blogManager.Create(ctx, &domain.Blog{UserID: author.ID, Title: "t", Content: "c", Visibility: "friends"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for an unknown visibility, got %v", err)
+	}
+
+	var unauthorizedErr *domain.UnauthorizedError
+	var notFoundErr *domain.NotFoundError
+	for _, tc := range []struct {
+		name       string
+		viewer     *domain.Viewer
+		visibility domain.Visibility
+		expected   any // nil when the blog is readable, otherwise the type of the error
+	}{
+		{"anonymous public", anonymous, domain.VisibilityPublic, nil},
+		{"anonymous unlisted", anonymous, domain.VisibilityUnlisted, nil},
+		{"anonymous members-only", anonymous, domain.VisibilityMembersOnly, &unauthorizedErr},
+		{"anonymous private", anonymous, domain.VisibilityPrivate, &notFoundErr},
+		{"member members-only", member(reader), domain.VisibilityMembersOnly, nil},
+		{"member private", member(reader), domain.VisibilityPrivate, &notFoundErr},
+		{"author private", member(author), domain.VisibilityPrivate, nil},
+		{"admin private", admin, domain.VisibilityPrivate, nil},
+	} {
+		_, err := blogManager.Get(ctx, tc.viewer, blogIDs[tc.visibility])
+		if tc.expected == nil && err != nil {
+			t.Errorf("%s: expected the blog to be readable, got %v", tc.name, err)
+		} else if tc.expected != nil && !errors.As(err, tc.expected) {
+			t.Errorf("%s: expected %T, got %v", tc.name, tc.expected, err)
+		}
+	}
+
+	// the lists leave out the unlisted blogs of the others
+	for _, tc := range []struct {
+		name     string
+		viewer   *domain.Viewer
+		expected []int64
+	}{
+		{"anonymous", anonymous, []int64{blogIDs[domain.VisibilityPublic]}},
+		{"member", member(reader), []int64{defaultID, blogIDs[domain.VisibilityMembersOnly], blogIDs[domain.VisibilityPublic]}},
+		{"author", member(author), []int64{defaultID, blogIDs[domain.VisibilityPrivate], blogIDs[domain.VisibilityMembersOnly],
+			blogIDs[domain.VisibilityUnlisted], blogIDs[domain.VisibilityPublic]}},
+		{"admin", admin, []int64{defaultID, blogIDs[domain.VisibilityPrivate], blogIDs[domain.VisibilityMembersOnly],
+			blogIDs[domain.VisibilityUnlisted], blogIDs[domain.VisibilityPublic]}},
+	} {
+		blogs, err := blogManager.Search(ctx, tc.viewer, 0, 10, "")
+		if err != nil {
+			t.Fatalf("%s: failed to search blogs: %v", tc.name, err)
+		}
+		var found []int64
+		for _, blog := range blogs {
+			found = append(found, blog.ID)
+		}
+		if fmt.Sprint(found) != fmt.Sprint(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, found)
+		}
+	}
+
+	if _, err := repos.Follows.Follow(ctx, &domain.Follow{FollowerID: reader.ID, FolloweeID: author.ID}); err != nil {
+		t.Fatalf("failed to follow: %v", err)
+	}
+	blogs, _, err := blogManager.Feed(ctx, member(reader), nil, 10)
+	if err != nil || len(blogs) != 3 {
+		t.Errorf("expected the public and the members-only blogs in the feed, got %v, %v", blogs, err)
+	}
+
+	commentManager := NewCommentManager(conf, repos.Tx, repos.Blogs, repos.Comments)
+	if _, err := commentManager.ListByBlog(ctx, anonymous, blogIDs[domain.VisibilityPublic], 0, 10); err != nil {
+		t.Errorf("expected the comments of a public blog to be readable without logging in, got %v", err)
+	}
+	if _, err := commentManager.Create(ctx, member(reader), &domain.Comment{BlogID: blogIDs[domain.VisibilityPrivate], UserID: reader.ID, Content: "hi"}); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for a comment on a private blog, got %v", err)
+	}
+
+	// the visibility of a blog changes along with the rest of it, it stays as it is when none is given
+	if _, err := blogManager.Get(ctx, anonymous, defaultID); !errors.As(err, &unauthorizedErr) {
+		t.Errorf("expected a members-only blog to need a login, got %v", err)
+	}
+	if blog, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: defaultID, Title: "default", Content: "Content", Visibility: domain.VisibilityPublic}); err != nil || blog.Visibility != domain.VisibilityPublic {
+		t.Errorf("expected the blog to become public, got %+v, %v", blog, err)
+	}
+	if _, err := blogManager.Get(ctx, anonymous, defaultID); err != nil {
+		t.Errorf("expected the public blog to be readable without logging in, got %v", err)
+	}
+	if blog, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: defaultID, Title: "default", Content: "Edited"}); err != nil || blog.Visibility != domain.VisibilityPublic {
+		t.Errorf("expected the visibility to stay public, got %+v, %v", blog, err)
+	}
+	if _, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: defaultID, Title: "default", Content: "Edited", Visibility: domain.VisibilityPrivate}); err != nil {
+		t.Fatalf("failed to update the blog: %v", err)
+	}
+	if _, err := blogManager.Get(ctx, anonymous, defaultID); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected the private blog to be hidden, got %v", err)
+	}
+	if _, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: defaultID, Title: "default", Content: "Edited", Visibility: "friends"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for an unknown visibility, got %v", err)
+	}
+}
+
+func TestDrafts(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+	author := createUser(t, repos, "gil")
+	reader := createUser(t, repos, "hal")
+	admin := &domain.Viewer{UserID: reader.ID + 1000, Permissions: map[string]any{utils.ReadAnyBlogPermission: true}}
+	if _, err := repos.Follows.Follow(ctx, &domain.Follow{FollowerID: reader.ID, FolloweeID: author.ID}); err != nil {
+		t.Fatalf("failed to follow: %v", err)
+	}
+
+	blogManager := newBlogManager(repos)
+	publishedID, err := blogManager.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Out", Content: "Content", Visibility: domain.VisibilityPublic})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	draftID, err := blogManager.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Soon", Content: "Content", Visibility: domain.VisibilityPublic,
+		Status: domain.StatusDraft})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, publishedID); err != nil || blog.Status != domain.DefaultStatus {
+		t.Errorf("expected the default status, got %+v, %v", blog, err)
+	}
+	var validationErr *domain.ValidationError
+	if _, err := blogManager.Create(ctx, &domain.Blog{UserID: author.ID, Title: "t", Content: "c", Status: "scheduled"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for an unknown status, got %v", err)
+	}
+
+	// only the author and the admins read a draft, even a public one
+	var notFoundErr *domain.NotFoundError
+	if _, err := blogManager.Get(ctx, member(reader), draftID); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a draft of somebody else to be not found, got %v", err)
+	}
+	if _, err := blogManager.Get(ctx, &domain.Viewer{}, draftID); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a draft to be not found without logging in, got %v", err)
+	}
+	for name, viewer := range map[string]*domain.Viewer{"author": member(author), "admin": admin} {
+		if blog, err := blogManager.Get(ctx, viewer, draftID); err != nil || blog.Status != domain.StatusDraft {
+			t.Errorf("%s: expected to read the draft, got %+v, %v", name, blog, err)
+		}
+	}
+	commentManager := NewCommentManager(conf, repos.Tx, repos.Blogs, repos.Comments)
+	if _, err := commentManager.Create(ctx, member(reader), &domain.Comment{BlogID: draftID, UserID: reader.ID, Content: "hi"}); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for a comment on a draft, got %v", err)
+	}
+
+	// the lists of the others leave the draft out
+	if blogs, err := blogManager.Search(ctx, member(author), 0, 10, ""); err != nil || blogIDs(blogs) != fmt.Sprint([]int64{draftID, publishedID}) {
+		t.Errorf("expected the author to find the draft, got %s, %v", blogIDs(blogs), err)
+	}
+	if blogs, err := blogManager.Search(ctx, admin, 0, 10, ""); err != nil || blogIDs(blogs) != fmt.Sprint([]int64{publishedID}) {
+		t.Errorf("expected the draft to be left out of the search, got %s, %v", blogIDs(blogs), err)
+	}
+	if blogs, _, err := blogManager.Feed(ctx, member(reader), nil, 10); err != nil || blogIDs(blogs) != fmt.Sprint([]int64{publishedID}) {
+		t.Errorf("expected the draft to be left out of the feed, got %s, %v", blogIDs(blogs), err)
+	}
+	syndicationManager := NewSyndicationManager(conf, repos.Users, repos.Blogs, render.NewRenderer())
+	if feed, err := syndicationManager.SiteFeed(ctx); err != nil || len(feed.Items) != 1 {
+		t.Errorf("expected the draft to be left out of the site feed, got %+v, %v", feed, err)
+	}
+
+	// an update without a status keeps it, publishing puts the blog in the lists
+	if blog, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: draftID, Title: "Soon", Content: "Edited"}); err != nil || blog.Status != domain.StatusDraft {
+		t.Errorf("expected the draft to stay a draft, got %+v, %v", blog, err)
+	}
+	if _, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: draftID, Title: "Soon", Content: "Edited", Status: "gone"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for an unknown status, got %v", err)
+	}
+	if blog, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: draftID, Title: "Now", Content: "Edited", Status: domain.StatusPublished}); err != nil || blog.Status != domain.StatusPublished {
+		t.Fatalf("failed to publish the draft: %+v, %v", blog, err)
+	}
+	if blogs, err := blogManager.Search(ctx, &domain.Viewer{}, 0, 10, ""); err != nil || blogIDs(blogs) != fmt.Sprint([]int64{draftID, publishedID}) {
+		t.Errorf("expected the published draft in the search, got %s, %v", blogIDs(blogs), err)
+	}
+}
+
+func TestContentFormats(t *testing.T) {
+	ctx := context.Background()
+	_, repos := setUp(t)
+	author := createUser(t, repos, "wes")
+	blogManager := newBlogManager(repos)
+
+	for _, tc := range []struct {
+		name     string
+		format   domain.ContentFormat
+		content  string
+		contains []string
+		excludes []string
+	}{
+		{"markdown", domain.FormatMarkdown,
+			"# Getting Started\n\nSome **bold** text <script>alert(1)</script>\n\n```go\nfunc main() {}\n```\n",
+			[]string{`<h1 id="getting-started">Getting Started</h1>`, "<strong>bold</strong>", `class="chroma"`},
+			[]string{"<script", "alert(1)"}},
+		{"html", domain.FormatHTML,
+			`<p onclick="steal()">Hi <a href="javascript:steal()">there</a><img src="x" onerror="steal()"></p>`,
+			[]string{"<p>Hi "},
+			[]string{"onclick", "onerror", "javascript:"}},
+		{"plaintext", domain.FormatPlaintext,
+			"1 < 2 & <b>not bold</b>\nnext line\n\nnext paragraph",
+			[]string{"<p>1 &lt; 2 &amp; &lt;b&gt;not bold&lt;/b&gt;<br>\nnext line</p>", "<p>next paragraph</p>"},
+			nil},
+	} {
+		blogID, err := blogManager.Create(ctx, &domain.Blog{UserID: author.ID, Title: tc.name, Content: tc.content, ContentFormat: tc.format})
+		if err != nil {
+			t.Fatalf("%s: failed to create blog: %v", tc.name, err)
+		}
+		blog, err := blogManager.Get(ctx, member(author), blogID)
+		if err != nil {
+			t.Fatalf("%s: failed to get blog: %v", tc.name, err)
+		}
+		if blog.Content != tc.content || blog.ContentFormat != tc.format {
+			t.Errorf("%s: expected the raw content to be kept, got %q (%s)", tc.name, blog.Content, blog.ContentFormat)
+		}
+		for _, expected := range tc.contains {
+			if !strings.Contains(blog.ContentHTML, expected) {
+				t.Errorf("%s: expected %q in %q", tc.name, expected, blog.ContentHTML)
+			}
+		}
+		for _, unexpected := range tc.excludes {
+			if strings.Contains(blog.ContentHTML, unexpected) {
+				t.Errorf("%s: did not expect %q in %q", tc.name, unexpected, blog.ContentHTML)
+			}
+		}
+	}
+
+	// the blogs are plain text unless the author says otherwise
+	blogID, err := blogManager.Create(ctx, &domain.Blog{UserID: author.ID, Title: "default", Content: "*text*"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, blogID); err != nil || blog.ContentFormat != domain.DefaultContentFormat {
+		t.Errorf("expected the default content format, got %+v, %v", blog, err)
+	}
+	var validationErr *domain.ValidationError
+	if _, err := blogManager.Create(ctx, &domain.Blog{UserID: author.ID, Title: "t", Content: "c", ContentFormat: "rtf"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for an unknown content format, got %v", err)
+	}
+
+	// the format of a blog changes along with the rest of it, it stays as it is when none is given
+	if blog, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: blogID, Title: "default", Content: "*text*", ContentFormat: domain.FormatMarkdown}); err != nil ||
+		blog.ContentFormat != domain.FormatMarkdown || !strings.Contains(blog.ContentHTML, "<em>text</em>") {
+		t.Errorf("expected the blog to become markdown, got %+v, %v", blog, err)
+	}
+	if blog, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: blogID, Title: "default", Content: "**text**"}); err != nil || blog.ContentFormat != domain.FormatMarkdown {
+		t.Errorf("expected the format to stay markdown, got %+v, %v", blog, err)
+	}
+	if _, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: blogID, Title: "default", Content: "c", ContentFormat: "rtf"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for an unknown content format, got %v", err)
+	}
+}
+
+func TestSlugs(t *testing.T) {
+	ctx := context.Background()
+	_, repos := setUp(t)
+	author := createUser(t, repos, "xia")
+	other := createUser(t, repos, "yan")
+	blogManager := newBlogManager(repos)
+
+	create := func(userID int64, title string, visibility domain.Visibility) *domain.Blog {
+		t.Helper()
+		blogID, err := blogManager.Create(ctx, &domain.Blog{UserID: userID, Title: title, Content: "Content", Visibility: visibility})
+		if err != nil {
+			t.Fatalf("failed to create blog: %v", err)
+		}
+		blog, err := repos.Blogs.Get(ctx, blogID)
+		if err != nil {
+			t.Fatalf("failed to get blog: %v", err)
+		}
+		return blog
+	}
+	first := create(author.ID, "Crème Brûlée à Paris!", domain.VisibilityPublic)
+	second := create(other.ID, "Crème brûlée, à Paris", domain.VisibilityPublic)
+	for blog, expected := range map[*domain.Blog]string{
+		first:  "creme-brulee-a-paris",
+		second: "creme-brulee-a-paris-2",
+		create(author.ID, "Привет мир", domain.VisibilityPublic): "privet-mir",
+		create(author.ID, "🎉🎉", domain.VisibilityPublic):         "untitled",
+	} {
+		if blog.Slug != expected {
+			t.Errorf("expected the slug %q for %q, got %q", expected, blog.Title, blog.Slug)
+		}
+	}
+
+	// a new title gives a new slug, the old one still finds the blog and is not given to another blog
+	renamed, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: first.ID, Title: "Tarte Tatin", Content: "New content"})
+	if err != nil {
+		t.Fatalf("failed to update blog: %v", err)
+	}
+	if renamed.Slug != "tarte-tatin" || renamed.Content != "New content" {
+		t.Errorf("expected the new title to give the slug tarte-tatin, got %+v", renamed)
+	}
+	if blog, err := blogManager.GetBySlug(ctx, &domain.Viewer{}, "creme-brulee-a-paris"); err != nil || blog.ID != first.ID || blog.Slug != "tarte-tatin" {
+		t.Errorf("expected the old slug to find the renamed blog, got %+v, %v", blog, err)
+	}
+	if third := create(other.ID, "Crème Brûlée à Paris", domain.VisibilityPublic); third.Slug != "creme-brulee-a-paris-3" {
+		t.Errorf("expected the old slug of another blog to be skipped, got %q", third.Slug)
+	}
+	// taking the old title back takes the old slug back
+	if renamed, err := blogManager.Update(ctx, author.ID, &domain.Blog{ID: first.ID, Title: "Crème Brûlée à Paris!"}); err != nil || renamed.Slug != "creme-brulee-a-paris" {
+		t.Errorf("expected the old slug back, got %+v, %v", renamed, err)
+	}
+
+	var forbiddenErr *domain.ForbiddenError
+	if _, err := blogManager.Update(ctx, other.ID, &domain.Blog{ID: first.ID, Title: "Mine"}); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected a forbidden error for the blog of somebody else, got %v", err)
+	}
+	var notFoundErr *domain.NotFoundError
+	if _, err := blogManager.GetBySlug(ctx, &domain.Viewer{}, "no-such-blog"); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown slug, got %v", err)
+	}
+	private := create(author.ID, "Secret", domain.VisibilityPrivate)
+	if _, err := blogManager.GetBySlug(ctx, &domain.Viewer{}, private.Slug); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for the private blog of somebody else, got %v", err)
+	}
+
+	// the blogs from before the slugs get theirs on start
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Tarte Tatin", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	if assigned, err := blogManager.AssignMissingSlugs(ctx); err != nil || assigned != 1 {
+		t.Errorf("expected one slug to be assigned, got %d, %v", assigned, err)
+	}
+	if blog, err := repos.Blogs.Get(ctx, blogID); err != nil || blog.Slug != "tarte-tatin-2" {
+		t.Errorf("expected the slug tarte-tatin-2, got %+v, %v", blog, err)
+	}
+}
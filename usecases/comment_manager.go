@@ -0,0 +1,239 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+CommentManager is the business logic of the blog comments. Readers only ever see the approved comments,
+the authors edit and delete their own comments and the moderators move the comments between the states.
+A deleted comment is kept with the removed status so that its replies stay in place.
+*/
+type CommentManager struct {
+	conf        *config.Config
+	txManager   domain.TxManager
+	blogRepo    domain.BlogRepo
+	commentRepo domain.CommentRepo
+}
+
+func NewCommentManager(conf *config.Config, txManager domain.TxManager, blogRepo domain.BlogRepo, commentRepo domain.CommentRepo) *CommentManager {
+	return &CommentManager{
+		conf:        conf,
+		txManager:   txManager,
+		blogRepo:    blogRepo,
+		commentRepo: commentRepo,
+	}
+}
+
+func (m *CommentManager) Create(ctx context.Context, viewer *domain.Viewer, newComment *domain.Comment) (comment *domain.Comment, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "CommentManager.Create", trace.WithAttributes(attribute.Int64("blog.id", newComment.BlogID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if err := m.validateContent(newComment.Content); err != nil {
+		return nil, err
+	}
+
+	err = m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		blog, err := getReadableBlog(ctx, m.blogRepo, viewer, newComment.BlogID)
+		if err != nil {
+			return err
+		}
+		if !blog.CommentsEnabled {
+			return domain.NewForbiddenError("comments are turned off for this blog")
+		}
+
+		depth := 0
+		if newComment.ParentID != 0 {
+			parent, err := m.commentRepo.Get(ctx, newComment.ParentID)
+			if err != nil && !isNotFound(err) {
+				return err
+			}
+			// only a visible comment of the same blog can be replied to
+			if parent == nil || parent.BlogID != newComment.BlogID || parent.Status != domain.CommentApproved {
+				return domain.NewValidationError(domain.FieldError{Field: "parentId", Code: "not_found", Message: "parent comment does not exist"})
+			}
+			depth = parent.Depth + 1
+			if depth > m.conf.Comments.MaxDepth {
+				return domain.NewValidationError(domain.FieldError{Field: "parentId", Code: "too_deep",
+					Message: fmt.Sprintf("replies can not be nested deeper than %d levels", m.conf.Comments.MaxDepth)})
+			}
+		}
+
+		status := domain.CommentApproved
+		if m.conf.Comments.RequireApproval {
+			status = domain.CommentPending
+		}
+		commentID, err := m.commentRepo.Create(ctx, &domain.Comment{
+			BlogID:   newComment.BlogID,
+			UserID:   newComment.UserID,
+			ParentID: newComment.ParentID,
+			Depth:    depth,
+			Content:  newComment.Content,
+			Status:   status,
+		})
+		if err != nil {
+			return err
+		}
+		comment, err = m.commentRepo.Get(ctx, commentID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// Update changes the content of the user's own comment. When the comments need an approval the edited
+// comment has to be approved again.
+func (m *CommentManager) Update(ctx context.Context, userID int64, commentID int64, content string) (comment *domain.Comment, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "CommentManager.Update", trace.WithAttributes(attribute.Int64("comment.id", commentID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if err := m.validateContent(content); err != nil {
+		return nil, err
+	}
+
+	err = m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		existing, err := m.getOwnComment(ctx, userID, commentID)
+		if err != nil {
+			return err
+		}
+		if existing.Status == domain.CommentRemoved || existing.Status == domain.CommentSpam {
+			return domain.NewForbiddenError("the comment can no longer be edited")
+		}
+
+		err = m.commentRepo.UpdateContent(ctx, commentID, content)
+		if err != nil {
+			return err
+		}
+		if m.conf.Comments.RequireApproval && existing.Status != domain.CommentPending {
+			err = m.commentRepo.UpdateStatus(ctx, commentID, domain.CommentPending)
+			if err != nil {
+				return err
+			}
+		}
+		comment, err = m.commentRepo.Get(ctx, commentID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// Delete removes the user's own comment
+func (m *CommentManager) Delete(ctx context.Context, userID int64, commentID int64) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "CommentManager.Delete", trace.WithAttributes(attribute.Int64("comment.id", commentID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	return m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := m.getOwnComment(ctx, userID, commentID); err != nil {
+			return err
+		}
+		return m.commentRepo.UpdateStatus(ctx, commentID, domain.CommentRemoved)
+	})
+}
+
+// SetStatus is the moderation of the comments, the caller is expected to hold the moderate_comment permission
+func (m *CommentManager) SetStatus(ctx context.Context, commentID int64, status domain.CommentStatus) (comment *domain.Comment, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "CommentManager.SetStatus", trace.WithAttributes(
+		attribute.Int64("comment.id", commentID), attribute.String("comment.status", string(status))))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if !status.IsValid() {
+		return nil, domain.NewValidationError(domain.FieldError{Field: "status", Code: "invalid",
+			Message: "must be one of pending, approved, spam or removed"})
+	}
+
+	err = m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		err := m.commentRepo.UpdateStatus(ctx, commentID, status)
+		if err != nil {
+			return err
+		}
+		comment, err = m.commentRepo.Get(ctx, commentID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// ListByBlog returns a page of the approved comments of the blog in thread order, when the viewer can read the blog
+func (m *CommentManager) ListByBlog(ctx context.Context, viewer *domain.Viewer, blogID int64, offset int, limit int) (comments []*domain.Comment, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "CommentManager.ListByBlog", trace.WithAttributes(
+		attribute.Int64("blog.id", blogID), attribute.Int("offset", offset), attribute.Int("limit", limit)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	// an unknown blog is a 404 rather than an empty list
+	if _, err := getReadableBlog(ctx, m.blogRepo, viewer, blogID); err != nil {
+		return nil, err
+	}
+	return m.commentRepo.ListByBlog(ctx, blogID, domain.CommentApproved, offset, limit)
+}
+
+// ListByStatus is the moderation queue, oldest comments first
+func (m *CommentManager) ListByStatus(ctx context.Context, status domain.CommentStatus, offset int, limit int) (comments []*domain.Comment, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "CommentManager.ListByStatus", trace.WithAttributes(
+		attribute.String("comment.status", string(status)), attribute.Int("offset", offset), attribute.Int("limit", limit)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if !status.IsValid() {
+		return nil, domain.NewValidationError(domain.FieldError{Field: "status", Code: "invalid",
+			Message: "must be one of pending, approved, spam or removed"})
+	}
+	return m.commentRepo.ListByStatus(ctx, status, offset, limit)
+}
+
+// SetCommentsEnabled turns the comments of the user's own blog on or off, the existing comments are kept
+func (m *CommentManager) SetCommentsEnabled(ctx context.Context, userID int64, blogID int64, enabled bool) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "CommentManager.SetCommentsEnabled", trace.WithAttributes(attribute.Int64("blog.id", blogID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	return m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		blog, err := m.blogRepo.Get(ctx, blogID)
+		if err != nil {
+			return err
+		}
+		if blog.UserID != userID {
+			return domain.NewForbiddenError("only the author of the blog can change its comment settings")
+		}
+		return m.blogRepo.SetCommentsEnabled(ctx, blogID, enabled)
+	})
+}
+
+func (m *CommentManager) getOwnComment(ctx context.Context, userID int64, commentID int64) (*domain.Comment, error) {
+	comment, err := m.commentRepo.Get(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.UserID != userID {
+		return nil, domain.NewForbiddenError("only the author of the comment can change it")
+	}
+	return comment, nil
+}
+
+func (m *CommentManager) validateContent(content string) error {
+	validationErr := domain.NewValidationError()
+	if content == "" {
+		validationErr.Add("content", "required", "must not be empty")
+	} else if maxLength := m.conf.Comments.MaxLength; maxLength > 0 && utf8.RuneCountInString(content) > maxLength {
+		validationErr.Add("content", "too_long", fmt.Sprintf("must not be longer than %d characters", maxLength))
+	}
+	return validationErr.OrNil()
+}
+
+func isNotFound(err error) bool {
+	var notFoundErr *domain.NotFoundError
+	return errors.As(err, &notFoundErr)
+}
@@ -0,0 +1,91 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+func TestCommentManager(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+	conf.Comments.MaxDepth = 1
+	conf.Comments.RequireApproval = true
+	manager := NewCommentManager(conf, repos.Tx, repos.Blogs, repos.Comments)
+
+	author := createUser(t, repos, "heidi")
+	reader := createUser(t, repos, "ivan")
+	// the readers can comment, only the admin can moderate
+	assertPermissions(t, conf, repos, "ivan", "secret-ivan", []string{utils.CreateCommentPermission}, []string{utils.ModerateCommentPermission})
+	assertPermissions(t, conf, repos, conf.DefaultUser.Username, conf.DefaultUser.Password, []string{utils.ModerateCommentPermission}, nil)
+
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+
+	comment, err := manager.Create(ctx, member(reader), &domain.Comment{BlogID: blogID, UserID: reader.ID, Content: "hello"})
+	if err != nil {
+		t.Fatalf("failed to create comment: %v", err)
+	}
+	if comment.Status != domain.CommentPending {
+		t.Errorf("expected the comment to wait for approval: %+v", comment)
+	}
+	if comments, err := manager.ListByBlog(ctx, member(reader), blogID, 0, 10); err != nil || len(comments) != 0 {
+		t.Errorf("expected the pending comment to be hidden, got %v, %v", commentIDs(comments), err)
+	}
+
+	// replies need a visible parent and are limited in depth
+	var validationErr *domain.ValidationError
+	if _, err := manager.Create(ctx, member(author), &domain.Comment{BlogID: blogID, UserID: author.ID, ParentID: comment.ID, Content: "reply"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for a reply to a pending comment, got %v", err)
+	}
+	if _, err := manager.SetStatus(ctx, comment.ID, domain.CommentApproved); err != nil {
+		t.Fatalf("failed to approve the comment: %v", err)
+	}
+	reply, err := manager.Create(ctx, member(author), &domain.Comment{BlogID: blogID, UserID: author.ID, ParentID: comment.ID, Content: "reply"})
+	if err != nil {
+		t.Fatalf("failed to create reply: %v", err)
+	}
+	if _, err := manager.SetStatus(ctx, reply.ID, domain.CommentApproved); err != nil {
+		t.Fatalf("failed to approve the reply: %v", err)
+	}
+	if _, err := manager.Create(ctx, member(reader), &domain.Comment{BlogID: blogID, UserID: reader.ID, ParentID: reply.ID, Content: "too deep"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for a reply past the max depth, got %v", err)
+	}
+	if _, err := manager.SetStatus(ctx, reply.ID, "bogus"); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for an unknown status, got %v", err)
+	}
+
+	// only the author edits or deletes, an edit has to be approved again
+	var forbiddenErr *domain.ForbiddenError
+	if _, err := manager.Update(ctx, author.ID, comment.ID, "hijacked"); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected a forbidden error when editing somebody else's comment, got %v", err)
+	}
+	if err := manager.Delete(ctx, author.ID, comment.ID); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected a forbidden error when deleting somebody else's comment, got %v", err)
+	}
+	if edited, err := manager.Update(ctx, reader.ID, comment.ID, "hello again"); err != nil || edited.Content != "hello again" || edited.Status != domain.CommentPending {
+		t.Errorf("expected the edited comment to wait for approval, got %+v, %v", edited, err)
+	}
+	if err := manager.Delete(ctx, author.ID, reply.ID); err != nil {
+		t.Fatalf("failed to delete the reply: %v", err)
+	}
+	if deleted, err := repos.Comments.Get(ctx, reply.ID); err != nil || deleted.Status != domain.CommentRemoved {
+		t.Errorf("expected the reply to be removed, got %+v, %v", deleted, err)
+	}
+
+	// only the blog author turns the comments off, after which nobody can comment
+	if err := manager.SetCommentsEnabled(ctx, reader.ID, blogID, false); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected a forbidden error when changing somebody else's blog, got %v", err)
+	}
+	if err := manager.SetCommentsEnabled(ctx, author.ID, blogID, false); err != nil {
+		t.Fatalf("failed to turn the comments off: %v", err)
+	}
+	if _, err := manager.Create(ctx, member(reader), &domain.Comment{BlogID: blogID, UserID: reader.ID, Content: "late"}); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected a forbidden error when the comments are off, got %v", err)
+	}
+}
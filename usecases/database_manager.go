@@ -3,20 +3,79 @@ package usecases
 import (
 	"context"
 
+	"github.com/bipuldutta/blogzilla/config"
 	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
 )
 
+var dbLogger = utils.Logger()
+
 /*
 DatabaseManager is the business logic to initialize database tables, roles and the default user
 */
 type DatabaseManager struct {
+	conf         *config.Config
+	txManager    domain.TxManager
 	databaseRepo domain.DatabaseRepo
+	userRepo     domain.UserRepo
 }
 
-func NewDatabaseManager(databaseRepo domain.DatabaseRepo) *DatabaseManager {
-	return &DatabaseManager{databaseRepo: databaseRepo}
+func NewDatabaseManager(conf *config.Config, txManager domain.TxManager, databaseRepo domain.DatabaseRepo, userRepo domain.UserRepo) *DatabaseManager {
+	return &DatabaseManager{
+		conf:         conf,
+		txManager:    txManager,
+		databaseRepo: databaseRepo,
+		userRepo:     userRepo,
+	}
 }
 
-func (m *DatabaseManager) Initialize(ctx context.Context) error {
+// Migrate creates or upgrades the database tables and the roles, without the default user
+func (m *DatabaseManager) Migrate(ctx context.Context) error {
 	return m.databaseRepo.Initialize(ctx)
 }
+
+// Initialize migrates the database and creates the default user, unless its password is left empty
+func (m *DatabaseManager) Initialize(ctx context.Context) error {
+	// tables and roles
+	err := m.Migrate(ctx)
+	if err != nil {
+		return err
+	}
+	if m.conf.DefaultUser.Password == "" {
+		return nil
+	}
+
+	// check if we have already created the admin user, happens during restart
+	user, err := m.userRepo.GetUserByUsername(ctx, m.conf.DefaultUser.Username)
+	if err != nil {
+		dbLogger.WithError(err).Error("failed to check if the default user exists or not")
+		return err
+	}
+	if user != nil {
+		return nil
+	}
+	dbLogger.Warnf("creating the default user '%s', change its password with the `user reset-password` command", m.conf.DefaultUser.Username)
+
+	hashedPassword, err := utils.HashPassword(ctx, m.conf.DefaultUser.Password)
+	if err != nil {
+		return err
+	}
+
+	// create the admin user and give it the admin role, all or nothing
+	return m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		adminUser, err := m.userRepo.Create(ctx, &domain.User{
+			Username: m.conf.DefaultUser.Username,
+			Password: hashedPassword,
+		})
+		if err != nil {
+			dbLogger.WithError(err).Error("failed to create admin user")
+			return err
+		}
+		err = assignRoles(ctx, m.userRepo, adminUser.ID, utils.AdminRole)
+		if err != nil {
+			dbLogger.WithError(err).Error("failed to assign admin role to the admin user")
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,43 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+func TestDatabaseManager(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+
+	// a restart must not fail nor create a second admin
+	if err := NewDatabaseManager(conf, repos.Tx, repos.Database, repos.Users).Initialize(ctx); err != nil {
+		t.Fatalf("second initialization failed: %v", err)
+	}
+	if users, err := repos.Users.ListUsers(ctx, 0, 10); err != nil || len(users) != 1 || users[0].Username != conf.DefaultUser.Username {
+		t.Errorf("expected the default user only, got %+v, %v", users, err)
+	}
+	// the admin gets every admin permission on top of the editor/viewer ones
+	assertPermissions(t, conf, repos, conf.DefaultUser.Username, conf.DefaultUser.Password,
+		[]string{utils.ManageSystemPermission, utils.CreateUserPermission, utils.CreateBlogPermission}, nil)
+}
+
+// TestNoDefaultUser the default user is left out without a password, as in the shipped config, the operators create
+// the first admin instead
+func TestNoDefaultUser(t *testing.T) {
+	ctx := context.Background()
+	conf := config.NewConfig()
+	repos := newTestRepos(conf)
+	if err := NewDatabaseManager(conf, repos.Tx, repos.Database, repos.Users).Initialize(ctx); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	if users, err := repos.Users.ListUsers(ctx, 0, 10); err != nil || len(users) != 0 {
+		t.Errorf("expected no users, got %+v, %v", users, err)
+	}
+	// the roles are there for the first admin
+	if _, err := repos.Users.GetRoleByName(ctx, utils.AdminRole); err != nil {
+		t.Errorf("expected the admin role, got %v", err)
+	}
+}
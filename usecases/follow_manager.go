@@ -0,0 +1,96 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+FollowManager lets the users follow the authors whose blogs they want to see in their feed.
+Following somebody twice, or unfollowing somebody who is not followed, is not an error.
+*/
+type FollowManager struct {
+	userRepo   domain.UserRepo
+	followRepo domain.FollowRepo
+}
+
+// FollowCounts how many users follow the user, and how many the user follows
+type FollowCounts struct {
+	Followers int64
+	Following int64
+}
+
+func NewFollowManager(userRepo domain.UserRepo, followRepo domain.FollowRepo) *FollowManager {
+	return &FollowManager{
+		userRepo:   userRepo,
+		followRepo: followRepo,
+	}
+}
+
+func (m *FollowManager) Follow(ctx context.Context, followerID int64, followeeID int64) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "FollowManager.Follow", trace.WithAttributes(attribute.Int64("followee.id", followeeID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if followerID == followeeID {
+		return domain.NewValidationError(domain.FieldError{Field: "id", Code: "self_follow", Message: "users can not follow themselves"})
+	}
+	if _, err := m.userRepo.GetUserByID(ctx, followeeID); err != nil {
+		return err
+	}
+	_, err = m.followRepo.Follow(ctx, &domain.Follow{FollowerID: followerID, FolloweeID: followeeID})
+	return err
+}
+
+func (m *FollowManager) Unfollow(ctx context.Context, followerID int64, followeeID int64) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "FollowManager.Unfollow", trace.WithAttributes(attribute.Int64("followee.id", followeeID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if _, err := m.userRepo.GetUserByID(ctx, followeeID); err != nil {
+		return err
+	}
+	_, err = m.followRepo.Unfollow(ctx, &domain.Follow{FollowerID: followerID, FolloweeID: followeeID})
+	return err
+}
+
+// Followers returns who follows the user, newest first
+func (m *FollowManager) Followers(ctx context.Context, userID int64, offset int, limit int) (follows []*domain.Follow, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "FollowManager.Followers", trace.WithAttributes(
+		attribute.Int64("user.id", userID), attribute.Int("offset", offset), attribute.Int("limit", limit)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if _, err := m.userRepo.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return m.followRepo.Followers(ctx, userID, offset, limit)
+}
+
+// Following returns whom the user follows, newest first
+func (m *FollowManager) Following(ctx context.Context, userID int64, offset int, limit int) (follows []*domain.Follow, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "FollowManager.Following", trace.WithAttributes(
+		attribute.Int64("user.id", userID), attribute.Int("offset", offset), attribute.Int("limit", limit)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if _, err := m.userRepo.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return m.followRepo.Following(ctx, userID, offset, limit)
+}
+
+func (m *FollowManager) Counts(ctx context.Context, userID int64) (counts *FollowCounts, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "FollowManager.Counts", trace.WithAttributes(attribute.Int64("user.id", userID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if _, err := m.userRepo.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	followers, following, err := m.followRepo.Counts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &FollowCounts{Followers: followers, Following: following}, nil
+}
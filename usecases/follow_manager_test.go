@@ -0,0 +1,44 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+func TestFollowManager(t *testing.T) {
+	ctx := context.Background()
+	_, repos := setUp(t)
+	leo := createUser(t, repos, "leo")
+	ned := createUser(t, repos, "ned")
+	followManager := NewFollowManager(repos.Users, repos.Follows)
+
+	// following twice, or unfollowing somebody who is not followed, is not an error
+	for i := 0; i < 2; i++ {
+		if err := followManager.Follow(ctx, leo.ID, ned.ID); err != nil {
+			t.Fatalf("failed to follow: %v", err)
+		}
+	}
+	if counts, err := followManager.Counts(ctx, ned.ID); err != nil || counts.Followers != 1 || counts.Following != 0 {
+		t.Errorf("expected ned to have one follower, got %+v, %v", counts, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := followManager.Unfollow(ctx, leo.ID, ned.ID); err != nil {
+			t.Fatalf("failed to unfollow: %v", err)
+		}
+	}
+
+	var validationErr *domain.ValidationError
+	if err := followManager.Follow(ctx, leo.ID, leo.ID); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error when following oneself, got %v", err)
+	}
+	var notFoundErr *domain.NotFoundError
+	if err := followManager.Follow(ctx, leo.ID, ned.ID+1000); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error when following an unknown user, got %v", err)
+	}
+	if _, err := followManager.Followers(ctx, ned.ID+1000, 0, 10); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for the followers of an unknown user, got %v", err)
+	}
+}
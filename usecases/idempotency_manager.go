@@ -0,0 +1,118 @@
+package usecases
+
+import (
+	"context"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key, a UUID is 36 characters
+const maxIdempotencyKeyLength = 255
+
+// idempotencyKeyField is the field of the errors about the key, which comes in a header rather than in the body
+const idempotencyKeyField = "Idempotency-Key"
+
+/*
+IdempotencyManager makes the retries of a request harmless. The first request made with a key reserves it and runs,
+its response is kept for idempotency.ttlhours and replayed to the retries. A retry which comes while the first request
+is still running is turned down rather than run a second time, so is a request which reuses the key for something
+else. A request which fails on the server side gives the key back, the retry runs again. A request which never
+finishes, e.g. because its server died, holds the key for idempotency.leaseseconds only, its retry runs afterwards.
+*/
+type IdempotencyManager struct {
+	conf            *config.Config
+	idempotencyRepo domain.IdempotencyRepo
+}
+
+func NewIdempotencyManager(conf *config.Config, idempotencyRepo domain.IdempotencyRepo) *IdempotencyManager {
+	return &IdempotencyManager{
+		conf:            conf,
+		idempotencyRepo: idempotencyRepo,
+	}
+}
+
+// Begin reserves the key of the user for the request with the fingerprint. A nil replay means that the caller runs the
+// request and then calls Finish, otherwise replay has the response of the first request.
+func (m *IdempotencyManager) Begin(ctx context.Context, userID int64, key string, fingerprint string) (replay *domain.IdempotentRequest, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "IdempotencyManager.Begin", trace.WithAttributes(attribute.Int64("user.id", userID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if err := validateIdempotencyKey(key); err != nil {
+		return nil, err
+	}
+	existing, err := m.idempotencyRepo.Reserve(ctx, &domain.IdempotentRequest{
+		UserID:      userID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   time.Now().Add(time.Duration(m.conf.Idempotency.TTLHours) * time.Hour),
+	}, time.Duration(m.conf.Idempotency.LeaseSeconds)*time.Second)
+	switch {
+	case err != nil:
+		return nil, err
+	case existing == nil:
+		return nil, nil
+	case existing.Fingerprint != fingerprint:
+		return nil, domain.NewValidationError(domain.FieldError{Field: idempotencyKeyField, Code: "key_reused",
+			Message: "was already used for a different request"})
+	case !existing.Done():
+		return nil, domain.NewConflictError("idempotent request", "a request with the same Idempotency-Key is still in progress")
+	}
+	span.SetAttributes(attribute.Bool("replayed", true))
+	return existing, nil
+}
+
+// Finish keeps the response of the request begun with the key. A server error is not kept, the key is given back
+// instead so that the retry runs again.
+func (m *IdempotencyManager) Finish(ctx context.Context, userID int64, key string, status int, contentType string, body []byte) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "IdempotencyManager.Finish", trace.WithAttributes(
+		attribute.Int64("user.id", userID), attribute.Int("status", status)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if status >= 500 {
+		return m.idempotencyRepo.Release(ctx, userID, key)
+	}
+	return m.idempotencyRepo.Complete(ctx, &domain.IdempotentRequest{
+		UserID:      userID,
+		Key:         key,
+		Status:      status,
+		ContentType: contentType,
+		Body:        body,
+	})
+}
+
+// Abandon gives the key back without a response, e.g. when the request panicked
+func (m *IdempotencyManager) Abandon(ctx context.Context, userID int64, key string) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "IdempotencyManager.Abandon", trace.WithAttributes(attribute.Int64("user.id", userID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	return m.idempotencyRepo.Release(ctx, userID, key)
+}
+
+// CleanupExpired deletes the responses which are no longer replayed and returns how many it deleted
+func (m *IdempotencyManager) CleanupExpired(ctx context.Context) (deleted int, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "IdempotencyManager.CleanupExpired")
+	defer func() { utils.EndSpan(span, err) }()
+
+	return m.idempotencyRepo.DeleteExpired(ctx, time.Now())
+}
+
+// validateIdempotencyKey the key is printable ASCII, which is what a header value can safely carry
+func validateIdempotencyKey(key string) error {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return domain.NewValidationError(domain.FieldError{Field: idempotencyKeyField, Code: "invalid",
+			Message: "must be between 1 and 255 characters long"})
+	}
+	for _, c := range key {
+		if c < ' ' || c > '~' {
+			return domain.NewValidationError(domain.FieldError{Field: idempotencyKeyField, Code: "invalid",
+				Message: "may only contain printable ASCII characters"})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+func TestIdempotencyManager(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+	ann := createUser(t, repos, "ann")
+	bob := createUser(t, repos, "bob")
+	idempotencyManager := NewIdempotencyManager(conf, repos.Idempotency)
+
+	// the first request runs, its retries get its response
+	if replay, err := idempotencyManager.Begin(ctx, ann.ID, "key-1", "create blog"); err != nil || replay != nil {
+		t.Fatalf("expected the first request to run, got %+v, %v", replay, err)
+	}
+	var conflictErr *domain.ConflictError
+	if _, err := idempotencyManager.Begin(ctx, ann.ID, "key-1", "create blog"); !errors.As(err, &conflictErr) {
+		t.Errorf("expected a conflict while the first request runs, got %v", err)
+	}
+	if err := idempotencyManager.Finish(ctx, ann.ID, "key-1", 201, "application/json", []byte(`{"id":7}`)); err != nil {
+		t.Fatalf("failed to finish: %v", err)
+	}
+	replay, err := idempotencyManager.Begin(ctx, ann.ID, "key-1", "create blog")
+	if err != nil || replay == nil || replay.Status != 201 || replay.ContentType != "application/json" || string(replay.Body) != `{"id":7}` {
+		t.Errorf("expected the response of the first request, got %+v, %v", replay, err)
+	}
+	var validationErr *domain.ValidationError
+	if _, err := idempotencyManager.Begin(ctx, ann.ID, "key-1", "create comment"); !errors.As(err, &validationErr) || validationErr.Fields[0].Code != "key_reused" {
+		t.Errorf("expected the key to be turned down for a different request, got %v", err)
+	}
+	// the keys are per user
+	if replay, err := idempotencyManager.Begin(ctx, bob.ID, "key-1", "create comment"); err != nil || replay != nil {
+		t.Errorf("expected the key of another user to be free, got %+v, %v", replay, err)
+	}
+	for _, key := range []string{"", strings.Repeat("k", 256), "key\n1", "ключ"} {
+		if _, err := idempotencyManager.Begin(ctx, ann.ID, key, "create blog"); !errors.As(err, &validationErr) {
+			t.Errorf("expected the key %q to be invalid, got %v", key, err)
+		}
+	}
+
+	// a server error gives the key back
+	if _, err := idempotencyManager.Begin(ctx, ann.ID, "key-2", "create blog"); err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	if err := idempotencyManager.Finish(ctx, ann.ID, "key-2", 500, "application/problem+json", []byte(`{}`)); err != nil {
+		t.Fatalf("failed to finish: %v", err)
+	}
+	if replay, err := idempotencyManager.Begin(ctx, ann.ID, "key-2", "create blog"); err != nil || replay != nil {
+		t.Errorf("expected the retry of a failed request to run, got %+v, %v", replay, err)
+	}
+
+	// a request which is still running after its lease is taken over by its retry, but not by another request
+	if _, err := idempotencyManager.Begin(ctx, ann.ID, "key-5", "create blog"); err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	conf.Idempotency.LeaseSeconds = -1
+	if _, err := idempotencyManager.Begin(ctx, ann.ID, "key-5", "create comment"); !errors.As(err, &validationErr) || validationErr.Fields[0].Code != "key_reused" {
+		t.Errorf("expected the key to be turned down for a different request after the lease, got %v", err)
+	}
+	if replay, err := idempotencyManager.Begin(ctx, ann.ID, "key-5", "create blog"); err != nil || replay != nil {
+		t.Errorf("expected the retry to take over after the lease, got %+v, %v", replay, err)
+	}
+	// a finished request is replayed whatever the lease
+	if err := idempotencyManager.Finish(ctx, ann.ID, "key-5", 201, "application/json", []byte(`{"id":8}`)); err != nil {
+		t.Fatalf("failed to finish: %v", err)
+	}
+	if replay, err := idempotencyManager.Begin(ctx, ann.ID, "key-5", "create blog"); err != nil || replay == nil || replay.Status != 201 {
+		t.Errorf("expected the response of the finished request, got %+v, %v", replay, err)
+	}
+	conf.Idempotency.LeaseSeconds = 60
+
+	// an expired request is replaced, and deleted by the cleanup
+	expired := &domain.IdempotentRequest{UserID: ann.ID, Key: "key-3", Fingerprint: "old", ExpiresAt: time.Now().Add(-time.Minute)}
+	if existing, err := repos.Idempotency.Reserve(ctx, expired, time.Minute); err != nil || existing != nil {
+		t.Fatalf("failed to reserve: %+v, %v", existing, err)
+	}
+	if replay, err := idempotencyManager.Begin(ctx, ann.ID, "key-3", "new"); err != nil || replay != nil {
+		t.Errorf("expected an expired key to be free, got %+v, %v", replay, err)
+	}
+	expired.Key = "key-4"
+	if _, err := repos.Idempotency.Reserve(ctx, expired, time.Minute); err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	if deleted, err := idempotencyManager.CleanupExpired(ctx); err != nil || deleted != 1 {
+		t.Errorf("expected the expired request to be deleted, got %d, %v", deleted, err)
+	}
+	if existing, err := repos.Idempotency.Reserve(ctx, &domain.IdempotentRequest{UserID: ann.ID, Key: "key-1", ExpiresAt: time.Now().Add(time.Hour)}, time.Minute); err != nil || existing == nil {
+		t.Errorf("expected the unexpired requests to survive the cleanup, got %+v, %v", existing, err)
+	}
+}
+
+func TestConcurrentIdempotentRequests(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+	user := createUser(t, repos, "retrier")
+	idempotencyManager := NewIdempotencyManager(conf, repos.Idempotency)
+
+	// the same request sent many times at once runs only once
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	runs, conflicts := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			replay, err := idempotencyManager.Begin(ctx, user.ID, "retried", "create blog")
+			var conflictErr *domain.ConflictError
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.As(err, &conflictErr):
+				conflicts++
+			case err != nil:
+				t.Errorf("failed to begin: %v", err)
+			case replay == nil:
+				runs++
+			}
+		}()
+	}
+	wg.Wait()
+	if runs != 1 || conflicts != 19 {
+		t.Errorf("expected one run and 19 conflicts, got %d runs and %d conflicts", runs, conflicts)
+	}
+}
@@ -0,0 +1,428 @@
+package usecases
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+var mediaLogger = utils.Logger()
+
+const (
+	// orphanBatch is how many orphans the cleanup reads at a time
+	orphanBatch = 100
+	// thumbnailVariant is the name of the square variant, the others are named after their width, e.g. "w640"
+	thumbnailVariant = "thumb"
+)
+
+// the extensions of the blob keys, the other types get the one registered with the mime package
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+/*
+MediaManager keeps the uploaded files in the BlobStore and tracks them in the MediaRepo. The content type is sniffed
+from the content, whatever the client claims, and the dimensions of the images are read from their headers. An
+upload which never gets attached to a blog is deleted by CleanupOrphans.
+
+The images lose their GPS position on upload and get smaller variants, which are made on their first request and kept
+in the BlobStore next to the image.
+*/
+type MediaManager struct {
+	conf      *config.Config
+	txManager domain.TxManager
+	blogRepo  domain.BlogRepo
+	mediaRepo domain.MediaRepo
+	blobStore domain.BlobStore
+	processor domain.ImageProcessor
+	// formats are the configured variant formats the processor can encode
+	formats []string
+	// generating makes a variant requested by many readers at once only once
+	generating singleflight.Group
+}
+
+func NewMediaManager(conf *config.Config, txManager domain.TxManager, blogRepo domain.BlogRepo, mediaRepo domain.MediaRepo, blobStore domain.BlobStore, processor domain.ImageProcessor) *MediaManager {
+	supported := map[string]bool{}
+	for _, format := range processor.Formats() {
+		supported[format] = true
+	}
+	var formats []string
+	for _, format := range conf.Media.Variants.Formats {
+		if supported[format] {
+			formats = append(formats, format)
+		} else {
+			mediaLogger.Warnf("the image variants can not be encoded in %s, it is skipped", format)
+		}
+	}
+	return &MediaManager{
+		conf:      conf,
+		txManager: txManager,
+		blogRepo:  blogRepo,
+		mediaRepo: mediaRepo,
+		blobStore: blobStore,
+		processor: processor,
+		formats:   formats,
+	}
+}
+
+// Upload stores the content for the user, when blogID is not 0 the media is attached to the user's blog right away
+func (m *MediaManager) Upload(ctx context.Context, userID int64, blogID int64, content io.Reader) (media *domain.Media, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "MediaManager.Upload", trace.WithAttributes(attribute.Int64("blog.id", blogID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	// one byte more than allowed tells a file which is too large
+	data, err := io.ReadAll(io.LimitReader(content, m.conf.Media.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	media = &domain.Media{UserID: userID, BlogID: blogID, Size: int64(len(data))}
+	err = m.inspect(media, data)
+	if err != nil {
+		return nil, err
+	}
+	if media.Width > 0 {
+		m.processor.StripLocation(data)
+	}
+	if blogID != 0 {
+		err = m.checkOwnBlog(ctx, userID, blogID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	media.Key, err = newBlobKey(media.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	err = m.blobStore.Put(ctx, media.Key, media.ContentType, media.Size, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	mediaID, err := m.mediaRepo.Create(ctx, media)
+	if err != nil {
+		// nothing refers to the blob
+		if deleteErr := m.blobStore.Delete(ctx, media.Key); deleteErr != nil {
+			mediaLogger.WithError(deleteErr).Errorf("failed to delete the blob of a failed upload. key: %s", media.Key)
+		}
+		return nil, err
+	}
+	return m.get(ctx, mediaID)
+}
+
+// Attach links the user's media to the user's blog
+func (m *MediaManager) Attach(ctx context.Context, userID int64, mediaID int64, blogID int64) (media *domain.Media, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "MediaManager.Attach", trace.WithAttributes(attribute.Int64("media.id", mediaID), attribute.Int64("blog.id", blogID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	err = m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		media, err := m.mediaRepo.Get(ctx, mediaID)
+		if err != nil {
+			return err
+		}
+		if media.UserID != userID {
+			return domain.NewForbiddenError("only the uploader of the media can attach it")
+		}
+		err = m.checkOwnBlog(ctx, userID, blogID)
+		if err != nil {
+			return err
+		}
+		return m.mediaRepo.Attach(ctx, mediaID, blogID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.get(ctx, mediaID)
+}
+
+// Open returns the media and its content, which the caller closes. The media of a blog is readable by the readers
+// of the blog, a media which is not attached yet only by its uploader.
+func (m *MediaManager) Open(ctx context.Context, viewer *domain.Viewer, mediaID int64) (media *domain.Media, content io.ReadCloser, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "MediaManager.Open", trace.WithAttributes(attribute.Int64("media.id", mediaID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	media, err = m.getReadable(ctx, viewer, mediaID)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err = m.blobStore.Get(ctx, media.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return media, content, nil
+}
+
+// OpenVariant returns the variant of the image and its content, which the caller closes. The variant is made when it
+// is requested for the first time. The variants are readable by whoever can read the image.
+func (m *MediaManager) OpenVariant(ctx context.Context, viewer *domain.Viewer, mediaID int64, name string, format string) (variant *domain.MediaVariant, content io.ReadCloser, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "MediaManager.OpenVariant", trace.WithAttributes(
+		attribute.Int64("media.id", mediaID), attribute.String("variant.name", name), attribute.String("variant.format", format)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	media, err := m.getReadable(ctx, viewer, mediaID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range media.Variants {
+		if media.Variants[i].Name == name && media.Variants[i].Format == format {
+			variant = &media.Variants[i]
+		}
+	}
+	if variant == nil {
+		return nil, nil, domain.NewNotFoundError("media variant", fmt.Sprintf("%d/%s.%s", mediaID, name, format))
+	}
+
+	key := variantKey(media, *variant)
+	content, err = m.blobStore.Get(ctx, key)
+	var notFoundErr *domain.NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		return variant, content, err
+	}
+	// the readers of a new variant wait for the first one to make it
+	encoded, err, _ := m.generating.Do(key, func() (any, error) {
+		return m.generateVariant(ctx, media, *variant, key)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return variant, io.NopCloser(bytes.NewReader(encoded.([]byte))), nil
+}
+
+// ListByBlog lists the media of the blog when the viewer can read it, oldest first
+func (m *MediaManager) ListByBlog(ctx context.Context, viewer *domain.Viewer, blogID int64) (media []*domain.Media, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "MediaManager.ListByBlog", trace.WithAttributes(attribute.Int64("blog.id", blogID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if _, err = getReadableBlog(ctx, m.blogRepo, viewer, blogID); err != nil {
+		return nil, err
+	}
+	media, err = m.mediaRepo.ListByBlog(ctx, blogID)
+	if err != nil {
+		return nil, err
+	}
+	for _, found := range media {
+		m.complete(found)
+	}
+	return media, nil
+}
+
+// CleanupOrphans deletes the media which have not been attached to a blog within media.orphanhours, along with
+// their blobs, and returns how many it deleted
+func (m *MediaManager) CleanupOrphans(ctx context.Context) (deleted int, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "MediaManager.CleanupOrphans")
+	defer func() { utils.EndSpan(span, err) }()
+
+	before := time.Now().Add(-time.Duration(m.conf.Media.OrphanHours) * time.Hour)
+	for {
+		orphans, err := m.mediaRepo.Orphans(ctx, before, orphanBatch)
+		if err != nil {
+			return deleted, err
+		}
+		if len(orphans) == 0 {
+			return deleted, nil
+		}
+		for _, orphan := range orphans {
+			// the row goes first, an upload attached in the meantime keeps its blob
+			ok, err := m.mediaRepo.DeleteOrphan(ctx, orphan.ID)
+			if err != nil {
+				return deleted, err
+			}
+			if !ok {
+				continue
+			}
+			// the variants which were never requested are not there, deleting them anyway is fine
+			keys := []string{orphan.Key}
+			for _, variant := range m.variants(orphan) {
+				keys = append(keys, variantKey(orphan, variant))
+			}
+			for _, key := range keys {
+				if err := m.blobStore.Delete(ctx, key); err != nil {
+					mediaLogger.WithError(err).Errorf("failed to delete the blob of an orphan. key: %s", key)
+				}
+			}
+			deleted++
+		}
+	}
+}
+
+// inspect fills in the content type and the dimensions, or tells why the upload is not acceptable
+func (m *MediaManager) inspect(media *domain.Media, data []byte) error {
+	if media.Size == 0 {
+		return domain.NewValidationError(domain.FieldError{Field: "file", Code: "required", Message: "must not be empty"})
+	}
+	if media.Size > m.conf.Media.MaxSize {
+		return domain.NewValidationError(domain.FieldError{Field: "file", Code: "too_large",
+			Message: fmt.Sprintf("must not be larger than %d bytes", m.conf.Media.MaxSize)})
+	}
+
+	// DetectContentType looks at the first 512 bytes only and may add parameters, e.g. "; charset=utf-8"
+	media.ContentType, _, _ = strings.Cut(http.DetectContentType(data), ";")
+	if !m.isAcceptedType(media.ContentType) {
+		return domain.NewValidationError(domain.FieldError{Field: "file", Code: "unsupported_type",
+			Message: fmt.Sprintf("must be one of %s, got %s", strings.Join(m.conf.Media.Types, ", "), media.ContentType)})
+	}
+
+	if strings.HasPrefix(media.ContentType, "image/") {
+		width, height, err := m.processor.Inspect(data)
+		if err != nil || width <= 0 || height <= 0 {
+			return domain.NewValidationError(domain.FieldError{Field: "file", Code: "invalid_image", Message: "is not a readable image"})
+		}
+		if maxPixels := m.conf.Media.MaxPixels; maxPixels > 0 && int64(width)*int64(height) > maxPixels {
+			return domain.NewValidationError(domain.FieldError{Field: "file", Code: "invalid_image",
+				Message: fmt.Sprintf("must not have more than %d pixels", maxPixels)})
+		}
+		media.Width, media.Height = width, height
+	}
+	return nil
+}
+
+func (m *MediaManager) get(ctx context.Context, mediaID int64) (*domain.Media, error) {
+	media, err := m.mediaRepo.Get(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	m.complete(media)
+	return media, nil
+}
+
+// getReadable returns the media when the viewer can read it. The media of a blog is readable by the readers of the
+// blog, a media which is not attached yet only by its uploader.
+func (m *MediaManager) getReadable(ctx context.Context, viewer *domain.Viewer, mediaID int64) (*domain.Media, error) {
+	media, err := m.get(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if media.BlogID == 0 {
+		if viewer.IsAnonymous() || viewer.UserID != media.UserID {
+			return nil, domain.NewNotFoundError("media", mediaID)
+		}
+	} else if _, err = getReadableBlog(ctx, m.blogRepo, viewer, media.BlogID); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// complete fills in what is not stored with the media
+func (m *MediaManager) complete(media *domain.Media) {
+	media.Variants = m.variants(media)
+}
+
+// variants are the variants of an image in every format, a thumbnail and one for each configured width smaller than
+// the image. The images are never scaled up.
+func (m *MediaManager) variants(media *domain.Media) []domain.MediaVariant {
+	if media.Width <= 0 || media.Height <= 0 {
+		return nil
+	}
+	widths := append([]int{}, m.conf.Media.Variants.Widths...)
+	sort.Ints(widths)
+
+	var variants []domain.MediaVariant
+	for _, format := range m.formats {
+		if thumbnail := m.conf.Media.Variants.Thumbnail; thumbnail > 0 {
+			size := thumbnail
+			if media.Width < size {
+				size = media.Width
+			}
+			if media.Height < size {
+				size = media.Height
+			}
+			variants = append(variants, domain.MediaVariant{Name: thumbnailVariant, Format: format, Width: size, Height: size, Crop: true})
+		}
+		for i, width := range widths {
+			if width <= 0 || width >= media.Width || (i > 0 && width == widths[i-1]) {
+				continue
+			}
+			height := (media.Height*width + media.Width/2) / media.Width
+			if height < 1 {
+				height = 1
+			}
+			variants = append(variants, domain.MediaVariant{Name: fmt.Sprintf("w%d", width), Format: format, Width: width, Height: height})
+		}
+	}
+	return variants
+}
+
+// generateVariant makes the variant from the image and keeps it in the BlobStore for the next requests
+func (m *MediaManager) generateVariant(ctx context.Context, media *domain.Media, variant domain.MediaVariant, key string) ([]byte, error) {
+	original, err := m.blobStore.Get(ctx, media.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer original.Close()
+	data, err := io.ReadAll(original)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := m.processor.Encode(data, variant)
+	if err != nil {
+		return nil, err
+	}
+	err = m.blobStore.Put(ctx, key, variant.ContentType(), int64(len(encoded)), bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	mediaLogger.Debugf("made the variant %s.%s of media %d, %d bytes", variant.Name, variant.Format, media.ID, len(encoded))
+	return encoded, nil
+}
+
+func (m *MediaManager) isAcceptedType(contentType string) bool {
+	for _, accepted := range m.conf.Media.Types {
+		if contentType == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MediaManager) checkOwnBlog(ctx context.Context, userID int64, blogID int64) error {
+	blog, err := m.blogRepo.Get(ctx, blogID)
+	if err != nil {
+		return err
+	}
+	if blog.UserID != userID {
+		return domain.NewForbiddenError("only the author of the blog can attach media to it")
+	}
+	return nil
+}
+
+// variantKey the variants are kept next to the image, e.g. media/ab/abcd/w640.webp for media/ab/abcd.jpg
+func variantKey(media *domain.Media, variant domain.MediaVariant) string {
+	return fmt.Sprintf("%s/%s.%s", strings.TrimSuffix(media.Key, path.Ext(media.Key)), variant.Name, variant.Format)
+}
+
+// newBlobKey is random so that the keys can not be guessed, the first two characters spread the blobs over directories
+func newBlobKey(contentType string) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(random)
+
+	extension, ok := mediaExtensions[contentType]
+	if !ok {
+		if extensions, err := mime.ExtensionsByType(contentType); err == nil && len(extensions) > 0 {
+			extension = extensions[0]
+		}
+	}
+	return fmt.Sprintf("media/%s/%s%s", name[:2], name, extension), nil
+}
@@ -0,0 +1,313 @@
+package usecases
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/gateways/blobs"
+	"github.com/bipuldutta/blogzilla/gateways/imaging"
+)
+
+func TestMediaManager(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+	author := createUser(t, repos, "zoe")
+	other := createUser(t, repos, "zak")
+	blobStore, err := blobs.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create the blob store: %v", err)
+	}
+	conf.Media.MaxSize = 4096
+	mediaManager := NewMediaManager(conf, repos.Tx, repos.Blogs, repos.Media, blobStore, imaging.NewProcessor(conf.Media.Variants.Quality, conf.Media.MaxPixels))
+
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Pictures", Content: "Content", Visibility: domain.VisibilityPublic})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	privateID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Secret", Content: "Content", Visibility: domain.VisibilityPrivate})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+
+	// the type and the dimensions come from the content
+	pngImage := encodeImage(t, "png", 3, 2)
+	uploaded, err := mediaManager.Upload(ctx, author.ID, 0, bytes.NewReader(pngImage))
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	if uploaded.ContentType != "image/png" || uploaded.Width != 3 || uploaded.Height != 2 || uploaded.Size != int64(len(pngImage)) ||
+		uploaded.BlogID != 0 || uploaded.UserID != author.ID || uploaded.CreatedAt.IsZero() {
+		t.Errorf("unexpected media %+v", uploaded)
+	}
+	jpegMedia, err := mediaManager.Upload(ctx, author.ID, blogID, bytes.NewReader(encodeImage(t, "jpeg", 5, 4)))
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	if jpegMedia.ContentType != "image/jpeg" || jpegMedia.Width != 5 || jpegMedia.Height != 4 || jpegMedia.BlogID != blogID {
+		t.Errorf("unexpected media %+v", jpegMedia)
+	}
+
+	for name, content := range map[string][]byte{
+		"empty":     nil,
+		"text":      []byte("just some text"),
+		"too large": append(append([]byte{}, pngImage...), make([]byte, conf.Media.MaxSize)...),
+		"broken":    pngImage[:20],
+		// a few bytes which would take gigabytes once decoded
+		"too many pixels": withDimensions(pngImage, 60000, 60000),
+	} {
+		var validationErr *domain.ValidationError
+		if _, err := mediaManager.Upload(ctx, author.ID, 0, bytes.NewReader(content)); !errors.As(err, &validationErr) {
+			t.Errorf("expected a validation error for the %s upload, got %v", name, err)
+		}
+	}
+	var forbiddenErr *domain.ForbiddenError
+	if _, err := mediaManager.Upload(ctx, other.ID, blogID, bytes.NewReader(pngImage)); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected a forbidden error for an upload to the blog of somebody else, got %v", err)
+	}
+
+	// only the uploader sees the media before it is attached
+	readMedia := func(viewer *domain.Viewer, mediaID int64) ([]byte, error) {
+		t.Helper()
+		_, content, err := mediaManager.Open(ctx, viewer, mediaID)
+		if err != nil {
+			return nil, err
+		}
+		defer content.Close()
+		return io.ReadAll(content)
+	}
+	if content, err := readMedia(member(author), uploaded.ID); err != nil || !bytes.Equal(content, pngImage) {
+		t.Errorf("expected the uploader to read the media, got %d bytes, %v", len(content), err)
+	}
+	var notFoundErr *domain.NotFoundError
+	for _, viewer := range []*domain.Viewer{member(other), {}} {
+		if _, err := readMedia(viewer, uploaded.ID); !errors.As(err, &notFoundErr) {
+			t.Errorf("expected a not found error for the unattached media of somebody else, got %v", err)
+		}
+	}
+
+	if _, err := mediaManager.Attach(ctx, other.ID, uploaded.ID, blogID); !errors.As(err, &forbiddenErr) {
+		t.Errorf("expected a forbidden error for attaching the media of somebody else, got %v", err)
+	}
+	attached, err := mediaManager.Attach(ctx, author.ID, uploaded.ID, blogID)
+	if err != nil || attached.BlogID != blogID {
+		t.Fatalf("expected the media to be attached, got %+v, %v", attached, err)
+	}
+	// the media of a blog follows the visibility of the blog
+	if _, err := readMedia(&domain.Viewer{}, uploaded.ID); err != nil {
+		t.Errorf("expected the media of a public blog to be readable, got %v", err)
+	}
+	list, err := mediaManager.ListByBlog(ctx, member(other), blogID)
+	if err != nil || len(list) != 2 || list[0].ID != uploaded.ID || list[1].ID != jpegMedia.ID {
+		t.Errorf("expected both media of the blog, got %+v, %v", list, err)
+	}
+	secret, err := mediaManager.Upload(ctx, author.ID, privateID, bytes.NewReader(pngImage))
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	if _, err := readMedia(member(other), secret.ID); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for the media of a private blog, got %v", err)
+	}
+	if _, err := mediaManager.ListByBlog(ctx, member(other), privateID); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for the media list of a private blog, got %v", err)
+	}
+
+	// only the unattached media old enough are cleaned up, along with their blobs
+	orphan, err := mediaManager.Upload(ctx, author.ID, 0, bytes.NewReader(pngImage))
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	conf.Media.OrphanHours = 1
+	if deleted, err := mediaManager.CleanupOrphans(ctx); err != nil || deleted != 0 {
+		t.Errorf("expected a fresh orphan to be kept, got %d, %v", deleted, err)
+	}
+	conf.Media.OrphanHours = -1
+	if deleted, err := mediaManager.CleanupOrphans(ctx); err != nil || deleted != 1 {
+		t.Errorf("expected one orphan to be deleted, got %d, %v", deleted, err)
+	}
+	if _, err := repos.Media.Get(ctx, orphan.ID); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected the orphan to be gone, got %v", err)
+	}
+	if _, err := blobStore.Get(ctx, orphan.Key); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected the blob of the orphan to be gone, got %v", err)
+	}
+	if _, err := repos.Media.Get(ctx, uploaded.ID); err != nil {
+		t.Errorf("expected the attached media to be kept, got %v", err)
+	}
+}
+
+func TestMediaVariants(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+	author := createUser(t, repos, "ada")
+	other := createUser(t, repos, "bob")
+	blobStore, err := blobs.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create the blob store: %v", err)
+	}
+	conf.Media.Variants = config.VariantsConfig{Thumbnail: 4, Widths: []int{16, 8, 64}, Formats: []string{"webp", "jpeg"}, Quality: 80}
+	processor := imaging.NewProcessor(conf.Media.Variants.Quality, conf.Media.MaxPixels)
+	mediaManager := NewMediaManager(conf, repos.Tx, repos.Blogs, repos.Media, blobStore, processor)
+
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Photos", Content: "Content", Visibility: domain.VisibilityPrivate})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	media, err := mediaManager.Upload(ctx, author.ID, blogID, bytes.NewReader(encodeImage(t, "png", 32, 20)))
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+
+	// the widths are sorted and the image is never scaled up, webp only when the processor can encode it
+	var expected []domain.MediaVariant
+	for _, format := range conf.Media.Variants.Formats {
+		if contains(processor.Formats(), format) {
+			expected = append(expected,
+				domain.MediaVariant{Name: "thumb", Format: format, Width: 4, Height: 4, Crop: true},
+				domain.MediaVariant{Name: "w8", Format: format, Width: 8, Height: 5},
+				domain.MediaVariant{Name: "w16", Format: format, Width: 16, Height: 10})
+		}
+	}
+	if fmt.Sprint(media.Variants) != fmt.Sprint(expected) {
+		t.Errorf("expected the variants %v, got %v", expected, media.Variants)
+	}
+
+	readVariant := func(viewer *domain.Viewer, name string, format string) (image.Image, string, error) {
+		t.Helper()
+		_, content, err := mediaManager.OpenVariant(ctx, viewer, media.ID, name, format)
+		if err != nil {
+			return nil, "", err
+		}
+		defer content.Close()
+		img, decodedFormat, err := image.Decode(content)
+		if err != nil {
+			t.Fatalf("failed to decode the variant %s.%s: %v", name, format, err)
+		}
+		return img, decodedFormat, nil
+	}
+	for _, variant := range expected {
+		// the second read finds the variant in the blob store
+		for i := 0; i < 2; i++ {
+			img, format, err := readVariant(member(author), variant.Name, variant.Format)
+			if err != nil || format != variant.Format || img.Bounds().Dx() != variant.Width || img.Bounds().Dy() != variant.Height {
+				t.Errorf("expected the %dx%d variant %s.%s, got %v %s, %v", variant.Width, variant.Height, variant.Name, variant.Format, img.Bounds(), format, err)
+			}
+		}
+	}
+	if _, err := blobStore.Get(ctx, strings.TrimSuffix(media.Key, ".png")+"/w8.jpeg"); err != nil {
+		t.Errorf("expected the variant to be kept in the blob store, got %v", err)
+	}
+
+	var notFoundErr *domain.NotFoundError
+	for _, variant := range [][2]string{{"w64", "jpeg"}, {"w16", "png"}, {"large", "jpeg"}} {
+		if _, _, err := readVariant(member(author), variant[0], variant[1]); !errors.As(err, &notFoundErr) {
+			t.Errorf("expected a not found error for the variant %s.%s, got %v", variant[0], variant[1], err)
+		}
+	}
+	if _, _, err := readVariant(member(other), "w8", "jpeg"); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for the variant of an image in a private blog, got %v", err)
+	}
+
+	// a photo taken with the phone turned keeps its orientation but loses where it was taken
+	photo := withEXIF(t, encodeImage(t, "jpeg", 32, 20), 6, "GPS SECRET")
+	turned, err := mediaManager.Upload(ctx, author.ID, blogID, bytes.NewReader(photo))
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	if turned.Width != 20 || turned.Height != 32 {
+		t.Errorf("expected the turned photo to be 20x32, got %dx%d", turned.Width, turned.Height)
+	}
+	_, content, err := mediaManager.Open(ctx, member(author), turned.ID)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	stored, err := io.ReadAll(content)
+	content.Close()
+	if err != nil || len(stored) != len(photo) || bytes.Contains(stored, []byte("GPS SECRET")) {
+		t.Errorf("expected the stored photo to have the same size without the GPS data, got %d bytes, %v", len(stored), err)
+	}
+	if width, height, err := processor.Inspect(stored); err != nil || width != 20 || height != 32 {
+		t.Errorf("expected the stored photo to keep its orientation, got %dx%d, %v", width, height, err)
+	}
+	_, content, err = mediaManager.OpenVariant(ctx, member(author), turned.ID, "w16", "jpeg")
+	if err != nil {
+		t.Fatalf("failed to open the variant: %v", err)
+	}
+	defer content.Close()
+	if img, _, err := image.Decode(content); err != nil || img.Bounds().Dx() != 16 || img.Bounds().Dy() != 26 {
+		t.Errorf("expected the variant of the turned photo to be 16x26, got %v, %v", img, err)
+	}
+}
+
+// withEXIF adds EXIF metadata with the orientation and a GPS entry with the text to the JPEG
+func withEXIF(t *testing.T, data []byte, orientation uint16, gpsText string) []byte {
+	t.Helper()
+	var tiff bytes.Buffer
+	write := func(values ...any) {
+		for _, value := range values {
+			if err := binary.Write(&tiff, binary.LittleEndian, value); err != nil {
+				t.Fatalf("failed to write the EXIF metadata: %v", err)
+			}
+		}
+	}
+	// the header, the first IFD with the orientation and the GPS IFD, the GPS IFD with one text entry and its text
+	const firstIFD, gpsIFD = 8, 8 + 2 + 2*12 + 4
+	const gpsValue = gpsIFD + 2 + 12 + 4
+	write([]byte("II*\x00"), uint32(firstIFD))
+	write(uint16(2), uint16(0x0112), uint16(3), uint32(1), uint16(orientation), uint16(0), uint16(0x8825), uint16(4), uint32(1), uint32(gpsIFD), uint32(0))
+	write(uint16(1), uint16(0x001b), uint16(7), uint32(len(gpsText)), uint32(gpsValue), uint32(0))
+	write([]byte(gpsText))
+
+	app1 := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := append([]byte{0xff, 0xe1, byte((len(app1) + 2) >> 8), byte(len(app1) + 2)}, app1...)
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+// withDimensions is a copy of the png with other dimensions in its header, the pixels are left as they are
+func withDimensions(pngImage []byte, width uint32, height uint32) []byte {
+	resized := append([]byte{}, pngImage...)
+	binary.BigEndian.PutUint32(resized[16:], width)
+	binary.BigEndian.PutUint32(resized[20:], height)
+	binary.BigEndian.PutUint32(resized[29:], crc32.ChecksumIEEE(resized[12:29]))
+	return resized
+}
+
+// encodeImage returns a blank image of the size in the format
+func encodeImage(t *testing.T, format string, width int, height int) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	blank := image.NewRGBA(image.Rect(0, 0, width, height))
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buffer, blank)
+	case "jpeg":
+		err = jpeg.Encode(&buffer, blank, nil)
+	default:
+		t.Fatalf("unknown image format %s", format)
+	}
+	if err != nil {
+		t.Fatalf("failed to encode the image: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
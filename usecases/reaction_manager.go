@@ -0,0 +1,113 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+ReactionManager lets the users react to the blogs, with a like or one of the configured emojis.
+Reacting twice with the same type, or removing a reaction which does not exist, is not an error.
+*/
+type ReactionManager struct {
+	conf         *config.Config
+	blogRepo     domain.BlogRepo
+	reactionRepo domain.ReactionRepo
+}
+
+func NewReactionManager(conf *config.Config, blogRepo domain.BlogRepo, reactionRepo domain.ReactionRepo) *ReactionManager {
+	return &ReactionManager{
+		conf:         conf,
+		blogRepo:     blogRepo,
+		reactionRepo: reactionRepo,
+	}
+}
+
+// Add reacts to the blog and returns the reaction counts of the blog
+func (m *ReactionManager) Add(ctx context.Context, viewer *domain.Viewer, reaction *domain.Reaction) (counts map[string]int64, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "ReactionManager.Add", trace.WithAttributes(
+		attribute.Int64("blog.id", reaction.BlogID), attribute.String("reaction.type", reaction.Type)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if err := m.validate(ctx, viewer, reaction.BlogID, reaction.Type); err != nil {
+		return nil, err
+	}
+	if _, err := m.reactionRepo.Add(ctx, reaction); err != nil {
+		return nil, err
+	}
+	return m.counts(ctx, reaction.BlogID)
+}
+
+// Remove takes the reaction back and returns the reaction counts of the blog
+func (m *ReactionManager) Remove(ctx context.Context, viewer *domain.Viewer, reaction *domain.Reaction) (counts map[string]int64, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "ReactionManager.Remove", trace.WithAttributes(
+		attribute.Int64("blog.id", reaction.BlogID), attribute.String("reaction.type", reaction.Type)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if err := m.validate(ctx, viewer, reaction.BlogID, reaction.Type); err != nil {
+		return nil, err
+	}
+	if _, err := m.reactionRepo.Remove(ctx, reaction); err != nil {
+		return nil, err
+	}
+	return m.counts(ctx, reaction.BlogID)
+}
+
+// List returns who reacted to the blog, newest first. An empty reactionType lists every type.
+func (m *ReactionManager) List(ctx context.Context, viewer *domain.Viewer, blogID int64, reactionType string, offset int, limit int) (reactions []*domain.Reaction, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "ReactionManager.List", trace.WithAttributes(
+		attribute.Int64("blog.id", blogID), attribute.Int("offset", offset), attribute.Int("limit", limit)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if reactionType == "" {
+		if _, err := getReadableBlog(ctx, m.blogRepo, viewer, blogID); err != nil {
+			return nil, err
+		}
+	} else if err := m.validate(ctx, viewer, blogID, reactionType); err != nil {
+		return nil, err
+	}
+	return m.reactionRepo.List(ctx, blogID, reactionType, offset, limit)
+}
+
+// validate checks the reaction type and that the viewer can read the blog
+func (m *ReactionManager) validate(ctx context.Context, viewer *domain.Viewer, blogID int64, reactionType string) error {
+	if !m.isKnownType(reactionType) {
+		return domain.NewValidationError(domain.FieldError{Field: "type", Code: "invalid", Message: "unknown reaction type"})
+	}
+	_, err := getReadableBlog(ctx, m.blogRepo, viewer, blogID)
+	return err
+}
+
+func (m *ReactionManager) isKnownType(reactionType string) bool {
+	if reactionType == domain.LikeReaction {
+		return true
+	}
+	for _, emoji := range m.conf.Reactions.Emojis {
+		if reactionType == emoji {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *ReactionManager) counts(ctx context.Context, blogID int64) (map[string]int64, error) {
+	counts, err := m.reactionRepo.Counts(ctx, blogID)
+	if err != nil {
+		return nil, err
+	}
+	return reactionCounts(counts, blogID), nil
+}
+
+// reactionCounts never returns nil, a blog without reactions has an empty map
+func reactionCounts(counts map[int64]map[string]int64, blogID int64) map[string]int64 {
+	if blogCounts := counts[blogID]; blogCounts != nil {
+		return blogCounts
+	}
+	return map[string]int64{}
+}
@@ -0,0 +1,84 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/domain"
+)
+
+func TestReactionManager(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+	judy := createUser(t, repos, "judy")
+	ken := createUser(t, repos, "ken")
+	blogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: judy.ID, Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	otherBlogID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: judy.ID, Title: "Other", Content: "Content"})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+	privateID, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: judy.ID, Title: "Secret", Content: "Content", Visibility: domain.VisibilityPrivate})
+	if err != nil {
+		t.Fatalf("failed to create blog: %v", err)
+	}
+
+	// reacting twice, or taking back a reaction which is not there, is not an error
+	reactionManager := NewReactionManager(conf, repos.Blogs, repos.Reactions)
+	for _, tc := range []struct {
+		name     string
+		add      bool
+		user     *domain.User
+		kind     string
+		expected map[string]int64
+	}{
+		{"like", true, judy, domain.LikeReaction, map[string]int64{domain.LikeReaction: 1}},
+		{"another like", true, ken, domain.LikeReaction, map[string]int64{domain.LikeReaction: 2}},
+		{"like again", true, ken, domain.LikeReaction, map[string]int64{domain.LikeReaction: 2}},
+		{"emoji", true, ken, conf.Reactions.Emojis[0], map[string]int64{domain.LikeReaction: 2, conf.Reactions.Emojis[0]: 1}},
+		{"emoji removed", false, ken, conf.Reactions.Emojis[0], map[string]int64{domain.LikeReaction: 2}},
+		{"emoji removed again", false, ken, conf.Reactions.Emojis[0], map[string]int64{domain.LikeReaction: 2}},
+	} {
+		change := reactionManager.Add
+		if !tc.add {
+			change = reactionManager.Remove
+		}
+		counts, err := change(ctx, member(tc.user), &domain.Reaction{BlogID: blogID, UserID: tc.user.ID, Type: tc.kind})
+		if err != nil || fmt.Sprint(counts) != fmt.Sprint(tc.expected) {
+			t.Errorf("%s: expected %v, got %v, %v", tc.name, tc.expected, counts, err)
+		}
+	}
+
+	var validationErr *domain.ValidationError
+	if _, err := reactionManager.Add(ctx, member(ken), &domain.Reaction{BlogID: blogID, UserID: ken.ID, Type: "🦄"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for an unknown reaction type, got %v", err)
+	}
+	if _, err := reactionManager.List(ctx, member(ken), blogID, "🦄", 0, 10); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for listing an unknown reaction type, got %v", err)
+	}
+	var notFoundErr *domain.NotFoundError
+	if _, err := reactionManager.Add(ctx, member(ken), &domain.Reaction{BlogID: blogID + 1000, UserID: ken.ID, Type: domain.LikeReaction}); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown blog, got %v", err)
+	}
+	if _, err := reactionManager.Add(ctx, member(ken), &domain.Reaction{BlogID: privateID, UserID: ken.ID, Type: domain.LikeReaction}); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for the private blog of somebody else, got %v", err)
+	}
+	if reactions, err := reactionManager.List(ctx, member(ken), blogID, "", 0, 10); err != nil || len(reactions) != 2 || reactions[0].UserID != ken.ID {
+		t.Errorf("expected the likes of ken and judy, newest first, got %v, %v", reactions, err)
+	}
+
+	// the blogs come with their counts and their creators
+	blogManager := newBlogManager(repos)
+	if blog, err := blogManager.Get(ctx, member(ken), otherBlogID); err != nil || blog.Reactions == nil || len(blog.Reactions) != 0 {
+		t.Errorf("expected an empty reaction count, got %+v, %v", blog, err)
+	}
+	if blogs, err := blogManager.Search(ctx, member(ken), 0, 10, ""); err != nil || len(blogs) != 2 || blogs[1].Reactions[domain.LikeReaction] != 2 {
+		t.Errorf("expected the search results to come with their counts, got %v, %v", blogs, err)
+	} else if blogs[0].Creator == nil || blogs[0].Creator.ID != judy.ID || blogs[1].Creator == nil || blogs[1].Creator.FirstName != "First judy" {
+		t.Errorf("expected the search results to come with their creator, got %+v, %+v", blogs[0].Creator, blogs[1].Creator)
+	}
+}
@@ -0,0 +1,126 @@
+package usecases
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var publicAccess = domain.BlogAccess{Visibilities: []domain.Visibility{domain.VisibilityPublic}}
+
+/*
+SyndicationManager builds the public feeds of the newest public blogs, for the whole site, for an author or for a tag.
+The feed is rendered by the API layer as RSS, Atom or JSON Feed.
+*/
+type SyndicationManager struct {
+	conf     *config.Config
+	userRepo domain.UserRepo
+	blogRepo domain.BlogRepo
+	renderer domain.ContentRenderer
+}
+
+// SyndicationFeed Updated is the newest updated_at of the items, it is zero when the feed is empty
+type SyndicationFeed struct {
+	Title   string
+	Updated time.Time
+	Items   []*SyndicationItem
+}
+
+// SyndicationItem AuthorName is the full name of the author, or the username when the author has not given a name.
+// The content of the blog is rendered to Blog.ContentHTML.
+type SyndicationItem struct {
+	Blog       *domain.Blog
+	AuthorName string
+}
+
+func NewSyndicationManager(conf *config.Config, userRepo domain.UserRepo, blogRepo domain.BlogRepo, renderer domain.ContentRenderer) *SyndicationManager {
+	return &SyndicationManager{
+		conf:     conf,
+		userRepo: userRepo,
+		blogRepo: blogRepo,
+		renderer: renderer,
+	}
+}
+
+// SiteFeed has the newest blogs of every author
+func (m *SyndicationManager) SiteFeed(ctx context.Context) (feed *SyndicationFeed, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "SyndicationManager.SiteFeed")
+	defer func() { utils.EndSpan(span, err) }()
+
+	return m.feed(ctx, m.conf.Syndication.Title, domain.BlogFilter{})
+}
+
+// AuthorFeed has the newest blogs of the author, an unknown author is a not found error
+func (m *SyndicationManager) AuthorFeed(ctx context.Context, userID int64) (feed *SyndicationFeed, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "SyndicationManager.AuthorFeed", trace.WithAttributes(attribute.Int64("user.id", userID)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	author, err := m.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return m.feed(ctx, m.conf.Syndication.Title+" - "+authorName(author), domain.BlogFilter{UserID: userID})
+}
+
+// TagFeed has the newest blogs with the tag
+func (m *SyndicationManager) TagFeed(ctx context.Context, tag string) (feed *SyndicationFeed, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "SyndicationManager.TagFeed", trace.WithAttributes(attribute.String("tag", tag)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return nil, domain.NewValidationError(domain.FieldError{Field: "tag", Code: "required", Message: "must not be empty"})
+	}
+	return m.feed(ctx, m.conf.Syndication.Title+" - "+tag, domain.BlogFilter{Tag: tag})
+}
+
+func (m *SyndicationManager) feed(ctx context.Context, title string, filter domain.BlogFilter) (*SyndicationFeed, error) {
+	// the feeds are public, so are their blogs
+	blogs, err := m.blogRepo.Latest(ctx, publicAccess, filter, m.conf.Syndication.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &SyndicationFeed{Title: title}
+	// the feeds mostly repeat a few authors, they are looked up at once
+	userIDs := make([]int64, 0, len(blogs))
+	for _, blog := range blogs {
+		userIDs = append(userIDs, blog.UserID)
+	}
+	authors, err := m.userRepo.GetUsersByIDs(ctx, userIDs...)
+	if err != nil {
+		return nil, err
+	}
+	for _, blog := range blogs {
+		author, ok := authors[blog.UserID]
+		if !ok {
+			return nil, domain.NewNotFoundError("user", blog.UserID)
+		}
+		name := authorName(author)
+		blog.ContentHTML, err = m.renderer.Render(ctx, blog.ContentFormat, blog.Content)
+		if err != nil {
+			return nil, err
+		}
+		if blog.UpdatedAt.After(feed.Updated) {
+			feed.Updated = blog.UpdatedAt
+		}
+		feed.Items = append(feed.Items, &SyndicationItem{Blog: blog, AuthorName: name})
+	}
+	return feed, nil
+}
+
+// authorName falls back to the username when the user has not given a name
+func authorName(user *domain.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		return user.Username
+	}
+	return name
+}
@@ -0,0 +1,93 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/gateways/render"
+)
+
+func TestSyndicationManager(t *testing.T) {
+	ctx := context.Background()
+	conf, repos := setUp(t)
+	author := createUser(t, repos, "sam")
+	// the feeds fall back to the username of an author without a name, whom only the repositories let in
+	other, err := repos.Users.Create(ctx, &domain.User{Username: "tina", Password: "secret-tina"})
+	if err != nil {
+		t.Fatalf("failed to create user tina: %v", err)
+	}
+
+	// created oldest to newest
+	var ids []int64
+	for i, blog := range []*domain.Blog{
+		{UserID: author.ID, Tags: "Go, Databases"},
+		{UserID: other.ID, Tags: "golang,web"},
+		{UserID: author.ID, Tags: " web ,go "},
+		{UserID: other.ID, Tags: "GO"},
+	} {
+		blog.Title, blog.Content, blog.Visibility = fmt.Sprintf("Blog %d", i), "Content", domain.VisibilityPublic
+		blogID, err := repos.Blogs.Create(ctx, blog)
+		if err != nil {
+			t.Fatalf("failed to create blog: %v", err)
+		}
+		ids = append(ids, blogID)
+	}
+	// the feeds are public, the other blogs are left out
+	for _, visibility := range []domain.Visibility{domain.VisibilityUnlisted, domain.VisibilityMembersOnly, domain.VisibilityPrivate} {
+		if _, err := repos.Blogs.Create(ctx, &domain.Blog{UserID: author.ID, Title: "Hidden", Content: "Content", Tags: "go", Visibility: visibility}); err != nil {
+			t.Fatalf("failed to create blog: %v", err)
+		}
+	}
+
+	syndicationManager := NewSyndicationManager(conf, repos.Users, repos.Blogs, render.NewRenderer())
+	for _, tc := range []struct {
+		name     string
+		feed     func() (*SyndicationFeed, error)
+		title    string
+		expected []int64
+		authors  []string
+	}{
+		{"site", func() (*SyndicationFeed, error) { return syndicationManager.SiteFeed(ctx) }, conf.Syndication.Title,
+			[]int64{ids[3], ids[2], ids[1], ids[0]}, []string{"tina", "First sam Last sam", "tina", "First sam Last sam"}},
+		{"author", func() (*SyndicationFeed, error) { return syndicationManager.AuthorFeed(ctx, author.ID) }, conf.Syndication.Title + " - First sam Last sam",
+			[]int64{ids[2], ids[0]}, []string{"First sam Last sam", "First sam Last sam"}},
+		{"tag", func() (*SyndicationFeed, error) { return syndicationManager.TagFeed(ctx, " go ") }, conf.Syndication.Title + " - go",
+			[]int64{ids[3], ids[2], ids[0]}, []string{"tina", "First sam Last sam", "First sam Last sam"}},
+	} {
+		feed, err := tc.feed()
+		if err != nil {
+			t.Fatalf("%s: failed to get the feed: %v", tc.name, err)
+		}
+		var found []*domain.Blog
+		var authors []string
+		for _, item := range feed.Items {
+			found = append(found, item.Blog)
+			authors = append(authors, item.AuthorName)
+			if item.Blog.ContentHTML != "<p>Content</p>\n" {
+				t.Errorf("%s: expected the content of the items rendered to HTML, got %q", tc.name, item.Blog.ContentHTML)
+			}
+		}
+		if feed.Title != tc.title || blogIDs(found) != fmt.Sprint(tc.expected) || fmt.Sprint(authors) != fmt.Sprint(tc.authors) {
+			t.Errorf("%s: expected %q with %v by %v, got %q with %s by %v", tc.name, tc.title, tc.expected, tc.authors, feed.Title, blogIDs(found), authors)
+		}
+		// the feed is updated when its newest blog was
+		if !feed.Updated.Equal(feed.Items[0].Blog.UpdatedAt) {
+			t.Errorf("%s: expected the feed to be updated at %v, got %v", tc.name, feed.Items[0].Blog.UpdatedAt, feed.Updated)
+		}
+	}
+
+	var notFoundErr *domain.NotFoundError
+	if _, err := syndicationManager.AuthorFeed(ctx, other.ID+1000); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected a not found error for an unknown author, got %v", err)
+	}
+	if feed, err := syndicationManager.TagFeed(ctx, "rust"); err != nil || len(feed.Items) != 0 || !feed.Updated.IsZero() {
+		t.Errorf("expected an empty feed for an unknown tag, got %+v, %v", feed, err)
+	}
+	var validationErr *domain.ValidationError
+	if _, err := syndicationManager.TagFeed(ctx, " "); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error for an empty tag, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/config"
+	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/gateways/memory"
+	"github.com/bipuldutta/blogzilla/gateways/render"
+	"github.com/bipuldutta/blogzilla/utils"
+)
+
+// testRepos is a set of in-memory repositories sharing the same store, the behaviour of the other backends is
+// checked against them by the contract suite
+type testRepos struct {
+	Tx          domain.TxManager
+	Database    domain.DatabaseRepo
+	Users       domain.UserRepo
+	Blogs       domain.BlogRepo
+	Comments    domain.CommentRepo
+	Reactions   domain.ReactionRepo
+	Follows     domain.FollowRepo
+	Media       domain.MediaRepo
+	Idempotency domain.IdempotencyRepo
+	Auth        domain.AuthRepo
+}
+
+func newTestRepos(conf *config.Config) testRepos {
+	store := memory.NewStore()
+	authRepo := memory.NewAuthRepo(conf)
+	return testRepos{
+		Tx:          memory.NewTxManager(store),
+		Database:    memory.NewDatabaseRepo(conf, store),
+		Users:       memory.NewUserRepo(store, authRepo),
+		Blogs:       memory.NewBlogRepo(store),
+		Comments:    memory.NewCommentRepo(store),
+		Reactions:   memory.NewReactionRepo(store),
+		Follows:     memory.NewFollowRepo(store),
+		Media:       memory.NewMediaRepo(store),
+		Idempotency: memory.NewIdempotencyRepo(store),
+		Auth:        authRepo,
+	}
+}
+
+// setUp creates the repositories and initializes them the way the server does on start up
+func setUp(t *testing.T) (*config.Config, testRepos) {
+	t.Helper()
+	conf := config.NewConfig()
+	// the tests log in as the default user, the shipped config has none
+	conf.DefaultUser.Password = "admin"
+	repos := newTestRepos(conf)
+	if err := NewDatabaseManager(conf, repos.Tx, repos.Database, repos.Users).Initialize(context.Background()); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	return conf, repos
+}
+
+func newBlogManager(repos testRepos) *BlogManager {
+	return NewBlogManager(repos.Tx, repos.Blogs, repos.Users, repos.Reactions, render.NewRenderer())
+}
+
+// member is the viewer of a logged in user who can read the blogs
+func member(user *domain.User) *domain.Viewer {
+	return &domain.Viewer{UserID: user.ID, Permissions: map[string]any{utils.ReadBlogPermission: true}}
+}
+
+// createUser registers a user the way the API does, i.e. along with the default roles
+func createUser(t *testing.T, repos testRepos, username string) *domain.User {
+	t.Helper()
+	user, err := NewUserManager(repos.Tx, repos.Users).Create(context.Background(), &domain.User{
+		Username:  username,
+		Password:  "secret-" + username,
+		FirstName: "First " + username,
+		LastName:  "Last " + username,
+	})
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", username, err)
+	}
+	return user
+}
+
+// assertPermissions logs in and checks the permissions carried by the token
+func assertPermissions(t *testing.T, conf *config.Config, repos testRepos, username string, password string, granted []string, denied []string) {
+	t.Helper()
+	token, err := repos.Users.Login(context.Background(), username, password)
+	if err != nil {
+		t.Fatalf("failed to login as %s: %v", username, err)
+	}
+
+	authManager := NewAuthManager(conf, repos.Users)
+	for _, permission := range granted {
+		if _, err := authManager.ValidateToken(context.Background(), token, permission); err != nil {
+			t.Errorf("expected %s to have permission %s: %v", username, permission, err)
+		}
+	}
+	for _, permission := range denied {
+		if _, err := authManager.ValidateToken(context.Background(), token, permission); err == nil {
+			t.Errorf("expected %s not to have permission %s", username, permission)
+		}
+	}
+}
+
+// blogIDs is the IDs of the blogs in their order, printed to be compared
+func blogIDs(blogs []*domain.Blog) string {
+	var ids []int64
+	for _, blog := range blogs {
+		ids = append(ids, blog.ID)
+	}
+	return fmt.Sprint(ids)
+}
+
+func commentIDs(comments []*domain.Comment) []int64 {
+	var ids []int64
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	return ids
+}
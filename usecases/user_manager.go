@@ -2,9 +2,9 @@ package usecases
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/bipuldutta/blogzilla/domain"
+	"github.com/bipuldutta/blogzilla/utils"
 )
 
 /*
@@ -13,22 +13,107 @@ while this is a skeleton and just making calls to the repo layer at this time th
 actual BL we could implement at some point
 */
 type UserManager struct {
-	userRepo domain.UserRepo
+	txManager domain.TxManager
+	userRepo  domain.UserRepo
 }
 
-func NewUserManager(userRepo domain.UserRepo) *UserManager {
-	return &UserManager{userRepo: userRepo}
+func NewUserManager(txManager domain.TxManager, userRepo domain.UserRepo) *UserManager {
+	return &UserManager{
+		txManager: txManager,
+		userRepo:  userRepo,
+	}
 }
 
-func (m *UserManager) Create(ctx context.Context, newUser *domain.User) (*domain.User, error) {
+func (m *UserManager) Create(ctx context.Context, newUser *domain.User) (user *domain.User, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "UserManager.Create")
+	defer func() { utils.EndSpan(span, err) }()
+
 	// validate user input
-	if newUser.Username == "" || newUser.Password == "" || newUser.FirstName == "" || newUser.LastName == "" {
-		return nil, fmt.Errorf("incomplete user information")
+	if err := validateNewUser(newUser); err != nil {
+		return nil, err
+	}
+	hashedUser, err := withHashedPassword(ctx, newUser)
+	if err != nil {
+		return nil, err
+	}
+
+	// a new user is an editor and a viewer, the user is only created along with its roles
+	err = m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		user, err = m.userRepo.Create(ctx, hashedUser)
+		if err != nil {
+			return err
+		}
+		return assignRoles(ctx, m.userRepo, user.ID, utils.EditorRole, utils.ViewerRole)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return user, nil
+}
+
+// AssignRoles gives the roles to the user, either all of them or none
+func (m *UserManager) AssignRoles(ctx context.Context, userID int64, roleNames ...string) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "UserManager.AssignRoles")
+	defer func() { utils.EndSpan(span, err) }()
 
-	return m.userRepo.Create(ctx, newUser)
+	return m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		return assignRoles(ctx, m.userRepo, userID, roleNames...)
+	})
 }
 
-func (m *UserManager) Login(ctx context.Context, username string, password string) (string, error) {
+func (m *UserManager) Login(ctx context.Context, username string, password string) (token string, err error) {
+	ctx, span := utils.Tracer().Start(ctx, "UserManager.Login")
+	defer func() { utils.EndSpan(span, err) }()
+
 	return m.userRepo.Login(ctx, username, password)
 }
+
+// withHashedPassword is a copy of the user with the password hashed. bcrypt is slow on purpose, so the password is
+// hashed before the transaction rather than within it, where it would hold the database locks and connection.
+func withHashedPassword(ctx context.Context, user *domain.User) (*domain.User, error) {
+	hashedPassword, err := utils.HashPassword(ctx, user.Password)
+	if err != nil {
+		return nil, err
+	}
+	hashedUser := *user
+	hashedUser.Password = hashedPassword
+	return &hashedUser, nil
+}
+
+// validateNewUser every field of a new user is required
+func validateNewUser(newUser *domain.User) error {
+	validationErr := domain.NewValidationError()
+	for _, field := range []struct{ name, value string }{
+		{"username", newUser.Username},
+		{"password", newUser.Password},
+		{"firstName", newUser.FirstName},
+		{"lastName", newUser.LastName},
+	} {
+		if field.value == "" {
+			validationErr.Add(field.name, "required", "must not be empty")
+		}
+	}
+	return validationErr.OrNil()
+}
+
+// assignRoles looks up the roles by name and assigns them, it is meant to be called within a transaction
+func assignRoles(ctx context.Context, userRepo domain.UserRepo, userID int64, roleNames ...string) error {
+	ids, err := roleIDs(ctx, userRepo, roleNames...)
+	if err != nil {
+		return err
+	}
+	return userRepo.AssignRoles(ctx, userID, ids...)
+}
+
+// roleIDs looks up the IDs of the roles by their names
+func roleIDs(ctx context.Context, userRepo domain.UserRepo, roleNames ...string) ([]int64, error) {
+	roleIDs := make([]int64, 0, len(roleNames))
+	for _, roleName := range roleNames {
+		role, err := userRepo.GetRoleByName(ctx, roleName)
+		if err != nil {
+			return nil, err
+		}
+		roleIDs = append(roleIDs, role.ID)
+	}
+	return roleIDs, nil
+}
@@ -23,12 +23,48 @@ const (
 	ReadBlogPermission   = "read_blog"
 	UpdateBlogPermission = "update_blog"
 	DeleteBlogPermission = "delete_blog"
+	// reads the private blogs of the other users as well
+	ReadAnyBlogPermission = "read_any_blog"
+
+	CreateCommentPermission   = "create_comment"
+	ModerateCommentPermission = "moderate_comment"
+
+	CreateReactionPermission = "create_reaction"
+
+	FollowUserPermission = "follow_user"
+
+	ManageSystemPermission = "manage_system"
 )
 
-func CreateContext() context.Context {
-	ctx := context.Background()
+// RoleDefinition describes one of the built-in roles
+type RoleDefinition struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// BuiltInRoles are created (or brought up to date) by every storage implementation on start up
+var BuiltInRoles = []RoleDefinition{
+	{Name: AdminRole, Description: "Administrator", Permissions: []string{
+		CreateUserPermission, ReadUserPermission, UpdateUserPermission, DeleteUserPermission,
+		CreateBlogPermission, ReadBlogPermission, UpdateBlogPermission, DeleteBlogPermission, ReadAnyBlogPermission,
+		CreateCommentPermission, ModerateCommentPermission, CreateReactionPermission, FollowUserPermission,
+		ManageSystemPermission,
+	}},
+	{Name: EditorRole, Description: "Editor", Permissions: []string{
+		CreateBlogPermission, ReadBlogPermission, UpdateBlogPermission, DeleteBlogPermission,
+		CreateCommentPermission, CreateReactionPermission, FollowUserPermission,
+	}},
+	{Name: ViewerRole, Description: "Viewer", Permissions: []string{
+		ReadUserPermission, ReadBlogPermission, CreateCommentPermission, CreateReactionPermission, FollowUserPermission,
+	}},
+}
+
+// CreateContext derives the context used by the business logic from the parent (usually the request context),
+// so that cancellation and the current tracing span are carried along
+func CreateContext(parent context.Context) context.Context {
 	// add a trace id so that we can put it in the log and see the entire flow
-	ctx = context.WithValue(ctx, traceID, getNewGUID())
+	ctx := context.WithValue(parent, traceID, getNewGUID())
 	return ctx
 }
 
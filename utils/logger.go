@@ -1,28 +1,149 @@
 package utils
 
 import (
+	"fmt"
 	"os"
+	"reflect"
+	"strings"
+
+	"github.com/bipuldutta/blogzilla/config"
 
 	runtime "github.com/banzaicloud/logrus-runtime-formatter"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	TextLogFormat = "text"
+	JSONLogFormat = "json"
+
+	redacted = "[REDACTED]"
+)
+
+// any log field whose name contains one of these (case insensitive) will have its value redacted
+var sensitiveFields = []string{"password", "token", "authorization", "secret", "cookie"}
+
 // Create a new instance of the logger. You can have any number of instances.
+// Always share the pointer, a copy of the logger would not see the level changes made at runtime.
 var log *logrus.Logger
 
 func init() {
 	log = logrus.New()
 
-	formatter := runtime.Formatter{ChildFormatter: &logrus.TextFormatter{
-		FullTimestamp: true,
-	}}
-	formatter.File = true
-	formatter.Line = true
-	log.SetFormatter(&formatter)
+	log.SetFormatter(newFormatter(TextLogFormat))
 	log.SetOutput(os.Stdout)
 	log.SetLevel(logrus.InfoLevel)
+	log.AddHook(&redactionHook{})
 }
 
 func Logger() *logrus.Logger {
 	return log
 }
+
+// ConfigureLogger applies the logging config, i.e. the output format and the initial level
+func ConfigureLogger(conf config.LoggingConfig) error {
+	format := conf.Format
+	if format == "" {
+		format = TextLogFormat
+	}
+	if format != TextLogFormat && format != JSONLogFormat {
+		return fmt.Errorf("unknown log format '%s'", conf.Format)
+	}
+	log.SetFormatter(newFormatter(format))
+
+	if conf.Level != "" {
+		return SetLogLevel(conf.Level)
+	}
+	return nil
+}
+
+// SetLogLevel changes the level of the logger, it can be called at any time
+func SetLogLevel(level string) error {
+	parsedLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(parsedLevel)
+	return nil
+}
+
+// LogLevel returns the current level of the logger
+func LogLevel() string {
+	return log.GetLevel().String()
+}
+
+func newFormatter(format string) logrus.Formatter {
+	var child logrus.Formatter = &logrus.TextFormatter{
+		FullTimestamp: true,
+	}
+	if format == JSONLogFormat {
+		child = &logrus.JSONFormatter{}
+	}
+	formatter := runtime.Formatter{ChildFormatter: child}
+	formatter.File = true
+	formatter.Line = true
+	return &formatter
+}
+
+// redactionHook masks the values of the sensitive fields before an entry is written
+type redactionHook struct{}
+
+func (h *redactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *redactionHook) Fire(entry *logrus.Entry) error {
+	for key, value := range entry.Data {
+		if isSensitiveField(key) {
+			entry.Data[key] = redacted
+		} else {
+			entry.Data[key] = redact(value)
+		}
+	}
+	return nil
+}
+
+// redact masks the sensitive keys of a map value, e.g. of the headers of a request, and of the maps in it. The map
+// is copied, the one of the caller is left as it is.
+func redact(value any) any {
+	original := reflect.ValueOf(value)
+	if original.Kind() != reflect.Map || original.Type().Key().Kind() != reflect.String || original.IsNil() {
+		return value
+	}
+	elemType := original.Type().Elem()
+	copied := reflect.MakeMapWithSize(original.Type(), original.Len())
+	for iter := original.MapRange(); iter.Next(); {
+		elem := iter.Value()
+		if isSensitiveField(iter.Key().String()) {
+			elem = redactedValue(elemType)
+		} else if nested := redact(elem.Interface()); nested != nil {
+			elem = reflect.ValueOf(nested)
+		}
+		copied.SetMapIndex(iter.Key(), elem)
+	}
+	return copied.Interface()
+}
+
+// redactedValue is the mask in the type of the values of a map, the zero value when the type can not hold it
+func redactedValue(elemType reflect.Type) reflect.Value {
+	switch {
+	case elemType.Kind() == reflect.String:
+		return reflect.ValueOf(redacted).Convert(elemType)
+	case elemType.Kind() == reflect.Interface:
+		return reflect.ValueOf(redacted)
+	case elemType.Kind() == reflect.Slice && elemType.Elem().Kind() == reflect.String:
+		masked := reflect.MakeSlice(elemType, 1, 1)
+		masked.Index(0).Set(reflect.ValueOf(redacted).Convert(elemType.Elem()))
+		return masked
+	}
+	return reflect.Zero(elemType)
+}
+
+func isSensitiveField(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range sensitiveFields {
+		if strings.Contains(key, field) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactionHook(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		data     logrus.Fields
+		expected logrus.Fields
+	}{
+		{"a password", logrus.Fields{"password": "secret", "user": "alice"}, logrus.Fields{"password": redacted, "user": "alice"}},
+		{"a token", logrus.Fields{"token": "abc", "status": 200}, logrus.Fields{"token": redacted, "status": 200}},
+		{"the mixed case", logrus.Fields{"Authorization": "Bearer abc", "X-CSRF-Token": "abc", "Set-Cookie": "a=b"},
+			logrus.Fields{"Authorization": redacted, "X-CSRF-Token": redacted, "Set-Cookie": redacted}},
+		{"a key containing one", logrus.Fields{"newPassword": "secret", "client_secret": 42}, logrus.Fields{"newPassword": redacted, "client_secret": redacted}},
+		{"a nested map", logrus.Fields{"request": map[string]any{"username": "alice", "Password": "secret", "login": map[string]any{"token": "abc"}}},
+			logrus.Fields{"request": map[string]any{"username": "alice", "Password": redacted, "login": map[string]any{"token": redacted}}}},
+		{"the headers", logrus.Fields{"headers": http.Header{"Authorization": {"Bearer abc"}, "Cookie": {"a=b"}, "Accept": {"*/*"}}},
+			logrus.Fields{"headers": http.Header{"Authorization": {redacted}, "Cookie": {redacted}, "Accept": {"*/*"}}}},
+		{"a map of strings", logrus.Fields{"query": map[string]string{"access_token": "abc", "page": "2"}},
+			logrus.Fields{"query": map[string]string{"access_token": redacted, "page": "2"}}},
+		{"nothing sensitive", logrus.Fields{"user": "alice", "nil": nil, "ids": []int{1, 2}}, logrus.Fields{"user": "alice", "nil": nil, "ids": []int{1, 2}}},
+	} {
+		entry := logrus.NewEntry(logrus.New()).WithFields(test.data)
+		if err := (&redactionHook{}).Fire(entry); err != nil {
+			t.Fatalf("%s: failed to redact: %v", test.name, err)
+		}
+		if fmt.Sprint(entry.Data) != fmt.Sprint(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, entry.Data)
+		}
+	}
+
+	// the maps of the caller keep their values
+	headers := http.Header{"Authorization": {"Bearer abc"}}
+	entry := logrus.NewEntry(logrus.New()).WithField("headers", headers)
+	if err := (&redactionHook{}).Fire(entry); err != nil || headers.Get("Authorization") != "Bearer abc" {
+		t.Errorf("expected the headers of the caller to be left as they are, got %v %v", headers, err)
+	}
+}
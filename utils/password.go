@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt is slow on purpose and dominates the registration and login latency, so it gets its own spans
+
+// HashPassword hashes the password the way the users' passwords are stored
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := Tracer().Start(ctx, "bcrypt.GenerateFromPassword")
+	defer span.End()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password")
+	}
+	return string(hashedPassword), nil
+}
+
+// ComparePassword is an error unless the password is the one of the hash
+func ComparePassword(ctx context.Context, hashedPassword string, password string) error {
+	_, span := Tracer().Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
+
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/gosimple/unidecode"
+)
+
+// MaxSlugLength leaves room for a collision suffix within the 100 characters a link is comfortable with
+const MaxSlugLength = 80
+
+/*
+Slugify turns a title into lowercase ASCII words joined by hyphens, e.g. "Crème Brûlée à Paris!" becomes
+"creme-brulee-a-paris". The letters of the other scripts are transliterated, apostrophes are dropped so that
+"Don't" stays one word, and a long slug is cut at a word boundary. It returns "" when nothing is left.
+*/
+func Slugify(title string) string {
+	var slug strings.Builder
+	separate := false
+	for _, c := range strings.ToLower(unidecode.Unidecode(title)) {
+		switch {
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+			if separate && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			separate = false
+			slug.WriteRune(c)
+		case c == '\'':
+		default:
+			separate = true
+		}
+	}
+
+	result := slug.String()
+	if len(result) > MaxSlugLength {
+		result = result[:MaxSlugLength]
+		if cut := strings.LastIndexByte(result, '-'); cut > 0 {
+			result = result[:cut]
+		}
+	}
+	return result
+}
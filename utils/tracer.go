@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bipuldutta/blogzilla/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/bipuldutta/blogzilla"
+
+	OTLPExporter = "otlp"
+	NoopExporter = "noop"
+)
+
+// the global tracer delegates to whatever provider has been installed with otel.SetTracerProvider,
+// so it is safe to grab it before InitTracer is called
+var tracer = otel.Tracer(instrumentationName)
+
+func Tracer() trace.Tracer {
+	return tracer
+}
+
+// InitTracer installs the global tracer provider and propagator based on the tracing config.
+// The returned function flushes and stops the exporter and should be called before exiting.
+func InitTracer(ctx context.Context, conf config.TracingConfig) (func(context.Context) error, error) {
+	if !conf.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newSpanExporter(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	provider := NewTracerProvider(conf, exporter, false)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider creates a tracer provider which samples according to the config and sends
+// the spans to the given exporter. With sync every span is exported as soon as it ends rather than
+// in batches, which is what tests asserting on the spans of an in-memory exporter want.
+func NewTracerProvider(conf config.TracingConfig, exporter sdktrace.SpanExporter, sync bool) *sdktrace.TracerProvider {
+	serviceName := conf.ServiceName
+	if serviceName == "" {
+		serviceName = "blogzilla"
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))
+
+	processor := sdktrace.NewBatchSpanProcessor(exporter)
+	if sync {
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRatio))),
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(processor),
+	)
+}
+
+// NewInMemoryExporter returns an exporter which keeps every span in memory for the tests, which install it with
+// NewTracerProvider and read the spans back. It is not one of the exporters of the config, nothing could read them.
+func NewInMemoryExporter() *tracetest.InMemoryExporter {
+	return tracetest.NewInMemoryExporter()
+}
+
+// EndSpan marks the span as failed when err is set and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func newSpanExporter(ctx context.Context, conf config.TracingConfig) (sdktrace.SpanExporter, error) {
+	switch conf.Exporter {
+	case OTLPExporter, "":
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(conf.Endpoint)}
+		if conf.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, options...)
+	case NoopExporter:
+		return noopExporter{}, nil
+	}
+	return nil, fmt.Errorf("unknown tracing exporter '%s'", conf.Exporter)
+}
+
+// noopExporter drops every span, useful when we want the spans (and trace ids) to be
+// created but do not have any collector to send them to
+type noopExporter struct{}
+
+func (noopExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	return nil
+}
+
+func (noopExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bipuldutta/blogzilla/config"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestInitTracer(t *testing.T) {
+	provider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(provider)
+
+	for _, test := range []struct {
+		exporter string
+		valid    bool
+	}{
+		{NoopExporter, true},
+		// the spans of an in-memory exporter could not be read back, the tests use NewInMemoryExporter
+		{"memory", false},
+		{"zipkin", false},
+	} {
+		shutdown, err := InitTracer(context.Background(), config.TracingConfig{Enabled: true, Exporter: test.exporter, SampleRatio: 1})
+		if test.valid != (err == nil) {
+			t.Errorf("%s: expected it to be valid %v, got %v", test.exporter, test.valid, err)
+		}
+		if err == nil {
+			shutdown(context.Background())
+		}
+	}
+}